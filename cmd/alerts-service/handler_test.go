@@ -1,22 +1,32 @@
 package main
 
 import (
+	"bytes"
 	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"runtime/debug"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
 	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/storage"
+	"golang.org/x/sync/singleflight"
 	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/type/latlng"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // TestHealthHandler tests the health check endpoint
@@ -166,6 +176,36 @@ func TestCorsMiddlewarePreflightRequest(t *testing.T) {
 	}
 }
 
+// TestPreconnectMiddleware tests that configured origins are sent as Link preconnect hints
+func TestPreconnectMiddleware(t *testing.T) {
+	innerHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handler := preconnectMiddleware([]string{"https://tiles.example.com", "https://fonts.example.com"}, innerHandler)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/police_alerts", nil))
+
+	want := "<https://tiles.example.com>; rel=preconnect, <https://fonts.example.com>; rel=preconnect"
+	if got := rr.Header().Get("Link"); got != want {
+		t.Errorf("expected Link %q, got %q", want, got)
+	}
+}
+
+// TestPreconnectMiddlewareDisabled tests that no Link header is added without configured origins
+func TestPreconnectMiddlewareDisabled(t *testing.T) {
+	innerHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	rr := httptest.NewRecorder()
+	preconnectMiddleware(nil, innerHandler).ServeHTTP(rr, httptest.NewRequest("GET", "/police_alerts", nil))
+
+	if got := rr.Header().Get("Link"); got != "" {
+		t.Errorf("expected no Link header, got %q", got)
+	}
+}
+
 // TestGzipMiddleware tests GZIP compression
 func TestGzipMiddleware(t *testing.T) {
 	tests := []struct {
@@ -821,6 +861,68 @@ func TestAlertsHandlerMultipleDates(t *testing.T) {
 	}
 }
 
+// TestAlertsHandlerMixedSchemas tests that a legacy archive is streamed with
+// its Go field names alongside snake_case alerts from Firestore, and that
+// both decode as alerts
+func TestAlertsHandlerMixedSchemas(t *testing.T) {
+	mockStore := &storage.MockAlertStore{
+		GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, startDate, endDate time.Time) ([]models.PoliceAlert, error) {
+			return []models.PoliceAlert{{UUID: "new-1", Subtype: "POLICE_HIDING", PublishTime: startDate}}, nil
+		},
+	}
+	mockGCS := &storage.MockGCSClient{
+		BucketFunc: func(name string) storage.GCSBucketHandle {
+			return &storage.MockGCSBucketHandle{
+				ObjectFunc: func(objName string) storage.GCSObjectHandle {
+					return &storage.MockGCSObjectHandle{
+						NewReaderFunc: func(ctx context.Context) (io.ReadCloser, error) {
+							if objName != "2024-01-01.jsonl" {
+								return nil, storage.ErrObjectNotExist
+							}
+							return io.NopCloser(strings.NewReader(`{"UUID":"legacy-1","Subtype":"POLICE_VISIBLE"}` + "\n")), nil
+						},
+					}
+				},
+			}
+		},
+	}
+
+	s := &server{
+		firestoreClient: mockStore,
+		storageClient:   mockGCS,
+		bucketName:      "test-bucket",
+		limiters:        make(map[string]*rate.Limiter),
+		ratePerMinute:   30,
+	}
+
+	req := httptest.NewRequest("GET", "/police_alerts?dates=2024-01-01,2024-01-02", nil)
+	rr := httptest.NewRecorder()
+	s.alertsHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	body := rr.Body.String()
+	if !strings.Contains(body, `"UUID":"legacy-1"`) {
+		t.Errorf("expected the legacy line as stored, got %q", body)
+	}
+	if !strings.Contains(body, `"uuid":"new-1"`) {
+		t.Errorf("expected the Firestore alert with snake_case keys, got %q", body)
+	}
+
+	subtypes := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		var alert models.PoliceAlert
+		if err := json.Unmarshal([]byte(line), &alert); err != nil {
+			t.Fatalf("could not decode %q: %v", line, err)
+		}
+		subtypes[alert.UUID] = alert.Subtype
+	}
+	if subtypes["legacy-1"] != "POLICE_VISIBLE" || subtypes["new-1"] != "POLICE_HIDING" {
+		t.Errorf("expected both alerts to decode, got %v", subtypes)
+	}
+}
+
 // TestAlertsHandlerEmptyArchive tests the handler with an empty archive file
 func TestAlertsHandlerEmptyArchive(t *testing.T) {
 	// Create mock GCS client that returns empty data
@@ -1202,3 +1304,3428 @@ func TestRateLimitExceeded(t *testing.T) {
 		t.Errorf("expected Retry-After header '60', got %q", rr2.Header().Get("Retry-After"))
 	}
 }
+
+// mockGCSWithArchives creates a mock GCS client serving the given archive contents
+// keyed by object name. Objects not in the map return ErrObjectNotExist.
+func mockGCSWithArchives(archives map[string]string) *storage.MockGCSClient {
+	return &storage.MockGCSClient{
+		BucketFunc: func(name string) storage.GCSBucketHandle {
+			return &storage.MockGCSBucketHandle{
+				ObjectFunc: func(objName string) storage.GCSObjectHandle {
+					return &storage.MockGCSObjectHandle{
+						NewReaderFunc: func(ctx context.Context) (io.ReadCloser, error) {
+							data, ok := archives[objName]
+							if !ok {
+								return nil, storage.ErrObjectNotExist
+							}
+							return io.NopCloser(strings.NewReader(data)), nil
+						},
+					}
+				},
+			}
+		},
+	}
+}
+
+// TestNormalizeLine tests line ending normalization for archive lines
+func TestNormalizeLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []byte
+	}{
+		{name: "plain line", input: `{"UUID":"a"}`, expected: []byte("{\"UUID\":\"a\"}\n")},
+		{name: "CRLF line", input: "{\"UUID\":\"a\"}\r", expected: []byte("{\"UUID\":\"a\"}\n")},
+		{name: "surrounding whitespace", input: "  {\"UUID\":\"a\"} \t", expected: []byte("{\"UUID\":\"a\"}\n")},
+		{name: "empty line", input: "", expected: nil},
+		{name: "blank CR line", input: "\r", expected: nil},
+		{name: "whitespace only", input: "   ", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := normalizeLine([]byte(tt.input))
+			if string(result) != string(tt.expected) || (result == nil) != (tt.expected == nil) {
+				t.Errorf("normalizeLine(%q) = %q, expected %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestAlertsHandlerNormalizesArchiveLines tests that CRLF line endings, blank lines
+// and a missing final newline in an archive are streamed as clean JSONL
+func TestAlertsHandlerNormalizesArchiveLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		archive string
+	}{
+		{
+			name:    "CRLF line endings",
+			archive: "{\"UUID\":\"alert-1\"}\r\n{\"UUID\":\"alert-2\"}\r\n",
+		},
+		{
+			name:    "blank lines",
+			archive: "\n{\"UUID\":\"alert-1\"}\n\n\r\n{\"UUID\":\"alert-2\"}\n\n",
+		},
+		{
+			name:    "missing final newline",
+			archive: "{\"UUID\":\"alert-1\"}\n{\"UUID\":\"alert-2\"}",
+		},
+		{
+			name:    "CRLF without final newline",
+			archive: "{\"UUID\":\"alert-1\"}\r\n{\"UUID\":\"alert-2\"}\r",
+		},
+		{
+			name:    "malformed lines",
+			archive: "{\"UUID\":\"alert-1\"}\r\n{\"UUID\":\"alert-\n\"}\n{\"UUID\":\"alert-2\"}\n{\"UUID\"",
+		},
+	}
+
+	expected := "{\"UUID\":\"alert-1\"}\n{\"UUID\":\"alert-2\"}\n"
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &server{
+				firestoreClient: &storage.MockAlertStore{},
+				storageClient:   mockGCSWithArchives(map[string]string{"2024-01-01.jsonl": tt.archive}),
+				bucketName:      "test-bucket",
+				limiters:        make(map[string]*rate.Limiter),
+				ratePerMinute:   30,
+				validateLines:   true,
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/police_alerts?dates=2024-01-01", nil)
+			rr := httptest.NewRecorder()
+			s.alertsHandler(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+			}
+
+			body := rr.Body.String()
+			if body != expected {
+				t.Errorf("expected body %q, got %q", expected, body)
+			}
+
+			for _, line := range strings.Split(strings.TrimSuffix(body, "\n"), "\n") {
+				if !json.Valid([]byte(line)) {
+					t.Errorf("expected valid JSON line, got %q", line)
+				}
+			}
+		})
+	}
+}
+
+// newDateRangeTestServer creates a server with data available from 2024-01-01
+// and "now" fixed at 2024-06-15 in Canberra.
+func newDateRangeTestServer(gcsClient storage.GCSClient) *server {
+	loc, _ := time.LoadLocation("Australia/Canberra")
+	return &server{
+		firestoreClient: &storage.MockAlertStore{},
+		storageClient:   gcsClient,
+		bucketName:      "test-bucket",
+		limiters:        make(map[string]*rate.Limiter),
+		ratePerMinute:   30,
+		dataStartDate:   time.Date(2024, 1, 1, 0, 0, 0, 0, loc),
+		now: func() time.Time {
+			return time.Date(2024, 6, 15, 12, 0, 0, 0, loc)
+		},
+	}
+}
+
+// TestAlertsHandlerOutOfRangeSingleDate tests that a single out-of-range date returns 404
+func TestAlertsHandlerOutOfRangeSingleDate(t *testing.T) {
+	tests := []struct {
+		name string
+		date string
+	}{
+		{name: "before collection began", date: "2023-12-31"},
+		{name: "future date", date: "2024-06-16"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newDateRangeTestServer(mockGCSWithArchives(nil))
+
+			req := httptest.NewRequest(http.MethodGet, "/police_alerts?dates="+tt.date, nil)
+			rr := httptest.NewRecorder()
+			s.alertsHandler(rr, req)
+
+			if rr.Code != http.StatusNotFound {
+				t.Errorf("expected status %d, got %d", http.StatusNotFound, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), tt.date) {
+				t.Errorf("expected body to mention %s, got %q", tt.date, rr.Body.String())
+			}
+		})
+	}
+}
+
+// TestAlertsHandlerInRangeEmptyDate tests that an in-range day with no alerts is reported as empty
+func TestAlertsHandlerInRangeEmptyDate(t *testing.T) {
+	s := newDateRangeTestServer(mockGCSWithArchives(nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/police_alerts?dates=2024-06-15", nil)
+	rr := httptest.NewRecorder()
+	s.alertsHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	status := rr.Result().Trailer.Get("X-Date-Status")
+	if status != "2024-06-15=empty" {
+		t.Errorf("expected X-Date-Status '2024-06-15=empty', got %q", status)
+	}
+}
+
+// TestAlertsHandlerDateStatusTrailer tests per-date statuses for a mixed multi-date request
+func TestAlertsHandlerDateStatusTrailer(t *testing.T) {
+	mockGCS := mockGCSWithArchives(map[string]string{
+		"2024-03-01.jsonl": "{\"UUID\":\"alert-1\"}\n",
+	})
+	s := newDateRangeTestServer(mockGCS)
+
+	req := httptest.NewRequest(http.MethodGet, "/police_alerts?dates=2024-03-01,2024-03-02,2023-06-01,2030-01-01", nil)
+	rr := httptest.NewRecorder()
+	s.alertsHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	if rr.Header().Get("Trailer") != "X-Date-Status" {
+		t.Errorf("expected Trailer header to announce X-Date-Status, got %q", rr.Header().Get("Trailer"))
+	}
+
+	expected := "2023-06-01=out_of_range,2024-03-01=ok,2024-03-02=empty,2030-01-01=out_of_range"
+	if status := rr.Result().Trailer.Get("X-Date-Status"); status != expected {
+		t.Errorf("expected X-Date-Status %q, got %q", expected, status)
+	}
+
+	if !strings.Contains(rr.Body.String(), "alert-1") {
+		t.Errorf("expected in-range archive data in body, got %q", rr.Body.String())
+	}
+}
+
+// TestAlertsHandlerNoDateStatusByDefault tests that range checks are disabled without a data start date
+func TestAlertsHandlerNoDateStatusByDefault(t *testing.T) {
+	s := &server{
+		firestoreClient: &storage.MockAlertStore{},
+		storageClient:   mockGCSWithArchives(nil),
+		bucketName:      "test-bucket",
+		limiters:        make(map[string]*rate.Limiter),
+		ratePerMinute:   30,
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/police_alerts?dates=2099-01-01", nil)
+	rr := httptest.NewRecorder()
+	s.alertsHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if rr.Header().Get("Trailer") != "" {
+		t.Errorf("expected no Trailer header, got %q", rr.Header().Get("Trailer"))
+	}
+}
+
+// TestAlertsHandlerFirestoreUnavailable tests that archived dates still stream when
+// Firestore is down, while dates needing the fallback are reported as unavailable
+func TestAlertsHandlerFirestoreUnavailable(t *testing.T) {
+	archived := `{"UUID":"archived-1"}` + "\n"
+	s := &server{
+		firestoreClient: &storage.MockAlertStore{
+			GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+				return nil, fmt.Errorf("failed to query police alerts: %w", status.Error(codes.Unavailable, "connection refused"))
+			},
+		},
+		storageClient: mockGCSWithArchives(map[string]string{"2024-03-01.jsonl": archived}),
+		bucketName:    "test-bucket",
+	}
+
+	req := httptest.NewRequest("GET", "/police_alerts?dates=2024-03-01,2024-03-02,2024-03-03", nil)
+	rr := httptest.NewRecorder()
+	s.alertsHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if rr.Body.String() != archived {
+		t.Errorf("expected archived data %q, got %q", archived, rr.Body.String())
+	}
+	expected := "2024-03-01=ok,2024-03-02=unavailable,2024-03-03=unavailable"
+	if got := rr.Result().Trailer.Get("X-Date-Status"); got != expected {
+		t.Errorf("expected X-Date-Status %q, got %q", expected, got)
+	}
+}
+
+// TestAlertsHandlerFirestoreQueryError tests that other Firestore errors are reported as errors
+func TestAlertsHandlerFirestoreQueryError(t *testing.T) {
+	s := &server{
+		firestoreClient: &storage.MockAlertStore{
+			GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+				return nil, errors.New("invalid query")
+			},
+		},
+		storageClient: mockGCSWithArchives(nil),
+		bucketName:    "test-bucket",
+	}
+
+	req := httptest.NewRequest("GET", "/police_alerts?dates=2024-03-02", nil)
+	rr := httptest.NewRecorder()
+	s.alertsHandler(rr, req)
+
+	if got := rr.Result().Trailer.Get("X-Date-Status"); got != "2024-03-02=error" {
+		t.Errorf("expected error status, got %q", got)
+	}
+}
+
+// =============================================================================
+// Heatmap Handler Tests
+// =============================================================================
+
+// TestHeatmapHandlerReturnsStreets tests the heatmap endpoint returns store results
+func TestHeatmapHandlerReturnsStreets(t *testing.T) {
+	var gotDates []string
+	mockStore := &storage.MockAlertStore{
+		GetStreetHeatmapFunc: func(ctx context.Context, dates []string) ([]models.StreetCount, error) {
+			gotDates = dates
+			return []models.StreetCount{
+				{Street: "Main St", Count: 3, Latitude: -35.2, Longitude: 149.2},
+				{Street: "Side Rd", Count: 1, Latitude: -35.5, Longitude: 149.5},
+			}, nil
+		},
+	}
+	s := &server{firestoreClient: mockStore}
+
+	req := httptest.NewRequest("POST", "/api/heatmap", strings.NewReader(`{"dates":["2024-01-01","2024-01-02"]}`))
+	rr := httptest.NewRecorder()
+	s.heatmapHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if len(gotDates) != 2 || gotDates[0] != "2024-01-01" || gotDates[1] != "2024-01-02" {
+		t.Errorf("expected dates to be passed to store, got %v", gotDates)
+	}
+
+	var resp models.HeatmapResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Streets) != 2 || resp.Streets[0].Street != "Main St" || resp.Streets[0].Count != 3 {
+		t.Errorf("unexpected streets: %+v", resp.Streets)
+	}
+	if resp.Streets[0].Latitude != -35.2 || resp.Streets[0].Longitude != 149.2 {
+		t.Errorf("unexpected coordinates: %+v", resp.Streets[0])
+	}
+	if len(resp.DatesQueried) != 2 {
+		t.Errorf("expected 2 dates queried, got %v", resp.DatesQueried)
+	}
+}
+
+// TestHeatmapHandlerValidation tests request validation for the heatmap endpoint
+func TestHeatmapHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		body           string
+		expectedStatus int
+	}{
+		{"GET not allowed", "GET", "", http.StatusMethodNotAllowed},
+		{"invalid JSON", "POST", "{", http.StatusBadRequest},
+		{"no dates", "POST", `{"dates":[]}`, http.StatusBadRequest},
+		{"invalid date", "POST", `{"dates":["2024/01/01"]}`, http.StatusBadRequest},
+		{"too many dates", "POST", `{"dates":["2024-01-01","2024-01-02","2024-01-03","2024-01-04","2024-01-05","2024-01-06","2024-01-07","2024-01-08"]}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := &storage.MockAlertStore{}
+			s := &server{firestoreClient: mockStore}
+
+			req := httptest.NewRequest(tt.method, "/api/heatmap", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			s.heatmapHandler(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if mockStore.CallLog.GetStreetHeatmapCalls != 0 {
+				t.Errorf("expected store not to be called for invalid request")
+			}
+		})
+	}
+}
+
+// graphQLRequest posts a GraphQL query to a server backed by store and returns
+// the decoded response
+func graphQLRequest(t *testing.T, store storage.AlertStore, query string, variables map[string]any) (map[string]json.RawMessage, []struct{ Message string }) {
+	t.Helper()
+	s := &server{firestoreClient: store}
+	schema, err := newGraphQLSchema(s)
+	if err != nil {
+		t.Fatalf("failed to parse schema: %v", err)
+	}
+	s.graphQL = schema
+
+	body, _ := json.Marshal(map[string]any{"query": query, "variables": variables})
+	rr := httptest.NewRecorder()
+	s.graphQLHandler(rr, httptest.NewRequest("POST", "/graphql", bytes.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var resp struct {
+		Data   map[string]json.RawMessage
+		Errors []struct{ Message string }
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return resp.Data, resp.Errors
+}
+
+// TestGraphQLAlerts tests that the alerts query passes its dates and filters to
+// the store and returns the requested fields
+func TestGraphQLAlerts(t *testing.T) {
+	var gotDates []string
+	var gotFilters models.AlertFilters
+	store := &storage.MockAlertStore{
+		GetPoliceAlertsByDatesWithFiltersFunc: func(ctx context.Context, dates []string, filters models.AlertFilters) ([]models.PoliceAlert, error) {
+			gotDates, gotFilters = dates, filters
+			return []models.PoliceAlert{
+				{
+					UUID:         "a1",
+					Type:         "POLICE",
+					Subtype:      "POLICE_HIDING",
+					Street:       "Main St",
+					City:         "Canberra",
+					LocationGeo:  &latlng.LatLng{Latitude: -35.28, Longitude: 149.13},
+					Reliability:  7,
+					PublishTime:  time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC),
+					ActiveMillis: 3600000,
+				},
+				{UUID: "a2", Subtype: "POLICE_VISIBLE"},
+			}, nil
+		},
+	}
+
+	data, errs := graphQLRequest(t, store, `query ($dates: [String!]!) {
+		alerts(dates: $dates, subtypes: ["POLICE_HIDING", "POLICE_VISIBLE"], streets: ["Main St"], city: "Canberra") {
+			uuid subtype street city lat lng reliability publishTime activeMillis
+		}
+	}`, map[string]any{"dates": []string{"2024-01-15", "2024-01-16"}})
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	if strings.Join(gotDates, ",") != "2024-01-15,2024-01-16" {
+		t.Errorf("expected dates to be passed to store, got %v", gotDates)
+	}
+	wantFilters := models.AlertFilters{
+		Subtypes: []string{"POLICE_HIDING", "POLICE_VISIBLE"},
+		Streets:  []string{"Main St"},
+		Cities:   []string{"Canberra"},
+	}
+	if !reflect.DeepEqual(gotFilters, wantFilters) {
+		t.Errorf("unexpected filters\n got %+v\nwant %+v", gotFilters, wantFilters)
+	}
+
+	var alerts []struct {
+		UUID         string
+		Subtype      string
+		Street       string
+		City         string
+		Lat          *float64
+		Lng          *float64
+		Reliability  int
+		PublishTime  string
+		ActiveMillis float64
+	}
+	if err := json.Unmarshal(data["alerts"], &alerts); err != nil {
+		t.Fatalf("failed to decode alerts: %v", err)
+	}
+	if len(alerts) != 2 {
+		t.Fatalf("expected 2 alerts, got %d", len(alerts))
+	}
+	first := alerts[0]
+	if first.UUID != "a1" || first.Subtype != "POLICE_HIDING" || first.Street != "Main St" || first.City != "Canberra" || first.Reliability != 7 {
+		t.Errorf("unexpected alert: %+v", first)
+	}
+	if first.Lat == nil || *first.Lat != -35.28 || first.Lng == nil || *first.Lng != 149.13 {
+		t.Errorf("unexpected location: %v, %v", first.Lat, first.Lng)
+	}
+	if first.PublishTime != "2024-01-15T10:00:00Z" || first.ActiveMillis != 3600000 {
+		t.Errorf("unexpected times: %+v", first)
+	}
+	if alerts[1].Lat != nil || alerts[1].Lng != nil {
+		t.Errorf("expected no location for an alert without one, got %v, %v", alerts[1].Lat, alerts[1].Lng)
+	}
+}
+
+// TestGraphQLStats tests that the stats query counts the dates' alerts by subtype
+func TestGraphQLStats(t *testing.T) {
+	store := &storage.MockAlertStore{
+		GetPoliceAlertsByDatesWithFiltersFunc: func(ctx context.Context, dates []string, filters models.AlertFilters) ([]models.PoliceAlert, error) {
+			if !reflect.DeepEqual(filters, models.AlertFilters{}) {
+				t.Errorf("expected no filters, got %+v", filters)
+			}
+			return []models.PoliceAlert{
+				{UUID: "a1", Subtype: "POLICE_VISIBLE"},
+				{UUID: "a2", Subtype: "POLICE_HIDING"},
+				{UUID: "a3", Subtype: "POLICE_VISIBLE"},
+			}, nil
+		},
+	}
+
+	data, errs := graphQLRequest(t, store, `{ stats(dates: ["2024-01-15"]) { dates total subtypes { subtype count } } }`, nil)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	want := `{"dates":["2024-01-15"],"total":3,"subtypes":[{"subtype":"POLICE_VISIBLE","count":2},{"subtype":"POLICE_HIDING","count":1}]}`
+	if string(data["stats"]) != want {
+		t.Errorf("unexpected stats\n got %s\nwant %s", data["stats"], want)
+	}
+}
+
+// TestGraphQLErrors tests that invalid dates and store failures are reported
+// as GraphQL errors, and that only POST is accepted
+func TestGraphQLErrors(t *testing.T) {
+	failing := &storage.MockAlertStore{
+		GetPoliceAlertsByDatesWithFiltersFunc: func(ctx context.Context, dates []string, filters models.AlertFilters) ([]models.PoliceAlert, error) {
+			return nil, errors.New("firestore unavailable")
+		},
+	}
+	tests := []struct {
+		name  string
+		store storage.AlertStore
+		query string
+		want  string
+	}{
+		{"no dates", &storage.MockAlertStore{}, `{ alerts(dates: []) { uuid } }`, "at least one date is required"},
+		{"invalid date", &storage.MockAlertStore{}, `{ stats(dates: ["2024/01/01"]) { total } }`, "invalid date format"},
+		{"too many dates", &storage.MockAlertStore{}, `{ alerts(dates: ["2024-01-01","2024-01-02","2024-01-03","2024-01-04","2024-01-05","2024-01-06","2024-01-07","2024-01-08"]) { uuid } }`, "maximum of 7 dates"},
+		{"store error", failing, `{ alerts(dates: ["2024-01-01"]) { uuid } }`, "failed to query alerts"},
+		{"unknown field", &storage.MockAlertStore{}, `{ alerts(dates: ["2024-01-01"]) { password } }`, "Cannot query field"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := graphQLRequest(t, tt.store, tt.query, nil)
+			if len(errs) != 1 || !strings.Contains(errs[0].Message, tt.want) {
+				t.Errorf("expected an error containing %q, got %v", tt.want, errs)
+			}
+		})
+	}
+
+	s := &server{firestoreClient: &storage.MockAlertStore{}}
+	rr := httptest.NewRecorder()
+	s.graphQLHandler(rr, httptest.NewRequest("GET", "/graphql", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d for GET, got %d", http.StatusMethodNotAllowed, rr.Code)
+	}
+}
+
+// TestHeatmapHandlerStoreError tests the heatmap endpoint surfaces store failures
+func TestHeatmapHandlerStoreError(t *testing.T) {
+	mockStore := &storage.MockAlertStore{
+		GetStreetHeatmapFunc: func(ctx context.Context, dates []string) ([]models.StreetCount, error) {
+			return nil, errors.New("firestore unavailable")
+		},
+	}
+	s := &server{firestoreClient: mockStore}
+
+	req := httptest.NewRequest("POST", "/api/heatmap", strings.NewReader(`{"dates":["2024-01-01"]}`))
+	rr := httptest.NewRecorder()
+	s.heatmapHandler(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+}
+
+// TestCorsMiddlewareWithMethods tests the advertised methods are configurable
+func TestCorsMiddlewareWithMethods(t *testing.T) {
+	handler := corsMiddlewareWithMethods("POST, OPTIONS", func(w http.ResponseWriter, r *http.Request) {})
+
+	req := httptest.NewRequest("OPTIONS", "/api/heatmap", nil)
+	req.Header.Set("Origin", "https://wazepolicescrapergcp.web.app")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("Access-Control-Allow-Methods"); got != "POST, OPTIONS" {
+		t.Errorf("expected Access-Control-Allow-Methods 'POST, OPTIONS', got %q", got)
+	}
+}
+
+// =============================================================================
+// Diff Handler Tests
+// =============================================================================
+
+// TestDiffAlerts tests adds, removes and metric changes between two synthetic days
+func TestDiffAlerts(t *testing.T) {
+	dayA := []models.PoliceAlert{
+		{UUID: "kept-same", NThumbsUpLast: 2, Reliability: 5, Confidence: 1},
+		{UUID: "kept-changed", NThumbsUpLast: 1, Reliability: 5, Confidence: 1},
+		{UUID: "gone-1"},
+		{UUID: "gone-2"},
+	}
+	dayB := []models.PoliceAlert{
+		{UUID: "kept-same", NThumbsUpLast: 2, Reliability: 5, Confidence: 1},
+		{UUID: "kept-changed", NThumbsUpLast: 4, Reliability: 7, Confidence: 0},
+		{UUID: "new-2"},
+		{UUID: "new-1"},
+	}
+
+	resp := diffAlerts(dayA, dayB)
+
+	if strings.Join(resp.Added, ",") != "new-1,new-2" {
+		t.Errorf("expected added [new-1 new-2], got %v", resp.Added)
+	}
+	if strings.Join(resp.Removed, ",") != "gone-1,gone-2" {
+		t.Errorf("expected removed [gone-1 gone-2], got %v", resp.Removed)
+	}
+	if resp.Unchanged != 1 {
+		t.Errorf("expected 1 unchanged alert, got %d", resp.Unchanged)
+	}
+	if len(resp.Changed) != 1 {
+		t.Fatalf("expected 1 changed alert, got %+v", resp.Changed)
+	}
+	want := models.AlertDelta{UUID: "kept-changed", ThumbsUpDelta: 3, ReliabilityDelta: 2, ConfidenceDelta: -1}
+	if resp.Changed[0] != want {
+		t.Errorf("expected %+v, got %+v", want, resp.Changed[0])
+	}
+}
+
+// TestDiffAlertsEmptyDays tests that empty days produce empty (non-nil) lists
+func TestDiffAlertsEmptyDays(t *testing.T) {
+	resp := diffAlerts(nil, nil)
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	if !strings.Contains(string(data), `"added":[]`) || !strings.Contains(string(data), `"removed":[]`) {
+		t.Errorf("expected empty arrays in JSON, got %s", data)
+	}
+}
+
+// TestDiffHandlerArchiveAndFirestore tests a diff where one day is archived and the other is not
+func TestDiffHandlerArchiveAndFirestore(t *testing.T) {
+	archiveA := `{"UUID":"a1","NThumbsUpLast":1}` + "\n" + `{"UUID":"a2","NThumbsUpLast":0}` + "\n"
+	mockStore := &storage.MockAlertStore{
+		GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, startDate, endDate time.Time) ([]models.PoliceAlert, error) {
+			if startDate.Format("2006-01-02") != "2024-01-02" {
+				t.Errorf("unexpected Firestore query for %s", startDate.Format("2006-01-02"))
+			}
+			return []models.PoliceAlert{
+				{UUID: "a1", NThumbsUpLast: 3},
+				{UUID: "b1"},
+			}, nil
+		},
+	}
+	s := &server{
+		firestoreClient: mockStore,
+		storageClient:   mockGCSWithArchives(map[string]string{"2024-01-01.jsonl": archiveA}),
+		bucketName:      "test-bucket",
+	}
+
+	req := httptest.NewRequest("POST", "/api/diff", strings.NewReader(`{"date_a":"2024-01-01","date_b":"2024-01-02"}`))
+	rr := httptest.NewRecorder()
+	s.diffHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var resp models.DiffResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.DateA != "2024-01-01" || resp.DateB != "2024-01-02" {
+		t.Errorf("unexpected dates: %s, %s", resp.DateA, resp.DateB)
+	}
+	if len(resp.Added) != 1 || resp.Added[0] != "b1" {
+		t.Errorf("expected added [b1], got %v", resp.Added)
+	}
+	if len(resp.Removed) != 1 || resp.Removed[0] != "a2" {
+		t.Errorf("expected removed [a2], got %v", resp.Removed)
+	}
+	if len(resp.Changed) != 1 || resp.Changed[0].UUID != "a1" || resp.Changed[0].ThumbsUpDelta != 2 {
+		t.Errorf("expected a1 thumbs up delta 2, got %+v", resp.Changed)
+	}
+}
+
+// TestDiffHandlerValidation tests request validation for the diff endpoint
+func TestDiffHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		body           string
+		expectedStatus int
+	}{
+		{"GET not allowed", "GET", "", http.StatusMethodNotAllowed},
+		{"invalid JSON", "POST", "not json", http.StatusBadRequest},
+		{"missing date", "POST", `{"date_a":"2024-01-01"}`, http.StatusBadRequest},
+		{"invalid date", "POST", `{"date_a":"2024-01-01","date_b":"01/02/2024"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &server{
+				firestoreClient: &storage.MockAlertStore{},
+				storageClient:   mockGCSWithArchives(nil),
+				bucketName:      "test-bucket",
+			}
+
+			req := httptest.NewRequest(tt.method, "/api/diff", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			s.diffHandler(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+// TestDiffHandlerStoreError tests that a failed day load returns 500
+func TestDiffHandlerStoreError(t *testing.T) {
+	s := &server{
+		firestoreClient: &storage.MockAlertStore{
+			GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, startDate, endDate time.Time) ([]models.PoliceAlert, error) {
+				return nil, errors.New("firestore unavailable")
+			},
+		},
+		storageClient: mockGCSWithArchives(nil),
+		bucketName:    "test-bucket",
+	}
+
+	req := httptest.NewRequest("POST", "/api/diff", strings.NewReader(`{"date_a":"2024-01-01","date_b":"2024-01-02"}`))
+	rr := httptest.NewRecorder()
+	s.diffHandler(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+}
+
+// =============================================================================
+// Output Buffering Tests
+// =============================================================================
+
+// countingFlusher counts Flush calls
+type countingFlusher struct {
+	flushes int
+}
+
+func (f *countingFlusher) Flush() { f.flushes++ }
+
+// streamLines writes n lines of the given size through writeStream
+func streamLines(n, size, flushBytes int, flushInterval time.Duration) (int, int, *strings.Builder) {
+	var out strings.Builder
+	flusher := &countingFlusher{}
+	dataChan := make(chan []byte, n)
+	line := []byte(strings.Repeat("x", size-1) + "\n")
+	for i := 0; i < n; i++ {
+		dataChan <- line
+	}
+	close(dataChan)
+
+	flushes := writeStream(&out, flusher, dataChan, flushBytes, flushInterval)
+	return flushes, flusher.flushes, &out
+}
+
+// TestWriteStreamBatchesFlushes compares per-line flushing with size-based flushing
+func TestWriteStreamBatchesFlushes(t *testing.T) {
+	// Flushing after every line (previous behaviour) - a threshold of 1 byte
+	perLine, _, perLineOut := streamLines(1000, 200, 1, time.Hour)
+	if perLine != 1000 {
+		t.Errorf("expected 1000 flushes with per-line flushing, got %d", perLine)
+	}
+
+	// 200-byte lines with a 32KB threshold flush every 164 lines, plus the final flush
+	batched, counted, batchedOut := streamLines(1000, 200, 32*1024, time.Hour)
+	if batched != 7 || counted != 7 {
+		t.Errorf("expected 7 flushes with buffering, got %d (flusher saw %d)", batched, counted)
+	}
+
+	if perLineOut.String() != batchedOut.String() {
+		t.Error("expected identical output regardless of flush policy")
+	}
+}
+
+// TestWriteStreamFlushesAtEnd tests that small outputs are still flushed at end of stream
+func TestWriteStreamFlushesAtEnd(t *testing.T) {
+	flushes, _, out := streamLines(3, 50, 32*1024, time.Hour)
+	if flushes != 1 {
+		t.Errorf("expected a single end-of-stream flush, got %d", flushes)
+	}
+	if out.Len() != 150 {
+		t.Errorf("expected 150 bytes written, got %d", out.Len())
+	}
+}
+
+// TestWriteStreamTimeBasedFlush tests that buffered data is flushed after the interval
+func TestWriteStreamTimeBasedFlush(t *testing.T) {
+	flusher := &countingFlusher{}
+	dataChan := make(chan []byte)
+	done := make(chan int)
+	go func() {
+		done <- writeStream(io.Discard, flusher, dataChan, 32*1024, 10*time.Millisecond)
+	}()
+
+	dataChan <- []byte("{}\n")
+	time.Sleep(50 * time.Millisecond) // Well past the flush interval
+	close(dataChan)
+
+	if flushes := <-done; flushes != 1 {
+		t.Errorf("expected 1 time-based flush and no empty end flush, got %d", flushes)
+	}
+}
+
+// errWriter fails every write
+type errWriter struct{}
+
+func (errWriter) Write(p []byte) (int, error) { return 0, errors.New("client disconnected") }
+
+// TestWriteStreamDrainsAfterError tests that senders are not blocked after a write error
+func TestWriteStreamDrainsAfterError(t *testing.T) {
+	dataChan := make(chan []byte)
+	done := make(chan int)
+	go func() {
+		done <- writeStream(errWriter{}, &countingFlusher{}, dataChan, 1, time.Hour)
+	}()
+
+	for i := 0; i < 10; i++ {
+		dataChan <- []byte("{}\n")
+	}
+	close(dataChan)
+
+	if flushes := <-done; flushes != 0 {
+		t.Errorf("expected no flushes after write error, got %d", flushes)
+	}
+}
+
+func BenchmarkWriteStreamPerLineFlush(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		streamLines(5000, 200, 1, time.Hour)
+	}
+}
+
+func BenchmarkWriteStreamBufferedFlush(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		streamLines(5000, 200, defaultFlushBytes, defaultFlushInterval)
+	}
+}
+
+// batchTestArchives builds archives for two dates with blank lines and no final newline
+func batchTestArchives(t testing.TB, perDate int) map[string]string {
+	archives := make(map[string]string)
+	for _, date := range []string{"2024-01-01", "2024-01-02"} {
+		var archive strings.Builder
+		for i := 0; i < perDate; i++ {
+			data, err := json.Marshal(models.PoliceAlert{
+				UUID:         fmt.Sprintf("%s-%d", date, i),
+				Type:         "POLICE",
+				ActiveMillis: int64(i) * 60000,
+				LocationGeo:  &latlng.LatLng{Latitude: -35.28, Longitude: 149.13},
+			})
+			if err != nil {
+				t.Fatalf("failed to marshal alert: %v", err)
+			}
+			if i%5 == 0 {
+				archive.WriteString("\r\n")
+			}
+			archive.Write(data)
+			if i < perDate-1 {
+				archive.WriteByte('\n')
+			}
+		}
+		archives[date+".jsonl"] = archive.String()
+	}
+	return archives
+}
+
+// TestAlertsHandlerBatchLines tests that batching worker sends produces byte-identical
+// output to per-line sends, for plain JSONL and the per-line transforms
+func TestAlertsHandlerBatchLines(t *testing.T) {
+	mockGCS := mockGCSWithArchives(batchTestArchives(t, 23))
+	tests := []struct {
+		name          string
+		query         string
+		durationHuman bool
+	}{
+		{name: "jsonl", query: ""},
+		{name: "geojsonseq", query: "&format=geojsonseq"},
+		{name: "duration human", query: "", durationHuman: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want string
+			for _, batchLines := range []int{0, 1, 7, 1000} {
+				s := &server{
+					firestoreClient: &storage.MockAlertStore{},
+					storageClient:   mockGCS,
+					bucketName:      "test-bucket",
+					durationHuman:   tt.durationHuman,
+					batchLines:      batchLines,
+				}
+				rr := httptest.NewRecorder()
+				s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024-01-01,2024-01-02&workers=1"+tt.query, nil))
+
+				if rr.Code != http.StatusOK {
+					t.Fatalf("batch %d: expected status %d, got %d", batchLines, http.StatusOK, rr.Code)
+				}
+				if batchLines == 0 {
+					want = rr.Body.String()
+					if n := strings.Count(want, "\n"); n != 46 {
+						t.Fatalf("expected 46 records, got %d", n)
+					}
+					continue
+				}
+				if got := rr.Body.String(); got != want {
+					t.Errorf("batch %d: output differs from unbatched:\n got %q\nwant %q", batchLines, got, want)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkAlertsHandlerBatchLines(b *testing.B) {
+	mockGCS := mockGCSWithArchives(batchTestArchives(b, 5000))
+	for _, batchLines := range []int{1, 64} {
+		b.Run(fmt.Sprintf("batch=%d", batchLines), func(b *testing.B) {
+			s := &server{
+				firestoreClient: &storage.MockAlertStore{},
+				storageClient:   mockGCS,
+				bucketName:      "test-bucket",
+				batchLines:      batchLines,
+			}
+			for i := 0; i < b.N; i++ {
+				rr := httptest.NewRecorder()
+				s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024-01-01,2024-01-02", nil))
+			}
+		})
+	}
+}
+
+// =============================================================================
+// Gzipped Archive Tests
+// =============================================================================
+
+// gzipString compresses s with gzip
+func gzipString(t *testing.T, s string) string {
+	t.Helper()
+	var buf strings.Builder
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(s)); err != nil {
+		t.Fatalf("failed to gzip: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("failed to gzip: %v", err)
+	}
+	return buf.String()
+}
+
+// TestAlertsHandlerGzippedArchive tests that gzipped archives stream as plain JSONL
+func TestAlertsHandlerGzippedArchive(t *testing.T) {
+	plain := `{"UUID":"gz-1"}` + "\n" + `{"UUID":"gz-2"}` + "\n"
+	s := &server{
+		firestoreClient: &storage.MockAlertStore{},
+		storageClient:   mockGCSWithArchives(map[string]string{"2024-01-01.jsonl": gzipString(t, plain)}),
+		bucketName:      "test-bucket",
+	}
+
+	req := httptest.NewRequest("GET", "/police_alerts?dates=2024-01-01", nil)
+	rr := httptest.NewRecorder()
+	s.alertsHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if rr.Body.String() != plain {
+		t.Errorf("expected decompressed JSONL %q, got %q", plain, rr.Body.String())
+	}
+}
+
+// TestAlertsHandlerMsgpackArchive tests that a MessagePack archive is served,
+// and downloaded, as the JSONL lines of its alerts
+func TestAlertsHandlerMsgpackArchive(t *testing.T) {
+	alerts := []models.PoliceAlert{
+		{UUID: "mp-1", Type: "POLICE", Subtype: "POLICE_HIDING", PublishTime: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)},
+		{UUID: "mp-2", Type: "POLICE", Subtype: "POLICE_VISIBLE", LocationGeo: &latlng.LatLng{Latitude: -35.3, Longitude: 149.1}},
+	}
+	var archive bytes.Buffer
+	if err := storage.WriteMsgpackAlerts(&archive, alerts); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+	var want strings.Builder
+	for _, alert := range alerts {
+		line, _ := json.Marshal(alert)
+		want.Write(line)
+		want.WriteByte('\n')
+	}
+	s := &server{
+		firestoreClient: &storage.MockAlertStore{},
+		storageClient:   mockGCSWithArchives(map[string]string{"2024-01-01.jsonl": archive.String()}),
+		bucketName:      "test-bucket",
+	}
+
+	rr := httptest.NewRecorder()
+	s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024-01-01", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if rr.Body.String() != want.String() {
+		t.Errorf("expected JSONL %q, got %q", want.String(), rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	s.downloadHandler(rr, httptest.NewRequest("GET", "/download?start=2024-01-01&end=2024-01-01", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected download status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if rr.Body.String() != want.String() {
+		t.Errorf("expected downloaded JSONL %q, got %q", want.String(), rr.Body.String())
+	}
+}
+
+// TestAlertsHandlerCorruptGzipArchive tests that an unreadable gzip archive is reported as an error
+func TestAlertsHandlerCorruptGzipArchive(t *testing.T) {
+	s := newDateRangeTestServer(mockGCSWithArchives(map[string]string{"2024-03-01.jsonl": "\x1f\x8bnot gzip"}))
+
+	req := httptest.NewRequest("GET", "/police_alerts?dates=2024-03-01", nil)
+	rr := httptest.NewRecorder()
+	s.alertsHandler(rr, req)
+
+	if got := rr.Result().Trailer.Get("X-Date-Status"); got != "2024-03-01=error" {
+		t.Errorf("expected error status for corrupt archive, got %q", got)
+	}
+}
+
+// =============================================================================
+// Sync Handler Tests
+// =============================================================================
+
+// TestSyncHandlerReturnsCursor tests that the sync endpoint passes since/limit through and returns next_since
+func TestSyncHandlerReturnsCursor(t *testing.T) {
+	var gotSince time.Time
+	var gotLimit int
+	next := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	mockStore := &storage.MockAlertStore{
+		GetPoliceAlertsUpdatedSinceFunc: func(ctx context.Context, since time.Time, limit int) ([]models.PoliceAlert, time.Time, error) {
+			gotSince, gotLimit = since, limit
+			return []models.PoliceAlert{{UUID: "a1", ExpireTime: next}}, next, nil
+		},
+	}
+	s := &server{firestoreClient: mockStore}
+
+	req := httptest.NewRequest("GET", "/api/sync?since=2024-01-15T10:00:00Z&limit=10", nil)
+	rr := httptest.NewRecorder()
+	s.syncHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if !gotSince.Equal(time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)) || gotLimit != 10 {
+		t.Errorf("expected since 10:00 and limit 10, got %v and %d", gotSince, gotLimit)
+	}
+
+	var resp models.SyncResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Alerts) != 1 || resp.Alerts[0].UUID != "a1" {
+		t.Errorf("unexpected alerts: %+v", resp.Alerts)
+	}
+	if !resp.NextSince.Equal(next) {
+		t.Errorf("expected next_since %v, got %v", next, resp.NextSince)
+	}
+}
+
+// TestSyncHandlerDefaults tests that a missing since syncs from the beginning with the default limit
+func TestSyncHandlerDefaults(t *testing.T) {
+	mockStore := &storage.MockAlertStore{
+		GetPoliceAlertsUpdatedSinceFunc: func(ctx context.Context, since time.Time, limit int) ([]models.PoliceAlert, time.Time, error) {
+			if !since.IsZero() || limit != defaultSyncLimit {
+				t.Errorf("expected zero since and default limit, got %v and %d", since, limit)
+			}
+			return nil, since, nil
+		},
+	}
+	s := &server{firestoreClient: mockStore}
+
+	rr := httptest.NewRecorder()
+	s.syncHandler(rr, httptest.NewRequest("GET", "/api/sync", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+}
+
+// TestSyncHandlerValidation tests request validation and error handling for the sync endpoint
+func TestSyncHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		storeErr       error
+		expectedStatus int
+	}{
+		{"POST not allowed", "POST", "/api/sync", nil, http.StatusMethodNotAllowed},
+		{"invalid since", "GET", "/api/sync?since=2024-01-15", nil, http.StatusBadRequest},
+		{"invalid limit", "GET", "/api/sync?limit=abc", nil, http.StatusBadRequest},
+		{"limit too large", "GET", "/api/sync?limit=100000", nil, http.StatusBadRequest},
+		{"store error", "GET", "/api/sync", errors.New("firestore down"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := &storage.MockAlertStore{
+				GetPoliceAlertsUpdatedSinceFunc: func(ctx context.Context, since time.Time, limit int) ([]models.PoliceAlert, time.Time, error) {
+					return nil, since, tt.storeErr
+				},
+			}
+			s := &server{firestoreClient: mockStore}
+
+			rr := httptest.NewRecorder()
+			s.syncHandler(rr, httptest.NewRequest(tt.method, tt.url, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+// TestSyncHandlerMissingIndex tests that a missing-index failure names the index-creation
+// link in the response only when EXPOSE_INDEX_ERRORS is enabled
+func TestSyncHandlerMissingIndex(t *testing.T) {
+	const url = "https://console.firebase.google.com/v1/r/project/demo/firestore/indexes?create_composite=abc"
+	indexErr := &storage.MissingIndexError{
+		URL: url,
+		Err: status.Error(codes.FailedPrecondition, "The query requires an index. You can create it here: "+url),
+	}
+	mockStore := &storage.MockAlertStore{
+		GetPoliceAlertsUpdatedSinceFunc: func(ctx context.Context, since time.Time, limit int) ([]models.PoliceAlert, time.Time, error) {
+			return nil, since, fmt.Errorf("failed to query updated police alerts: %w", indexErr)
+		},
+	}
+
+	for _, expose := range []bool{false, true} {
+		s := &server{firestoreClient: mockStore, exposeIndexErrors: expose}
+		rr := httptest.NewRecorder()
+		s.syncHandler(rr, httptest.NewRequest("GET", "/api/sync", nil))
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Fatalf("expected status %d, got %d", http.StatusInternalServerError, rr.Code)
+		}
+		body := strings.TrimSpace(rr.Body.String())
+		want := "Failed to sync alerts"
+		if expose {
+			want += ": firestore query requires a missing composite index; create it at " + url
+		}
+		if body != want {
+			t.Errorf("expose=%v: expected body %q, got %q", expose, want, body)
+		}
+	}
+}
+
+// TestActiveAtHandler tests that the active-at endpoint passes the instant through and returns the alerts
+func TestActiveAtHandler(t *testing.T) {
+	var gotAt time.Time
+	mockStore := &storage.MockAlertStore{
+		GetPoliceAlertsActiveAtFunc: func(ctx context.Context, at time.Time) ([]models.PoliceAlert, error) {
+			gotAt = at
+			return []models.PoliceAlert{{UUID: "a1"}}, nil
+		},
+	}
+	s := &server{firestoreClient: mockStore}
+
+	rr := httptest.NewRecorder()
+	s.activeAtHandler(rr, httptest.NewRequest("GET", "/api/active-at?ts=2024-01-15T14:32:00%2B11:00", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	expected := time.Date(2024, 1, 15, 3, 32, 0, 0, time.UTC)
+	if !gotAt.Equal(expected) {
+		t.Errorf("expected instant %v, got %v", expected, gotAt)
+	}
+
+	var resp models.ActiveAtResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !resp.At.Equal(expected) || len(resp.Alerts) != 1 || resp.Alerts[0].UUID != "a1" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+// TestHaversineKm tests distances between known points
+func TestHaversineKm(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lng1, lat2, lng2 float64
+		wantKm                 float64
+	}{
+		{"same point", -35.2809, 149.13, -35.2809, 149.13, 0},
+		{"Canberra to Sydney", -35.2809, 149.13, -33.8688, 151.2093, 247},
+		{"one degree of latitude", 0, 0, 1, 0, 111.2},
+		{"across the antimeridian", 0, 179.5, 0, -179.5, 111.2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := haversineKm(tt.lat1, tt.lng1, tt.lat2, tt.lng2)
+			if math.Abs(got-tt.wantKm) > 1 {
+				t.Errorf("expected about %.1f km, got %.1f km", tt.wantKm, got)
+			}
+		})
+	}
+}
+
+// TestActiveAtHandlerNear tests that near_lat/near_lng order alerts by distance and
+// radius_km drops distant ones
+func TestActiveAtHandlerNear(t *testing.T) {
+	// Distances from Civic, Canberra (-35.2809, 149.13)
+	alerts := []models.PoliceAlert{
+		{UUID: "sydney", LocationGeo: &latlng.LatLng{Latitude: -33.8688, Longitude: 151.2093}}, // ~247 km
+		{UUID: "no-location"},
+		{UUID: "queanbeyan", LocationGeo: &latlng.LatLng{Latitude: -35.3533, Longitude: 149.2343}}, // ~12 km
+		{UUID: "civic", LocationGeo: &latlng.LatLng{Latitude: -35.2812, Longitude: 149.1310}},      // ~0.1 km
+		{UUID: "goulburn", LocationGeo: &latlng.LatLng{Latitude: -34.7547, Longitude: 149.7186}},   // ~79 km
+	}
+	mockStore := &storage.MockAlertStore{
+		GetPoliceAlertsActiveAtFunc: func(ctx context.Context, at time.Time) ([]models.PoliceAlert, error) {
+			return append([]models.PoliceAlert(nil), alerts...), nil
+		},
+	}
+	s := &server{firestoreClient: mockStore}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"no point keeps store order", "", []string{"sydney", "no-location", "queanbeyan", "civic", "goulburn"}},
+		{"sorted by distance", "&near_lat=-35.2809&near_lng=149.13", []string{"civic", "queanbeyan", "goulburn", "sydney"}},
+		{"within radius", "&near_lat=-35.2809&near_lng=149.13&radius_km=100", []string{"civic", "queanbeyan", "goulburn"}},
+		{"tight radius", "&near_lat=-35.2809&near_lng=149.13&radius_km=1", []string{"civic"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			s.activeAtHandler(rr, httptest.NewRequest("GET", "/api/active-at?ts=2024-01-15T14:32:00Z"+tt.query, nil))
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+			var resp models.ActiveAtResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			got := make([]string, len(resp.Alerts))
+			for i, alert := range resp.Alerts {
+				got[i] = alert.UUID
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestActiveAtHandlerValidation tests request validation and error handling for the active-at endpoint
+func TestActiveAtHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		storeErr       error
+		expectedStatus int
+	}{
+		{"POST not allowed", "POST", "/api/active-at?ts=2024-01-15T14:32:00Z", nil, http.StatusMethodNotAllowed},
+		{"missing ts", "GET", "/api/active-at", nil, http.StatusBadRequest},
+		{"date only", "GET", "/api/active-at?ts=2024-01-15", nil, http.StatusBadRequest},
+		{"near_lat without near_lng", "GET", "/api/active-at?ts=2024-01-15T14:32:00Z&near_lat=-35.28", nil, http.StatusBadRequest},
+		{"near_lat out of range", "GET", "/api/active-at?ts=2024-01-15T14:32:00Z&near_lat=-95&near_lng=149.13", nil, http.StatusBadRequest},
+		{"radius without point", "GET", "/api/active-at?ts=2024-01-15T14:32:00Z&radius_km=5", nil, http.StatusBadRequest},
+		{"negative radius", "GET", "/api/active-at?ts=2024-01-15T14:32:00Z&near_lat=-35.28&near_lng=149.13&radius_km=-5", nil, http.StatusBadRequest},
+		{"store error", "GET", "/api/active-at?ts=2024-01-15T14:32:00Z", errors.New("firestore down"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := &storage.MockAlertStore{
+				GetPoliceAlertsActiveAtFunc: func(ctx context.Context, at time.Time) ([]models.PoliceAlert, error) {
+					return nil, tt.storeErr
+				},
+			}
+			s := &server{firestoreClient: mockStore}
+
+			rr := httptest.NewRecorder()
+			s.activeAtHandler(rr, httptest.NewRequest(tt.method, tt.url, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+// publishedCounter fakes the count aggregation by counting publish times in each bucket
+func publishedCounter(published []time.Time) func(ctx context.Context, edges []time.Time) ([]int64, error) {
+	return func(ctx context.Context, edges []time.Time) ([]int64, error) {
+		counts := make([]int64, len(edges)-1)
+		for _, p := range published {
+			for i := range counts {
+				if !p.Before(edges[i]) && p.Before(edges[i+1]) {
+					counts[i]++
+				}
+			}
+		}
+		return counts, nil
+	}
+}
+
+// TestTimeSeriesHandlerDaily tests daily bucket counts across a multi-day range in Canberra time
+func TestTimeSeriesHandlerDaily(t *testing.T) {
+	loc, _ := time.LoadLocation("Australia/Canberra")
+	published := []time.Time{
+		time.Date(2024, 1, 14, 23, 59, 0, 0, loc), // before the range
+		time.Date(2024, 1, 15, 0, 0, 0, 0, loc),
+		time.Date(2024, 1, 15, 13, 0, 0, 0, time.UTC), // 00:00 on the 16th in Canberra
+		time.Date(2024, 1, 16, 9, 30, 0, 0, loc),
+		time.Date(2024, 1, 17, 23, 59, 59, 0, loc),
+		time.Date(2024, 1, 18, 0, 0, 0, 0, loc), // after the range
+	}
+	s := &server{firestoreClient: &storage.MockAlertStore{CountPoliceAlertsPublishedFunc: publishedCounter(published)}}
+
+	rr := httptest.NewRecorder()
+	s.timeSeriesHandler(rr, httptest.NewRequest("GET", "/api/timeseries?start=2024-01-15&end=2024-01-17&interval=day", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var resp models.TimeSeriesResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Interval != "day" {
+		t.Errorf("expected interval day, got %q", resp.Interval)
+	}
+	want := []int64{1, 2, 1}
+	if len(resp.Buckets) != len(want) {
+		t.Fatalf("expected %d buckets, got %d", len(want), len(resp.Buckets))
+	}
+	for i, bucket := range resp.Buckets {
+		wantStart := time.Date(2024, 1, 15+i, 0, 0, 0, 0, loc)
+		if !bucket.Start.Equal(wantStart) || bucket.Count != want[i] {
+			t.Errorf("bucket %d: expected %d at %s, got %d at %s", i, want[i], wantStart, bucket.Count, bucket.Start)
+		}
+	}
+}
+
+// TestTimeSeriesHandlerHourly tests hourly buckets, including the 25-hour day when daylight saving ends
+func TestTimeSeriesHandlerHourly(t *testing.T) {
+	loc, _ := time.LoadLocation("Australia/Canberra")
+	published := []time.Time{
+		time.Date(2024, 4, 6, 0, 15, 0, 0, loc),
+		time.Date(2024, 4, 6, 0, 45, 0, 0, loc),
+		time.Date(2024, 4, 7, 23, 30, 0, 0, loc),
+	}
+	mockStore := &storage.MockAlertStore{CountPoliceAlertsPublishedFunc: publishedCounter(published)}
+	s := &server{firestoreClient: mockStore}
+
+	rr := httptest.NewRecorder()
+	s.timeSeriesHandler(rr, httptest.NewRequest("GET", "/api/timeseries?start=2024-04-06&end=2024-04-07&interval=hour", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var resp models.TimeSeriesResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Buckets) != 24+25 {
+		t.Fatalf("expected 49 hourly buckets, got %d", len(resp.Buckets))
+	}
+	var total int64
+	for _, bucket := range resp.Buckets {
+		total += bucket.Count
+	}
+	if resp.Buckets[0].Count != 2 || resp.Buckets[len(resp.Buckets)-1].Count != 1 || total != 3 {
+		t.Errorf("expected 2 alerts in the first hour and 1 in the last, got %d and %d (total %d)",
+			resp.Buckets[0].Count, resp.Buckets[len(resp.Buckets)-1].Count, total)
+	}
+	if mockStore.CallLog.CountPoliceAlertsPublishedCalls != 1 {
+		t.Errorf("expected a single count call, got %d", mockStore.CallLog.CountPoliceAlertsPublishedCalls)
+	}
+}
+
+// TestTimeSeriesHandlerValidation tests parameter validation and store errors
+func TestTimeSeriesHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		storeErr       error
+		expectedStatus int
+	}{
+		{"POST not allowed", "POST", "/api/timeseries?start=2024-01-15&end=2024-01-16", nil, http.StatusMethodNotAllowed},
+		{"missing start", "GET", "/api/timeseries?end=2024-01-16", nil, http.StatusBadRequest},
+		{"invalid end", "GET", "/api/timeseries?start=2024-01-15&end=tomorrow", nil, http.StatusBadRequest},
+		{"end before start", "GET", "/api/timeseries?start=2024-01-16&end=2024-01-15", nil, http.StatusBadRequest},
+		{"invalid interval", "GET", "/api/timeseries?start=2024-01-15&end=2024-01-16&interval=week", nil, http.StatusBadRequest},
+		{"too many buckets", "GET", "/api/timeseries?start=2024-01-01&end=2024-01-31&interval=hour", nil, http.StatusBadRequest},
+		{"single day", "GET", "/api/timeseries?start=2024-01-15&end=2024-01-15", nil, http.StatusOK},
+		{"store error", "GET", "/api/timeseries?start=2024-01-15&end=2024-01-16", errors.New("firestore down"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := &storage.MockAlertStore{
+				CountPoliceAlertsPublishedFunc: func(ctx context.Context, edges []time.Time) ([]int64, error) {
+					if tt.storeErr != nil {
+						return nil, tt.storeErr
+					}
+					return make([]int64, len(edges)-1), nil
+				},
+			}
+			s := &server{firestoreClient: mockStore}
+
+			rr := httptest.NewRecorder()
+			s.timeSeriesHandler(rr, httptest.NewRequest(tt.method, tt.url, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+// =============================================================================
+// Date Layout Tests
+// =============================================================================
+
+// TestParseDateLayouts tests alternate date layouts normalize to the canonical date
+func TestParseDateLayouts(t *testing.T) {
+	s := &server{dateLayouts: []string{"2006/01/02", "02-01-2006"}}
+	strict := &server{}
+
+	tests := []struct {
+		input      string
+		want       string
+		wantStrict bool // also accepted without alternate layouts
+	}{
+		{"2024-01-15", "2024-01-15", true},
+		{"2024/01/15", "2024-01-15", false},
+		{"15-01-2024", "2024-01-15", false},
+	}
+	for _, tt := range tests {
+		date, err := s.parseDate(tt.input, time.UTC)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.input, err)
+			continue
+		}
+		if got := date.Format("2006-01-02"); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.want, got)
+		}
+		if _, err := strict.parseDate(tt.input, time.UTC); (err == nil) != tt.wantStrict {
+			t.Errorf("%s: strict parsing accepted=%v, want %v", tt.input, err == nil, tt.wantStrict)
+		}
+	}
+
+	for _, invalid := range []string{"2024/13/45", "31-02-2024", "15.01.2024", "yesterday", ""} {
+		if _, err := s.parseDate(invalid, time.UTC); err == nil {
+			t.Errorf("%q: expected error", invalid)
+		}
+	}
+}
+
+// TestAlertsHandlerAlternateDateLayout tests that alternate layouts read the canonical archive
+func TestAlertsHandlerAlternateDateLayout(t *testing.T) {
+	archived := `{"UUID":"a1"}` + "\n"
+	s := &server{
+		firestoreClient: &storage.MockAlertStore{},
+		storageClient:   mockGCSWithArchives(map[string]string{"2024-01-15.jsonl": archived}),
+		bucketName:      "test-bucket",
+		dateLayouts:     []string{"2006/01/02"},
+	}
+
+	rr := httptest.NewRecorder()
+	s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024/01/15", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != archived {
+		t.Errorf("expected archived data with status 200, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024/02/30", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for invalid date, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+// TestHeatmapHandlerNormalizesDates tests that heatmap dates reach the store as YYYY-MM-DD
+func TestHeatmapHandlerNormalizesDates(t *testing.T) {
+	var gotDates []string
+	s := &server{
+		firestoreClient: &storage.MockAlertStore{
+			GetStreetHeatmapFunc: func(ctx context.Context, dates []string) ([]models.StreetCount, error) {
+				gotDates = dates
+				return nil, nil
+			},
+		},
+		dateLayouts: []string{"02-01-2006"},
+	}
+
+	rr := httptest.NewRecorder()
+	s.heatmapHandler(rr, httptest.NewRequest("POST", "/api/heatmap", strings.NewReader(`{"dates":["15-01-2024","2024-01-16"]}`)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if strings.Join(gotDates, ",") != "2024-01-15,2024-01-16" {
+		t.Errorf("expected normalized dates, got %v", gotDates)
+	}
+}
+
+// =============================================================================
+// Archive Read Coalescing Tests
+// =============================================================================
+
+// TestAlertsHandlerCoalescesConcurrentReads tests that concurrent requests for the
+// same archived date share a single GCS read
+func TestAlertsHandlerCoalescesConcurrentReads(t *testing.T) {
+	const numRequests = 10
+	archive := `{"UUID":"a1"}` + "\n\n" + `{"UUID":"a2"}` + "\r\n"
+	expected := `{"UUID":"a1"}` + "\n" + `{"UUID":"a2"}` + "\n"
+
+	var reads atomic.Int64
+	started := make(chan struct{}, numRequests)
+	release := make(chan struct{})
+	gcsClient := &storage.MockGCSClient{
+		BucketFunc: func(name string) storage.GCSBucketHandle {
+			return &storage.MockGCSBucketHandle{
+				ObjectFunc: func(objName string) storage.GCSObjectHandle {
+					return &storage.MockGCSObjectHandle{
+						NewReaderFunc: func(ctx context.Context) (io.ReadCloser, error) {
+							reads.Add(1)
+							started <- struct{}{}
+							<-release
+							return io.NopCloser(strings.NewReader(archive)), nil
+						},
+					}
+				},
+			}
+		},
+	}
+
+	s := &server{
+		firestoreClient: &storage.MockAlertStore{},
+		storageClient:   gcsClient,
+		bucketName:      "test-bucket",
+		archiveReads:    &singleflight.Group{},
+	}
+
+	bodies := make([]string, numRequests)
+	var wg sync.WaitGroup
+	for i := 0; i < numRequests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rr := httptest.NewRecorder()
+			s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024-01-15", nil))
+			bodies[i] = rr.Body.String()
+		}(i)
+	}
+
+	// Hold the first read open until the other requests have joined it
+	<-started
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := reads.Load(); got != 1 {
+		t.Errorf("expected 1 GCS read for %d concurrent requests, got %d", numRequests, got)
+	}
+	for i, body := range bodies {
+		if body != expected {
+			t.Errorf("request %d: expected %q, got %q", i, expected, body)
+		}
+	}
+}
+
+// TestAlertsHandlerCoalescedMissingArchive tests that coalesced reads still fall back to Firestore
+func TestAlertsHandlerCoalescedMissingArchive(t *testing.T) {
+	s := &server{
+		firestoreClient: &storage.MockAlertStore{
+			GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+				return []models.PoliceAlert{{UUID: "live-1"}}, nil
+			},
+		},
+		storageClient: mockGCSWithArchives(nil),
+		bucketName:    "test-bucket",
+		archiveReads:  &singleflight.Group{},
+	}
+
+	rr := httptest.NewRecorder()
+	s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024-01-15", nil))
+
+	if !strings.Contains(rr.Body.String(), `"uuid":"live-1"`) {
+		t.Errorf("expected Firestore fallback data, got %q", rr.Body.String())
+	}
+}
+
+// =============================================================================
+// Pooled Gzip Writer Tests
+// =============================================================================
+
+// gunzipBody decompresses a recorded response body
+func gunzipBody(t *testing.T, rr *httptest.ResponseRecorder) string {
+	t.Helper()
+	reader, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatalf("failed to create gzip reader: %v", err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to read gzip body: %v", err)
+	}
+	return string(data)
+}
+
+// TestPooledGzipMiddlewareConcurrentStreams tests that pooled writers keep concurrent
+// streamed responses separate and intact across flushes
+func TestPooledGzipMiddlewareConcurrentStreams(t *testing.T) {
+	pool := newGzipWriterPool()
+	handler := gzipMiddlewareWithPool(pool, func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("id")
+		dataChan := make(chan []byte)
+		go func() {
+			for i := 0; i < 50; i++ {
+				dataChan <- []byte(fmt.Sprintf(`{"req":%s,"line":%d}`+"\n", id, i))
+			}
+			close(dataChan)
+		}()
+		writeStream(w, w.(http.Flusher), dataChan, 64, time.Hour)
+	})
+
+	for round := 0; round < 3; round++ {
+		recorders := make([]*httptest.ResponseRecorder, 8)
+		var wg sync.WaitGroup
+		for id := range recorders {
+			wg.Add(1)
+			go func(id int) {
+				defer wg.Done()
+				req := httptest.NewRequest("GET", fmt.Sprintf("/police_alerts?id=%d", id), nil)
+				req.Header.Set("Accept-Encoding", "gzip")
+				recorders[id] = httptest.NewRecorder()
+				handler(recorders[id], req)
+			}(id)
+		}
+		wg.Wait()
+
+		for id, rr := range recorders {
+			var expected strings.Builder
+			for i := 0; i < 50; i++ {
+				fmt.Fprintf(&expected, `{"req":%d,"line":%d}`+"\n", id, i)
+			}
+			if got := gunzipBody(t, rr); got != expected.String() {
+				t.Errorf("round %d request %d: response corrupted or mixed with another request", round, id)
+			}
+		}
+	}
+}
+
+// TestPooledGzipMiddlewareReturnsWriters tests that writers go back to the pool,
+// including when the handler panics
+func TestPooledGzipMiddlewareReturnsWriters(t *testing.T) {
+	// Disable GC so the pool cannot drop idle writers during the test
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+
+	var created atomic.Int64
+	pool := newGzipWriterPool()
+	newWriter := pool.New
+	pool.New = func() interface{} {
+		created.Add(1)
+		return newWriter()
+	}
+
+	ok := gzipMiddlewareWithPool(pool, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	})
+	panics := gzipMiddlewareWithPool(pool, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+		panic("handler failed")
+	})
+
+	request := func(h http.HandlerFunc) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rr := httptest.NewRecorder()
+		func() {
+			defer func() { _ = recover() }()
+			h(rr, req)
+		}()
+		return rr
+	}
+
+	if got := gunzipBody(t, request(ok)); got != "hello" {
+		t.Errorf("expected %q, got %q", "hello", got)
+	}
+	request(panics)
+	if got := gunzipBody(t, request(ok)); got != "hello" {
+		t.Errorf("expected %q after a panicking request, got %q", "hello", got)
+	}
+
+	if got := created.Load(); got != 1 {
+		t.Errorf("expected a single pooled writer to be reused, got %d created", got)
+	}
+}
+
+func benchmarkGzipMiddleware(b *testing.B, handler http.HandlerFunc) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			handler(httptest.NewRecorder(), req)
+		}
+	})
+}
+
+func BenchmarkGzipMiddleware(b *testing.B) {
+	body := []byte(strings.Repeat(`{"UUID":"abc","Type":"POLICE"}`+"\n", 100))
+	benchmarkGzipMiddleware(b, gzipMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(body)
+	}))
+}
+
+func BenchmarkGzipMiddlewarePooled(b *testing.B) {
+	body := []byte(strings.Repeat(`{"UUID":"abc","Type":"POLICE"}`+"\n", 100))
+	benchmarkGzipMiddleware(b, gzipMiddlewareWithPool(newGzipWriterPool(), func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(body)
+	}))
+}
+
+// =============================================================================
+// Admin Stats Tests
+// =============================================================================
+
+// TestCollectionStatsHandler tests that the stats endpoint reports the store's numbers
+func TestCollectionStatsHandler(t *testing.T) {
+	s := &server{
+		firestoreClient: &storage.MockAlertStore{
+			GetCollectionStatsFunc: func(ctx context.Context) (models.CollectionStats, error) {
+				return models.CollectionStats{
+					Collection:       "police_alerts",
+					DocumentCount:    48213,
+					SampledDocuments: 100,
+					AvgDocumentBytes: 2100,
+					EstimatedBytes:   101247300,
+				}, nil
+			},
+		},
+	}
+
+	rr := httptest.NewRecorder()
+	s.collectionStatsHandler(rr, httptest.NewRequest("GET", "/admin/stats", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var stats models.CollectionStats
+	if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if stats.DocumentCount != 48213 || stats.EstimatedBytes != 101247300 || stats.AvgDocumentBytes != 2100 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	s.firestoreClient = &storage.MockAlertStore{
+		GetCollectionStatsFunc: func(ctx context.Context) (models.CollectionStats, error) {
+			return models.CollectionStats{}, errors.New("aggregation failed")
+		},
+	}
+	rr = httptest.NewRecorder()
+	s.collectionStatsHandler(rr, httptest.NewRequest("GET", "/admin/stats", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d on store error, got %d", http.StatusInternalServerError, rr.Code)
+	}
+}
+
+// TestAdminMiddleware tests that only configured admin UIDs reach admin handlers
+func TestAdminMiddleware(t *testing.T) {
+	s := &server{adminUIDs: map[string]bool{"admin-uid": true}}
+	handler := s.adminMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		uid            string
+		expectedStatus int
+	}{
+		{"admin allowed", "admin-uid", http.StatusOK},
+		{"other user forbidden", "anonymous-uid", http.StatusForbidden},
+		{"no user forbidden", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/admin/stats", nil)
+			if tt.uid != "" {
+				req = req.WithContext(context.WithValue(req.Context(), uidContextKey, tt.uid))
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+// TestAlertsHandlerWorkersParam tests that ?workers= overrides the worker count, clamped to 1..maxWorkers
+func TestAlertsHandlerWorkersParam(t *testing.T) {
+	mockGCS := &storage.MockGCSClient{
+		BucketFunc: func(name string) storage.GCSBucketHandle {
+			return &storage.MockGCSBucketHandle{
+				ObjectFunc: func(objName string) storage.GCSObjectHandle {
+					return &storage.MockGCSObjectHandle{
+						NewReaderFunc: func(ctx context.Context) (io.ReadCloser, error) {
+							return io.NopCloser(strings.NewReader(`{"uuid":"` + objName + `"}` + "\n")), nil
+						},
+					}
+				},
+			}
+		},
+	}
+
+	tests := []struct {
+		name        string
+		query       string
+		wantStatus  int
+		wantWorkers string
+	}{
+		{"default", "", http.StatusOK, "7"},
+		{"valid", "&workers=3", http.StatusOK, "3"},
+		{"zero clamps to one", "&workers=0", http.StatusOK, "1"},
+		{"over max clamps to max", "&workers=100", http.StatusOK, "10"},
+		{"not a number", "&workers=many", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &server{
+				firestoreClient: &storage.MockAlertStore{},
+				storageClient:   mockGCS,
+				bucketName:      "test-bucket",
+				maxWorkers:      10,
+			}
+
+			req := httptest.NewRequest("GET", "/police_alerts?dates=2024-01-01,2024-01-02,2024-01-03"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			s.alertsHandler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := rr.Header().Get("X-Workers"); got != tt.wantWorkers {
+				t.Errorf("expected X-Workers %q, got %q", tt.wantWorkers, got)
+			}
+			if lines := strings.Count(rr.Body.String(), "\n"); lines != 3 {
+				t.Errorf("expected 3 lines for 3 dates, got %d", lines)
+			}
+		})
+	}
+}
+
+// TestRequestWorkersDefaultMax tests that an unset maxWorkers falls back to defaultMaxWorkers
+func TestRequestWorkersDefaultMax(t *testing.T) {
+	s := &server{}
+	if n, ok := s.requestWorkers("1000"); !ok || n != defaultMaxWorkers {
+		t.Errorf("expected %d, got %d (ok=%v)", defaultMaxWorkers, n, ok)
+	}
+	s.maxWorkers = 4
+	if n, _ := s.requestWorkers(""); n != 4 {
+		t.Errorf("expected default capped at maxWorkers 4, got %d", n)
+	}
+}
+
+// newStaleArchiveTestServer returns a server with stale archive serving whose GCS
+// reads fail while *gcsDown is true
+func newStaleArchiveTestServer(gcsDown *bool, now *time.Time) *server {
+	mockGCS := &storage.MockGCSClient{
+		BucketFunc: func(name string) storage.GCSBucketHandle {
+			return &storage.MockGCSBucketHandle{
+				ObjectFunc: func(objName string) storage.GCSObjectHandle {
+					return &storage.MockGCSObjectHandle{
+						NewReaderFunc: func(ctx context.Context) (io.ReadCloser, error) {
+							if *gcsDown {
+								return nil, errors.New("gcs: service unavailable")
+							}
+							return io.NopCloser(strings.NewReader(`{"uuid":"cached-1"}` + "\n" + `{"uuid":"cached-2"}` + "\n")), nil
+						},
+					}
+				},
+			}
+		},
+	}
+	return &server{
+		firestoreClient: &storage.MockAlertStore{},
+		storageClient:   mockGCS,
+		bucketName:      "test-bucket",
+		now:             func() time.Time { return *now },
+		staleArchives:   newArchiveCache(time.Hour, defaultStaleArchiveEntries),
+	}
+}
+
+// TestAlertsHandlerServesStaleArchiveOnGCSError tests that a cached archive is served with a Warning when GCS fails
+func TestAlertsHandlerServesStaleArchiveOnGCSError(t *testing.T) {
+	gcsDown := false
+	now := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	s := newStaleArchiveTestServer(&gcsDown, &now)
+
+	rr := httptest.NewRecorder()
+	s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024-01-01", nil))
+	fresh := rr.Body.String()
+	if rr.Code != http.StatusOK || strings.Count(fresh, "\n") != 2 {
+		t.Fatalf("expected 2 fresh lines, got %d: %q", rr.Code, fresh)
+	}
+	if w := rr.Result().Trailer.Get("Warning"); w != "" {
+		t.Errorf("expected no Warning on a fresh read, got %q", w)
+	}
+
+	gcsDown = true
+	now = now.Add(30 * time.Minute)
+	rr = httptest.NewRecorder()
+	s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024-01-01", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if rr.Body.String() != fresh {
+		t.Errorf("expected cached bytes %q, got %q", fresh, rr.Body.String())
+	}
+	trailer := rr.Result().Trailer
+	if got := trailer.Get("Warning"); got != staleWarning {
+		t.Errorf("expected Warning %q, got %q", staleWarning, got)
+	}
+	if got := trailer.Get("X-Date-Status"); got != "2024-01-01=stale" {
+		t.Errorf("expected stale date status, got %q", got)
+	}
+}
+
+// TestAlertsHandlerStaleArchiveExpired tests that cached archives older than the max age are not served
+func TestAlertsHandlerStaleArchiveExpired(t *testing.T) {
+	gcsDown := false
+	now := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	s := newStaleArchiveTestServer(&gcsDown, &now)
+
+	s.alertsHandler(httptest.NewRecorder(), httptest.NewRequest("GET", "/police_alerts?dates=2024-01-01", nil))
+
+	gcsDown = true
+	now = now.Add(2 * time.Hour)
+	rr := httptest.NewRecorder()
+	s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024-01-01", nil))
+
+	if rr.Body.Len() != 0 {
+		t.Errorf("expected no data from an expired cache, got %q", rr.Body.String())
+	}
+	trailer := rr.Result().Trailer
+	if got := trailer.Get("Warning"); got != "" {
+		t.Errorf("expected no Warning, got %q", got)
+	}
+	if got := trailer.Get("X-Date-Status"); got != "2024-01-01=error" {
+		t.Errorf("expected error date status, got %q", got)
+	}
+}
+
+// TestArchiveCacheEvictsOldest tests that a full cache drops the least recently read archive
+func TestArchiveCacheEvictsOldest(t *testing.T) {
+	c := newArchiveCache(time.Hour, 2)
+	base := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	c.put("a.jsonl", [][]byte{[]byte("a")}, base)
+	c.put("b.jsonl", [][]byte{[]byte("b")}, base.Add(time.Minute))
+	c.put("a.jsonl", [][]byte{[]byte("a2")}, base.Add(2*time.Minute))
+	c.put("c.jsonl", [][]byte{[]byte("c")}, base.Add(3*time.Minute))
+
+	now := base.Add(4 * time.Minute)
+	if _, ok := c.get("b.jsonl", now); ok {
+		t.Error("expected b.jsonl to be evicted")
+	}
+	if lines, ok := c.get("a.jsonl", now); !ok || string(lines[0]) != "a2" {
+		t.Errorf("expected refreshed a.jsonl to be kept, got %q (ok=%v)", lines, ok)
+	}
+	if _, ok := c.get("c.jsonl", now); !ok {
+		t.Error("expected c.jsonl to be cached")
+	}
+}
+
+// TestAlertsHandlerGeoJSONSeq tests RFC 8142 output: RS-framed GeoJSON features, skipping alerts without a location
+func TestAlertsHandlerGeoJSONSeq(t *testing.T) {
+	var archive strings.Builder
+	for _, alert := range []models.PoliceAlert{
+		{UUID: "located", Type: "POLICE", Subtype: "POLICE_HIDING", Street: "Hume Hwy", LocationGeo: &latlng.LatLng{Latitude: -35.28, Longitude: 149.13}},
+		{UUID: "no-location", Type: "POLICE"},
+		{UUID: "located-2", Type: "POLICE", LocationGeo: &latlng.LatLng{Latitude: -34.5, Longitude: 150.1}},
+	} {
+		data, err := json.Marshal(alert)
+		if err != nil {
+			t.Fatalf("failed to marshal alert: %v", err)
+		}
+		archive.Write(append(data, '\n'))
+	}
+
+	mockGCS := &storage.MockGCSClient{
+		BucketFunc: func(name string) storage.GCSBucketHandle {
+			return &storage.MockGCSBucketHandle{
+				ObjectFunc: func(objName string) storage.GCSObjectHandle {
+					return &storage.MockGCSObjectHandle{
+						NewReaderFunc: func(ctx context.Context) (io.ReadCloser, error) {
+							return io.NopCloser(strings.NewReader(archive.String())), nil
+						},
+					}
+				},
+			}
+		},
+	}
+	s := &server{
+		firestoreClient: &storage.MockAlertStore{},
+		storageClient:   mockGCS,
+		bucketName:      "test-bucket",
+	}
+
+	rr := httptest.NewRecorder()
+	s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024-01-01&format=geojsonseq", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/geo+json-seq" {
+		t.Errorf("expected geo+json-seq content type, got %q", ct)
+	}
+
+	body := rr.Body.String()
+	if !strings.HasPrefix(body, "\x1e") || !strings.HasSuffix(body, "\n") {
+		t.Fatalf("expected records framed by RS and LF, got %q", body)
+	}
+	records := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records (no-location skipped), got %d: %q", len(records), body)
+	}
+	for i, record := range records {
+		if !strings.HasPrefix(record, "\x1e") {
+			t.Fatalf("record %d missing RS prefix: %q", i, record)
+		}
+		var feature models.GeoJSONFeature
+		if err := json.Unmarshal([]byte(record[1:]), &feature); err != nil {
+			t.Fatalf("record %d is not valid JSON: %v", i, err)
+		}
+		if feature.Type != "Feature" || feature.Geometry.Type != "Point" {
+			t.Errorf("record %d is not a Point feature: %+v", i, feature)
+		}
+		if i == 0 {
+			if feature.Geometry.Coordinates != [2]float64{149.13, -35.28} {
+				t.Errorf("expected [lng, lat] coordinates, got %v", feature.Geometry.Coordinates)
+			}
+			if feature.Properties["uuid"] != "located" || feature.Properties["street"] != "Hume Hwy" {
+				t.Errorf("unexpected properties %v", feature.Properties)
+			}
+		}
+	}
+}
+
+// TestTruncateRunes tests that long fields are cut on rune boundaries with an indicator
+func TestTruncateRunes(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		max      int
+		expected string
+	}{
+		{"short unchanged", "Hume Hwy", 10, "Hume Hwy"},
+		{"exact length unchanged", "Ομόνοια", 7, "Ομόνοια"},
+		{"disabled", "Friedrichstraße", 0, "Friedrichstraße"},
+		{"ascii", "Northbourne Avenue", 8, "Northbo…"},
+		{"german", "Friedrichstraße", 14, "Friedrichstra…"},
+		{"chinese", "王府井大街", 4, "王府井…"},
+		{"arabic rtl", "شارع الشانزليزيه", 5, "شارع…"},
+		{"emoji at cut", "Calle ñoño 🚔 Norte", 13, "Calle ñoño 🚔…"},
+		{"cut before emoji", "Calle ñoño 🚔", 11, "Calle ñoño…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateRunes(tt.input, tt.max)
+			if got != tt.expected {
+				t.Errorf("truncateRunes(%q, %d) = %q, want %q", tt.input, tt.max, got, tt.expected)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("truncateRunes(%q, %d) produced invalid UTF-8 %q", tt.input, tt.max, got)
+			}
+			if tt.max >= 2 && utf8.RuneCountInString(got) > tt.max {
+				t.Errorf("truncateRunes(%q, %d) kept %d characters", tt.input, tt.max, utf8.RuneCountInString(got))
+			}
+		})
+	}
+}
+
+// TestGeoJSONSeqRecordUnicode tests that unicode streets survive GeoJSON
+// encoding intact, and are truncated safely when a limit is set
+func TestGeoJSONSeqRecordUnicode(t *testing.T) {
+	streets := []string{
+		"王府井大街",
+		"شارع الشانزليزيه",
+		"Calle ñoño 🚔",
+		"മഹാത്മാഗാന്ധി Road",
+		`Quote "and" comma, street`,
+	}
+
+	for _, maxRunes := range []int{0, 6} {
+		s := &server{geoJSONMaxFieldRunes: maxRunes}
+		for _, street := range streets {
+			line, err := json.Marshal(models.PoliceAlert{
+				UUID:        "u1",
+				Street:      street,
+				City:        street,
+				LocationGeo: &latlng.LatLng{Latitude: -35.28, Longitude: 149.13},
+			})
+			if err != nil {
+				t.Fatalf("failed to marshal alert: %v", err)
+			}
+
+			record, ok := s.geoJSONSeqRecord(line)
+			if !ok {
+				t.Fatalf("expected a record for %q", street)
+			}
+			if !utf8.Valid(record) {
+				t.Errorf("record for %q is not valid UTF-8", street)
+			}
+			var feature models.GeoJSONFeature
+			if err := json.Unmarshal(record[1:], &feature); err != nil {
+				t.Fatalf("record for %q is not valid JSON: %v", street, err)
+			}
+
+			expected := truncateRunes(street, maxRunes)
+			if maxRunes == 0 && expected != street {
+				t.Fatalf("expected no truncation without a limit")
+			}
+			if feature.Properties["street"] != expected || feature.Properties["city"] != expected {
+				t.Errorf("max %d: expected street and city %q, got %v", maxRunes, expected, feature.Properties)
+			}
+		}
+	}
+}
+
+// TestAlertsHandlerInvalidFormat tests that an unknown format is rejected
+func TestAlertsHandlerInvalidFormat(t *testing.T) {
+	s := &server{}
+	rr := httptest.NewRecorder()
+	s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024-01-01&format=kml", nil))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+// TestHumanDuration tests formatting of ActiveMillis with the two largest units
+func TestHumanDuration(t *testing.T) {
+	tests := []struct {
+		ms   int64
+		want string
+	}{
+		{0, "0s"},
+		{-5000, "0s"},
+		{999, "0s"},
+		{45 * 1000, "45s"},
+		{90 * 1000, "1m 30s"},
+		{15 * 60 * 1000, "15m"},
+		{(2*60 + 15) * 60 * 1000, "2h 15m"},
+		{2 * 60 * 60 * 1000, "2h"},
+		{(24 + 3) * 60 * 60 * 1000, "1d 3h"},
+		{(3*24*60 + 4*60 + 59) * 60 * 1000, "3d 4h"},
+		{10 * 24 * 60 * 60 * 1000, "10d"},
+	}
+
+	for _, tt := range tests {
+		if got := humanDuration(tt.ms); got != tt.want {
+			t.Errorf("humanDuration(%d) = %q, want %q", tt.ms, got, tt.want)
+		}
+	}
+}
+
+// TestAlertsHandlerDurationHuman tests that duration_human is added to streamed alerts only when enabled
+func TestAlertsHandlerDurationHuman(t *testing.T) {
+	archive := `{"UUID":"a1","ActiveMillis":8100000}` + "\n" + `{"UUID":"a2","ActiveMillis":0}` + "\n"
+	mockGCS := &storage.MockGCSClient{
+		BucketFunc: func(name string) storage.GCSBucketHandle {
+			return &storage.MockGCSBucketHandle{
+				ObjectFunc: func(objName string) storage.GCSObjectHandle {
+					return &storage.MockGCSObjectHandle{
+						NewReaderFunc: func(ctx context.Context) (io.ReadCloser, error) {
+							return io.NopCloser(strings.NewReader(archive)), nil
+						},
+					}
+				},
+			}
+		},
+	}
+
+	for _, enabled := range []bool{false, true} {
+		s := &server{
+			firestoreClient: &storage.MockAlertStore{},
+			storageClient:   mockGCS,
+			bucketName:      "test-bucket",
+			durationHuman:   enabled,
+		}
+		rr := httptest.NewRecorder()
+		s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024-01-01", nil))
+
+		if !enabled {
+			if rr.Body.String() != archive {
+				t.Errorf("expected archive lines unchanged when disabled, got %q", rr.Body.String())
+			}
+			continue
+		}
+		want := `{"UUID":"a1","ActiveMillis":8100000,"duration_human":"2h 15m"}` + "\n" +
+			`{"UUID":"a2","ActiveMillis":0,"duration_human":"0s"}` + "\n"
+		if rr.Body.String() != want {
+			t.Errorf("expected duration_human on each line:\n got %q\nwant %q", rr.Body.String(), want)
+		}
+	}
+}
+
+// TestSyncHandlerDurationHuman tests that /api/sync alerts carry duration_human when enabled
+func TestSyncHandlerDurationHuman(t *testing.T) {
+	mockStore := &storage.MockAlertStore{
+		GetPoliceAlertsUpdatedSinceFunc: func(ctx context.Context, since time.Time, limit int) ([]models.PoliceAlert, time.Time, error) {
+			return []models.PoliceAlert{{UUID: "a1", ActiveMillis: 3 * 24 * 60 * 60 * 1000}}, since, nil
+		},
+	}
+
+	for _, enabled := range []bool{false, true} {
+		s := &server{firestoreClient: mockStore, durationHuman: enabled}
+		rr := httptest.NewRecorder()
+		s.syncHandler(rr, httptest.NewRequest("GET", "/api/sync", nil))
+
+		hasField := strings.Contains(rr.Body.String(), `"duration_human":"3d"`)
+		if hasField != enabled {
+			t.Errorf("enabled=%v: unexpected body %s", enabled, rr.Body.String())
+		}
+	}
+}
+
+// TestSecondsSinceLastSeen tests that seconds_since_last_seen is the time since
+// ExpireTime for a recently seen and a long-stale alert, in streamed and
+// /api/sync responses, only when enabled
+func TestSecondsSinceLastSeen(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	recent := models.PoliceAlert{UUID: "recent", ExpireTime: now.Add(-90 * time.Second)}
+	stale := models.PoliceAlert{UUID: "stale", ExpireTime: now.Add(-26 * time.Hour)}
+	want := map[string]int64{"recent": 90, "stale": 26 * 60 * 60}
+
+	var archive strings.Builder
+	for _, alert := range []models.PoliceAlert{recent, stale} {
+		line, _ := json.Marshal(alert)
+		archive.Write(line)
+		archive.WriteByte('\n')
+	}
+	mockStore := &storage.MockAlertStore{
+		GetPoliceAlertsUpdatedSinceFunc: func(ctx context.Context, since time.Time, limit int) ([]models.PoliceAlert, time.Time, error) {
+			return []models.PoliceAlert{recent, stale}, since, nil
+		},
+	}
+
+	for _, enabled := range []bool{false, true} {
+		s := &server{
+			firestoreClient: mockStore,
+			storageClient:   mockGCSWithArchives(map[string]string{"2024-01-14.jsonl": archive.String()}),
+			bucketName:      "test-bucket",
+			now:             func() time.Time { return now },
+			sinceLastSeen:   enabled,
+		}
+
+		rr := httptest.NewRecorder()
+		s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024-01-14", nil))
+		var streamed []models.PoliceAlert
+		for _, line := range strings.Split(strings.TrimSpace(rr.Body.String()), "\n") {
+			var alert models.PoliceAlert
+			if err := json.Unmarshal([]byte(line), &alert); err != nil {
+				t.Fatalf("failed to decode streamed line %q: %v", line, err)
+			}
+			streamed = append(streamed, alert)
+		}
+
+		rr = httptest.NewRecorder()
+		s.syncHandler(rr, httptest.NewRequest("GET", "/api/sync", nil))
+		var synced models.SyncResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &synced); err != nil {
+			t.Fatalf("failed to decode sync response: %v", err)
+		}
+
+		for source, alerts := range map[string][]models.PoliceAlert{"stream": streamed, "sync": synced.Alerts} {
+			if len(alerts) != 2 {
+				t.Fatalf("%s: expected 2 alerts, got %d", source, len(alerts))
+			}
+			for _, alert := range alerts {
+				switch {
+				case !enabled && alert.SecondsSinceLastSeen != nil:
+					t.Errorf("%s: expected no seconds_since_last_seen on %s when disabled", source, alert.UUID)
+				case enabled && alert.SecondsSinceLastSeen == nil:
+					t.Errorf("%s: expected seconds_since_last_seen on %s", source, alert.UUID)
+				case enabled && *alert.SecondsSinceLastSeen != want[alert.UUID]:
+					t.Errorf("%s: expected %d seconds since %s was last seen, got %d", source, want[alert.UUID], alert.UUID, *alert.SecondsSinceLastSeen)
+				}
+			}
+		}
+	}
+}
+
+// heavyAlert is an alert with every lifecycle and raw data field set, for view tests
+func heavyAlert() models.PoliceAlert {
+	verified := int64(1705312800000)
+	return models.PoliceAlert{
+		UUID:                   "a1",
+		Type:                   "POLICE",
+		Subtype:                "POLICE_VISIBLE",
+		Street:                 "Hume Highway",
+		City:                   "Goulburn",
+		LocationGeo:            &latlng.LatLng{Latitude: -34.75, Longitude: 149.72},
+		Reliability:            8,
+		PublishTime:            time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC),
+		ScrapeTime:             time.Date(2024, 1, 15, 9, 1, 0, 0, time.UTC),
+		ExpireTime:             time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC),
+		ActiveMillis:           3600000,
+		LastVerificationMillis: &verified,
+		NThumbsUpInitial:       1,
+		NThumbsUpLast:          4,
+		Comments:               []models.Comment{{ReportMillis: verified, Text: "still there"}},
+		RawDataInitial:         `{"uuid":"a1"}`,
+		RawDataLast:            `{"uuid":"a1","nThumbsUp":4}`,
+	}
+}
+
+// heavyAlertFields are PoliceAlert fields left out of the summary view
+var heavyAlertFields = []string{"raw_data_initial", "raw_data_last", "comments", "n_thumbs_up_initial", "scrape_time", "last_verification_millis"}
+
+// TestAlertsHandlerSummaryView tests that view=summary omits the heavy fields
+// from streamed alerts while view=full (the default) keeps them
+func TestAlertsHandlerSummaryView(t *testing.T) {
+	line, _ := json.Marshal(heavyAlert())
+	mockGCS := &storage.MockGCSClient{
+		BucketFunc: func(name string) storage.GCSBucketHandle {
+			return &storage.MockGCSBucketHandle{
+				ObjectFunc: func(objName string) storage.GCSObjectHandle {
+					return &storage.MockGCSObjectHandle{
+						NewReaderFunc: func(ctx context.Context) (io.ReadCloser, error) {
+							return io.NopCloser(strings.NewReader(string(line) + "\n")), nil
+						},
+					}
+				},
+			}
+		},
+	}
+	s := &server{firestoreClient: &storage.MockAlertStore{}, storageClient: mockGCS, bucketName: "test-bucket"}
+
+	for _, view := range []string{"", "full", "summary"} {
+		rr := httptest.NewRecorder()
+		s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024-01-15&view="+view, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("view=%q: expected status 200, got %d", view, rr.Code)
+		}
+
+		var got map[string]interface{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatalf("view=%q: failed to decode alert: %v", view, err)
+		}
+		for _, field := range heavyAlertFields {
+			if _, ok := got[field]; ok != (view != "summary") {
+				t.Errorf("view=%q: field %s present=%v", view, field, ok)
+			}
+		}
+		for _, field := range []string{"uuid", "subtype", "location", "n_thumbs_up_last", "expire_time"} {
+			if _, ok := got[field]; !ok {
+				t.Errorf("view=%q: expected field %s", view, field)
+			}
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024-01-15&view=lean", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an unknown view, got %d", rr.Code)
+	}
+}
+
+// TestSyncHandlerSummaryView tests that /api/sync?view=summary omits the heavy fields
+func TestSyncHandlerSummaryView(t *testing.T) {
+	mockStore := &storage.MockAlertStore{
+		GetPoliceAlertsUpdatedSinceFunc: func(ctx context.Context, since time.Time, limit int) ([]models.PoliceAlert, time.Time, error) {
+			return []models.PoliceAlert{heavyAlert()}, since, nil
+		},
+	}
+	s := &server{firestoreClient: mockStore, durationHuman: true}
+
+	rr := httptest.NewRecorder()
+	s.syncHandler(rr, httptest.NewRequest("GET", "/api/sync?view=summary", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+
+	var resp struct {
+		Alerts []map[string]interface{} `json:"alerts"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Alerts) != 1 {
+		t.Fatalf("expected 1 alert, got %d", len(resp.Alerts))
+	}
+	for _, field := range heavyAlertFields {
+		if _, ok := resp.Alerts[0][field]; ok {
+			t.Errorf("expected summary view to omit %s", field)
+		}
+	}
+	if resp.Alerts[0]["n_thumbs_up_last"] != float64(4) || resp.Alerts[0]["duration_human"] != "1h" {
+		t.Errorf("unexpected summary %v", resp.Alerts[0])
+	}
+
+	rr = httptest.NewRecorder()
+	s.syncHandler(rr, httptest.NewRequest("GET", "/api/sync?view=lean", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an unknown view, got %d", rr.Code)
+	}
+}
+
+// TestAlertsHandlerServeStats tests that archive hits, Firestore fallbacks and
+// streamed alerts are counted across requests and reported at /stats
+func TestAlertsHandlerServeStats(t *testing.T) {
+	archive := `{"UUID":"archived-1"}` + "\n" + `{"UUID":"archived-2"}` + "\n"
+	mockGCS := &storage.MockGCSClient{
+		BucketFunc: func(name string) storage.GCSBucketHandle {
+			return &storage.MockGCSBucketHandle{
+				ObjectFunc: func(objName string) storage.GCSObjectHandle {
+					if objName != "2024-01-15.jsonl" {
+						return &storage.MockGCSObjectHandle{} // Not archived
+					}
+					return &storage.MockGCSObjectHandle{
+						NewReaderFunc: func(ctx context.Context) (io.ReadCloser, error) {
+							return io.NopCloser(strings.NewReader(archive)), nil
+						},
+					}
+				},
+			}
+		},
+	}
+	mockStore := &storage.MockAlertStore{
+		GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+			return []models.PoliceAlert{{UUID: "live-1"}}, nil
+		},
+	}
+	s := &server{firestoreClient: mockStore, storageClient: mockGCS, bucketName: "test-bucket"}
+
+	var wantBytes int64
+	for _, dates := range []string{"2024-01-15", "2024-01-16", "2024-01-15,2024-01-16"} {
+		rr := httptest.NewRecorder()
+		s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates="+dates, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("dates=%s: expected status 200, got %d", dates, rr.Code)
+		}
+		wantBytes += int64(rr.Body.Len())
+	}
+
+	rr := httptest.NewRecorder()
+	s.statsHandler(rr, httptest.NewRequest("GET", "/stats", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 from /stats, got %d", rr.Code)
+	}
+
+	var got models.ServeStats
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode stats: %v", err)
+	}
+	want := models.ServeStats{
+		Requests:           3,
+		ArchiveHits:        2,
+		FirestoreFallbacks: 2,
+		AlertsStreamed:     6, // 2 archived + 1 live, twice
+		BytesStreamed:      wantBytes,
+	}
+	if got != want {
+		t.Errorf("unexpected stats\n got %+v\nwant %+v", got, want)
+	}
+}
+
+// TestGzipPassthrough tests that a gzipped archive repack marked normalized is
+// served as its stored bytes to clients accepting gzip, with the preconnect
+// hints and X-Workers, decompressed to those that don't, and that plain or
+// unmarked archives and requests changing the lines go through the gzip middleware
+func TestGzipPassthrough(t *testing.T) {
+	lines := `{"UUID":"a1"}` + "\n" + `{"UUID":"a2"}` + "\n"
+	var stored bytes.Buffer
+	gz := gzip.NewWriter(&stored)
+	gz.Write([]byte(lines))
+	gz.Close()
+
+	gcs := storage.NewMemGCS()
+	gcs.Objects["2024-01-15.jsonl"] = stored.Bytes()
+	gcs.Metadata["2024-01-15.jsonl"] = map[string]string{archiveNormalizedMetadataKey: "true"}
+	gcs.Objects["2024-01-16.jsonl"] = []byte(lines)
+	gcs.Metadata["2024-01-16.jsonl"] = map[string]string{archiveNormalizedMetadataKey: "true"}
+	gcs.Objects["2024-01-17.jsonl"] = stored.Bytes()
+
+	s := &server{
+		firestoreClient: &storage.MockAlertStore{},
+		storageClient:   gcs,
+		bucketName:      "test-bucket",
+		gzipPassthrough: true,
+		// Normalized archives are passed through even with validation on
+		validateLines: true,
+	}
+	handler := preconnectMiddleware([]string{"https://tiles.example.com"}, s.gzipPassthroughMiddleware(gzipMiddleware(s.alertsHandler)))
+
+	request := func(query string, acceptGzip bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/police_alerts?"+query, nil)
+		if acceptGzip {
+			req.Header.Set("Accept-Encoding", "gzip, deflate")
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", query, rr.Code)
+		}
+		return rr
+	}
+	gunzip := func(t *testing.T, body []byte) string {
+		t.Helper()
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("response is not gzipped: %v", err)
+		}
+		out, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("failed to decompress response: %v", err)
+		}
+		return string(out)
+	}
+
+	t.Run("accepts gzip", func(t *testing.T) {
+		rr := request("dates=2024-01-15&workers=3", true)
+		if rr.Header().Get("Content-Encoding") != "gzip" {
+			t.Errorf("expected Content-Encoding gzip, got %q", rr.Header().Get("Content-Encoding"))
+		}
+		if got := rr.Header().Get("Link"); got != "<https://tiles.example.com>; rel=preconnect" {
+			t.Errorf("expected preconnect hint, got %q", got)
+		}
+		if got := rr.Header().Get("X-Workers"); got != "3" {
+			t.Errorf("expected X-Workers 3, got %q", got)
+		}
+		if !bytes.Equal(rr.Body.Bytes(), stored.Bytes()) {
+			t.Errorf("expected the stored gzip bytes to be passed through")
+		}
+		if got := gunzip(t, rr.Body.Bytes()); got != lines {
+			t.Errorf("unexpected decompressed body %q", got)
+		}
+	})
+
+	t.Run("no gzip", func(t *testing.T) {
+		rr := request("dates=2024-01-15", false)
+		if rr.Header().Get("Content-Encoding") != "" {
+			t.Errorf("expected no Content-Encoding, got %q", rr.Header().Get("Content-Encoding"))
+		}
+		if rr.Body.String() != lines {
+			t.Errorf("expected decompressed lines, got %q", rr.Body.String())
+		}
+	})
+
+	// A plain archive, an archive not marked normalized, several dates and a
+	// changed view fall back to decompressing and compressing again
+	for _, query := range []string{"dates=2024-01-16", "dates=2024-01-17", "dates=2024-01-15,2024-01-16", "dates=2024-01-15&summary=true"} {
+		t.Run(query, func(t *testing.T) {
+			rr := request(query, true)
+			if rr.Header().Get("Link") == "" {
+				t.Errorf("expected preconnect hint")
+			}
+			if bytes.Equal(rr.Body.Bytes(), stored.Bytes()) {
+				t.Errorf("expected the response not to be the stored bytes")
+			}
+			if got := gunzip(t, rr.Body.Bytes()); !strings.HasPrefix(got, `{"UUID":"a1"}`) {
+				t.Errorf("unexpected decompressed body %q", got)
+			}
+		})
+	}
+
+	// Settings that read or report on the decompressed lines turn pass-through off
+	settings := map[string]func(s *server){
+		"coalesced reads": func(s *server) { s.archiveReads = &singleflight.Group{} },
+		"stale archives":  func(s *server) { s.staleArchives = newArchiveCache(time.Hour, 10) },
+		"date status": func(s *server) {
+			s.dataStartDate = time.Date(2024, 1, 1, 0, 0, 0, 0, archiveLoc)
+		},
+	}
+	for name, set := range settings {
+		t.Run(name, func(t *testing.T) {
+			set(s)
+			defer func() {
+				s.archiveReads, s.staleArchives, s.dataStartDate = nil, nil, time.Time{}
+			}()
+			rr := request("dates=2024-01-15", true)
+			if bytes.Equal(rr.Body.Bytes(), stored.Bytes()) {
+				t.Errorf("expected the response not to be the stored bytes")
+			}
+			if got := gunzip(t, rr.Body.Bytes()); got != lines {
+				t.Errorf("unexpected decompressed body %q", got)
+			}
+		})
+	}
+}
+
+// TestAlertsHandlerValidateLines tests that with line validation enabled a
+// corrupt archive line is skipped and counted in /stats, whether the archive is
+// streamed or buffered, and that it is passed through when disabled
+func TestAlertsHandlerValidateLines(t *testing.T) {
+	archive := `{"UUID":"a1"}` + "\n" + `{"UUID":"a2",` + "\x00garbage\n" + `{"UUID":"a3"}` + "\n" + `{"UUID":"a4"`
+	want := `{"UUID":"a1"}` + "\n" + `{"UUID":"a3"}` + "\n"
+
+	tests := []struct {
+		name     string
+		validate bool
+		buffered bool
+	}{
+		{"disabled", false, false},
+		{"streamed", true, false},
+		{"buffered", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &server{
+				firestoreClient: &storage.MockAlertStore{},
+				storageClient:   mockGCSWithArchives(map[string]string{"2024-01-15.jsonl": archive}),
+				bucketName:      "test-bucket",
+				validateLines:   tt.validate,
+			}
+			if tt.buffered {
+				s.archiveReads = &singleflight.Group{}
+			}
+
+			rr := httptest.NewRecorder()
+			s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024-01-15", nil))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", rr.Code)
+			}
+
+			stats := s.stats.snapshot(nil)
+			if !tt.validate {
+				if stats.InvalidLines != 0 || stats.AlertsStreamed != 4 {
+					t.Errorf("expected every line streamed when disabled, got %+v", stats)
+				}
+				return
+			}
+			if rr.Body.String() != want {
+				t.Errorf("expected corrupt lines skipped:\n got %q\nwant %q", rr.Body.String(), want)
+			}
+			if stats.InvalidLines != 2 || stats.AlertsStreamed != 2 {
+				t.Errorf("expected 2 invalid lines and 2 alerts streamed, got %+v", stats)
+			}
+		})
+	}
+}
+
+// TestAlertsHandlerServeStatsSubtypes tests that streamed alerts are counted by
+// subtype and rolled up into categories when subtype counting is enabled
+func TestAlertsHandlerServeStatsSubtypes(t *testing.T) {
+	archive := `{"UUID":"a1","Subtype":"POLICE_VISIBLE"}` + "\n" +
+		`{"UUID":"a2","Subtype":"POLICE_HIDING"}` + "\n" +
+		`{"UUID":"a3","Subtype":"POLICE_ON_BRIDGE"}` + "\n" +
+		`{"UUID":"a4","Subtype":""}` + "\n"
+	mockStore := &storage.MockAlertStore{
+		GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+			return []models.PoliceAlert{{UUID: "live-1", Subtype: "POLICE_WITH_MOBILE_CAMERA"}}, nil
+		},
+	}
+	s := &server{
+		firestoreClient: mockStore,
+		storageClient:   mockGCSWithArchives(map[string]string{"2024-01-15.jsonl": archive}),
+		bucketName:      "test-bucket",
+		alertCategories: defaultAlertCategories,
+	}
+
+	rr := httptest.NewRecorder()
+	s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024-01-15,2024-01-16", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	s.statsHandler(rr, httptest.NewRequest("GET", "/stats", nil))
+	var got models.ServeStats
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode stats: %v", err)
+	}
+	if got.AlertTypes == nil {
+		t.Fatal("expected alert_types in stats")
+	}
+
+	wantSubtypes := map[string]int64{
+		"POLICE_VISIBLE":            1,
+		"POLICE_HIDING":             1,
+		"POLICE_ON_BRIDGE":          1,
+		"POLICE":                    1,
+		"POLICE_WITH_MOBILE_CAMERA": 1,
+	}
+	if !reflect.DeepEqual(got.AlertTypes.Subtypes, wantSubtypes) {
+		t.Errorf("unexpected subtypes\n got %v\nwant %v", got.AlertTypes.Subtypes, wantSubtypes)
+	}
+	wantCategories := map[string]int64{"Visible": 2, "Hidden": 1, "Speed Camera": 1, "Other": 1}
+	if !reflect.DeepEqual(got.AlertTypes.Categories, wantCategories) {
+		t.Errorf("unexpected categories\n got %v\nwant %v", got.AlertTypes.Categories, wantCategories)
+	}
+}
+
+// TestRollupCategories tests that each category's total is the sum of the
+// counts of the subtypes mapped to it
+func TestRollupCategories(t *testing.T) {
+	subtypes := map[string]int64{
+		"POLICE_VISIBLE":            7,
+		"POLICE_ON_BRIDGE":          2,
+		"POLICE_MOTORCYCLIST":       1,
+		"POLICE_HIDING":             5,
+		"POLICE_WITH_MOBILE_CAMERA": 3,
+		"POLICE":                    4,
+		"POLICE_UNKNOWN":            6,
+	}
+	categories, err := parseAlertCategories("Visible=POLICE_VISIBLE,POLICE_ON_BRIDGE; Hidden=POLICE_HIDING ;Speed Camera=POLICE_WITH_MOBILE_CAMERA;Patrol=POLICE_MOTORCYCLIST;Unused=POLICE_RADAR")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, mapping := range []map[string]string{defaultAlertCategories, categories} {
+		totals := rollupCategories(subtypes, mapping)
+
+		want := make(map[string]int64)
+		var total, sum int64
+		for subtype, n := range subtypes {
+			category, ok := mapping[subtype]
+			if !ok {
+				category = otherCategory
+			}
+			want[category] += n
+			total += n
+		}
+		for category := range want {
+			if totals[category] != want[category] {
+				t.Errorf("category %s: expected %d, got %d", category, want[category], totals[category])
+			}
+		}
+		for _, n := range totals {
+			sum += n
+		}
+		if sum != total {
+			t.Errorf("expected category totals to sum to %d, got %d", total, sum)
+		}
+	}
+
+	totals := rollupCategories(subtypes, categories)
+	if totals["Visible"] != 9 || totals["Patrol"] != 1 || totals["Other"] != 10 {
+		t.Errorf("unexpected totals for custom mapping: %v", totals)
+	}
+	if n, ok := totals["Unused"]; !ok || n != 0 {
+		t.Errorf("expected a zero total for a category with no counted subtypes, got %v", totals)
+	}
+}
+
+// TestParseAlertCategoriesInvalid tests that malformed ALERT_CATEGORIES values are rejected
+func TestParseAlertCategoriesInvalid(t *testing.T) {
+	for _, v := range []string{
+		"",
+		"POLICE_VISIBLE",
+		"=POLICE_VISIBLE",
+		"Visible=",
+		"Visible=POLICE_VISIBLE;Seen=POLICE_VISIBLE",
+	} {
+		if _, err := parseAlertCategories(v); err == nil {
+			t.Errorf("expected an error for %q", v)
+		}
+	}
+}
+
+// TestPrewarmServesRecentArchivesFromMemory tests that pre-warming reads the
+// archives of the last days and that requests for them no longer read GCS
+func TestPrewarmServesRecentArchivesFromMemory(t *testing.T) {
+	var mu sync.Mutex
+	reads := map[string]int{}
+	mockGCS := &storage.MockGCSClient{
+		BucketFunc: func(name string) storage.GCSBucketHandle {
+			return &storage.MockGCSBucketHandle{
+				ObjectFunc: func(objName string) storage.GCSObjectHandle {
+					return &storage.MockGCSObjectHandle{
+						NewReaderFunc: func(ctx context.Context) (io.ReadCloser, error) {
+							mu.Lock()
+							reads[objName]++
+							mu.Unlock()
+							if objName == "2024-01-14.jsonl" {
+								return nil, storage.ErrObjectNotExist
+							}
+							return io.NopCloser(strings.NewReader(`{"UUID":"` + objName + `"}` + "\n")), nil
+						},
+					}
+				},
+			}
+		},
+	}
+	loc, _ := time.LoadLocation("Australia/Canberra")
+	now := time.Date(2024, 1, 17, 12, 0, 0, 0, loc)
+	s := &server{
+		firestoreClient: &storage.MockAlertStore{},
+		storageClient:   mockGCS,
+		bucketName:      "test-bucket",
+		now:             func() time.Time { return now },
+		warmArchives:    newArchiveCache(prewarmMaxAge, 3),
+	}
+
+	s.prewarm(context.Background(), 3)
+
+	wantReads := map[string]int{"2024-01-16.jsonl": 1, "2024-01-15.jsonl": 1, "2024-01-14.jsonl": 1}
+	if !reflect.DeepEqual(reads, wantReads) {
+		t.Fatalf("expected pre-warm to read the last 3 days, got %v", reads)
+	}
+
+	rr := httptest.NewRecorder()
+	s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024-01-15,2024-01-16", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	for _, uuid := range []string{"2024-01-15.jsonl", "2024-01-16.jsonl"} {
+		if !strings.Contains(rr.Body.String(), uuid) {
+			t.Errorf("expected pre-warmed alert %s in response %q", uuid, rr.Body.String())
+		}
+	}
+	if !reflect.DeepEqual(reads, wantReads) {
+		t.Errorf("expected pre-warmed days to be served from memory, got reads %v", reads)
+	}
+
+	// Once the pre-warmed copies expire, archives are read from GCS again
+	now = now.Add(prewarmMaxAge + time.Minute)
+	s.alertsHandler(httptest.NewRecorder(), httptest.NewRequest("GET", "/police_alerts?dates=2024-01-16", nil))
+	if reads["2024-01-16.jsonl"] != 2 {
+		t.Errorf("expected an expired pre-warmed archive to be read again, got %d reads", reads["2024-01-16.jsonl"])
+	}
+}
+
+// TestTemporalFields tests weekday and ISO week derivation for dates where the
+// time zone moves an alert across a day, week or year boundary
+func TestTemporalFields(t *testing.T) {
+	canberra, err := time.LoadLocation("Australia/Canberra")
+	if err != nil {
+		t.Fatalf("failed to load location: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		t        time.Time
+		loc      *time.Location
+		wantDay  string
+		wantWeek string
+	}{
+		{"new year in Canberra", time.Date(2023, 12, 31, 14, 0, 0, 0, time.UTC), canberra, "Monday", "2024-W01"},
+		{"new year eve in UTC", time.Date(2023, 12, 31, 14, 0, 0, 0, time.UTC), time.UTC, "Sunday", "2023-W52"},
+		{"ISO week 53 in UTC", time.Date(2021, 1, 3, 13, 30, 0, 0, time.UTC), time.UTC, "Sunday", "2020-W53"},
+		{"first ISO week in Canberra", time.Date(2021, 1, 3, 13, 30, 0, 0, time.UTC), canberra, "Monday", "2021-W01"},
+		{"Saturday after midnight AEST", time.Date(2024, 6, 7, 14, 30, 0, 0, time.UTC), canberra, "Saturday", "2024-W23"},
+		{"Sunday before DST starts", time.Date(2024, 10, 5, 14, 30, 0, 0, time.UTC), canberra, "Sunday", "2024-W40"},
+		{"Monday after DST starts", time.Date(2024, 10, 6, 13, 30, 0, 0, time.UTC), canberra, "Monday", "2024-W41"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			day, week := temporalFields(tt.t, tt.loc)
+			if day != tt.wantDay || week != tt.wantWeek {
+				t.Errorf("temporalFields(%s) = %q, %q, want %q, %q", tt.t.Format(time.RFC3339), day, week, tt.wantDay, tt.wantWeek)
+			}
+		})
+	}
+}
+
+// TestAlertsHandlerTemporalFields tests that day_of_week and iso_week are added
+// to streamed alerts after duration_human, and skipped for alerts without a publish time
+func TestAlertsHandlerTemporalFields(t *testing.T) {
+	canberra, err := time.LoadLocation("Australia/Canberra")
+	if err != nil {
+		t.Fatalf("failed to load location: %v", err)
+	}
+	archive := `{"UUID":"a1","PublishTime":"2023-12-31T14:00:00Z","ActiveMillis":60000}` + "\n" +
+		`{"UUID":"a2","ActiveMillis":0}` + "\n"
+	mockGCS := &storage.MockGCSClient{
+		BucketFunc: func(name string) storage.GCSBucketHandle {
+			return &storage.MockGCSBucketHandle{
+				ObjectFunc: func(objName string) storage.GCSObjectHandle {
+					return &storage.MockGCSObjectHandle{
+						NewReaderFunc: func(ctx context.Context) (io.ReadCloser, error) {
+							return io.NopCloser(strings.NewReader(archive)), nil
+						},
+					}
+				},
+			}
+		},
+	}
+
+	s := &server{
+		firestoreClient: &storage.MockAlertStore{},
+		storageClient:   mockGCS,
+		bucketName:      "test-bucket",
+		durationHuman:   true,
+		temporalLoc:     canberra,
+	}
+	rr := httptest.NewRecorder()
+	s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024-01-01", nil))
+
+	want := `{"UUID":"a1","PublishTime":"2023-12-31T14:00:00Z","ActiveMillis":60000,"duration_human":"1m","day_of_week":"Monday","iso_week":"2024-W01"}` + "\n" +
+		`{"UUID":"a2","ActiveMillis":0,"duration_human":"0s"}` + "\n"
+	if rr.Body.String() != want {
+		t.Errorf("unexpected body:\n got %q\nwant %q", rr.Body.String(), want)
+	}
+}
+
+// TestSyncHandlerTemporalFields tests that /api/sync alerts carry day_of_week and iso_week when enabled
+func TestSyncHandlerTemporalFields(t *testing.T) {
+	mockStore := &storage.MockAlertStore{
+		GetPoliceAlertsUpdatedSinceFunc: func(ctx context.Context, since time.Time, limit int) ([]models.PoliceAlert, time.Time, error) {
+			return []models.PoliceAlert{{UUID: "a1", PublishTime: time.Date(2024, 6, 7, 14, 30, 0, 0, time.UTC)}}, since, nil
+		},
+	}
+
+	for _, loc := range []*time.Location{nil, time.UTC} {
+		s := &server{firestoreClient: mockStore, temporalLoc: loc}
+		rr := httptest.NewRecorder()
+		s.syncHandler(rr, httptest.NewRequest("GET", "/api/sync", nil))
+
+		hasFields := strings.Contains(rr.Body.String(), `"day_of_week":"Friday","iso_week":"2024-W23"`)
+		if hasFields != (loc != nil) {
+			t.Errorf("loc=%v: unexpected body %s", loc, rr.Body.String())
+		}
+	}
+}
+
+// TestDownloadHandler tests that a 3-day download concatenates each day in date
+// order, reading archives and falling back to Firestore for an unarchived day
+func TestDownloadHandler(t *testing.T) {
+	mockGCS := mockGCSWithArchives(map[string]string{
+		"2024-01-01.jsonl": `{"UUID":"d1a"}` + "\n" + `{"UUID":"d1b"}` + "\n",
+		"2024-01-03.jsonl": "{\"UUID\":\"d3a\"}\r\n\r\n{\"UUID\":\"d3b\"}",
+	})
+	var firestoreDays []string
+	mockStore := &storage.MockAlertStore{
+		GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+			firestoreDays = append(firestoreDays, start.Format("2006-01-02"))
+			return []models.PoliceAlert{{UUID: "d2a"}}, nil
+		},
+	}
+	s := &server{firestoreClient: mockStore, storageClient: mockGCS, bucketName: "test-bucket"}
+
+	rr := httptest.NewRecorder()
+	s.downloadHandler(rr, httptest.NewRequest("GET", "/download?start=2024-01-01&end=2024-01-03", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := rr.Header().Get("Content-Type"); got != "application/jsonl" {
+		t.Errorf("expected Content-Type application/jsonl, got %q", got)
+	}
+	wantDisposition := `attachment; filename="police_alerts_2024-01-01_to_2024-01-03.jsonl"`
+	if got := rr.Header().Get("Content-Disposition"); got != wantDisposition {
+		t.Errorf("expected Content-Disposition %q, got %q", wantDisposition, got)
+	}
+	if len(firestoreDays) != 1 || firestoreDays[0] != "2024-01-02" {
+		t.Errorf("expected a Firestore query for 2024-01-02 only, got %v", firestoreDays)
+	}
+
+	var uuids []string
+	for _, line := range strings.Split(strings.TrimSuffix(rr.Body.String(), "\n"), "\n") {
+		var alert models.PoliceAlert
+		if err := json.Unmarshal([]byte(line), &alert); err != nil {
+			t.Fatalf("invalid line %q: %v", line, err)
+		}
+		uuids = append(uuids, alert.UUID)
+	}
+	if got := strings.Join(uuids, ","); got != "d1a,d1b,d2a,d3a,d3b" {
+		t.Errorf("expected days concatenated in order, got %s", got)
+	}
+}
+
+// TestDownloadHandlerValidation tests rejected ranges and a failure before any output
+func TestDownloadHandlerValidation(t *testing.T) {
+	failing := &storage.MockGCSClient{
+		BucketFunc: func(name string) storage.GCSBucketHandle {
+			return &storage.MockGCSBucketHandle{
+				ObjectFunc: func(objName string) storage.GCSObjectHandle {
+					return &storage.MockGCSObjectHandle{
+						NewReaderFunc: func(ctx context.Context) (io.ReadCloser, error) {
+							return nil, errors.New("gcs unavailable")
+						},
+					}
+				},
+			}
+		},
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		maxDays    int
+		wantStatus int
+	}{
+		{"missing start", "end=2024-01-03", 0, http.StatusBadRequest},
+		{"invalid end", "start=2024-01-01&end=soon", 0, http.StatusBadRequest},
+		{"end before start", "start=2024-01-03&end=2024-01-01", 0, http.StatusBadRequest},
+		{"over configured span", "start=2024-01-01&end=2024-01-08", 7, http.StatusBadRequest},
+		{"over default span", "start=2024-01-01&end=2024-02-01", 0, http.StatusBadRequest},
+		{"at configured span", "start=2024-01-01&end=2024-01-07", 7, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &server{
+				firestoreClient: &storage.MockAlertStore{},
+				storageClient:   failing,
+				bucketName:      "test-bucket",
+				downloadMaxDays: tt.maxDays,
+			}
+			rr := httptest.NewRecorder()
+			s.downloadHandler(rr, httptest.NewRequest("GET", "/download?"+tt.query, nil))
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if rr.Code != http.StatusOK && rr.Header().Get("Content-Disposition") != "" {
+				t.Errorf("expected no Content-Disposition on an error, got %q", rr.Header().Get("Content-Disposition"))
+			}
+		})
+	}
+}
+
+// TestAlertsHandlerVerifyArchiveCounts tests that an archived date is flagged as
+// diverged only when Firestore counts more alerts for it than the archive holds
+func TestAlertsHandlerVerifyArchiveCounts(t *testing.T) {
+	archive := `{"UUID":"a1"}` + "\n" + `{"UUID":"a2"}` + "\n"
+
+	tests := []struct {
+		name       string
+		verify     bool
+		firestore  int64
+		wantStatus string
+		wantCounts int
+	}{
+		{"disabled", false, 5, "", 0},
+		{"matching counts", true, 2, "", 1},
+		{"Firestore has fewer", true, 0, "", 1},
+		{"Firestore has more", true, 3, "2024-01-01=diverged", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := &storage.MockAlertStore{
+				CountPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) (int64, error) {
+					if start.Format("2006-01-02") != "2024-01-01" || end.Sub(start) != 24*time.Hour-time.Second {
+						t.Errorf("unexpected count range %v to %v", start, end)
+					}
+					return tt.firestore, nil
+				},
+			}
+			s := &server{
+				firestoreClient: mockStore,
+				storageClient:   mockGCSWithArchives(map[string]string{"2024-01-01.jsonl": archive}),
+				bucketName:      "test-bucket",
+				verifyArchives:  tt.verify,
+			}
+			rr := httptest.NewRecorder()
+			s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024-01-01", nil))
+
+			if rr.Body.String() != archive {
+				t.Errorf("expected the archive served unchanged, got %q", rr.Body.String())
+			}
+			if got := rr.Result().Trailer.Get("X-Date-Status"); got != tt.wantStatus {
+				t.Errorf("expected X-Date-Status %q, got %q", tt.wantStatus, got)
+			}
+			if got := mockStore.CallLog.CountPoliceAlertsByDateRangeCalls; got != tt.wantCounts {
+				t.Errorf("expected %d count calls, got %d", tt.wantCounts, got)
+			}
+		})
+	}
+}
+
+// TestAlertsHandlerVerifyArchiveCountsMetadata tests that verification uses
+// the archive's recorded alert count, so skipped invalid lines don't make it
+// diverge, and skips archives the archive service filtered
+func TestAlertsHandlerVerifyArchiveCountsMetadata(t *testing.T) {
+	archive := `{"uuid":"a1"}` + "\n" + `{"uuid":` + "\n" + `{"uuid":"a3"}` + "\n"
+
+	tests := []struct {
+		name       string
+		metadata   map[string]string
+		firestore  int64
+		wantStatus string
+		wantCounts int
+	}{
+		{"recorded count matches", map[string]string{"alert_count": "3"}, 3, "", 1},
+		{"recorded count below Firestore", map[string]string{"alert_count": "3"}, 4, "2024-01-01=diverged", 1},
+		{"served lines without a recorded count", nil, 3, "2024-01-01=diverged", 1},
+		{"filtered archive", map[string]string{"alert_count": "3", "filters": "span_policy=publish_day,min_confidence=5"}, 10, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := &storage.MockAlertStore{
+				CountPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) (int64, error) {
+					return tt.firestore, nil
+				},
+			}
+			mockGCS := &storage.MockGCSClient{
+				BucketFunc: func(name string) storage.GCSBucketHandle {
+					return &storage.MockGCSBucketHandle{
+						ObjectFunc: func(objName string) storage.GCSObjectHandle {
+							return &storage.MockGCSObjectHandle{
+								NewReaderFunc: func(ctx context.Context) (io.ReadCloser, error) {
+									return io.NopCloser(strings.NewReader(archive)), nil
+								},
+								AttrsFunc: func(ctx context.Context) (*storage.GCSObjectAttrs, error) {
+									return &storage.GCSObjectAttrs{Name: objName, Metadata: tt.metadata}, nil
+								},
+							}
+						},
+					}
+				},
+			}
+			s := &server{
+				firestoreClient: mockStore,
+				storageClient:   mockGCS,
+				bucketName:      "test-bucket",
+				verifyArchives:  true,
+				validateLines:   true,
+			}
+			rr := httptest.NewRecorder()
+			s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024-01-01", nil))
+
+			if want := `{"uuid":"a1"}` + "\n" + `{"uuid":"a3"}` + "\n"; rr.Body.String() != want {
+				t.Errorf("expected the invalid line skipped, got %q", rr.Body.String())
+			}
+			if got := rr.Result().Trailer.Get("X-Date-Status"); got != tt.wantStatus {
+				t.Errorf("expected X-Date-Status %q, got %q", tt.wantStatus, got)
+			}
+			if got := mockStore.CallLog.CountPoliceAlertsByDateRangeCalls; got != tt.wantCounts {
+				t.Errorf("expected %d count calls, got %d", tt.wantCounts, got)
+			}
+		})
+	}
+}
+
+// TestAlertsHandlerVerifyArchiveCountsSkipsFirestoreDates tests that dates
+// served from Firestore are not counted again
+func TestAlertsHandlerVerifyArchiveCountsSkipsFirestoreDates(t *testing.T) {
+	mockStore := &storage.MockAlertStore{}
+	s := &server{
+		firestoreClient: mockStore,
+		storageClient:   mockGCSWithArchives(map[string]string{}),
+		bucketName:      "test-bucket",
+		verifyArchives:  true,
+	}
+	rr := httptest.NewRecorder()
+	s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024-01-01", nil))
+
+	if got := mockStore.CallLog.CountPoliceAlertsByDateRangeCalls; got != 0 {
+		t.Errorf("expected no count calls for a Firestore date, got %d", got)
+	}
+}
+
+// TestAlertsHandlerSummaryLine tests that summary=true ends the stream with a
+// summary whose counts match the alerts streamed from each source
+func TestAlertsHandlerSummaryLine(t *testing.T) {
+	mockStore := &storage.MockAlertStore{
+		GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+			return []models.PoliceAlert{{UUID: "f1"}, {UUID: "f2"}, {UUID: "f3"}}, nil
+		},
+	}
+	s := &server{
+		firestoreClient: mockStore,
+		storageClient: mockGCSWithArchives(map[string]string{
+			"2024-01-01.jsonl": `{"UUID":"a1"}` + "\n" + `{"UUID":"a2"}` + "\n",
+			"2024-01-03.jsonl": "",
+		}),
+		bucketName: "test-bucket",
+	}
+	rr := httptest.NewRecorder()
+	s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024-01-03,2024-01-01,2024-01-02&summary=true", nil))
+
+	lines := strings.Split(strings.TrimSuffix(rr.Body.String(), "\n"), "\n")
+	var summaryLine models.StreamSummaryLine
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &summaryLine); err != nil {
+		t.Fatalf("invalid summary line %q: %v", lines[len(lines)-1], err)
+	}
+	alerts := lines[:len(lines)-1]
+	for _, line := range alerts {
+		if strings.Contains(line, "_summary") {
+			t.Errorf("expected the summary only on the last line, found %q", line)
+		}
+	}
+
+	summary := summaryLine.Summary
+	if got := strings.Join(summary.Dates, ","); got != "2024-01-01,2024-01-02,2024-01-03" {
+		t.Errorf("expected dates in order, got %s", got)
+	}
+	if summary.Total != int64(len(alerts)) || summary.Total != 5 {
+		t.Errorf("expected total 5 matching %d streamed alerts, got %d", len(alerts), summary.Total)
+	}
+	if summary.Sources.Archive != 2 || summary.Sources.Firestore != 3 {
+		t.Errorf("expected 2 archive and 3 Firestore alerts, got %+v", summary.Sources)
+	}
+}
+
+// TestAlertsHandlerSummaryParam tests that the summary line is opt-in and validated
+func TestAlertsHandlerSummaryParam(t *testing.T) {
+	archive := `{"UUID":"a1"}` + "\n"
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantBody   string
+	}{
+		{"omitted", "", http.StatusOK, archive},
+		{"false", "&summary=false", http.StatusOK, archive},
+		{"invalid", "&summary=yes", http.StatusBadRequest, ""},
+		{"geojsonseq", "&summary=true&format=geojsonseq", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &server{
+				firestoreClient: &storage.MockAlertStore{},
+				storageClient:   mockGCSWithArchives(map[string]string{"2024-01-01.jsonl": archive}),
+				bucketName:      "test-bucket",
+			}
+			rr := httptest.NewRecorder()
+			s.alertsHandler(rr, httptest.NewRequest("GET", "/police_alerts?dates=2024-01-01"+tt.query, nil))
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK && rr.Body.String() != tt.wantBody {
+				t.Errorf("expected body %q, got %q", tt.wantBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+// TestDebugDocPath tests that doc_path is added only for ?debug=true when
+// document paths are exposed, from the document each alert was read from
+func TestDebugDocPath(t *testing.T) {
+	archive := `{"UUID":"archived"}` + "\n"
+	path := "police_alerts/a1_2024-01-02"
+	mockStore := &storage.MockAlertStore{
+		GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+			return []models.PoliceAlert{{UUID: "a1", SourcePath: path}}, nil
+		},
+		GetPoliceAlertsUpdatedSinceFunc: func(ctx context.Context, since time.Time, limit int) ([]models.PoliceAlert, time.Time, error) {
+			return []models.PoliceAlert{{UUID: "a1", SourcePath: path}}, since, nil
+		},
+		GetPoliceAlertsActiveAtFunc: func(ctx context.Context, at time.Time) ([]models.PoliceAlert, error) {
+			return []models.PoliceAlert{{UUID: "a1", SourcePath: path}}, nil
+		},
+	}
+	tests := []struct {
+		name     string
+		docPaths bool
+		query    string
+		wantPath bool
+	}{
+		{"not requested", true, "", false},
+		{"debug false", true, "debug=false", false},
+		{"requested", true, "debug=true", true},
+		{"not exposed", false, "debug=true", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &server{
+				firestoreClient: mockStore,
+				storageClient:   mockGCSWithArchives(map[string]string{"2024-01-01.jsonl": archive}),
+				bucketName:      "test-bucket",
+				docPaths:        tt.docPaths,
+			}
+			requests := []struct {
+				handler http.HandlerFunc
+				url     string
+			}{
+				{s.alertsHandler, "/police_alerts?dates=2024-01-01,2024-01-02&" + tt.query},
+				{s.syncHandler, "/api/sync?" + tt.query},
+				{s.activeAtHandler, "/api/active-at?ts=2024-01-15T00:00:00Z&" + tt.query},
+			}
+			for _, req := range requests {
+				rr := httptest.NewRecorder()
+				req.handler(rr, httptest.NewRequest("GET", req.url, nil))
+
+				if rr.Code != http.StatusOK {
+					t.Fatalf("%s: expected status %d, got %d: %s", req.url, http.StatusOK, rr.Code, rr.Body.String())
+				}
+				hasPath := strings.Contains(rr.Body.String(), `"doc_path":"`+path+`"`)
+				if hasPath != tt.wantPath {
+					t.Errorf("%s: expected doc_path %v, got body %s", req.url, tt.wantPath, rr.Body.String())
+				}
+				// The document an archived alert came from is unknown
+				if strings.Count(rr.Body.String(), `"doc_path"`) > 1 {
+					t.Errorf("%s: expected no doc_path on archived alerts, got body %s", req.url, rr.Body.String())
+				}
+			}
+		})
+	}
+}
+
+// TestDebugDocPathValidation tests that invalid and unsupported debug requests are rejected
+func TestDebugDocPathValidation(t *testing.T) {
+	s := &server{
+		firestoreClient: &storage.MockAlertStore{},
+		storageClient:   mockGCSWithArchives(map[string]string{}),
+		bucketName:      "test-bucket",
+		docPaths:        true,
+	}
+	requests := []struct {
+		handler http.HandlerFunc
+		url     string
+	}{
+		{s.alertsHandler, "/police_alerts?dates=2024-01-01&debug=yes"},
+		{s.alertsHandler, "/police_alerts?dates=2024-01-01&debug=true&view=summary"},
+		{s.alertsHandler, "/police_alerts?dates=2024-01-01&debug=true&format=geojsonseq"},
+		{s.syncHandler, "/api/sync?debug=1"},
+		{s.syncHandler, "/api/sync?debug=true&view=summary"},
+		{s.activeAtHandler, "/api/active-at?ts=2024-01-15T00:00:00Z&debug=on"},
+	}
+
+	for _, req := range requests {
+		rr := httptest.NewRecorder()
+		req.handler(rr, httptest.NewRequest("GET", req.url, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", req.url, http.StatusBadRequest, rr.Code)
+		}
+	}
+}
+
+// TestDownloadHandlerOrderedMerge tests that days read concurrently and
+// finishing out of order are still concatenated in date order
+func TestDownloadHandlerOrderedMerge(t *testing.T) {
+	archives := map[string]string{
+		"2024-01-01.jsonl": `{"UUID":"d1"}` + "\n",
+		"2024-01-02.jsonl": `{"UUID":"d2"}` + "\n",
+		"2024-01-03.jsonl": `{"UUID":"d3"}` + "\n",
+	}
+	// The first two days are held until the last has been read, so the last
+	// finishes first and the first finishes last
+	lastRead := make(chan struct{})
+	secondRead := make(chan struct{})
+	var mu sync.Mutex
+	var finished []string
+	mockGCS := &storage.MockGCSClient{
+		BucketFunc: func(name string) storage.GCSBucketHandle {
+			return &storage.MockGCSBucketHandle{
+				ObjectFunc: func(objName string) storage.GCSObjectHandle {
+					return &storage.MockGCSObjectHandle{
+						NewReaderFunc: func(ctx context.Context) (io.ReadCloser, error) {
+							switch objName {
+							case "2024-01-01.jsonl":
+								<-secondRead
+							case "2024-01-02.jsonl":
+								<-lastRead
+								defer close(secondRead)
+							case "2024-01-03.jsonl":
+								defer close(lastRead)
+							}
+							mu.Lock()
+							finished = append(finished, objName)
+							mu.Unlock()
+							return io.NopCloser(strings.NewReader(archives[objName])), nil
+						},
+					}
+				},
+			}
+		},
+	}
+	s := &server{
+		firestoreClient: &storage.MockAlertStore{},
+		storageClient:   mockGCS,
+		bucketName:      "test-bucket",
+		downloadWorkers: 3,
+	}
+
+	rr := httptest.NewRecorder()
+	s.downloadHandler(rr, httptest.NewRequest("GET", "/download?start=2024-01-01&end=2024-01-03", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := strings.Join(finished, ","); got != "2024-01-03.jsonl,2024-01-02.jsonl,2024-01-01.jsonl" {
+		t.Fatalf("expected days to be read in reverse, got %s", got)
+	}
+	want := `{"UUID":"d1"}` + "\n" + `{"UUID":"d2"}` + "\n" + `{"UUID":"d3"}` + "\n"
+	if rr.Body.String() != want {
+		t.Errorf("expected days concatenated in date order:\n got %q\nwant %q", rr.Body.String(), want)
+	}
+}
+
+// TestWriteDaysOrderedBoundsWorkers tests that no more days than workers are
+// read or buffered at once
+func TestWriteDaysOrderedBoundsWorkers(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	mockGCS := &storage.MockGCSClient{
+		BucketFunc: func(name string) storage.GCSBucketHandle {
+			return &storage.MockGCSBucketHandle{
+				ObjectFunc: func(objName string) storage.GCSObjectHandle {
+					return &storage.MockGCSObjectHandle{
+						NewReaderFunc: func(ctx context.Context) (io.ReadCloser, error) {
+							n := inFlight.Add(1)
+							defer inFlight.Add(-1)
+							for {
+								m := maxInFlight.Load()
+								if n <= m || maxInFlight.CompareAndSwap(m, n) {
+									break
+								}
+							}
+							time.Sleep(10 * time.Millisecond)
+							return io.NopCloser(strings.NewReader(`{"UUID":"` + strings.TrimSuffix(objName, ".jsonl") + `"}` + "\n")), nil
+						},
+					}
+				},
+			}
+		},
+	}
+	s := &server{firestoreClient: &storage.MockAlertStore{}, storageClient: mockGCS, bucketName: "test-bucket"}
+
+	loc, _ := time.LoadLocation("Australia/Canberra")
+	var dates []time.Time
+	var want strings.Builder
+	for d := 1; d <= 10; d++ {
+		date := time.Date(2024, 1, d, 0, 0, 0, 0, loc)
+		dates = append(dates, date)
+		want.WriteString(`{"UUID":"` + date.Format("2006-01-02") + `"}` + "\n")
+	}
+
+	var out bytes.Buffer
+	if err := s.writeDaysOrdered(context.Background(), &out, dates, loc, 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := maxInFlight.Load(); got > 2 {
+		t.Errorf("expected at most 2 days read at once, got %d", got)
+	}
+	if out.String() != want.String() {
+		t.Errorf("expected days in date order:\n got %q\nwant %q", out.String(), want.String())
+	}
+}
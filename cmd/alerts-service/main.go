@@ -13,16 +13,96 @@
 //   - FIRESTORE_COLLECTION: Firestore collection name (default: "police_alerts")
 //   - GCS_BUCKET_NAME: GCS bucket for archived data (required)
 //   - RATE_LIMIT_PER_MINUTE: Per-user rate limit (default: 30)
+//   - DATA_START_DATE: First date (YYYY-MM-DD) with collected data. When set, dates
+//     before it or in the future are reported as out of range (optional)
+//   - STARTUP_PING: Set to "true" to verify Firestore connectivity at startup (optional)
+//   - DATE_LAYOUTS: Semicolon-separated Go time layouts accepted for request dates in
+//     addition to YYYY-MM-DD, tried in order (e.g. "2006/01/02;02-01-2006") (default: strict YYYY-MM-DD)
+//   - NORMALIZE_FILTERS: Set to "true" to match street and city filters ignoring case, extra
+//     whitespace and road abbreviations such as "Hwy" (default: exact match)
+//   - MAX_FILTER_VALUES: Maximum values in each subtype, street or city filter list. Longer
+//     lists are rejected (default: 100)
+//   - COMMENTS_STORAGE: Where alert comments are stored: "inline" on the alert document or in a
+//     "subcollection" of it. Must match across services (default: "inline")
+//   - COALESCE_ARCHIVE_READS: Set to "true" to share one GCS read between concurrent
+//     requests for the same archived date (optional)
+//   - STALE_ARCHIVE_MAX_AGE: When set (e.g. "6h"), archives read from GCS are kept in memory
+//     and served with a Warning if GCS errors for up to this long afterwards (optional)
+//   - STALE_ARCHIVE_ENTRIES: Maximum archives kept for stale serving (default: 31)
+//   - GEOJSON_MAX_FIELD_CHARS: Truncate streets and cities longer than this many characters in
+//     ?format=geojsonseq output, ending them with "…" (default: unlimited)
+//   - DURATION_HUMAN: Set to "true" to add a "duration_human" field (e.g. "2h 15m") computed
+//     from ActiveMillis to alerts in /police_alerts and /api/sync responses (optional)
+//   - TEMPORAL_FIELDS: Set to "true" to add "day_of_week" (e.g. "Saturday") and "iso_week"
+//     (e.g. "2024-W01") fields, derived from PublishTime in TEMPORAL_TIMEZONE, to alerts in
+//     /police_alerts and /api responses (optional)
+//   - TEMPORAL_TIMEZONE: IANA time zone for TEMPORAL_FIELDS (default: "Australia/Canberra")
+//   - SECONDS_SINCE_LAST_SEEN: Set to "true" to add a "seconds_since_last_seen" field (now minus
+//     ExpireTime, the last scrape that saw the alert) to alerts in /police_alerts and /api
+//     responses, so clients can gray out alerts that have likely ended (optional)
+//   - EXPOSE_DOC_PATHS: Set to "true" to honour ?debug=true on /police_alerts, /api/sync and
+//     /api/active-at, adding the path of the Firestore document each alert was read from (e.g.
+//     "police_alerts/<uuid>") as "doc_path". Alerts served from archives have no doc_path.
+//     Without it ?debug is ignored (optional)
+//   - VERIFY_ARCHIVE_COUNTS: Set to "true" to count each archived date's alerts in Firestore
+//     when serving /police_alerts and flag archives with fewer alerts as "diverged" in the
+//     X-Date-Status trailer. Archives filtered by the archive service are not checked (optional)
+//   - EXPOSE_INDEX_ERRORS: Set to "true" to include the Firestore index-creation link in /api
+//     error responses when a query fails for a missing composite index. The link is always
+//     logged (optional)
+//   - PRECONNECT_ORIGINS: Comma-separated origins (e.g. a map tile CDN) sent as
+//     "Link: <origin>; rel=preconnect" hints on alert and API responses (optional)
+//   - GZIP_WRITER_POOL: Set to "true" to reuse gzip writers across requests (optional)
+//   - GZIP_PASSTHROUGH: Set to "true" to serve a single-date /police_alerts request for an
+//     archive stored gzipped and marked normalized by cmd/repack as the stored bytes, to
+//     clients that accept gzip, instead of decompressing and re-compressing it. Not used with COALESCE_ARCHIVE_READS,
+//     STALE_ARCHIVE_MAX_AGE or DATA_START_DATE, which need the decompressed lines (optional)
+//   - ADMIN_UIDS: Comma-separated Firebase UIDs allowed to call /admin endpoints. The
+//     endpoints are not registered when unset (optional)
+//   - FLUSH_BYTES: Buffered output size that triggers a flush (default: 32768)
+//   - FLUSH_INTERVAL_MS: Maximum time buffered output waits before a flush (default: 100)
+//   - STREAM_BATCH_LINES: Lines each /police_alerts worker joins before handing them to the
+//     response writer, reducing channel operations (default: 1, unbatched)
+//   - MAX_WORKERS: Upper bound for the per-request ?workers= override on /police_alerts
+//     (default: 32)
+//   - PREWARM_DAYS: Read the archives of the last N days into memory in the background at
+//     startup and serve them from memory for 24 hours (default: 0, disabled)
+//   - TIMESERIES_ENDPOINT: Set to "true" to serve /api/timeseries, alert counts per day or
+//     hour for the dashboard's trend chart (optional)
+//   - GRAPHQL_ENDPOINT: Set to "true" to serve /graphql, a GraphQL API with alerts and
+//     stats queries over the same Firestore data as the REST endpoints (optional)
+//   - DOWNLOAD_ENDPOINT: Set to "true" to serve /download, a date range's alerts as a single
+//     JSONL attachment (optional)
+//   - DOWNLOAD_MAX_DAYS: Longest range, in days, accepted by /download (default: 31)
+//   - DOWNLOAD_WORKERS: Days of a /download read at once. Days are still written in date
+//     order, so up to this many are held in memory (default: 4)
+//   - STATS_ENDPOINT: Set to "true" to serve /police_alerts counters (archive hits, Firestore
+//     fallbacks, alerts and bytes streamed) at /stats (optional)
+//   - VALIDATE_ARCHIVE_LINES: Set to "false" to stream archive lines without checking that
+//     they are valid JSON. By default /police_alerts skips and counts (as invalid_lines in
+//     /stats) any that are not (default: "true")
+//   - STATS_SUBTYPES: Set to "true" to also count streamed alerts by subtype and category in
+//     /stats. Each streamed line is decoded to read its subtype (optional)
+//   - ALERT_CATEGORIES: Categories subtypes are rolled up into for STATS_SUBTYPES, as
+//     "Category=SUBTYPE,SUBTYPE;Category=SUBTYPE". Unlisted subtypes count as "Other"
+//     (default: Visible, Hidden and Speed Camera)
+//   - LOG_LEVEL: Minimum log level: "debug" (adds per-alert detail), "info", "warn" or "error" (default: "info")
 //   - PORT: HTTP server port (default: "8080")
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
 	"runtime"
 	"sort"
@@ -32,11 +112,15 @@ import (
 	"sync/atomic"
 	"time"
 	_ "time/tzdata"
+	"unicode/utf8"
 
 	gcs "cloud.google.com/go/storage"
 	firebase "firebase.google.com/go/v4"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/logging"
 	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
 	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/storage"
+	"github.com/graph-gophers/graphql-go"
+	"golang.org/x/sync/singleflight"
 	"golang.org/x/time/rate"
 )
 
@@ -45,6 +129,71 @@ type contextKey string
 
 const uidContextKey contextKey = "uid"
 
+// Default output flush thresholds for streamed responses
+const (
+	defaultFlushBytes    = 32 * 1024
+	defaultFlushInterval = 100 * time.Millisecond
+)
+
+// Worker counts for reading dates in /police_alerts. A request may override the
+// default with ?workers=N, clamped to 1..maxWorkers.
+const (
+	defaultWorkers    = 7
+	defaultMaxWorkers = 32
+)
+
+// Output formats for /police_alerts
+const (
+	formatJSONL      = "jsonl"
+	formatGeoJSONSeq = "geojsonseq" // RFC 8142 GeoJSON Text Sequences
+)
+
+// Alert views for /police_alerts and /api/sync
+const (
+	viewFull    = "full"    // every PoliceAlert field
+	viewSummary = "summary" // latest state only, see models.PoliceAlertSummary
+)
+
+// Page size limits for /api/sync
+const (
+	defaultSyncLimit = 500
+	maxSyncLimit     = 5000
+)
+
+// archiveLoc is the time zone archive days are named in, loaded once at startup
+var archiveLoc = mustLoadLocation("Australia/Canberra")
+
+// mustLoadLocation loads the named time zone, exiting if it is unavailable
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Fatalf("Failed to load location %s: %v", name, err)
+	}
+	return loc
+}
+
+// Per-date statuses reported in the X-Date-Status trailer
+const (
+	dateStatusOK          = "ok"
+	dateStatusEmpty       = "empty"
+	dateStatusOutOfRange  = "out_of_range"
+	dateStatusError       = "error"
+	dateStatusUnavailable = "unavailable" // needed Firestore, which could not be reached
+	dateStatusStale       = "stale"       // GCS failed, served from the stale archive cache
+	dateStatusDiverged    = "diverged"    // archive has fewer alerts than Firestore for the date
+)
+
+// staleWarning is sent in the Warning trailer when any date was served from
+// the stale archive cache (110 is the HTTP "Response is Stale" warn-code)
+const staleWarning = `110 - "Response is Stale"`
+
+// defaultStaleArchiveEntries is the default number of archives kept for stale serving
+const defaultStaleArchiveEntries = 31
+
+// prewarmMaxAge is how long archives read at startup are served from memory.
+// Archives are written once a day, so a day's copy rarely changes within it.
+const prewarmMaxAge = 24 * time.Hour
+
 // Metrics for buffer performance testing
 type requestMetrics struct {
 	bufferGrows    atomic.Int64
@@ -64,9 +213,221 @@ type server struct {
 	limiters      map[string]*rate.Limiter
 	limitersMutex sync.RWMutex
 	ratePerMinute int
+	// Data availability (zero dataStartDate disables range checks)
+	dataStartDate time.Time
+	now           func() time.Time
+	// Output flushing (zero values use the defaults)
+	flushBytes    int
+	flushInterval time.Duration
+	// Upper bound for ?workers= (zero uses defaultMaxWorkers)
+	maxWorkers int
+	// Lines joined per send from workers to the writer (zero or one sends each line)
+	batchLines int
+	// Longest /download range in days (zero uses defaultDownloadMaxDays)
+	downloadMaxDays int
+	// Days read at once by /download (zero uses defaultDownloadWorkers)
+	downloadWorkers int
+	// Request date layouts accepted besides YYYY-MM-DD
+	dateLayouts []string
+	// Coalesces concurrent reads of the same archive (nil streams each read)
+	archiveReads *singleflight.Group
+	// Recently read archives served when GCS errors (nil disables stale serving)
+	staleArchives *archiveCache
+	// Archives read at startup and served without reading GCS (nil disables pre-warming)
+	warmArchives *archiveCache
+	// Firebase UIDs allowed to call admin endpoints
+	adminUIDs map[string]bool
+	// Add a human-readable duration_human field to served alerts
+	durationHuman bool
+	// Time zone for day_of_week and iso_week fields on served alerts (nil omits them)
+	temporalLoc *time.Location
+	// Add a seconds_since_last_seen field, computed at serve time, to served alerts
+	sinceLastSeen bool
+	// Honour ?debug=true by adding doc_path to alerts read from Firestore
+	docPaths bool
+	// Compare archived dates' alert counts with Firestore when serving them
+	verifyArchives bool
+	// Include index-creation links in error responses for queries missing an index
+	exposeIndexErrors bool
+	// Longest street or city, in characters, written to GeoJSON (zero disables truncation)
+	geoJSONMaxFieldRunes int
+	// Skip archive lines that are not valid JSON instead of streaming them
+	validateLines bool
+	// Serve gzipped archives' stored bytes to clients accepting gzip
+	gzipPassthrough bool
+	// Category of each subtype for /stats rollups (nil skips counting subtypes)
+	alertCategories map[string]string
+	// Counters for /police_alerts, served at /stats
+	stats serveStats
+	// Schema executed by /graphql (nil when the endpoint is disabled)
+	graphQL *graphql.Schema
+}
+
+// defaultAlertCategories groups POLICE subtypes into the categories shown on
+// the dashboard
+var defaultAlertCategories = map[string]string{
+	"POLICE_VISIBLE":            "Visible",
+	"POLICE_ON_BRIDGE":          "Visible",
+	"POLICE_MOTORCYCLIST":       "Visible",
+	"POLICE_HIDING":             "Hidden",
+	"POLICE_WITH_MOBILE_CAMERA": "Speed Camera",
+}
+
+// otherCategory holds subtypes missing from the category mapping
+const otherCategory = "Other"
+
+// serveStats counts how /police_alerts requests are served. The counters are
+// updated concurrently by request workers.
+type serveStats struct {
+	requests           atomic.Int64
+	archiveHits        atomic.Int64
+	firestoreFallbacks atomic.Int64
+	alertsStreamed     atomic.Int64
+	bytesStreamed      atomic.Int64
+	invalidLines       atomic.Int64
+
+	subtypesMu sync.Mutex
+	subtypes   map[string]int64 // Alerts streamed per subtype, when counted
+}
+
+// addSubtypes adds a worker's per-subtype counts to the totals
+func (st *serveStats) addSubtypes(counts map[string]int64) {
+	if len(counts) == 0 {
+		return
+	}
+	st.subtypesMu.Lock()
+	defer st.subtypesMu.Unlock()
+	if st.subtypes == nil {
+		st.subtypes = make(map[string]int64, len(counts))
+	}
+	for subtype, n := range counts {
+		st.subtypes[subtype] += n
+	}
+}
+
+// snapshot returns the current counter values. Subtype counts and their
+// rollup into categories are included when categories is non-nil.
+func (st *serveStats) snapshot(categories map[string]string) models.ServeStats {
+	stats := models.ServeStats{
+		Requests:           st.requests.Load(),
+		ArchiveHits:        st.archiveHits.Load(),
+		FirestoreFallbacks: st.firestoreFallbacks.Load(),
+		AlertsStreamed:     st.alertsStreamed.Load(),
+		BytesStreamed:      st.bytesStreamed.Load(),
+		InvalidLines:       st.invalidLines.Load(),
+	}
+	if categories != nil {
+		st.subtypesMu.Lock()
+		subtypes := make(map[string]int64, len(st.subtypes))
+		for subtype, n := range st.subtypes {
+			subtypes[subtype] = n
+		}
+		st.subtypesMu.Unlock()
+		stats.AlertTypes = &models.AlertTypeCounts{
+			Subtypes:   subtypes,
+			Categories: rollupCategories(subtypes, categories),
+		}
+	}
+	return stats
+}
+
+// rollupCategories sums subtype counts into the category each subtype maps to.
+// Every category in the mapping is present, with zero if none of its subtypes
+// were counted.
+func rollupCategories(subtypes map[string]int64, categories map[string]string) map[string]int64 {
+	totals := make(map[string]int64)
+	for _, category := range categories {
+		totals[category] = 0
+	}
+	for subtype, n := range subtypes {
+		category, ok := categories[subtype]
+		if !ok {
+			category = otherCategory
+		}
+		totals[category] += n
+	}
+	return totals
+}
+
+// parseAlertCategories parses ALERT_CATEGORIES, "Category=SUBTYPE,SUBTYPE;..",
+// into the category of each subtype
+func parseAlertCategories(v string) (map[string]string, error) {
+	categories := make(map[string]string)
+	for _, group := range strings.Split(v, ";") {
+		if strings.TrimSpace(group) == "" {
+			continue
+		}
+		name, list, ok := strings.Cut(group, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q must be Category=SUBTYPE,SUBTYPE", group)
+		}
+		found := false
+		for _, subtype := range strings.Split(list, ",") {
+			if subtype = strings.TrimSpace(subtype); subtype == "" {
+				continue
+			}
+			if existing, dup := categories[subtype]; dup {
+				return nil, fmt.Errorf("subtype %s is in both %q and %q", subtype, existing, name)
+			}
+			categories[subtype] = name
+			found = true
+		}
+		if !found {
+			return nil, fmt.Errorf("category %q has no subtypes", name)
+		}
+	}
+	if len(categories) == 0 {
+		return nil, errors.New("no categories given")
+	}
+	return categories, nil
+}
+
+// skipInvalidLine reports whether an archive line must be skipped because line
+// validation is enabled and it is not valid JSON, counting it for /stats
+func (s *server) skipInvalidLine(fileName string, line []byte) bool {
+	if !s.validateLines || json.Valid(line) {
+		return false
+	}
+	s.stats.invalidLines.Add(1)
+	logging.Warnf("Skipping invalid JSON line in %s (%d bytes)", fileName, len(line))
+	return true
+}
+
+// countSubtype adds a streamed alert line to counts under its subtype, with
+// alerts that have none counted as POLICE. A nil map skips decoding, and lines
+// that cannot be decoded are not counted.
+func countSubtype(counts map[string]int64, line []byte) {
+	if counts == nil {
+		return
+	}
+	var alert struct{ Subtype string }
+	if err := json.Unmarshal(line, &alert); err != nil {
+		return
+	}
+	if alert.Subtype == "" {
+		alert.Subtype = "POLICE"
+	}
+	counts[alert.Subtype]++
+}
+
+// dateResult tracks the outcome of serving a single requested date
+type dateResult struct {
+	lines       atomic.Int64
+	failed      atomic.Bool
+	unavailable atomic.Bool // Firestore fallback was needed but unreachable
+	stale       atomic.Bool // GCS failed and a cached copy was served
+	diverged    atomic.Bool // archive has fewer alerts than Firestore
+	firestore   atomic.Bool // lines were read from Firestore rather than an archive
 }
 
 func main() {
+	logLevel, err := logging.ParseLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		log.Fatalf("Invalid LOG_LEVEL: %v", err)
+	}
+	logging.SetLevel(logLevel)
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -97,13 +458,116 @@ func main() {
 		log.Fatalf("Invalid RATE_LIMIT_PER_MINUTE: %s", rateLimit)
 	}
 
+	// Data availability configuration
+	var dataStartDate time.Time
+	if startDate := os.Getenv("DATA_START_DATE"); startDate != "" {
+		loc, err := time.LoadLocation("Australia/Canberra")
+		if err != nil {
+			log.Fatalf("Failed to load location: %v", err)
+		}
+		dataStartDate, err = time.ParseInLocation("2006-01-02", startDate, loc)
+		if err != nil {
+			log.Fatalf("Invalid DATA_START_DATE: %s", startDate)
+		}
+	}
+
+	// Output flush configuration
+	flushBytes := defaultFlushBytes
+	if v := os.Getenv("FLUSH_BYTES"); v != "" {
+		flushBytes, err = strconv.Atoi(v)
+		if err != nil || flushBytes <= 0 {
+			log.Fatalf("Invalid FLUSH_BYTES: %s", v)
+		}
+	}
+	flushInterval := defaultFlushInterval
+	if v := os.Getenv("FLUSH_INTERVAL_MS"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms <= 0 {
+			log.Fatalf("Invalid FLUSH_INTERVAL_MS: %s", v)
+		}
+		flushInterval = time.Duration(ms) * time.Millisecond
+	}
+
+	batchLines := 1
+	if v := os.Getenv("STREAM_BATCH_LINES"); v != "" {
+		batchLines, err = strconv.Atoi(v)
+		if err != nil || batchLines <= 0 {
+			log.Fatalf("Invalid STREAM_BATCH_LINES: %s", v)
+		}
+	}
+
+	downloadMaxDays := defaultDownloadMaxDays
+	if v := os.Getenv("DOWNLOAD_MAX_DAYS"); v != "" {
+		downloadMaxDays, err = strconv.Atoi(v)
+		if err != nil || downloadMaxDays <= 0 {
+			log.Fatalf("Invalid DOWNLOAD_MAX_DAYS: %s", v)
+		}
+	}
+
+	downloadWorkers := defaultDownloadWorkers
+	if v := os.Getenv("DOWNLOAD_WORKERS"); v != "" {
+		downloadWorkers, err = strconv.Atoi(v)
+		if err != nil || downloadWorkers <= 0 {
+			log.Fatalf("Invalid DOWNLOAD_WORKERS: %s", v)
+		}
+	}
+
+	maxWorkers := defaultMaxWorkers
+	if v := os.Getenv("MAX_WORKERS"); v != "" {
+		maxWorkers, err = strconv.Atoi(v)
+		if err != nil || maxWorkers <= 0 {
+			log.Fatalf("Invalid MAX_WORKERS: %s", v)
+		}
+	}
+
+	// Alternate request date layouts
+	var dateLayouts []string
+	if v := os.Getenv("DATE_LAYOUTS"); v != "" {
+		for _, layout := range strings.Split(v, ";") {
+			if layout = strings.TrimSpace(layout); layout != "" {
+				dateLayouts = append(dateLayouts, layout)
+			}
+		}
+		logging.Infof("Accepting date layouts: %v", dateLayouts)
+	}
+
+	var storeOpts []storage.Option
+	if os.Getenv("NORMALIZE_FILTERS") == "true" {
+		logging.Infof("Matching street and city filters by normalized name")
+		storeOpts = append(storeOpts, storage.WithNormalizedFilters(true))
+	}
+	if v := os.Getenv("MAX_FILTER_VALUES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Fatalf("Invalid MAX_FILTER_VALUES %q: must be a positive integer", v)
+		}
+		storeOpts = append(storeOpts, storage.WithMaxFilterValues(n))
+	}
+	if v := os.Getenv("COMMENTS_STORAGE"); v != "" {
+		if v != storage.CommentsInline && v != storage.CommentsSubcollection {
+			log.Fatalf("Invalid COMMENTS_STORAGE %q: must be %q or %q", v, storage.CommentsInline, storage.CommentsSubcollection)
+		}
+		logging.Infof("Storing alert comments %s", v)
+		storeOpts = append(storeOpts, storage.WithCommentsStorage(v))
+	}
+
 	ctx := context.Background()
-	firestoreClient, err := storage.NewFirestoreClient(ctx, projectID, collectionName)
+	firestoreClient, err := storage.NewFirestoreClient(ctx, projectID, collectionName, storeOpts...)
 	if err != nil {
 		log.Fatalf("Failed to create Firestore client: %v", err)
 	}
 	defer firestoreClient.Close()
 
+	if os.Getenv("STARTUP_PING") == "true" {
+		pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		err := firestoreClient.Ping(pingCtx)
+		cancel()
+		if err != nil {
+			log.Fatalf("Firestore startup ping failed (check GCP_PROJECT_ID and credentials): %v", err)
+		}
+		logging.Infof("Firestore startup ping succeeded")
+	}
+
 	storageClient, err := gcs.NewClient(ctx)
 	if err != nil {
 		log.Fatalf("Failed to create Storage client: %v", err)
@@ -125,7 +589,7 @@ func main() {
 
 	// Log if using emulator (for local testing)
 	if os.Getenv("FIREBASE_AUTH_EMULATOR_HOST") != "" {
-		log.Printf("Using Firebase Auth Emulator at %s", os.Getenv("FIREBASE_AUTH_EMULATOR_HOST"))
+		logging.Infof("Using Firebase Auth Emulator at %s", os.Getenv("FIREBASE_AUTH_EMULATOR_HOST"))
 	}
 
 	s := &server{
@@ -135,15 +599,179 @@ func main() {
 		firebaseAuth:    &storage.FirebaseAuthClientAdapter{Client: firebaseAuth},
 		limiters:        make(map[string]*rate.Limiter),
 		ratePerMinute:   ratePerMinute,
+		dataStartDate:   dataStartDate,
+		now:             time.Now,
+		flushBytes:      flushBytes,
+		flushInterval:   flushInterval,
+		maxWorkers:      maxWorkers,
+		batchLines:      batchLines,
+		downloadMaxDays: downloadMaxDays,
+		downloadWorkers: downloadWorkers,
+		dateLayouts:     dateLayouts,
+	}
+	if v := os.Getenv("ADMIN_UIDS"); v != "" {
+		s.adminUIDs = make(map[string]bool)
+		for _, uid := range strings.Split(v, ",") {
+			if uid = strings.TrimSpace(uid); uid != "" {
+				s.adminUIDs[uid] = true
+			}
+		}
+	}
+	if os.Getenv("DURATION_HUMAN") == "true" {
+		logging.Infof("Adding duration_human to served alerts")
+		s.durationHuman = true
+	}
+	if os.Getenv("TEMPORAL_FIELDS") == "true" {
+		tz := os.Getenv("TEMPORAL_TIMEZONE")
+		if tz == "" {
+			tz = "Australia/Canberra"
+		}
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			log.Fatalf("Invalid TEMPORAL_TIMEZONE %q: %v", tz, err)
+		}
+		logging.Infof("Adding day_of_week and iso_week in %s to served alerts", tz)
+		s.temporalLoc = loc
+	}
+	if os.Getenv("GZIP_PASSTHROUGH") == "true" {
+		logging.Infof("Serving gzipped archives without re-compressing them")
+		s.gzipPassthrough = true
+	}
+	if os.Getenv("VALIDATE_ARCHIVE_LINES") == "false" {
+		logging.Infof("Streaming archive lines without checking they are valid JSON")
+	} else {
+		s.validateLines = true
+	}
+	if os.Getenv("STATS_SUBTYPES") == "true" {
+		s.alertCategories = defaultAlertCategories
+		if v := os.Getenv("ALERT_CATEGORIES"); v != "" {
+			categories, err := parseAlertCategories(v)
+			if err != nil {
+				log.Fatalf("Invalid ALERT_CATEGORIES %q: %v", v, err)
+			}
+			s.alertCategories = categories
+		}
+		logging.Infof("Counting streamed alerts by subtype and category for /stats")
+	}
+	if os.Getenv("SECONDS_SINCE_LAST_SEEN") == "true" {
+		logging.Infof("Adding seconds_since_last_seen to served alerts")
+		s.sinceLastSeen = true
+	}
+	if os.Getenv("EXPOSE_DOC_PATHS") == "true" {
+		logging.Infof("Adding doc_path to alerts served with ?debug=true")
+		s.docPaths = true
+	}
+	if os.Getenv("VERIFY_ARCHIVE_COUNTS") == "true" {
+		logging.Infof("Verifying archive alert counts against Firestore")
+		s.verifyArchives = true
+	}
+	if os.Getenv("EXPOSE_INDEX_ERRORS") == "true" {
+		logging.Infof("Including Firestore index-creation links in error responses")
+		s.exposeIndexErrors = true
+	}
+	if v := os.Getenv("GEOJSON_MAX_FIELD_CHARS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 2 {
+			log.Fatalf("Invalid GEOJSON_MAX_FIELD_CHARS %q: must be an integer of at least 2", v)
+		}
+		logging.Infof("Truncating GeoJSON streets and cities to %d characters", n)
+		s.geoJSONMaxFieldRunes = n
+	}
+	if os.Getenv("COALESCE_ARCHIVE_READS") == "true" {
+		logging.Infof("Coalescing concurrent archive reads")
+		s.archiveReads = &singleflight.Group{}
+	}
+	if v := os.Getenv("STALE_ARCHIVE_MAX_AGE"); v != "" {
+		maxAge, err := time.ParseDuration(v)
+		if err != nil || maxAge <= 0 {
+			log.Fatalf("Invalid STALE_ARCHIVE_MAX_AGE: %s", v)
+		}
+		entries := defaultStaleArchiveEntries
+		if v := os.Getenv("STALE_ARCHIVE_ENTRIES"); v != "" {
+			entries, err = strconv.Atoi(v)
+			if err != nil || entries <= 0 {
+				log.Fatalf("Invalid STALE_ARCHIVE_ENTRIES: %s", v)
+			}
+		}
+		logging.Infof("Serving archives up to %v stale during GCS errors (%d cached)", maxAge, entries)
+		s.staleArchives = newArchiveCache(maxAge, entries)
+	}
+
+	if v := os.Getenv("PREWARM_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			log.Fatalf("Invalid PREWARM_DAYS: %s", v)
+		}
+		if days > 0 {
+			logging.Infof("Pre-warming archives for the last %d days", days)
+			s.warmArchives = newArchiveCache(prewarmMaxAge, days)
+			go s.prewarm(context.Background(), days)
+		}
 	}
 
 	// Start cleanup routine for old limiters
 	go s.cleanupLimiters()
 
-	log.Printf("Starting Alerts Service on port %s", port)
-	log.Printf("Rate limit: %d requests per minute per user", ratePerMinute)
-	log.Printf("Firebase Authentication: Enabled")
-	http.HandleFunc("/police_alerts", corsMiddleware(s.authMiddleware(s.rateLimitMiddleware(gzipMiddleware(s.alertsHandler)))))
+	logging.Infof("Starting Alerts Service on port %s", port)
+	logging.Infof("Rate limit: %d requests per minute per user", ratePerMinute)
+	logging.Infof("Firebase Authentication: Enabled")
+	gzipped := gzipMiddleware
+	if os.Getenv("GZIP_WRITER_POOL") == "true" {
+		logging.Infof("Pooling gzip writers")
+		pool := newGzipWriterPool()
+		gzipped = func(next http.HandlerFunc) http.HandlerFunc {
+			return gzipMiddlewareWithPool(pool, next)
+		}
+	}
+	var origins []string
+	if v := os.Getenv("PRECONNECT_ORIGINS"); v != "" {
+		for _, origin := range strings.Split(v, ",") {
+			if origin = strings.TrimSpace(origin); origin == "" {
+				continue
+			}
+			if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" {
+				log.Fatalf("Invalid PRECONNECT_ORIGINS entry: %s", origin)
+			}
+			origins = append(origins, origin)
+		}
+		logging.Infof("Sending preconnect hints for %v", origins)
+	}
+	compress := func(next http.HandlerFunc) http.HandlerFunc {
+		return preconnectMiddleware(origins, gzipped(next))
+	}
+
+	// Pass-through sits inside the preconnect hints and outside gzip, which
+	// it replaces for the archives it serves
+	http.HandleFunc("/police_alerts", corsMiddleware(s.authMiddleware(s.rateLimitMiddleware(preconnectMiddleware(origins, s.gzipPassthroughMiddleware(gzipped(s.alertsHandler)))))))
+	http.HandleFunc("/api/heatmap", corsMiddlewareWithMethods("POST, OPTIONS", s.authMiddleware(s.rateLimitMiddleware(compress(s.heatmapHandler)))))
+	http.HandleFunc("/api/diff", corsMiddlewareWithMethods("POST, OPTIONS", s.authMiddleware(s.rateLimitMiddleware(compress(s.diffHandler)))))
+	http.HandleFunc("/api/sync", corsMiddleware(s.authMiddleware(s.rateLimitMiddleware(compress(s.syncHandler)))))
+	http.HandleFunc("/api/active-at", corsMiddleware(s.authMiddleware(s.rateLimitMiddleware(compress(s.activeAtHandler)))))
+	if os.Getenv("TIMESERIES_ENDPOINT") == "true" {
+		logging.Infof("Serving alert time series at /api/timeseries")
+		http.HandleFunc("/api/timeseries", corsMiddleware(s.authMiddleware(s.rateLimitMiddleware(compress(s.timeSeriesHandler)))))
+	}
+	if os.Getenv("GRAPHQL_ENDPOINT") == "true" {
+		schema, err := newGraphQLSchema(s)
+		if err != nil {
+			log.Fatalf("Failed to parse GraphQL schema: %v", err)
+		}
+		s.graphQL = schema
+		logging.Infof("Serving GraphQL queries at /graphql")
+		http.HandleFunc("/graphql", corsMiddlewareWithMethods("POST, OPTIONS", s.authMiddleware(s.rateLimitMiddleware(compress(s.graphQLHandler)))))
+	}
+	if os.Getenv("DOWNLOAD_ENDPOINT") == "true" {
+		logging.Infof("Serving downloads of up to %d days at /download", downloadMaxDays)
+		http.HandleFunc("/download", corsMiddleware(s.authMiddleware(s.rateLimitMiddleware(compress(s.downloadHandler)))))
+	}
+	if len(s.adminUIDs) > 0 {
+		logging.Infof("Admin endpoints enabled for %d users", len(s.adminUIDs))
+		http.HandleFunc("/admin/stats", corsMiddleware(s.authMiddleware(s.adminMiddleware(s.collectionStatsHandler))))
+	}
+	if os.Getenv("STATS_ENDPOINT") == "true" {
+		logging.Infof("Serving request counters at /stats")
+		http.HandleFunc("/stats", corsMiddleware(s.statsHandler))
+	}
 	http.HandleFunc("/health", healthHandler)
 
 	log.Fatal(http.ListenAndServe(":"+port, nil))
@@ -174,6 +802,23 @@ func (w *gzipResponseWriter) Flush() {
 }
 
 func gzipMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return gzipMiddlewareWithPool(nil, next)
+}
+
+// newGzipWriterPool returns a pool of reusable gzip writers for gzipMiddlewareWithPool
+func newGzipWriterPool() *sync.Pool {
+	return &sync.Pool{
+		New: func() interface{} {
+			return gzip.NewWriter(io.Discard)
+		},
+	}
+}
+
+// gzipMiddlewareWithPool compresses responses like gzipMiddleware, taking
+// writers from pool (when non-nil) instead of allocating one per request.
+// Writers are reset before use and returned to the pool once closed, even if
+// the handler panics.
+func gzipMiddlewareWithPool(pool *sync.Pool, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
 			next(w, r)
@@ -181,14 +826,150 @@ func gzipMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		}
 		w.Header().Set("Content-Encoding", "gzip")
 		w.Header().Set("Vary", "Accept-Encoding")
-		gz := gzip.NewWriter(w)
-		defer gz.Close()
+
+		var gz *gzip.Writer
+		if pool != nil {
+			gz = pool.Get().(*gzip.Writer)
+			gz.Reset(w)
+			defer func() {
+				gz.Close()
+				// Drop the reference to the response before pooling the writer
+				gz.Reset(io.Discard)
+				pool.Put(gz)
+			}()
+		} else {
+			gz = gzip.NewWriter(w)
+			defer gz.Close()
+		}
+
 		gzw := &gzipResponseWriter{Writer: gz, ResponseWriter: w}
 		next(gzw, r)
 	}
 }
 
+// archiveNormalizedMetadataKey is set to "true" by cmd/repack on archives it
+// has rewritten as normalized JSONL, whose lines can be served as stored
+const archiveNormalizedMetadataKey = "normalized"
+
+// gzipPassthroughMiddleware serves a /police_alerts request for one archived
+// day stored gzipped by copying the stored bytes with Content-Encoding: gzip,
+// rather than next decompressing them for the gzip middleware to compress
+// again. Only archives repack marked as normalized are passed through, since
+// their lines are already what next would serve. Clients that don't accept
+// gzip, requests or settings that change the served lines, and days whose
+// archive is missing, stored plain or not normalized go to next.
+func (s *server) gzipPassthroughMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	if !s.gzipPassthrough {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		fileName, workers, ok := s.passthroughArchive(r)
+		if !ok {
+			next(w, r)
+			return
+		}
+		obj := s.storageClient.Bucket(s.bucketName).Object(fileName)
+		attrs, err := obj.Attrs(r.Context())
+		if err != nil || attrs.Metadata[archiveNormalizedMetadataKey] != "true" {
+			next(w, r)
+			return
+		}
+		// Read the stored bytes even if the object has gzip content encoding,
+		// which GCS would otherwise decompress
+		reader, err := obj.ReadCompressed(true).NewReader(r.Context())
+		if err != nil {
+			next(w, r)
+			return
+		}
+		br := bufio.NewReader(reader)
+		if magic, err := br.Peek(2); err != nil || magic[0] != 0x1f || magic[1] != 0x8b {
+			// The archive is stored plain
+			reader.Close()
+			next(w, r)
+			return
+		}
+		defer reader.Close()
+
+		s.stats.requests.Add(1)
+		s.stats.archiveHits.Add(1)
+		w.Header().Set("Content-Type", "application/jsonl")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Vary", "Accept-Encoding")
+		w.Header().Set("X-Workers", strconv.Itoa(workers))
+		if _, err := io.Copy(w, br); err != nil {
+			logging.Errorf("Error streaming gzipped archive %s: %v", fileName, err)
+		}
+	}
+}
+
+// passthroughArchive returns the archive a /police_alerts request could be
+// served from as stored, and the worker count the request asked for: a GET for
+// a single date that is not pre-warmed, with no parameters or settings that
+// change its lines or how it is read, from a client that accepts gzip. Line
+// validation doesn't count, as repack only writes valid lines.
+func (s *server) passthroughArchive(r *http.Request) (string, int, bool) {
+	if r.Method != http.MethodGet || !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		return "", 0, false
+	}
+	if s.durationHuman || s.temporalLoc != nil || s.sinceLastSeen || s.alertCategories != nil || s.verifyArchives {
+		return "", 0, false
+	}
+	// Coalesced and stale-cached reads, and the X-Date-Status trailer, need
+	// the decompressed lines
+	if s.archiveReads != nil || s.staleArchives != nil || !s.dataStartDate.IsZero() {
+		return "", 0, false
+	}
+	query := r.URL.Query()
+	for param := range query {
+		if param != "dates" && param != "workers" {
+			return "", 0, false
+		}
+	}
+	workers, ok := s.requestWorkers(query.Get("workers"))
+	if !ok {
+		return "", 0, false
+	}
+	ds := query.Get("dates")
+	if ds == "" || strings.Contains(ds, ",") {
+		return "", 0, false
+	}
+	date, err := s.parseDate(ds, archiveLoc)
+	if err != nil {
+		return "", 0, false
+	}
+	fileName := fmt.Sprintf("%s.jsonl", date.Format("2006-01-02"))
+	if s.warmArchives != nil {
+		if _, warm := s.warmArchives.get(fileName, s.clock()); warm {
+			return "", 0, false
+		}
+	}
+	return fileName, workers, true
+}
+
+// preconnectMiddleware adds a Link preconnect hint for each origin so the
+// browser can open connections (e.g. to the tile CDN) while alerts load
+func preconnectMiddleware(origins []string, next http.HandlerFunc) http.HandlerFunc {
+	if len(origins) == 0 {
+		return next
+	}
+	links := make([]string, len(origins))
+	for i, origin := range origins {
+		links[i] = "<" + origin + ">; rel=preconnect"
+	}
+	link := strings.Join(links, ", ")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Link", link)
+		next(w, r)
+	}
+}
+
 func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return corsMiddlewareWithMethods("GET, OPTIONS", next)
+}
+
+// corsMiddlewareWithMethods applies the CORS policy, advertising the given allowed methods
+func corsMiddlewareWithMethods(methods string, next http.HandlerFunc) http.HandlerFunc {
 	allowedOrigins := []string{
 		"https://wazepolicescrapergcp.web.app",
 		"https://wazepolicescrapergcp.firebaseapp.com",
@@ -215,7 +996,7 @@ func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		}
 
 		w.Header().Set("Vary", "Origin")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", methods)
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 		if r.Method == "OPTIONS" {
@@ -232,14 +1013,14 @@ func (s *server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		// Extract Authorization header
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			log.Printf("Authentication failed: Missing Authorization header from %s", r.RemoteAddr)
+			logging.Warnf("Authentication failed: Missing Authorization header from %s", r.RemoteAddr)
 			http.Error(w, "Missing authorization header", http.StatusUnauthorized)
 			return
 		}
 
 		// Extract Bearer token
 		if !strings.HasPrefix(authHeader, "Bearer ") {
-			log.Printf("Authentication failed: Invalid Authorization header format from %s", r.RemoteAddr)
+			logging.Warnf("Authentication failed: Invalid Authorization header format from %s", r.RemoteAddr)
 			http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
 			return
 		}
@@ -248,19 +1029,33 @@ func (s *server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		// Verify Firebase ID token
 		token, err := s.firebaseAuth.VerifyIDToken(r.Context(), idToken)
 		if err != nil {
-			log.Printf("Authentication failed: Invalid token from %s: %v", r.RemoteAddr, err)
+			logging.Warnf("Authentication failed: Invalid token from %s: %v", r.RemoteAddr, err)
 			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
 			return
 		}
 
 		// Add user ID to context for use in downstream handlers
 		ctx := context.WithValue(r.Context(), uidContextKey, token.UID)
-		log.Printf("Authenticated user: %s", token.UID)
+		logging.Debugf("Authenticated user: %s", token.UID)
 
 		next(w, r.WithContext(ctx))
 	}
 }
 
+// adminMiddleware allows only authenticated users listed in ADMIN_UIDS.
+// It must run after authMiddleware, which puts the UID in the context.
+func (s *server) adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, _ := r.Context().Value(uidContextKey).(string)
+		if !s.adminUIDs[uid] {
+			logging.Warnf("Admin access denied for user %q", uid)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
 func (s *server) getLimiter(uid string) *rate.Limiter {
 	s.limitersMutex.Lock()
 	defer s.limitersMutex.Unlock()
@@ -279,7 +1074,7 @@ func (s *server) rateLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		// Get user ID from context (set by authMiddleware)
 		uid, ok := r.Context().Value(uidContextKey).(string)
 		if !ok || uid == "" {
-			log.Printf("Rate limiting failed: No UID in context")
+			logging.Errorf("Rate limiting failed: No UID in context")
 			http.Error(w, "Authentication required", http.StatusUnauthorized)
 			return
 		}
@@ -289,7 +1084,7 @@ func (s *server) rateLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		if !limiter.Allow() {
 			w.Header().Set("Retry-After", "60")
 			http.Error(w, "Rate limit exceeded. Maximum "+strconv.Itoa(s.ratePerMinute)+" requests per minute.", http.StatusTooManyRequests)
-			log.Printf("Rate limit exceeded for user: %s", uid)
+			logging.Warnf("Rate limit exceeded for user: %s", uid)
 			return
 		}
 
@@ -306,7 +1101,7 @@ func (s *server) cleanupLimiters() {
 		// Clear all limiters - they'll be recreated on next request
 		s.limiters = make(map[string]*rate.Limiter)
 		s.limitersMutex.Unlock()
-		log.Println("Cleaned up rate limiters")
+		logging.Debugf("Cleaned up rate limiters")
 	}
 }
 
@@ -316,6 +1111,8 @@ func (s *server) alertsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.stats.requests.Add(1)
+
 	ctx := context.Background()
 	datesParam := r.URL.Query().Get("dates")
 	if datesParam == "" {
@@ -328,11 +1125,58 @@ func (s *server) alertsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Query limited to a maximum of 7 dates.", http.StatusBadRequest)
 		return
 	}
+
+	workersParam := r.URL.Query().Get("workers")
+	numWorkers, ok := s.requestWorkers(workersParam)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Invalid 'workers' parameter '%s', must be an integer", workersParam), http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	contentType := "application/jsonl"
+	switch format {
+	case "", formatJSONL:
+	case formatGeoJSONSeq:
+		contentType = "application/geo+json-seq"
+	default:
+		http.Error(w, fmt.Sprintf("Invalid 'format' parameter '%s', use %s or %s", format, formatJSONL, formatGeoJSONSeq), http.StatusBadRequest)
+		return
+	}
+
+	view, ok := parseView(r.URL.Query().Get("view"))
+	if !ok {
+		http.Error(w, fmt.Sprintf("Invalid 'view' parameter '%s', use %s or %s", view, viewFull, viewSummary), http.StatusBadRequest)
+		return
+	}
+	debug, ok := s.parseDebug(r.URL.Query().Get("debug"))
+	if !ok {
+		http.Error(w, fmt.Sprintf("Invalid 'debug' parameter '%s', use true or false", r.URL.Query().Get("debug")), http.StatusBadRequest)
+		return
+	}
+	if debug && (format == formatGeoJSONSeq || view == viewSummary) {
+		http.Error(w, "debug=true is only supported for full-view JSONL output", http.StatusBadRequest)
+		return
+	}
+	includeSummary := false
+	switch v := r.URL.Query().Get("summary"); v {
+	case "", "false":
+	case "true":
+		if format == formatGeoJSONSeq {
+			http.Error(w, "summary=true is only supported for JSONL output", http.StatusBadRequest)
+			return
+		}
+		includeSummary = true
+	default:
+		http.Error(w, fmt.Sprintf("Invalid 'summary' parameter '%s', use true or false", v), http.StatusBadRequest)
+		return
+	}
+
 	var dates []time.Time
-	loc, _ := time.LoadLocation("Australia/Canberra")
+	loc := archiveLoc
 
 	for _, ds := range dateStrings {
-		t, err := time.ParseInLocation("2006-01-02", ds, loc)
+		t, err := s.parseDate(ds, loc)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Invalid date format for '%s', use YYYY-MM-DD", ds), http.StatusBadRequest)
 			return
@@ -341,7 +1185,7 @@ func (s *server) alertsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if len(dates) == 0 {
-		w.Header().Set("Content-Type", "application/jsonl")
+		w.Header().Set("Content-Type", contentType)
 		w.WriteHeader(http.StatusOK)
 		return
 	}
@@ -350,13 +1194,67 @@ func (s *server) alertsHandler(w http.ResponseWriter, r *http.Request) {
 		return dates[i].Before(dates[j])
 	})
 
-	w.Header().Set("Content-Type", "application/jsonl")
+	// Separate out dates with no possible data so they aren't mistaken for empty days
+	reportStatus := !s.dataStartDate.IsZero()
+	var outOfRange []time.Time
+	if reportStatus {
+		var inRange []time.Time
+		for _, date := range dates {
+			if s.isOutOfRange(date, loc) {
+				outOfRange = append(outOfRange, date)
+			} else {
+				inRange = append(inRange, date)
+			}
+		}
+		if len(dates) == 1 && len(outOfRange) == 1 {
+			http.Error(w, fmt.Sprintf("No data available for %s (outside the collection period)", dates[0].Format("2006-01-02")), http.StatusNotFound)
+			return
+		}
+		dates = inRange
+	}
+
+	results := make(map[string]*dateResult, len(dates))
+	for _, date := range dates {
+		results[date.Format("2006-01-02")] = &dateResult{}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Workers", strconv.Itoa(numWorkers))
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		http.Error(w, "Streaming unsupported!", http.StatusInternalServerError)
 		return
 	}
 
+	if reportStatus {
+		w.Header().Set("Trailer", "X-Date-Status")
+		defer func() {
+			w.Header().Set("X-Date-Status", formatDateStatus(results, outOfRange))
+		}()
+	} else {
+		// Without range checks the trailer is undeclared, so it is only sent
+		// (via TrailerPrefix) when a date failed and would otherwise look empty
+		defer func() {
+			for _, result := range results {
+				if result.failed.Load() || result.stale.Load() || result.diverged.Load() {
+					w.Header().Set(http.TrailerPrefix+"X-Date-Status", formatDateStatus(results, outOfRange))
+					return
+				}
+			}
+		}()
+	}
+
+	// A stale copy is only known to be needed once the stream may have started,
+	// so the Warning is sent as a trailer
+	defer func() {
+		for _, result := range results {
+			if result.stale.Load() {
+				w.Header().Set(http.TrailerPrefix+"Warning", staleWarning)
+				return
+			}
+		}
+	}()
+
 	// Initialize metrics
 	metrics := &requestMetrics{
 		start: time.Now(),
@@ -365,7 +1263,7 @@ func (s *server) alertsHandler(w http.ResponseWriter, r *http.Request) {
 		duration := time.Since(metrics.start)
 		var m runtime.MemStats
 		runtime.ReadMemStats(&m)
-		log.Printf("[METRICS] Request completed in %v | Lines: %d | Bytes: %d (%.2f MB) | Throughput: %.2f MB/s | Buffer grows: %d | Max buffer: %d bytes | Channel blocks: %d | Memory: Alloc=%d MB, TotalAlloc=%d MB, Sys=%d MB, NumGC=%d",
+		logging.Infof("[METRICS] Request completed in %v | Lines: %d | Bytes: %d (%.2f MB) | Throughput: %.2f MB/s | Buffer grows: %d | Max buffer: %d bytes | Channel blocks: %d | Memory: Alloc=%d MB, TotalAlloc=%d MB, Sys=%d MB, NumGC=%d",
 			duration,
 			metrics.linesProcessed.Load(),
 			metrics.bytesProcessed.Load(),
@@ -381,21 +1279,52 @@ func (s *server) alertsHandler(w http.ResponseWriter, r *http.Request) {
 		)
 	}()
 
-	numWorkers := 7
+	// Once Firestore is found to be unreachable, remaining fallback dates fail
+	// fast instead of each waiting on their own timeout
+	var firestoreDown atomic.Bool
+
 	jobs := make(chan time.Time, len(dates))
 	dataChan := make(chan []byte, 100) // Channel for workers to send data to the writer
 	var wg sync.WaitGroup
 
 	// Start a single writer goroutine
 	writerDone := make(chan struct{})
-	go func() {
-		for data := range dataChan {
-			if _, err := w.Write(data); err != nil {
-				log.Printf("Error writing response: %v", err)
-				return // Stop writing if there's an error
-			}
-			flusher.Flush()
-		}
+	flushBytes, flushInterval := s.flushThresholds()
+	// Lines are converted between the workers and the writer when the output
+	// differs from the stored JSONL
+	var transform func(line []byte) ([]byte, bool)
+	switch {
+	case format == formatGeoJSONSeq:
+		transform = s.geoJSONSeqRecord
+	case view == viewSummary:
+		transform = s.summaryRecord
+	case s.durationHuman || s.temporalLoc != nil || s.sinceLastSeen:
+		transform = s.derivedFieldsRecord
+	}
+	var output <-chan []byte = dataChan
+	if transform != nil {
+		records := make(chan []byte, 100)
+		go func() {
+			defer close(records)
+			for batch := range dataChan {
+				// Batches hold whole newline-terminated lines
+				for len(batch) > 0 {
+					end := bytes.IndexByte(batch, '\n') + 1
+					if end == 0 {
+						end = len(batch)
+					}
+					line := batch[:end:end]
+					batch = batch[end:]
+					if record, ok := transform(line); ok {
+						records <- record
+					}
+				}
+			}
+		}()
+		output = records
+	}
+	go func() {
+		writeStream(&countingWriter{w: w, n: &s.stats.bytesStreamed}, flusher, output, flushBytes, flushInterval)
 		close(writerDone)
 	}()
 
@@ -404,12 +1333,57 @@ func (s *server) alertsHandler(w http.ResponseWriter, r *http.Request) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
+			batch := &lineBatcher{out: dataChan, max: s.batchLines, blocked: &metrics.channelBlocks}
+			var subtypes map[string]int64
+			if s.alertCategories != nil {
+				subtypes = make(map[string]int64)
+				defer s.stats.addSubtypes(subtypes)
+			}
 			for date := range jobs {
-				fileName := fmt.Sprintf("%s.jsonl", date.Format("2006-01-02"))
-				obj := s.storageClient.Bucket(s.bucketName).Object(fileName)
+				// Send each date's remaining lines before starting the next
+				batch.flush()
 
-				reader, err := obj.NewReader(ctx)
+				result := results[date.Format("2006-01-02")]
+				fileName := fmt.Sprintf("%s.jsonl", date.Format("2006-01-02"))
+				var reader io.ReadCloser
+				var sharedLines [][]byte
+				var err error
+				var warm bool
+				if s.warmArchives != nil {
+					sharedLines, warm = s.warmArchives.get(fileName, s.clock())
+				}
+				buffered := warm || s.archiveReads != nil || s.staleArchives != nil
+				switch {
+				case warm:
+				case buffered:
+					sharedLines, err = s.readArchiveBuffered(ctx, fileName)
+				default:
+					reader, err = s.openArchive(ctx, fileName)
+				}
+				if err != nil && !storage.IsObjectNotExist(err) && s.staleArchives != nil {
+					if cached, ok := s.staleArchives.get(fileName, s.clock()); ok {
+						logging.Warnf("Error reading archive %s, serving cached copy: %v", fileName, err)
+						sharedLines, err = cached, nil
+						result.stale.Store(true)
+					}
+				}
 				if err == nil {
+					s.stats.archiveHits.Add(1)
+				}
+				fromArchive := err == nil && !result.stale.Load()
+				if err == nil && buffered {
+					// Lines may be shared with concurrent requests, so they are only read
+					for _, line := range sharedLines {
+						metrics.linesProcessed.Add(1)
+						metrics.bytesProcessed.Add(int64(len(line)))
+						if s.skipInvalidLine(fileName, line) {
+							continue
+						}
+						result.lines.Add(1)
+						countSubtype(subtypes, line)
+						batch.add(line)
+					}
+				} else if err == nil {
 					// Archive exists - read line by line to avoid splitting JSON objects
 					buf := make([]byte, 0, 64*1024) // 64KB buffer for accumulating data
 					readBuf := make([]byte, 4096)
@@ -443,32 +1417,30 @@ func (s *server) alertsHandler(w http.ResponseWriter, r *http.Request) {
 									break
 								}
 
-								// Send complete line including newline
-								line := make([]byte, lineEnd+1)
-								copy(line, buf[:lineEnd+1])
+								// Normalize the line and remove it from the buffer
+								line := normalizeLine(buf[:lineEnd])
+								buf = buf[lineEnd+1:]
+								if line == nil {
+									continue // Skip blank lines
+								}
 								metrics.linesProcessed.Add(1)
-
-								// Non-blocking send with metrics
-								select {
-								case dataChan <- line:
-									// Sent without blocking
-								default:
-									metrics.channelBlocks.Add(1)
-									dataChan <- line // Block if necessary
+								if s.skipInvalidLine(fileName, line) {
+									continue
 								}
+								result.lines.Add(1)
+								countSubtype(subtypes, line)
 
-								// Remove processed line from buffer
-								buf = buf[lineEnd+1:]
+								batch.add(line)
 							}
 						}
 						if readErr != nil {
-							// Send any remaining data
-							if len(buf) > 0 {
-								remaining := make([]byte, len(buf))
-								copy(remaining, buf)
-								dataChan <- remaining
-								if buf[len(buf)-1] != '\n' {
-									dataChan <- []byte("\n")
+							// Send any remaining data (archive without a trailing newline)
+							if line := normalizeLine(buf); line != nil {
+								metrics.linesProcessed.Add(1)
+								if !s.skipInvalidLine(fileName, line) {
+									result.lines.Add(1)
+									countSubtype(subtypes, line)
+									batch.add(line)
 								}
 							}
 							break
@@ -477,27 +1449,49 @@ func (s *server) alertsHandler(w http.ResponseWriter, r *http.Request) {
 					reader.Close()
 				} else if storage.IsObjectNotExist(err) {
 					// Archive does not exist, query Firestore
+					if firestoreDown.Load() {
+						result.failed.Store(true)
+						result.unavailable.Store(true)
+						continue
+					}
+					s.stats.firestoreFallbacks.Add(1)
+					result.firestore.Store(true)
 					startOfDay := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, loc)
 					endOfDay := startOfDay.Add(24*time.Hour - time.Second)
 
 					var alerts []models.PoliceAlert
 					alerts, firestoreErr := s.firestoreClient.GetPoliceAlertsByDateRange(ctx, startOfDay, endOfDay)
 					if firestoreErr != nil {
-						log.Printf("Error getting alerts from Firestore for %s: %v", date.Format("2006-01-02"), firestoreErr)
+						logging.Errorf("Error getting alerts from Firestore for %s: %v", date.Format("2006-01-02"), firestoreErr)
+						result.failed.Store(true)
+						if storage.IsUnavailable(firestoreErr) {
+							firestoreDown.Store(true)
+							result.unavailable.Store(true)
+						}
 						continue
 					}
 					for _, alert := range alerts {
+						if debug {
+							alert.DocPath = alert.SourcePath
+						}
 						jsonData, marshalErr := json.Marshal(alert)
 						if marshalErr != nil {
-							log.Printf("Error marshaling alert %s: %v", alert.UUID, marshalErr)
+							logging.Errorf("Error marshaling alert %s: %v", alert.UUID, marshalErr)
 							continue
 						}
-						dataChan <- append(jsonData, '\n')
+						result.lines.Add(1)
+						countSubtype(subtypes, jsonData)
+						batch.add(append(jsonData, '\n'))
 					}
 				} else {
-					log.Printf("Error checking for archive %s: %v", fileName, err)
+					logging.Errorf("Error checking for archive %s: %v", fileName, err)
+					result.failed.Store(true)
+				}
+				if fromArchive && s.verifyArchives {
+					s.verifyArchiveCount(ctx, date, fileName, loc, result)
 				}
 			}
+			batch.flush()
 		}()
 	}
 
@@ -511,6 +1505,1616 @@ func (s *server) alertsHandler(w http.ResponseWriter, r *http.Request) {
 	wg.Wait()
 	close(dataChan)
 	<-writerDone
+
+	for _, result := range results {
+		s.stats.alertsStreamed.Add(result.lines.Load())
+	}
+	if includeSummary {
+		line, err := json.Marshal(models.StreamSummaryLine{Summary: streamSummary(dates, results)})
+		if err != nil {
+			logging.Errorf("Error marshaling stream summary: %v", err)
+			return
+		}
+		if _, err := (&countingWriter{w: w, n: &s.stats.bytesStreamed}).Write(append(line, '\n')); err != nil {
+			logging.Errorf("Error writing stream summary: %v", err)
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// streamSummary totals the lines served for dates by source
+func streamSummary(dates []time.Time, results map[string]*dateResult) models.StreamSummary {
+	summary := models.StreamSummary{Dates: make([]string, 0, len(dates))}
+	for _, date := range dates {
+		key := date.Format("2006-01-02")
+		summary.Dates = append(summary.Dates, key)
+		result := results[key]
+		lines := result.lines.Load()
+		summary.Total += lines
+		if result.firestore.Load() {
+			summary.Sources.Firestore += lines
+		} else {
+			summary.Sources.Archive += lines
+		}
+	}
+	return summary
+}
+
+// lineBatcher joins newline-terminated lines into batches of up to max lines
+// before sending them, so a worker makes one channel send per batch rather
+// than per line. Batches are only ever split back on newlines.
+type lineBatcher struct {
+	out     chan<- []byte
+	max     int           // one or less sends every line on its own
+	blocked *atomic.Int64 // counts sends that had to wait for the writer
+	buf     []byte
+	lines   int
+}
+
+// add queues a line, sending the batch once it holds max lines
+func (b *lineBatcher) add(line []byte) {
+	if b.max <= 1 {
+		b.send(line)
+		return
+	}
+	b.buf = append(b.buf, line...)
+	b.lines++
+	if b.lines >= b.max {
+		b.flush()
+	}
+}
+
+// flush sends any queued lines
+func (b *lineBatcher) flush() {
+	if b.lines == 0 {
+		return
+	}
+	b.send(b.buf)
+	b.buf = nil // The receiver owns the sent batch
+	b.lines = 0
+}
+
+// send hands data to the writer, counting sends that block
+func (b *lineBatcher) send(data []byte) {
+	select {
+	case b.out <- data:
+	default:
+		if b.blocked != nil {
+			b.blocked.Add(1)
+		}
+		b.out <- data
+	}
+}
+
+// countingWriter adds the number of bytes written through it to n
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// geoJSONSeqRecord converts a JSONL alert line into an RFC 8142 record: the
+// alert as a GeoJSON Feature, prefixed with a record separator (0x1E) and
+// terminated by a newline. Alerts without a location are skipped.
+func (s *server) geoJSONSeqRecord(line []byte) ([]byte, bool) {
+	var alert models.PoliceAlert
+	if err := json.Unmarshal(line, &alert); err != nil {
+		logging.Warnf("Skipping unparseable alert line for GeoJSON: %v", err)
+		return nil, false
+	}
+	if alert.LocationGeo == nil {
+		return nil, false
+	}
+
+	feature := models.GeoJSONFeature{
+		Type: "Feature",
+		Geometry: models.GeoJSONPoint{
+			Type:        "Point",
+			Coordinates: [2]float64{alert.LocationGeo.GetLongitude(), alert.LocationGeo.GetLatitude()},
+		},
+		Properties: map[string]interface{}{
+			"uuid":         alert.UUID,
+			"type":         alert.Type,
+			"subtype":      alert.Subtype,
+			"street":       truncateRunes(alert.Street, s.geoJSONMaxFieldRunes),
+			"city":         truncateRunes(alert.City, s.geoJSONMaxFieldRunes),
+			"reliability":  alert.Reliability,
+			"confidence":   alert.Confidence,
+			"publish_time": alert.PublishTime,
+			"expire_time":  alert.ExpireTime,
+		},
+	}
+	data, err := json.Marshal(feature)
+	if err != nil {
+		logging.Errorf("Error marshaling GeoJSON feature for %s: %v", alert.UUID, err)
+		return nil, false
+	}
+
+	record := make([]byte, 0, len(data)+2)
+	record = append(record, 0x1e)
+	record = append(record, data...)
+	return append(record, '\n'), true
+}
+
+// truncationIndicator ends a field shortened by truncateRunes
+const truncationIndicator = "…"
+
+// truncateRunes shortens s to at most max characters, ending it with
+// truncationIndicator when anything was cut. It counts and cuts whole runes so
+// a multibyte character is never split. A max below 2 leaves s unchanged.
+func truncateRunes(s string, max int) string {
+	if max < 2 || utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	kept := 0
+	for i := range s {
+		if kept == max-1 {
+			return s[:i] + truncationIndicator
+		}
+		kept++
+	}
+	return s
+}
+
+// parseView returns the requested alert view, defaulting to viewFull, and
+// whether it is valid
+func parseView(view string) (string, bool) {
+	switch view {
+	case "", viewFull:
+		return viewFull, true
+	case viewSummary:
+		return viewSummary, true
+	}
+	return view, false
+}
+
+// summarizeAlert projects an alert onto its latest state
+func (s *server) summarizeAlert(alert models.PoliceAlert) models.PoliceAlertSummary {
+	summary := models.PoliceAlertSummary{
+		UUID:          alert.UUID,
+		Type:          alert.Type,
+		Subtype:       alert.Subtype,
+		Street:        alert.Street,
+		City:          alert.City,
+		Country:       alert.Country,
+		LocationGeo:   alert.LocationGeo,
+		Reliability:   alert.Reliability,
+		Confidence:    alert.Confidence,
+		PublishTime:   alert.PublishTime,
+		ExpireTime:    alert.ExpireTime,
+		ActiveMillis:  alert.ActiveMillis,
+		NThumbsUpLast: alert.NThumbsUpLast,
+	}
+	if s.durationHuman {
+		summary.DurationHuman = humanDuration(alert.ActiveMillis)
+	}
+	if s.temporalLoc != nil {
+		summary.DayOfWeek, summary.ISOWeek = temporalFields(alert.PublishTime, s.temporalLoc)
+	}
+	if s.sinceLastSeen && !alert.ExpireTime.IsZero() {
+		seconds := secondsSinceLastSeen(alert.ExpireTime, s.clock())
+		summary.SecondsSinceLastSeen = &seconds
+	}
+	return summary
+}
+
+// summaryRecord converts a JSONL alert line into its summary view. Lines that
+// cannot be parsed are skipped.
+func (s *server) summaryRecord(line []byte) ([]byte, bool) {
+	var alert models.PoliceAlert
+	if err := json.Unmarshal(line, &alert); err != nil {
+		logging.Warnf("Skipping unparseable alert line for summary view: %v", err)
+		return nil, false
+	}
+	data, err := json.Marshal(s.summarizeAlert(alert))
+	if err != nil {
+		logging.Errorf("Error marshaling alert summary for %s: %v", alert.UUID, err)
+		return nil, false
+	}
+	return append(data, '\n'), true
+}
+
+// addDerivedFields fills in the enabled display fields computed from each
+// alert, and the path of the document it was read from when debug is set
+func (s *server) addDerivedFields(alerts []models.PoliceAlert, debug bool) {
+	now := s.clock()
+	for i := range alerts {
+		if debug {
+			alerts[i].DocPath = alerts[i].SourcePath
+		}
+		if s.durationHuman {
+			alerts[i].DurationHuman = humanDuration(alerts[i].ActiveMillis)
+		}
+		if s.temporalLoc != nil {
+			alerts[i].DayOfWeek, alerts[i].ISOWeek = temporalFields(alerts[i].PublishTime, s.temporalLoc)
+		}
+		if s.sinceLastSeen && !alerts[i].ExpireTime.IsZero() {
+			seconds := secondsSinceLastSeen(alerts[i].ExpireTime, now)
+			alerts[i].SecondsSinceLastSeen = &seconds
+		}
+	}
+}
+
+// derivedFieldsRecord appends the enabled display fields ("duration_human",
+// "day_of_week", "iso_week" and "seconds_since_last_seen") to a JSONL alert
+// line without re-encoding it. Lines that cannot be parsed are passed through
+// unchanged.
+func (s *server) derivedFieldsRecord(line []byte) ([]byte, bool) {
+	var alert models.PoliceAlert
+	if err := json.Unmarshal(line, &alert); err != nil {
+		return line, true
+	}
+	body := bytes.TrimRight(line, "\n")
+	if len(body) < 2 || body[len(body)-1] != '}' {
+		return line, true
+	}
+
+	var fields []string
+	var values []any
+	if s.durationHuman {
+		fields = append(fields, "duration_human")
+		values = append(values, humanDuration(alert.ActiveMillis))
+	}
+	if s.temporalLoc != nil && !alert.PublishTime.IsZero() {
+		day, week := temporalFields(alert.PublishTime, s.temporalLoc)
+		fields = append(fields, "day_of_week", "iso_week")
+		values = append(values, day, week)
+	}
+	if s.sinceLastSeen && !alert.ExpireTime.IsZero() {
+		fields = append(fields, "seconds_since_last_seen")
+		values = append(values, secondsSinceLastSeen(alert.ExpireTime, s.clock()))
+	}
+
+	out := make([]byte, 0, len(line)+64)
+	out = append(out, body[:len(body)-1]...)
+	hasFields := len(bytes.TrimSpace(body[1:len(body)-1])) > 0
+	for i, field := range fields {
+		value, err := json.Marshal(values[i])
+		if err != nil {
+			return line, true
+		}
+		if hasFields {
+			out = append(out, ',')
+		}
+		hasFields = true
+		out = append(out, '"')
+		out = append(out, field...)
+		out = append(out, '"', ':')
+		out = append(out, value...)
+	}
+	return append(out, '}', '\n'), true
+}
+
+// parseDebug reads the debug parameter, reporting false for a valid value
+// unless document paths are exposed
+func (s *server) parseDebug(v string) (debug bool, ok bool) {
+	switch v {
+	case "", "false":
+		return false, true
+	case "true":
+		return s.docPaths, true
+	}
+	return false, false
+}
+
+// temporalFields returns the weekday name and ISO 8601 week ("2006-W01") of t
+// in loc. The ISO week year can differ from the calendar year around New Year.
+func temporalFields(t time.Time, loc *time.Location) (string, string) {
+	local := t.In(loc)
+	year, week := local.ISOWeek()
+	return local.Weekday().String(), fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// secondsSinceLastSeen is the whole seconds from an alert's ExpireTime, when
+// the scraper last saw it, to now. It is never negative.
+func secondsSinceLastSeen(expire, now time.Time) int64 {
+	return max(int64(now.Sub(expire)/time.Second), 0)
+}
+
+// humanDuration formats milliseconds using its two largest units, e.g. "45s",
+// "2h 15m" or "3d 4h". A zero second unit is omitted ("2h"); zero and negative
+// durations are "0s".
+func humanDuration(ms int64) string {
+	if ms < 1000 {
+		return "0s"
+	}
+	units := []struct {
+		suffix string
+		size   int64
+	}{
+		{"d", 24 * 60 * 60},
+		{"h", 60 * 60},
+		{"m", 60},
+		{"s", 1},
+	}
+
+	remaining := ms / 1000
+	for i, unit := range units {
+		if remaining < unit.size {
+			continue
+		}
+		result := fmt.Sprintf("%d%s", remaining/unit.size, unit.suffix)
+		if i+1 < len(units) {
+			next := units[i+1]
+			if n := remaining % unit.size / next.size; n > 0 {
+				result += fmt.Sprintf(" %d%s", n, next.suffix)
+			}
+		}
+		return result
+	}
+	return "0s"
+}
+
+// prewarm reads the archives of the last days days (yesterday back, in
+// Canberra time) into warmArchives. Days without an archive are skipped.
+func (s *server) prewarm(ctx context.Context, days int) {
+	loc, err := time.LoadLocation("Australia/Canberra")
+	if err != nil {
+		logging.Errorf("Error loading location for pre-warming: %v", err)
+		return
+	}
+
+	today := s.clock().In(loc)
+	warmed := 0
+	for i := 1; i <= days; i++ {
+		fileName := fmt.Sprintf("%s.jsonl", today.AddDate(0, 0, -i).Format("2006-01-02"))
+		lines, err := s.readArchiveLines(ctx, fileName)
+		if err != nil {
+			if !storage.IsObjectNotExist(err) {
+				logging.Errorf("Error pre-warming archive %s: %v", fileName, err)
+			}
+			continue
+		}
+		s.warmArchives.put(fileName, lines, s.clock())
+		warmed++
+	}
+	logging.Infof("Pre-warmed %d of the last %d days' archives", warmed, days)
+}
+
+// readArchiveBuffered reads a whole archive into lines, sharing the read with
+// concurrent requests when coalescing is enabled and remembering it for stale
+// serving when that is enabled
+func (s *server) readArchiveBuffered(ctx context.Context, fileName string) ([][]byte, error) {
+	var lines [][]byte
+	var err error
+	if s.archiveReads != nil {
+		lines, err = s.readArchiveShared(ctx, fileName)
+	} else {
+		lines, err = s.readArchiveLines(ctx, fileName)
+	}
+	if err == nil && s.staleArchives != nil {
+		s.staleArchives.put(fileName, lines, s.clock())
+	}
+	return lines, err
+}
+
+// readArchiveShared returns the normalized lines of an archive. Concurrent
+// callers for the same archive share a single GCS read and its result.
+func (s *server) readArchiveShared(ctx context.Context, fileName string) ([][]byte, error) {
+	v, err, _ := s.archiveReads.Do(fileName, func() (interface{}, error) {
+		return s.readArchiveLines(ctx, fileName)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([][]byte), nil
+}
+
+// readArchiveLines reads a whole archive into normalized lines, skipping blank ones
+func (s *server) readArchiveLines(ctx context.Context, fileName string) ([][]byte, error) {
+	reader, err := s.openArchive(ctx, fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	lines := [][]byte{}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		if line := normalizeLine(scanner.Bytes()); line != nil {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read archive %s: %w", fileName, err)
+	}
+	return lines, nil
+}
+
+// openArchive opens an archive object for reading as JSONL. Archives uploaded gzipped (with
+// Content-Encoding: gzip) are returned as-is when GCS does not transcode them, so
+// gzip content is detected by its magic bytes and decompressed here. MessagePack
+// archives (ARCHIVE_FORMAT=msgpack in the archive service) are converted to JSONL lines.
+func (s *server) openArchive(ctx context.Context, fileName string) (io.ReadCloser, error) {
+	reader, err := s.storageClient.Bucket(s.bucketName).Object(fileName).NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return storage.OpenArchive(reader)
+}
+
+// requestWorkers returns the worker count for a request: the default when
+// param is empty, otherwise param clamped to 1..maxWorkers. It reports false if
+// param is not an integer.
+func (s *server) requestWorkers(param string) (int, bool) {
+	maxWorkers := s.maxWorkers
+	if maxWorkers <= 0 {
+		maxWorkers = defaultMaxWorkers
+	}
+	if param == "" {
+		return min(defaultWorkers, maxWorkers), true
+	}
+
+	n, err := strconv.Atoi(param)
+	if err != nil {
+		return 0, false
+	}
+	return max(1, min(n, maxWorkers)), true
+}
+
+// flushThresholds returns the configured flush size and interval, falling back to defaults
+func (s *server) flushThresholds() (int, time.Duration) {
+	flushBytes, flushInterval := s.flushBytes, s.flushInterval
+	if flushBytes <= 0 {
+		flushBytes = defaultFlushBytes
+	}
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
+	return flushBytes, flushInterval
+}
+
+// writeStream writes data from dataChan to w, flushing once at least flushBytes
+// have been written since the last flush, or when flushInterval elapses with
+// unflushed data, and always at end of stream. It returns the number of flushes.
+// After a write error the remaining data is drained so senders never block.
+func writeStream(w io.Writer, flusher http.Flusher, dataChan <-chan []byte, flushBytes int, flushInterval time.Duration) int {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	flushes := 0
+	pending := 0
+	failed := false
+	flush := func() {
+		if pending > 0 {
+			flusher.Flush()
+			flushes++
+			pending = 0
+		}
+	}
+
+	for {
+		select {
+		case data, ok := <-dataChan:
+			if !ok {
+				if !failed {
+					flush()
+				}
+				return flushes
+			}
+			if failed {
+				continue
+			}
+			if _, err := w.Write(data); err != nil {
+				logging.Errorf("Error writing response: %v", err)
+				failed = true // Stop writing if there's an error
+				continue
+			}
+			pending += len(data)
+			if pending >= flushBytes {
+				flush()
+			}
+		case <-ticker.C:
+			if !failed {
+				flush()
+			}
+		}
+	}
+}
+
+// parseDate parses a request date as YYYY-MM-DD, falling back to any
+// configured alternate layouts in order. Callers format the result back to
+// YYYY-MM-DD so alternate layouts never reach archive names or queries.
+func (s *server) parseDate(ds string, loc *time.Location) (time.Time, error) {
+	date, err := time.ParseInLocation("2006-01-02", ds, loc)
+	if err == nil {
+		return date, nil
+	}
+	for _, layout := range s.dateLayouts {
+		if date, layoutErr := time.ParseInLocation(layout, ds, loc); layoutErr == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// clock returns the current time, from s.now when set
+func (s *server) clock() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
+
+// isOutOfRange reports whether a date falls outside the collection period, i.e. it
+// is before the configured data start date or after today in the given location.
+func (s *server) isOutOfRange(date time.Time, loc *time.Location) bool {
+	today := s.clock().In(loc)
+	endOfToday := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, 1)
+	return date.Before(s.dataStartDate) || !date.Before(endOfToday)
+}
+
+// archiveCache keeps the most recently read archives so they can be served
+// stale when GCS errors. Entries older than maxAge are not served.
+type archiveCache struct {
+	mu         sync.Mutex
+	entries    map[string]cachedArchive
+	maxAge     time.Duration
+	maxEntries int
+}
+
+// cachedArchive is an archive's lines and when they were read from GCS
+type cachedArchive struct {
+	lines  [][]byte
+	readAt time.Time
+}
+
+func newArchiveCache(maxAge time.Duration, maxEntries int) *archiveCache {
+	return &archiveCache{
+		entries:    make(map[string]cachedArchive),
+		maxAge:     maxAge,
+		maxEntries: maxEntries,
+	}
+}
+
+// put stores an archive's lines, evicting the least recently read archive when full
+func (c *archiveCache) put(fileName string, lines [][]byte, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[fileName]; !ok && len(c.entries) >= c.maxEntries {
+		var oldest string
+		for name, entry := range c.entries {
+			if oldest == "" || entry.readAt.Before(c.entries[oldest].readAt) {
+				oldest = name
+			}
+		}
+		delete(c.entries, oldest)
+	}
+	c.entries[fileName] = cachedArchive{lines: lines, readAt: now}
+}
+
+// get returns an archive's cached lines if they were read within maxAge
+func (c *archiveCache) get(fileName string, now time.Time) ([][]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[fileName]
+	if !ok || now.Sub(entry.readAt) > c.maxAge {
+		return nil, false
+	}
+	return entry.lines, true
+}
+
+// Archive object metadata written by the archive service
+const (
+	archiveCountMetadataKey   = "alert_count" // number of alerts in the archive
+	archiveFiltersMetadataKey = "filters"     // settings that left overlapping alerts out
+)
+
+// verifyArchiveCount compares the alert count of a date's archive with a
+// Firestore count of the same day and flags the date as diverged when Firestore
+// has more, which means the archive was written before collection finished.
+// Firestore having fewer is expected once archived alerts are deleted from it.
+//
+// The archive's count is its alert_count metadata, so lines skipped as invalid
+// don't count against it, or the lines served for archives without one.
+// Archives recording filters (a publish-day span policy or a minimum
+// confidence) intentionally hold fewer alerts than Firestore and are not checked.
+func (s *server) verifyArchiveCount(ctx context.Context, date time.Time, fileName string, loc *time.Location, result *dateResult) {
+	archived := result.lines.Load()
+	attrs, err := s.storageClient.Bucket(s.bucketName).Object(fileName).Attrs(ctx)
+	if err != nil {
+		logging.Warnf("Error reading archive metadata for %s, verifying served lines: %v", fileName, err)
+	} else {
+		if filters := attrs.Metadata[archiveFiltersMetadataKey]; filters != "" {
+			return
+		}
+		if v, ok := attrs.Metadata[archiveCountMetadataKey]; ok {
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				archived = n
+			} else {
+				logging.Warnf("Ignoring invalid %s metadata %q on %s", archiveCountMetadataKey, v, fileName)
+			}
+		}
+	}
+
+	startOfDay := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, loc)
+	endOfDay := startOfDay.Add(24*time.Hour - time.Second)
+	count, err := s.firestoreClient.CountPoliceAlertsByDateRange(ctx, startOfDay, endOfDay)
+	if err != nil {
+		logging.Errorf("Error counting Firestore alerts to verify archive for %s: %v", date.Format("2006-01-02"), err)
+		return
+	}
+	if count > archived {
+		logging.Warnf("Archive for %s diverges from Firestore: %d archived alerts, %d in Firestore", date.Format("2006-01-02"), archived, count)
+		result.diverged.Store(true)
+	}
+}
+
+// formatDateStatus builds the X-Date-Status value, e.g. "2024-01-01=ok,2024-01-02=empty".
+// Dates are listed in chronological order.
+func formatDateStatus(results map[string]*dateResult, outOfRange []time.Time) string {
+	statuses := make(map[string]string, len(results)+len(outOfRange))
+	for date, result := range results {
+		switch {
+		case result.stale.Load():
+			statuses[date] = dateStatusStale
+		case result.unavailable.Load():
+			statuses[date] = dateStatusUnavailable
+		case result.failed.Load():
+			statuses[date] = dateStatusError
+		case result.diverged.Load():
+			statuses[date] = dateStatusDiverged
+		case result.lines.Load() > 0:
+			statuses[date] = dateStatusOK
+		default:
+			statuses[date] = dateStatusEmpty
+		}
+	}
+	for _, date := range outOfRange {
+		statuses[date.Format("2006-01-02")] = dateStatusOutOfRange
+	}
+
+	keys := make([]string, 0, len(statuses))
+	for date := range statuses {
+		keys = append(keys, date)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, date := range keys {
+		parts = append(parts, date+"="+statuses[date])
+	}
+	return strings.Join(parts, ",")
+}
+
+// normalizeLine returns a copy of an archive line terminated by a single '\n'.
+// Surrounding whitespace (including the '\r' of CRLF line endings) is stripped,
+// and blank lines return nil so they can be skipped. Callers check the line
+// with skipInvalidLine before serving it when line validation is enabled.
+func normalizeLine(line []byte) []byte {
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == 0 {
+		return nil
+	}
+	out := make([]byte, len(trimmed)+1)
+	copy(out, trimmed)
+	out[len(trimmed)] = '\n'
+	return out
+}
+
+// queryError writes a 500 response for a failed Firestore query. When the
+// query failed for a missing composite index and exposeIndexErrors is set, the
+// message names the index and how to create it.
+func (s *server) queryError(w http.ResponseWriter, msg string, err error) {
+	var indexErr *storage.MissingIndexError
+	if s.exposeIndexErrors && errors.As(err, &indexErr) {
+		msg += ": " + indexErr.Error()
+	}
+	http.Error(w, msg, http.StatusInternalServerError)
+}
+
+// heatmapHandler returns streets ranked by alert count for the requested dates
+func (s *server) heatmapHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed. Use POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.HeatmapRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Dates) == 0 {
+		http.Error(w, "At least one date is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Dates) > 7 {
+		http.Error(w, "Query limited to a maximum of 7 dates.", http.StatusBadRequest)
+		return
+	}
+	// Normalize to YYYY-MM-DD, which the store expects
+	dates := make([]string, len(req.Dates))
+	for i, ds := range req.Dates {
+		date, err := s.parseDate(ds, time.UTC)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid date format for '%s', use YYYY-MM-DD", ds), http.StatusBadRequest)
+			return
+		}
+		dates[i] = date.Format("2006-01-02")
+	}
+
+	streets, err := s.firestoreClient.GetStreetHeatmap(r.Context(), dates)
+	if err != nil {
+		logging.Errorf("Failed to build street heatmap: %v", err)
+		s.queryError(w, "Failed to build heatmap", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(models.HeatmapResponse{
+		Streets:      streets,
+		DatesQueried: dates,
+	}); err != nil {
+		logging.Errorf("Failed to encode heatmap response: %v", err)
+	}
+}
+
+// diffHandler compares the alerts of two days, returning added and removed UUIDs
+// and metric changes for alerts present on both
+func (s *server) diffHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed. Use POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.DiffRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	loc := archiveLoc
+	var days [2][]models.PoliceAlert
+	var canonical [2]string
+	for i, ds := range []string{req.DateA, req.DateB} {
+		date, err := s.parseDate(ds, loc)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid date format for '%s', use YYYY-MM-DD", ds), http.StatusBadRequest)
+			return
+		}
+		canonical[i] = date.Format("2006-01-02")
+
+		days[i], err = s.loadDayAlerts(r.Context(), date, loc)
+		if err != nil {
+			logging.Errorf("Failed to load alerts for %s: %v", ds, err)
+			s.queryError(w, fmt.Sprintf("Failed to load alerts for %s", ds), err)
+			return
+		}
+	}
+
+	resp := diffAlerts(days[0], days[1])
+	resp.DateA = canonical[0]
+	resp.DateB = canonical[1]
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logging.Errorf("Failed to encode diff response: %v", err)
+	}
+}
+
+// syncHandler returns alerts updated after the since timestamp (RFC 3339) for
+// clients maintaining a local mirror. The response's next_since is passed as
+// since on the following request; an empty page means the client is up to date.
+func (s *server) syncHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed. Use GET", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid since '%s', use an RFC 3339 timestamp", v), http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit := defaultSyncLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSyncLimit {
+			http.Error(w, fmt.Sprintf("Invalid limit '%s', must be between 1 and %d", v, maxSyncLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	view, ok := parseView(r.URL.Query().Get("view"))
+	if !ok {
+		http.Error(w, fmt.Sprintf("Invalid 'view' parameter '%s', use %s or %s", view, viewFull, viewSummary), http.StatusBadRequest)
+		return
+	}
+	debug, ok := s.parseDebug(r.URL.Query().Get("debug"))
+	if !ok {
+		http.Error(w, fmt.Sprintf("Invalid 'debug' parameter '%s', use true or false", r.URL.Query().Get("debug")), http.StatusBadRequest)
+		return
+	}
+	if debug && view == viewSummary {
+		http.Error(w, "debug=true is only supported for the full view", http.StatusBadRequest)
+		return
+	}
+
+	alerts, nextSince, err := s.firestoreClient.GetPoliceAlertsUpdatedSince(r.Context(), since, limit)
+	if err != nil {
+		logging.Errorf("Failed to query alerts updated since %s: %v", since.Format(time.RFC3339Nano), err)
+		s.queryError(w, "Failed to sync alerts", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if view == viewSummary {
+		summaries := make([]models.PoliceAlertSummary, len(alerts))
+		for i, alert := range alerts {
+			summaries[i] = s.summarizeAlert(alert)
+		}
+		if err := json.NewEncoder(w).Encode(models.SyncSummaryResponse{
+			Alerts:    summaries,
+			NextSince: nextSince,
+		}); err != nil {
+			logging.Errorf("Failed to encode sync response: %v", err)
+		}
+		return
+	}
+	s.addDerivedFields(alerts, debug)
+	if err := json.NewEncoder(w).Encode(models.SyncResponse{
+		Alerts:    alerts,
+		NextSince: nextSince,
+	}); err != nil {
+		logging.Errorf("Failed to encode sync response: %v", err)
+	}
+}
+
+// activeAtHandler returns the alerts active at the instant given by ts, an
+// RFC 3339 timestamp: those published at or before it and last seen at or after it
+func (s *server) activeAtHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed. Use GET", http.StatusMethodNotAllowed)
+		return
+	}
+
+	v := r.URL.Query().Get("ts")
+	if v == "" {
+		http.Error(w, "Missing 'ts' parameter, use an RFC 3339 timestamp", http.StatusBadRequest)
+		return
+	}
+	at, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid ts '%s', use an RFC 3339 timestamp", v), http.StatusBadRequest)
+		return
+	}
+	near, err := parseNear(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	debug, ok := s.parseDebug(r.URL.Query().Get("debug"))
+	if !ok {
+		http.Error(w, fmt.Sprintf("Invalid 'debug' parameter '%s', use true or false", r.URL.Query().Get("debug")), http.StatusBadRequest)
+		return
+	}
+
+	alerts, err := s.firestoreClient.GetPoliceAlertsActiveAt(r.Context(), at)
+	if err != nil {
+		logging.Errorf("Failed to query alerts active at %s: %v", at.Format(time.RFC3339Nano), err)
+		s.queryError(w, "Failed to query active alerts", err)
+		return
+	}
+	if near != nil {
+		alerts = near.sort(alerts)
+	}
+	s.addDerivedFields(alerts, debug)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(models.ActiveAtResponse{
+		At:     at,
+		Alerts: alerts,
+	}); err != nil {
+		logging.Errorf("Failed to encode active-at response: %v", err)
+	}
+}
+
+// earthRadiusKm is the mean Earth radius used for haversine distances
+const earthRadiusKm = 6371.0
+
+// nearPoint orders alerts by distance from a point, optionally within a radius
+type nearPoint struct {
+	lat, lng float64
+	radiusKm float64 // zero means no radius limit
+}
+
+// parseNear reads the optional near_lat, near_lng and radius_km parameters.
+// It returns nil when no point was requested.
+func parseNear(query url.Values) (*nearPoint, error) {
+	latParam, lngParam, radiusParam := query.Get("near_lat"), query.Get("near_lng"), query.Get("radius_km")
+	if latParam == "" && lngParam == "" {
+		if radiusParam != "" {
+			return nil, fmt.Errorf("'radius_km' requires 'near_lat' and 'near_lng'")
+		}
+		return nil, nil
+	}
+
+	lat, err := strconv.ParseFloat(latParam, 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return nil, fmt.Errorf("Invalid near_lat '%s', must be between -90 and 90", latParam)
+	}
+	lng, err := strconv.ParseFloat(lngParam, 64)
+	if err != nil || lng < -180 || lng > 180 {
+		return nil, fmt.Errorf("Invalid near_lng '%s', must be between -180 and 180", lngParam)
+	}
+	near := &nearPoint{lat: lat, lng: lng}
+	if radiusParam != "" {
+		near.radiusKm, err = strconv.ParseFloat(radiusParam, 64)
+		if err != nil || !(near.radiusKm > 0) {
+			return nil, fmt.Errorf("Invalid radius_km '%s', must be a positive number", radiusParam)
+		}
+	}
+	return near, nil
+}
+
+// sort returns the alerts with a location, nearest first, leaving out those
+// beyond the radius. Alerts at equal distances keep their original order.
+func (p *nearPoint) sort(alerts []models.PoliceAlert) []models.PoliceAlert {
+	type ranked struct {
+		alert models.PoliceAlert
+		km    float64
+	}
+	candidates := make([]ranked, 0, len(alerts))
+	for _, alert := range alerts {
+		if alert.LocationGeo == nil {
+			continue
+		}
+		km := haversineKm(p.lat, p.lng, alert.LocationGeo.GetLatitude(), alert.LocationGeo.GetLongitude())
+		if p.radiusKm > 0 && km > p.radiusKm {
+			continue
+		}
+		candidates = append(candidates, ranked{alert: alert, km: km})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].km < candidates[j].km
+	})
+
+	sorted := make([]models.PoliceAlert, len(candidates))
+	for i, c := range candidates {
+		sorted[i] = c.alert
+	}
+	return sorted
+}
+
+// haversineKm returns the great-circle distance in kilometres between two points
+func haversineKm(lat1, lng1, lat2, lng2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLng := (lng2 - lng1) * toRad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(math.Min(1, a)))
+}
+
+// maxTimeSeriesBuckets bounds the count queries a single /api/timeseries request runs
+const maxTimeSeriesBuckets = 400
+
+// Time series intervals accepted by /api/timeseries
+const (
+	intervalDay  = "day"
+	intervalHour = "hour"
+)
+
+// timeSeriesHandler returns the number of alerts published in each day or hour
+// from start to end (inclusive Canberra dates)
+func (s *server) timeSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed. Use GET", http.StatusMethodNotAllowed)
+		return
+	}
+
+	loc := archiveLoc
+	query := r.URL.Query()
+	start, err := s.parseDate(query.Get("start"), loc)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid start '%s', use YYYY-MM-DD", query.Get("start")), http.StatusBadRequest)
+		return
+	}
+	end, err := s.parseDate(query.Get("end"), loc)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid end '%s', use YYYY-MM-DD", query.Get("end")), http.StatusBadRequest)
+		return
+	}
+	if end.Before(start) {
+		http.Error(w, "end must not be before start", http.StatusBadRequest)
+		return
+	}
+	interval := query.Get("interval")
+	if interval == "" {
+		interval = intervalDay
+	}
+	if interval != intervalDay && interval != intervalHour {
+		http.Error(w, fmt.Sprintf("Invalid interval '%s', use %s or %s", interval, intervalDay, intervalHour), http.StatusBadRequest)
+		return
+	}
+
+	edges := timeSeriesEdges(start, end.AddDate(0, 0, 1), interval)
+	if len(edges)-1 > maxTimeSeriesBuckets {
+		http.Error(w, fmt.Sprintf("Range too large: %d buckets, maximum is %d", len(edges)-1, maxTimeSeriesBuckets), http.StatusBadRequest)
+		return
+	}
+
+	counts, err := s.firestoreClient.CountPoliceAlertsPublished(r.Context(), edges)
+	if err != nil {
+		logging.Errorf("Failed to count alerts from %s to %s: %v", start.Format("2006-01-02"), end.Format("2006-01-02"), err)
+		s.queryError(w, "Failed to build time series", err)
+		return
+	}
+
+	buckets := make([]models.TimeSeriesBucket, len(counts))
+	for i, count := range counts {
+		buckets[i] = models.TimeSeriesBucket{Start: edges[i], Count: count}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(models.TimeSeriesResponse{
+		Interval: interval,
+		Buckets:  buckets,
+	}); err != nil {
+		logging.Errorf("Failed to encode time series response: %v", err)
+	}
+}
+
+// timeSeriesEdges returns the bucket boundaries from start to end. Days follow
+// the calendar of start's location, so days around a daylight saving change
+// are 23 or 25 hours long and hold that many hourly buckets. It stops once
+// there are more than maxTimeSeriesBuckets buckets.
+func timeSeriesEdges(start, end time.Time, interval string) []time.Time {
+	edges := []time.Time{start}
+	for t := start; t.Before(end) && len(edges) <= maxTimeSeriesBuckets+1; {
+		if interval == intervalHour {
+			t = t.Add(time.Hour)
+		} else {
+			t = t.AddDate(0, 0, 1)
+		}
+		edges = append(edges, t)
+	}
+	return edges
+}
+
+// defaultDownloadMaxDays is the longest range /download accepts unless configured
+const defaultDownloadMaxDays = 31
+
+// defaultDownloadWorkers is the number of days /download reads at once unless configured
+const defaultDownloadWorkers = 4
+
+// downloadHandler serves the alerts from start to end (inclusive Canberra
+// dates) as one JSONL attachment, each day's archive in date order with
+// Firestore used for days not yet archived. Days are written as they are read,
+// so a day that fails after output has been sent aborts the response and the
+// client sees a truncated transfer rather than a silently missing day.
+func (s *server) downloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed. Use GET", http.StatusMethodNotAllowed)
+		return
+	}
+
+	loc := archiveLoc
+	query := r.URL.Query()
+	start, err := s.parseDate(query.Get("start"), loc)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid start '%s', use YYYY-MM-DD", query.Get("start")), http.StatusBadRequest)
+		return
+	}
+	end, err := s.parseDate(query.Get("end"), loc)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid end '%s', use YYYY-MM-DD", query.Get("end")), http.StatusBadRequest)
+		return
+	}
+	if end.Before(start) {
+		http.Error(w, "end must not be before start", http.StatusBadRequest)
+		return
+	}
+	var dates []time.Time
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		dates = append(dates, d)
+	}
+	maxDays := s.downloadMaxDays
+	if maxDays <= 0 {
+		maxDays = defaultDownloadMaxDays
+	}
+	if len(dates) > maxDays {
+		http.Error(w, fmt.Sprintf("Range too large: %d days, maximum is %d", len(dates), maxDays), http.StatusBadRequest)
+		return
+	}
+
+	fileName := fmt.Sprintf("police_alerts_%s_to_%s.jsonl", start.Format("2006-01-02"), end.Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/jsonl")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+
+	workers := s.downloadWorkers
+	if workers <= 0 {
+		workers = defaultDownloadWorkers
+	}
+
+	var sent atomic.Int64
+	bw := bufio.NewWriterSize(&countingWriter{w: w, n: &sent}, defaultFlushBytes)
+	if err := s.writeDaysOrdered(r.Context(), bw, dates, loc, workers); err != nil {
+		logging.Errorf("Failed to download %s: %v", fileName, err)
+		if sent.Load() == 0 {
+			// Nothing has reached the client, so the error can still be reported
+			w.Header().Del("Content-Disposition")
+			http.Error(w, "Failed to read alerts", http.StatusInternalServerError)
+			return
+		}
+		panic(http.ErrAbortHandler)
+	}
+	if err := bw.Flush(); err != nil {
+		logging.Errorf("Failed to write download %s: %v", fileName, err)
+	}
+}
+
+// dayLines is one day's JSONL read for /download
+type dayLines struct {
+	index int
+	data  []byte
+	err   error
+}
+
+// writeDaysOrdered reads up to workers dates at once and writes their lines to
+// w in the order of dates. Days that finish early wait in a reorder buffer
+// until every earlier day is written. A day's slot is only freed once it is
+// written, so at most workers days are held in memory.
+func (s *server) writeDaysOrdered(ctx context.Context, w io.Writer, dates []time.Time, loc *time.Location, workers int) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dayLines)
+	slots := make(chan struct{}, workers)
+	go func() {
+		var wg sync.WaitGroup
+		defer func() {
+			wg.Wait()
+			close(results)
+		}()
+		for i, date := range dates {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var buf bytes.Buffer
+				err := s.writeDayLines(ctx, &buf, date, loc)
+				if err != nil {
+					err = fmt.Errorf("%s: %w", date.Format("2006-01-02"), err)
+				}
+				select {
+				case results <- dayLines{index: i, data: buf.Bytes(), err: err}:
+				case <-ctx.Done():
+				}
+			}()
+		}
+	}()
+
+	pending := make(map[int]dayLines)
+	next := 0
+	for day := range results {
+		pending[day.index] = day
+		for {
+			ready, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			if ready.err != nil {
+				return ready.err
+			}
+			if _, err := w.Write(ready.data); err != nil {
+				return err
+			}
+			<-slots
+			next++
+		}
+	}
+	if next < len(dates) {
+		// Reading stopped early because the request was cancelled
+		return ctx.Err()
+	}
+	return nil
+}
+
+// writeDayLines writes a day's alerts to w as JSONL, from its archive when one
+// exists and otherwise from Firestore
+func (s *server) writeDayLines(ctx context.Context, w io.Writer, date time.Time, loc *time.Location) error {
+	fileName := fmt.Sprintf("%s.jsonl", date.Format("2006-01-02"))
+	reader, err := s.openArchive(ctx, fileName)
+	if err == nil {
+		defer reader.Close()
+
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+		for scanner.Scan() {
+			if line := normalizeLine(scanner.Bytes()); line != nil && !s.skipInvalidLine(fileName, line) {
+				if _, err := w.Write(line); err != nil {
+					return err
+				}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("failed to read archive %s: %w", fileName, err)
+		}
+		return nil
+	}
+	if !storage.IsObjectNotExist(err) {
+		return fmt.Errorf("failed to open archive %s: %w", fileName, err)
+	}
+
+	startOfDay := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, loc)
+	endOfDay := startOfDay.Add(24*time.Hour - time.Second)
+	alerts, err := s.firestoreClient.GetPoliceAlertsByDateRange(ctx, startOfDay, endOfDay)
+	if err != nil {
+		return err
+	}
+	for _, alert := range alerts {
+		data, err := json.Marshal(alert)
+		if err != nil {
+			logging.Errorf("Error marshaling alert %s: %v", alert.UUID, err)
+			continue
+		}
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// graphQLMaxDates is the most dates a GraphQL alerts or stats query accepts,
+// matching the REST endpoints
+const graphQLMaxDates = 7
+
+// graphQLSchema describes the /graphql endpoint. Alerts and stats are read
+// from Firestore with the same filters as the REST endpoints.
+const graphQLSchema = `
+schema {
+	query: Query
+}
+
+type Query {
+	# Alerts active on the dates (YYYY-MM-DD), optionally filtered by subtype,
+	# street and city
+	alerts(dates: [String!]!, subtypes: [String!], streets: [String!], city: String): [Alert!]!
+	# Alert counts for the dates, by subtype
+	stats(dates: [String!]!): Stats!
+}
+
+type Alert {
+	uuid: String!
+	type: String!
+	subtype: String!
+	street: String!
+	city: String!
+	lat: Float
+	lng: Float
+	reliability: Int!
+	confidence: Int!
+	publishTime: String!
+	expireTime: String!
+	activeMillis: Float!
+}
+
+type Stats {
+	dates: [String!]!
+	total: Int!
+	subtypes: [SubtypeCount!]!
+}
+
+type SubtypeCount {
+	subtype: String!
+	count: Int!
+}
+`
+
+// newGraphQLSchema parses graphQLSchema with resolvers reading from s's store
+func newGraphQLSchema(s *server) (*graphql.Schema, error) {
+	return graphql.ParseSchema(graphQLSchema, &graphQLResolver{s: s}, graphql.UseFieldResolvers())
+}
+
+// graphQLResolver resolves the Query type
+type graphQLResolver struct {
+	s *server
+}
+
+// graphQLAlert is the GraphQL view of a PoliceAlert
+type graphQLAlert struct {
+	UUID         string
+	Type         string
+	Subtype      string
+	Street       string
+	City         string
+	Lat          *float64
+	Lng          *float64
+	Reliability  int32
+	Confidence   int32
+	PublishTime  string
+	ExpireTime   string
+	ActiveMillis float64
+}
+
+// graphQLStats is the GraphQL view of alert counts for a set of dates
+type graphQLStats struct {
+	Dates    []string
+	Total    int32
+	Subtypes []*graphQLSubtypeCount
+}
+
+// graphQLSubtypeCount is the number of alerts of one subtype
+type graphQLSubtypeCount struct {
+	Subtype string
+	Count   int32
+}
+
+// Alerts resolves Query.alerts
+func (r *graphQLResolver) Alerts(ctx context.Context, args struct {
+	Dates    []string
+	Subtypes *[]string
+	Streets  *[]string
+	City     *string
+}) ([]*graphQLAlert, error) {
+	dates, err := r.s.graphQLDates(args.Dates)
+	if err != nil {
+		return nil, err
+	}
+	var filters models.AlertFilters
+	if args.Subtypes != nil {
+		filters.Subtypes = *args.Subtypes
+	}
+	if args.Streets != nil {
+		filters.Streets = *args.Streets
+	}
+	if args.City != nil && *args.City != "" {
+		filters.Cities = []string{*args.City}
+	}
+
+	alerts, err := r.s.firestoreClient.GetPoliceAlertsByDatesWithFilters(ctx, dates, filters)
+	if err != nil {
+		logging.Errorf("Failed to query alerts for GraphQL: %v", err)
+		return nil, errors.New("failed to query alerts")
+	}
+	out := make([]*graphQLAlert, len(alerts))
+	for i, alert := range alerts {
+		out[i] = newGraphQLAlert(alert)
+	}
+	return out, nil
+}
+
+// Stats resolves Query.stats
+func (r *graphQLResolver) Stats(ctx context.Context, args struct{ Dates []string }) (*graphQLStats, error) {
+	dates, err := r.s.graphQLDates(args.Dates)
+	if err != nil {
+		return nil, err
+	}
+	alerts, err := r.s.firestoreClient.GetPoliceAlertsByDatesWithFilters(ctx, dates, models.AlertFilters{})
+	if err != nil {
+		logging.Errorf("Failed to query alerts for GraphQL stats: %v", err)
+		return nil, errors.New("failed to query alerts")
+	}
+
+	counts := make(map[string]int32)
+	for _, alert := range alerts {
+		counts[alert.Subtype]++
+	}
+	stats := &graphQLStats{Dates: dates, Total: int32(len(alerts))}
+	for subtype, count := range counts {
+		stats.Subtypes = append(stats.Subtypes, &graphQLSubtypeCount{Subtype: subtype, Count: count})
+	}
+	sort.Slice(stats.Subtypes, func(i, j int) bool {
+		if stats.Subtypes[i].Count != stats.Subtypes[j].Count {
+			return stats.Subtypes[i].Count > stats.Subtypes[j].Count
+		}
+		return stats.Subtypes[i].Subtype < stats.Subtypes[j].Subtype
+	})
+	return stats, nil
+}
+
+// graphQLDates validates a query's dates and normalizes them to YYYY-MM-DD,
+// which the store expects
+func (s *server) graphQLDates(dates []string) ([]string, error) {
+	if len(dates) == 0 {
+		return nil, errors.New("at least one date is required")
+	}
+	if len(dates) > graphQLMaxDates {
+		return nil, fmt.Errorf("query limited to a maximum of %d dates", graphQLMaxDates)
+	}
+	out := make([]string, len(dates))
+	for i, ds := range dates {
+		date, err := s.parseDate(ds, time.UTC)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date format for '%s', use YYYY-MM-DD", ds)
+		}
+		out[i] = date.Format("2006-01-02")
+	}
+	return out, nil
+}
+
+// newGraphQLAlert converts an alert to its GraphQL view
+func newGraphQLAlert(alert models.PoliceAlert) *graphQLAlert {
+	out := &graphQLAlert{
+		UUID:         alert.UUID,
+		Type:         alert.Type,
+		Subtype:      alert.Subtype,
+		Street:       alert.Street,
+		City:         alert.City,
+		Reliability:  int32(alert.Reliability),
+		Confidence:   int32(alert.Confidence),
+		PublishTime:  alert.PublishTime.Format(time.RFC3339),
+		ExpireTime:   alert.ExpireTime.Format(time.RFC3339),
+		ActiveMillis: float64(alert.ActiveMillis),
+	}
+	if alert.LocationGeo != nil {
+		lat, lng := alert.LocationGeo.Latitude, alert.LocationGeo.Longitude
+		out.Lat, out.Lng = &lat, &lng
+	}
+	return out
+}
+
+// graphQLHandler executes a GraphQL query posted as JSON ({"query": ...,
+// "operationName": ..., "variables": ...}). Query errors are reported in the
+// response's errors list with status 200, as GraphQL clients expect.
+func (s *server) graphQLHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed. Use POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Query         string         `json:"query"`
+		OperationName string         `json:"operationName"`
+		Variables     map[string]any `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	resp := s.graphQL.Exec(r.Context(), req.Query, req.OperationName, req.Variables)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logging.Errorf("Failed to encode GraphQL response: %v", err)
+	}
+}
+
+// collectionStatsHandler reports the Firestore document count and an estimate of
+// the data stored, for planning teardown of the live collection
+func (s *server) collectionStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed. Use GET", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats, err := s.firestoreClient.GetCollectionStats(r.Context())
+	if err != nil {
+		logging.Errorf("Failed to get collection stats: %v", err)
+		http.Error(w, "Failed to get collection stats", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		logging.Errorf("Failed to encode collection stats: %v", err)
+	}
+}
+
+// statsHandler reports the /police_alerts counters
+func (s *server) statsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed. Use GET", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.stats.snapshot(s.alertCategories)); err != nil {
+		logging.Errorf("Failed to encode stats: %v", err)
+	}
+}
+
+// loadDayAlerts returns the alerts for a single day, preferring the GCS archive
+// (a snapshot taken after the day ended) and falling back to Firestore
+func (s *server) loadDayAlerts(ctx context.Context, date time.Time, loc *time.Location) ([]models.PoliceAlert, error) {
+	fileName := fmt.Sprintf("%s.jsonl", date.Format("2006-01-02"))
+	reader, err := s.openArchive(ctx, fileName)
+	if err == nil {
+		defer reader.Close()
+
+		var alerts []models.PoliceAlert
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+		for scanner.Scan() {
+			line := normalizeLine(scanner.Bytes())
+			if line == nil {
+				continue
+			}
+			var alert models.PoliceAlert
+			if err := json.Unmarshal(line, &alert); err != nil {
+				logging.Warnf("Skipping malformed line in %s: %v", fileName, err)
+				continue
+			}
+			alerts = append(alerts, alert)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read archive %s: %w", fileName, err)
+		}
+		return alerts, nil
+	}
+	if !storage.IsObjectNotExist(err) {
+		return nil, fmt.Errorf("failed to open archive %s: %w", fileName, err)
+	}
+
+	startOfDay := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, loc)
+	endOfDay := startOfDay.Add(24*time.Hour - time.Second)
+	return s.firestoreClient.GetPoliceAlertsByDateRange(ctx, startOfDay, endOfDay)
+}
+
+// diffAlerts compares two sets of alerts by UUID. Deltas are B minus A.
+// All UUID lists are sorted for stable output.
+func diffAlerts(a, b []models.PoliceAlert) models.DiffResponse {
+	byUUID := make(map[string]models.PoliceAlert, len(a))
+	for _, alert := range a {
+		byUUID[alert.UUID] = alert
+	}
+
+	resp := models.DiffResponse{
+		Added:   []string{},
+		Removed: []string{},
+		Changed: []models.AlertDelta{},
+	}
+
+	seen := make(map[string]bool, len(b))
+	for _, alertB := range b {
+		if seen[alertB.UUID] {
+			continue
+		}
+		seen[alertB.UUID] = true
+
+		alertA, ok := byUUID[alertB.UUID]
+		if !ok {
+			resp.Added = append(resp.Added, alertB.UUID)
+			continue
+		}
+
+		delta := models.AlertDelta{
+			UUID:             alertB.UUID,
+			ThumbsUpDelta:    alertB.NThumbsUpLast - alertA.NThumbsUpLast,
+			ReliabilityDelta: alertB.Reliability - alertA.Reliability,
+			ConfidenceDelta:  alertB.Confidence - alertA.Confidence,
+		}
+		if delta.ThumbsUpDelta == 0 && delta.ReliabilityDelta == 0 && delta.ConfidenceDelta == 0 {
+			resp.Unchanged++
+			continue
+		}
+		resp.Changed = append(resp.Changed, delta)
+	}
+
+	for uuid := range byUUID {
+		if !seen[uuid] {
+			resp.Removed = append(resp.Removed, uuid)
+		}
+	}
+
+	sort.Strings(resp.Added)
+	sort.Strings(resp.Removed)
+	sort.Slice(resp.Changed, func(i, j int) bool {
+		return resp.Changed[i].UUID < resp.Changed[j].UUID
+	})
+	return resp
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
@@ -1,16 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/metrics"
 	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/notify"
 	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/storage"
 )
 
@@ -408,6 +415,105 @@ func TestLargeDatasetJSONL(t *testing.T) {
 	}
 }
 
+// TestWriteJSONLMatchesInMemory tests that chunked streaming writes the same bytes as
+// marshaling the whole day in memory, without any single write exceeding the chunk size
+func TestWriteJSONLMatchesInMemory(t *testing.T) {
+	alerts := make([]models.PoliceAlert, 5000)
+	for i := range alerts {
+		alerts[i] = models.PoliceAlert{
+			UUID:        fmt.Sprintf("alert-%05d", i),
+			Type:        "POLICE",
+			Subtype:     "POLICE_VISIBLE",
+			Street:      "Test Street",
+			PublishTime: time.Date(2024, 1, 15, 0, 0, i, 0, time.UTC),
+			RawDataLast: strings.Repeat("x", i%300),
+		}
+	}
+
+	var expected []byte
+	for _, alert := range alerts {
+		line, err := json.Marshal(alert)
+		if err != nil {
+			t.Fatalf("marshal failed: %v", err)
+		}
+		expected = append(expected, line...)
+		expected = append(expected, '\n')
+	}
+
+	for _, chunkBytes := range []int{1, 100, 4096, defaultArchiveChunkBytes} {
+		maxWrite := 0
+		writer := &storage.MockGCSWriter{}
+		writer.WriteFunc = func(p []byte) (int, error) {
+			if len(p) > maxWrite {
+				maxWrite = len(p)
+			}
+			writer.Written = append(writer.Written, p...)
+			return len(p), nil
+		}
+
+		if err := writeJSONL(writer, alerts, chunkBytes); err != nil {
+			t.Fatalf("chunk %d: writeJSONL failed: %v", chunkBytes, err)
+		}
+		if !bytes.Equal(writer.Written, expected) {
+			t.Errorf("chunk %d: streamed output differs from in-memory output (%d vs %d bytes)", chunkBytes, len(writer.Written), len(expected))
+		}
+		// A line longer than the chunk is written whole, so only check chunk
+		// sizes that fit every line
+		if chunkBytes >= 4096 && maxWrite > chunkBytes {
+			t.Errorf("chunk %d: write of %d bytes exceeds chunk size", chunkBytes, maxWrite)
+		}
+	}
+}
+
+// TestArchiveHandlerAbortsUploadOnWriteError tests that a failed streaming write never closes the object
+func TestArchiveHandlerAbortsUploadOnWriteError(t *testing.T) {
+	closed := false
+	var writerCtx context.Context
+	gcsClient := &storage.MockGCSClient{
+		BucketFunc: func(name string) storage.GCSBucketHandle {
+			return &storage.MockGCSBucketHandle{
+				ObjectFunc: func(name string) storage.GCSObjectHandle {
+					return &storage.MockGCSObjectHandle{
+						NewWriterFunc: func(ctx context.Context) storage.GCSWriter {
+							writerCtx = ctx
+							return &storage.MockGCSWriter{
+								WriteFunc: func(p []byte) (int, error) {
+									return 0, errors.New("connection reset")
+								},
+								CloseFunc: func() error {
+									closed = true
+									return nil
+								},
+							}
+						},
+					}
+				},
+			}
+		},
+	}
+	store := &mockAlertStore{
+		GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+			return []models.PoliceAlert{{UUID: "a1"}, {UUID: "a2"}}, nil
+		},
+	}
+	s := createTestServer(store, gcsClient)
+	s.chunkBytes = 16
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"date":"2024-01-15"}`))
+	rr := httptest.NewRecorder()
+	s.archiveHandler(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+	if closed {
+		t.Error("expected writer not to be closed after a write error")
+	}
+	if writerCtx == nil || writerCtx.Err() == nil {
+		t.Error("expected writer context to be cancelled to abort the upload")
+	}
+}
+
 // TestFilenameGeneration tests archive filename generation
 func TestFilenameGeneration(t *testing.T) {
 	tests := []struct {
@@ -510,14 +616,38 @@ func (m *mockAlertStore) GetPoliceAlertsByDateRange(ctx context.Context, start,
 	return nil, nil
 }
 
-func (m *mockAlertStore) SavePoliceAlerts(ctx context.Context, alerts []models.WazeAlert, scrapeTime time.Time) error {
-	return nil
+func (m *mockAlertStore) SavePoliceAlerts(ctx context.Context, alerts []models.WazeAlert, scrapeTime time.Time) (int, error) {
+	return 0, nil
+}
+
+func (m *mockAlertStore) GetPoliceAlertsByDatesWithFilters(ctx context.Context, dates []string, filters models.AlertFilters) ([]models.PoliceAlert, error) {
+	return nil, nil
+}
+
+func (m *mockAlertStore) GetPoliceAlertsActiveAt(ctx context.Context, t time.Time) ([]models.PoliceAlert, error) {
+	return nil, nil
+}
+
+func (m *mockAlertStore) GetPoliceAlertsUpdatedSince(ctx context.Context, since time.Time, limit int) ([]models.PoliceAlert, time.Time, error) {
+	return nil, since, nil
+}
+
+func (m *mockAlertStore) CountPoliceAlertsPublished(ctx context.Context, edges []time.Time) ([]int64, error) {
+	return nil, nil
+}
+
+func (m *mockAlertStore) CountPoliceAlertsByDateRange(ctx context.Context, startDate, endDate time.Time) (int64, error) {
+	return 0, nil
 }
 
-func (m *mockAlertStore) GetPoliceAlertsByDatesWithFilters(ctx context.Context, dates []string, subtypes []string, streets []string) ([]models.PoliceAlert, error) {
+func (m *mockAlertStore) GetStreetHeatmap(ctx context.Context, dates []string) ([]models.StreetCount, error) {
 	return nil, nil
 }
 
+func (m *mockAlertStore) GetCollectionStats(ctx context.Context) (models.CollectionStats, error) {
+	return models.CollectionStats{}, nil
+}
+
 func (m *mockAlertStore) Close() error {
 	return nil
 }
@@ -525,6 +655,15 @@ func (m *mockAlertStore) Close() error {
 // Ensure mockAlertStore implements storage.AlertStore
 var _ storage.AlertStore = (*mockAlertStore)(nil)
 
+// createJSONL returns alerts as a single in-memory JSONL document
+func createJSONL(alerts []models.PoliceAlert) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeJSONL(&buf, alerts, defaultArchiveChunkBytes); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 // createTestServer creates a server with mock dependencies for testing
 func createTestServer(alertStore storage.AlertStore, gcsClient storage.GCSClient) *server {
 	return &server{
@@ -655,6 +794,161 @@ func TestArchiveHandlerAlreadyExists(t *testing.T) {
 	}
 }
 
+// newForceArchiveServer returns a server whose existing archive has the given
+// attrs and content, with alertCount alerts in Firestore for the day
+func newForceArchiveServer(attrs *storage.GCSObjectAttrs, content string, alertCount int, writer *storage.MockGCSWriter) *server {
+	mockObjHandle := &storage.MockGCSObjectHandle{
+		AttrsFunc: func(ctx context.Context) (*storage.GCSObjectAttrs, error) {
+			return attrs, nil
+		},
+		NewReaderFunc: func(ctx context.Context) (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(content)), nil
+		},
+		NewWriterFunc: func(ctx context.Context) storage.GCSWriter {
+			return writer
+		},
+	}
+	mockGCS := &storage.MockGCSClient{
+		BucketFunc: func(name string) storage.GCSBucketHandle {
+			return &storage.MockGCSBucketHandle{
+				ObjectFunc: func(name string) storage.GCSObjectHandle {
+					return mockObjHandle
+				},
+			}
+		},
+	}
+	store := &mockAlertStore{
+		GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+			alerts := make([]models.PoliceAlert, alertCount)
+			for i := range alerts {
+				alerts[i] = models.PoliceAlert{UUID: fmt.Sprintf("alert-%d", i)}
+			}
+			return alerts, nil
+		},
+	}
+	s := createTestServer(store, mockGCS)
+	s.maxShrink = defaultMaxShrink
+	return s
+}
+
+// TestArchiveHandlerForceReArchive tests that force overwrites an existing archive and records its count
+func TestArchiveHandlerForceReArchive(t *testing.T) {
+	writer := &storage.MockGCSWriter{}
+	attrs := &storage.GCSObjectAttrs{Name: "2024-01-15.jsonl", Metadata: map[string]string{alertCountMetadataKey: "10"}}
+	s := newForceArchiveServer(attrs, "", 12, writer)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"date": "2024-01-15", "force": true}`))
+	rr := httptest.NewRecorder()
+	s.archiveHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if got := bytes.Count(writer.Written, []byte("\n")); got != 12 {
+		t.Errorf("expected 12 lines written, got %d", got)
+	}
+	if writer.Metadata[alertCountMetadataKey] != "12" {
+		t.Errorf("expected alert_count metadata 12, got %v", writer.Metadata)
+	}
+}
+
+// TestArchiveHandlerForceBlocksShrink tests that a re-archive losing too many alerts is refused
+func TestArchiveHandlerForceBlocksShrink(t *testing.T) {
+	tests := []struct {
+		name    string
+		attrs   *storage.GCSObjectAttrs
+		content string
+	}{
+		{
+			name:  "count from metadata",
+			attrs: &storage.GCSObjectAttrs{Name: "2024-01-15.jsonl", Metadata: map[string]string{alertCountMetadataKey: "10"}},
+		},
+		{
+			name:    "count from legacy archive lines",
+			attrs:   &storage.GCSObjectAttrs{Name: "2024-01-15.jsonl"},
+			content: strings.Repeat(`{"uuid":"x"}`+"\n", 10),
+		},
+		{
+			name:    "count from gzipped legacy archive",
+			attrs:   &storage.GCSObjectAttrs{Name: "2024-01-15.jsonl"},
+			content: gzipString(strings.Repeat(`{"uuid":"x"}`+"\n", 10)),
+		},
+		{
+			name:    "count ignores blank lines and a missing final newline",
+			attrs:   &storage.GCSObjectAttrs{Name: "2024-01-15.jsonl"},
+			content: strings.Repeat(`{"uuid":"x"}`+"\r\n\r\n", 9) + "  \n" + `{"uuid":"x"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := &storage.MockGCSWriter{}
+			notifier := &notify.MockNotifier{}
+			s := newForceArchiveServer(tt.attrs, tt.content, 5, writer)
+			s.notifier = notifier
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"date": "2024-01-15", "force": true}`))
+			rr := httptest.NewRecorder()
+			s.archiveHandler(rr, req)
+
+			if rr.Code != http.StatusConflict {
+				t.Fatalf("expected status %d, got %d", http.StatusConflict, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), "from 10 to 5") {
+				t.Errorf("expected counts in message, got %q", rr.Body.String())
+			}
+			if len(writer.Written) != 0 {
+				t.Errorf("expected nothing written, got %d bytes", len(writer.Written))
+			}
+			if events := notifier.Events(); len(events) != 1 || events[0].Kind != notify.KindFailure {
+				t.Errorf("expected one failure event, got %+v", events)
+			}
+		})
+	}
+}
+
+// gzipString returns s gzipped
+func gzipString(s string) string {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(s))
+	gz.Close()
+	return buf.String()
+}
+
+// TestArchiveHandlerForceAllowsSmallShrink tests that a shrink within ARCHIVE_MAX_SHRINK proceeds
+func TestArchiveHandlerForceAllowsSmallShrink(t *testing.T) {
+	writer := &storage.MockGCSWriter{}
+	attrs := &storage.GCSObjectAttrs{Name: "2024-01-15.jsonl", Metadata: map[string]string{alertCountMetadataKey: "10"}}
+	s := newForceArchiveServer(attrs, "", 9, writer)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"date": "2024-01-15", "force": true}`))
+	rr := httptest.NewRecorder()
+	s.archiveHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+}
+
+// TestArchiveHandlerForceAllowShrinkOverride tests that allow_shrink lets a shrinking re-archive proceed
+func TestArchiveHandlerForceAllowShrinkOverride(t *testing.T) {
+	writer := &storage.MockGCSWriter{}
+	attrs := &storage.GCSObjectAttrs{Name: "2024-01-15.jsonl", Metadata: map[string]string{alertCountMetadataKey: "10"}}
+	s := newForceArchiveServer(attrs, "", 5, writer)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"date": "2024-01-15", "force": true, "allow_shrink": true}`))
+	rr := httptest.NewRecorder()
+	s.archiveHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if writer.Metadata[alertCountMetadataKey] != "5" {
+		t.Errorf("expected alert_count metadata 5, got %v", writer.Metadata)
+	}
+}
+
 // TestArchiveHandlerNoAlerts tests behavior when no alerts for the date
 func TestArchiveHandlerNoAlerts(t *testing.T) {
 	testDate := "2024-01-15"
@@ -960,6 +1254,71 @@ func TestArchiveHandlerDefaultsToYesterday(t *testing.T) {
 	}
 }
 
+// TestArchiveHandlerStrictBody tests that STRICT_BODY rejects requests without an explicit
+// date, except from Cloud Scheduler, and that lenient mode defaults them to yesterday
+func TestArchiveHandlerStrictBody(t *testing.T) {
+	loc, _ := time.LoadLocation("Australia/Canberra")
+	yesterday := time.Now().In(loc).AddDate(0, 0, -1).Format("2006-01-02")
+
+	tests := []struct {
+		name       string
+		strict     bool
+		body       string
+		scheduler  bool
+		wantStatus int
+		wantDate   string // empty when the store must not be queried
+	}{
+		{name: "lenient empty body", body: "", wantStatus: http.StatusOK, wantDate: yesterday},
+		{name: "lenient malformed body", body: "{", wantStatus: http.StatusOK, wantDate: yesterday},
+		{name: "strict empty body", strict: true, body: "", wantStatus: http.StatusBadRequest},
+		{name: "strict empty object", strict: true, body: "{}", wantStatus: http.StatusBadRequest},
+		{name: "strict malformed body", strict: true, body: `{"date":`, wantStatus: http.StatusBadRequest},
+		{name: "strict explicit date", strict: true, body: `{"date":"2024-01-15"}`, wantStatus: http.StatusOK, wantDate: "2024-01-15"},
+		{name: "strict scheduled run", strict: true, body: "", scheduler: true, wantStatus: http.StatusOK, wantDate: yesterday},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var queried string
+			mockStore := &mockAlertStore{
+				GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+					queried = start.Format("2006-01-02")
+					return []models.PoliceAlert{}, nil
+				},
+			}
+			mockGCS := &storage.MockGCSClient{
+				BucketFunc: func(name string) storage.GCSBucketHandle {
+					return &storage.MockGCSBucketHandle{
+						ObjectFunc: func(name string) storage.GCSObjectHandle {
+							return &storage.MockGCSObjectHandle{
+								AttrsFunc: func(ctx context.Context) (*storage.GCSObjectAttrs, error) {
+									return nil, storage.ErrObjectNotExist
+								},
+							}
+						},
+					}
+				},
+			}
+			s := createTestServer(mockStore, mockGCS)
+			s.strictBody = tt.strict
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			if tt.scheduler {
+				req.Header.Set("X-CloudScheduler", "true")
+			}
+			rr := httptest.NewRecorder()
+			s.archiveHandler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if queried != tt.wantDate {
+				t.Errorf("expected store queried for %q, got %q", tt.wantDate, queried)
+			}
+		})
+	}
+}
+
 // TestArchiveHandlerTimezoneLoadError tests error handling for timezone loading failures
 func TestArchiveHandlerTimezoneLoadError(t *testing.T) {
 	mockStore := &mockAlertStore{}
@@ -1061,3 +1420,981 @@ func TestArchiveHandlerVerifiesJSONLContent(t *testing.T) {
 		t.Errorf("expected City 'Canberra', got %q", parsed.City)
 	}
 }
+
+// TestArchiveHandlerMsgpack tests that ARCHIVE_FORMAT=msgpack writes a
+// MessagePack archive that decodes to the archived alerts, and that a forced
+// re-archive counts the alerts of an existing MessagePack archive
+func TestArchiveHandlerMsgpack(t *testing.T) {
+	alerts := []models.PoliceAlert{
+		{UUID: "alert-1", Type: "POLICE", Subtype: "POLICE_VISIBLE", Street: "Test Street", PublishTime: time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)},
+		{UUID: "alert-2", Type: "POLICE", Subtype: "POLICE_HIDING", Reliability: 8, PublishTime: time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)},
+	}
+	archived := alerts
+	store := &mockAlertStore{
+		GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+			return archived, nil
+		},
+	}
+	gcs := storage.NewMemGCS()
+	s := createTestServer(store, gcs)
+	s.format = archiveFormatMsgpack
+
+	rr := httptest.NewRecorder()
+	s.archiveHandler(rr, httptest.NewRequest("POST", "/", strings.NewReader(`{"date":"2024-01-15"}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	written := gcs.Objects["2024-01-15.jsonl"]
+	if !storage.IsMsgpackArchive(written) {
+		t.Fatalf("expected a MessagePack archive, got %q", written)
+	}
+	got, err := storage.ReadMsgpackAlerts(bytes.NewReader(written))
+	if err != nil {
+		t.Fatalf("failed to read archive: %v", err)
+	}
+	if !reflect.DeepEqual(got, alerts) {
+		t.Errorf("unexpected archived alerts\n got %+v\nwant %+v", got, alerts)
+	}
+	metadata := gcs.Metadata["2024-01-15.jsonl"]
+	if metadata[formatMetadataKey] != archiveFormatMsgpack || metadata[alertCountMetadataKey] != "2" {
+		t.Errorf("unexpected metadata %v", metadata)
+	}
+
+	// Without the recorded count, a shrinking re-archive is refused after
+	// counting the alerts of the MessagePack archive
+	delete(gcs.Metadata["2024-01-15.jsonl"], alertCountMetadataKey)
+	archived = alerts[:1]
+	rr = httptest.NewRecorder()
+	s.archiveHandler(rr, httptest.NewRequest("POST", "/", strings.NewReader(`{"date":"2024-01-15","force":true}`)))
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "shrink from 2 to 1") {
+		t.Errorf("expected the shrink to be refused, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+// =============================================================================
+// Path Handling Tests
+// =============================================================================
+
+// TestArchiveHandlerAcceptedPaths tests that archive paths and their trailing-slash variants are handled
+func TestArchiveHandlerAcceptedPaths(t *testing.T) {
+	for _, path := range []string{"/", "//", "/archive", "/archive/", "/archive//"} {
+		t.Run(path, func(t *testing.T) {
+			mockGCS := &storage.MockGCSClient{
+				BucketFunc: func(name string) storage.GCSBucketHandle {
+					return &storage.MockGCSBucketHandle{
+						ObjectFunc: func(objName string) storage.GCSObjectHandle {
+							return &storage.MockGCSObjectHandle{
+								AttrsFunc: func(ctx context.Context) (*storage.GCSObjectAttrs, error) {
+									return &storage.GCSObjectAttrs{Name: objName}, nil
+								},
+							}
+						},
+					}
+				},
+			}
+			s := createTestServer(&mockAlertStore{}, mockGCS)
+
+			req := httptest.NewRequest("POST", path, strings.NewReader(`{"date":"2024-01-15"}`))
+			rr := httptest.NewRecorder()
+			s.archiveHandler(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("expected status %d for %q, got %d", http.StatusOK, path, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), "already exists") {
+				t.Errorf("expected archive run for %q, got %q", path, rr.Body.String())
+			}
+		})
+	}
+}
+
+// TestArchiveHandlerRejectedPaths tests that unknown paths return 404 without archiving
+func TestArchiveHandlerRejectedPaths(t *testing.T) {
+	for _, path := range []string{"/archiv", "/archive/2024-01-15", "/foo", "/archives", "//archive/x"} {
+		t.Run(path, func(t *testing.T) {
+			store := &mockAlertStore{
+				GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+					t.Errorf("unexpected Firestore query for %q", path)
+					return nil, nil
+				},
+			}
+			s := createTestServer(store, &storage.MockGCSClient{})
+
+			req := httptest.NewRequest("POST", path, strings.NewReader(`{"date":"2024-01-15"}`))
+			rr := httptest.NewRecorder()
+			s.archiveHandler(rr, req)
+
+			if rr.Code != http.StatusNotFound {
+				t.Errorf("expected status %d for %q, got %d", http.StatusNotFound, path, rr.Code)
+			}
+		})
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	tests := map[string]string{
+		"/":          "/",
+		"//":         "/",
+		"":           "/",
+		"/archive":   "/archive",
+		"/archive/":  "/archive",
+		"/archive//": "/archive",
+		"/a/b/":      "/a/b",
+	}
+	for in, want := range tests {
+		if got := normalizePath(in); got != want {
+			t.Errorf("normalizePath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// TestCreateJSONLByteIdentical tests that archives are reproducible for identical input
+func TestCreateJSONLByteIdentical(t *testing.T) {
+	publish := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	alerts := []models.PoliceAlert{
+		{UUID: "a1", Type: "POLICE", Subtype: "POLICE_VISIBLE", Street: "Main St", PublishTime: publish, ExpireTime: publish.Add(time.Hour)},
+		{UUID: "a2", Type: "POLICE", Comments: []models.Comment{{ReportMillis: 1, Text: "x"}}},
+	}
+
+	first, err := createJSONL(alerts)
+	if err != nil {
+		t.Fatalf("createJSONL failed: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		again, err := createJSONL(alerts)
+		if err != nil {
+			t.Fatalf("createJSONL failed: %v", err)
+		}
+		if string(again) != string(first) {
+			t.Fatalf("run %d produced different output", i)
+		}
+	}
+
+	// Keys follow struct declaration order
+	if !strings.HasPrefix(string(first), `{"uuid":"a1","type":"POLICE","subtype":"POLICE_VISIBLE","street":"Main St"`) {
+		t.Errorf("unexpected field order: %s", first)
+	}
+}
+
+// =============================================================================
+// Span Policy Tests
+// =============================================================================
+
+// archiveBoundaryDay runs the archive handler for a date with a boundary-spanning alert
+// and returns the archived JSONL content (empty if nothing was written)
+func archiveBoundaryDay(t *testing.T, policy, date string) string {
+	t.Helper()
+	loc, _ := time.LoadLocation("Australia/Canberra")
+	spanning := models.PoliceAlert{
+		UUID:        "spanning",
+		PublishTime: time.Date(2024, 1, 15, 23, 55, 0, 0, loc),
+		ExpireTime:  time.Date(2024, 1, 16, 0, 10, 0, 0, loc),
+	}
+
+	store := &mockAlertStore{
+		GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+			// Mirror the Firestore overlap query
+			if spanning.ExpireTime.Before(start) || spanning.PublishTime.After(end) {
+				return nil, nil
+			}
+			return []models.PoliceAlert{spanning}, nil
+		},
+	}
+
+	var written []byte
+	mockGCS := &storage.MockGCSClient{
+		BucketFunc: func(name string) storage.GCSBucketHandle {
+			return &storage.MockGCSBucketHandle{
+				ObjectFunc: func(objName string) storage.GCSObjectHandle {
+					return &storage.MockGCSObjectHandle{
+						NewWriterFunc: func(ctx context.Context) storage.GCSWriter {
+							w := &storage.MockGCSWriter{}
+							w.CloseFunc = func() error {
+								written = w.Written
+								return nil
+							}
+							return w
+						},
+					}
+				},
+			}
+		},
+	}
+
+	s := createTestServer(store, mockGCS)
+	s.spanPolicy = policy
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"date":"`+date+`"}`))
+	rr := httptest.NewRecorder()
+	s.archiveHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	return string(written)
+}
+
+// TestArchiveSpanPolicyOverlap tests that a midnight-spanning alert is archived on both days by default
+func TestArchiveSpanPolicyOverlap(t *testing.T) {
+	for _, policy := range []string{"", spanPolicyOverlap} {
+		for _, date := range []string{"2024-01-15", "2024-01-16"} {
+			if got := archiveBoundaryDay(t, policy, date); !strings.Contains(got, `"uuid":"spanning"`) {
+				t.Errorf("policy %q: expected spanning alert in %s archive, got %q", policy, date, got)
+			}
+		}
+	}
+}
+
+// TestArchiveSpanPolicyPublishDay tests that a midnight-spanning alert is archived only on its publish day
+func TestArchiveSpanPolicyPublishDay(t *testing.T) {
+	if got := archiveBoundaryDay(t, spanPolicyPublishDay, "2024-01-15"); !strings.Contains(got, `"uuid":"spanning"`) {
+		t.Errorf("expected spanning alert in publish day archive, got %q", got)
+	}
+	if got := archiveBoundaryDay(t, spanPolicyPublishDay, "2024-01-16"); got != "" {
+		t.Errorf("expected no archive for the following day, got %q", got)
+	}
+}
+
+// =============================================================================
+// Failure Notification Tests
+// =============================================================================
+
+// TestArchiveHandlerNotifiesOnFailure tests that a failed archive run sends a notification
+func TestArchiveHandlerNotifiesOnFailure(t *testing.T) {
+	store := &mockAlertStore{
+		GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+			return nil, errors.New("firestore unavailable")
+		},
+	}
+	notifier := &notify.MockNotifier{}
+	s := createTestServer(store, &storage.MockGCSClient{})
+	s.notifier = notifier
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"date":"2024-01-15"}`))
+	rr := httptest.NewRecorder()
+	s.archiveHandler(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+	events := notifier.Events()
+	if len(events) != 1 || events[0].Kind != notify.KindFailure || events[0].Service != "archive-service" {
+		t.Fatalf("expected one failure event, got %+v", events)
+	}
+	if !strings.Contains(events[0].Message, "firestore unavailable") {
+		t.Errorf("expected error in message, got %q", events[0].Message)
+	}
+}
+
+// TestArchiveHandlerNotifiesOnZeroAlerts tests that an empty archive day sends a notification
+func TestArchiveHandlerNotifiesOnZeroAlerts(t *testing.T) {
+	notifier := &notify.MockNotifier{}
+	s := createTestServer(&mockAlertStore{}, &storage.MockGCSClient{})
+	s.notifier = notifier
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"date":"2024-01-15"}`))
+	rr := httptest.NewRecorder()
+	s.archiveHandler(rr, req)
+
+	events := notifier.Events()
+	if len(events) != 1 || events[0].Kind != notify.KindZeroAlerts || !strings.Contains(events[0].Message, "2024-01-15") {
+		t.Errorf("expected one zero-alerts event for 2024-01-15, got %+v", events)
+	}
+}
+
+// TestArchiveHandlerNoNotificationOnSuccess tests that successful runs stay quiet
+func TestArchiveHandlerNoNotificationOnSuccess(t *testing.T) {
+	store := &mockAlertStore{
+		GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+			return []models.PoliceAlert{{UUID: "a1"}}, nil
+		},
+	}
+	notifier := &notify.MockNotifier{
+		NotifyFunc: func(ctx context.Context, event notify.Event) error {
+			return errors.New("should not be called")
+		},
+	}
+	s := createTestServer(store, &storage.MockGCSClient{})
+	s.notifier = notifier
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"date":"2024-01-15"}`))
+	rr := httptest.NewRecorder()
+	s.archiveHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if events := notifier.Events(); len(events) != 0 {
+		t.Errorf("expected no notifications, got %+v", events)
+	}
+}
+
+// =============================================================================
+// Metrics Tests
+// =============================================================================
+
+// TestArchiveHandlerWritesMetricsOnSuccess tests that archive size and alert count are recorded
+func TestArchiveHandlerWritesMetricsOnSuccess(t *testing.T) {
+	writer := &storage.MockGCSWriter{}
+	gcsClient := &storage.MockGCSClient{
+		BucketFunc: func(name string) storage.GCSBucketHandle {
+			return &storage.MockGCSBucketHandle{
+				ObjectFunc: func(name string) storage.GCSObjectHandle {
+					return &storage.MockGCSObjectHandle{
+						NewWriterFunc: func(ctx context.Context) storage.GCSWriter {
+							return writer
+						},
+					}
+				},
+			}
+		},
+	}
+	store := &mockAlertStore{
+		GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+			return []models.PoliceAlert{{UUID: "a1"}, {UUID: "a2"}}, nil
+		},
+	}
+	metricsWriter := &metrics.MockWriter{}
+	s := createTestServer(store, gcsClient)
+	s.metrics = metricsWriter
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"date":"2024-01-15"}`))
+	rr := httptest.NewRecorder()
+	s.archiveHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	points := metricsWriter.Points()
+	if len(points) != 2 {
+		t.Fatalf("expected 2 points, got %+v", points)
+	}
+	values := metricsWriter.Values()
+	if values[metrics.ArchiveBytes] != int64(len(writer.Written)) || len(writer.Written) == 0 {
+		t.Errorf("expected archive_bytes=%d, got %d", len(writer.Written), values[metrics.ArchiveBytes])
+	}
+	if values[metrics.ArchiveAlerts] != 2 {
+		t.Errorf("expected archive_alerts=2, got %d", values[metrics.ArchiveAlerts])
+	}
+	for _, p := range points {
+		if p.Labels["service"] != "archive-service" || p.Time.IsZero() {
+			t.Errorf("expected service label and timestamp on %+v", p)
+		}
+	}
+}
+
+// TestArchiveHandlerNoMetricsOnFailure tests that failed uploads record no archive metrics
+func TestArchiveHandlerNoMetricsOnFailure(t *testing.T) {
+	store := &mockAlertStore{
+		GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+			return nil, errors.New("firestore unavailable")
+		},
+	}
+	metricsWriter := &metrics.MockWriter{}
+	s := createTestServer(store, &storage.MockGCSClient{})
+	s.metrics = metricsWriter
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"date":"2024-01-15"}`))
+	rr := httptest.NewRecorder()
+	s.archiveHandler(rr, req)
+
+	if points := metricsWriter.Points(); len(points) != 0 {
+		t.Errorf("expected no metrics, got %+v", points)
+	}
+}
+
+// =============================================================================
+// Minimum Confidence Tests
+// =============================================================================
+
+// TestArchiveHandlerMinConfidence tests that alerts below ARCHIVE_MIN_CONFIDENCE are left out of the archive
+func TestArchiveHandlerMinConfidence(t *testing.T) {
+	tests := []struct {
+		name     string
+		minConf  int
+		expected []string
+	}{
+		{"disabled keeps all", 0, []string{"c0", "c1", "c2", "c3", "c5"}},
+		{"threshold is inclusive", 2, []string{"c2", "c3", "c5"}},
+		{"above every alert", 6, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := &storage.MockGCSWriter{}
+			gcsClient := &storage.MockGCSClient{
+				BucketFunc: func(name string) storage.GCSBucketHandle {
+					return &storage.MockGCSBucketHandle{
+						ObjectFunc: func(name string) storage.GCSObjectHandle {
+							return &storage.MockGCSObjectHandle{
+								NewWriterFunc: func(ctx context.Context) storage.GCSWriter {
+									return writer
+								},
+							}
+						},
+					}
+				},
+			}
+			store := &mockAlertStore{
+				GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+					return []models.PoliceAlert{
+						{UUID: "c0", Confidence: 0},
+						{UUID: "c1", Confidence: 1},
+						{UUID: "c2", Confidence: 2},
+						{UUID: "c3", Confidence: 3},
+						{UUID: "c5", Confidence: 5},
+					}, nil
+				},
+			}
+			s := createTestServer(store, gcsClient)
+			s.minConf = tt.minConf
+
+			req := httptest.NewRequest("POST", "/", strings.NewReader(`{"date":"2024-01-15"}`))
+			rr := httptest.NewRecorder()
+			s.archiveHandler(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+			}
+
+			var archived []string
+			for _, line := range bytes.Split(bytes.TrimSpace(writer.Written), []byte("\n")) {
+				if len(line) == 0 {
+					continue
+				}
+				var alert models.PoliceAlert
+				if err := json.Unmarshal(line, &alert); err != nil {
+					t.Fatalf("invalid JSONL line %q: %v", line, err)
+				}
+				archived = append(archived, alert.UUID)
+			}
+			if fmt.Sprint(archived) != fmt.Sprint(tt.expected) {
+				t.Errorf("expected archived %v, got %v", tt.expected, archived)
+			}
+			if tt.expected == nil && !strings.Contains(rr.Body.String(), "No alerts to archive") {
+				t.Errorf("expected no-alerts response, got %q", rr.Body.String())
+			}
+			if tt.expected != nil {
+				want := ""
+				if tt.minConf > 0 {
+					want = fmt.Sprintf("min_confidence=%d", tt.minConf)
+				}
+				if got := writer.Metadata[filtersMetadataKey]; got != want {
+					t.Errorf("expected filters metadata %q, got %q", want, got)
+				}
+			}
+		})
+	}
+}
+
+// TestArchiveFilters tests that the settings leaving alerts out of an archive are described
+func TestArchiveFilters(t *testing.T) {
+	tests := []struct {
+		spanPolicy string
+		minConf    int
+		expected   string
+	}{
+		{"", 0, ""},
+		{spanPolicyOverlap, 0, ""},
+		{spanPolicyPublishDay, 0, "span_policy=publish_day"},
+		{spanPolicyOverlap, 3, "min_confidence=3"},
+		{spanPolicyPublishDay, 3, "span_policy=publish_day,min_confidence=3"},
+	}
+
+	for _, tt := range tests {
+		s := &server{spanPolicy: tt.spanPolicy, minConf: tt.minConf}
+		if got := s.archiveFilters(); got != tt.expected {
+			t.Errorf("span policy %q, min confidence %d: expected %q, got %q", tt.spanPolicy, tt.minConf, tt.expected, got)
+		}
+	}
+}
+
+// TestArchiveContentHash tests that identical alerts hash the same and differing alerts differ
+func TestArchiveContentHash(t *testing.T) {
+	alerts := []models.PoliceAlert{{UUID: "alert-1", Street: "Hume Hwy"}, {UUID: "alert-2"}}
+	same := []models.PoliceAlert{{UUID: "alert-1", Street: "Hume Hwy"}, {UUID: "alert-2"}}
+	changed := []models.PoliceAlert{{UUID: "alert-1", Street: "Federal Hwy"}, {UUID: "alert-2"}}
+
+	jsonl := func(alerts []models.PoliceAlert, chunkBytes int) []byte {
+		var buf bytes.Buffer
+		if err := writeJSONL(&buf, alerts, chunkBytes); err != nil {
+			t.Fatalf("writeJSONL failed: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	hash := archiveContentHash(jsonl(alerts, defaultArchiveChunkBytes))
+	if len(hash) != 64 {
+		t.Errorf("expected a hex SHA-256, got %q", hash)
+	}
+
+	// The chunk size only affects buffering, not the content
+	if got := archiveContentHash(jsonl(same, 16)); got != hash {
+		t.Errorf("expected identical content to hash the same, got %s and %s", hash, got)
+	}
+	if got := archiveContentHash(jsonl(changed, defaultArchiveChunkBytes)); got == hash {
+		t.Errorf("expected differing content to hash differently, both got %s", hash)
+	}
+}
+
+// TestArchiveHandlerContentAddressed tests that the archive is also written under its
+// hash and that the date archive's metadata points at it
+func TestArchiveHandlerContentAddressed(t *testing.T) {
+	alerts := []models.PoliceAlert{{UUID: "alert-1"}, {UUID: "alert-2"}}
+	jsonl, err := createJSONL(alerts)
+	if err != nil {
+		t.Fatalf("createJSONL failed: %v", err)
+	}
+	hash := archiveContentHash(jsonl)
+
+	tests := []struct {
+		name          string
+		contentExists bool
+	}{
+		{"new content", false},
+		{"content already archived", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writers := map[string]*storage.MockGCSWriter{}
+			mockGCS := &storage.MockGCSClient{
+				BucketFunc: func(bucket string) storage.GCSBucketHandle {
+					return &storage.MockGCSBucketHandle{
+						ObjectFunc: func(name string) storage.GCSObjectHandle {
+							obj := &storage.MockGCSObjectHandle{
+								NewWriterFunc: func(ctx context.Context) storage.GCSWriter {
+									writers[name] = &storage.MockGCSWriter{}
+									return writers[name]
+								},
+							}
+							if tt.contentExists && name == contentObjectName(hash) {
+								obj.AttrsFunc = func(ctx context.Context) (*storage.GCSObjectAttrs, error) {
+									return &storage.GCSObjectAttrs{Name: name}, nil
+								}
+							}
+							return obj
+						},
+					}
+				},
+			}
+			store := &mockAlertStore{
+				GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+					return alerts, nil
+				},
+			}
+			s := createTestServer(store, mockGCS)
+			s.contentAddressed = true
+
+			rr := httptest.NewRecorder()
+			s.archiveHandler(rr, httptest.NewRequest("POST", "/", strings.NewReader(`{"date":"2024-01-15"}`)))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+
+			dateWriter := writers["2024-01-15.jsonl"]
+			if dateWriter == nil {
+				t.Fatal("expected the date archive to be written")
+			}
+			if dateWriter.Metadata[contentHashMetadataKey] != hash {
+				t.Errorf("expected content hash %s in metadata, got %v", hash, dateWriter.Metadata)
+			}
+			if dateWriter.Metadata[contentObjectMetadataKey] != "sha256/"+hash+".jsonl" {
+				t.Errorf("expected content object in metadata, got %v", dateWriter.Metadata)
+			}
+
+			contentWriter := writers[contentObjectName(hash)]
+			if tt.contentExists {
+				if contentWriter != nil {
+					t.Error("expected existing content-addressed archive not to be rewritten")
+				}
+				return
+			}
+			if contentWriter == nil {
+				t.Fatal("expected the content-addressed archive to be written")
+			}
+			if !bytes.Equal(contentWriter.Written, dateWriter.Written) || !bytes.Equal(dateWriter.Written, jsonl) {
+				t.Error("expected the content-addressed archive to match the date archive")
+			}
+			if contentWriter.Metadata[alertCountMetadataKey] != "2" {
+				t.Errorf("expected alert_count metadata 2, got %v", contentWriter.Metadata)
+			}
+		})
+	}
+}
+
+// TestArchiveHandlerCooldown tests that a run recorded within the cooldown
+// refuses a second attempt for the same date
+func TestArchiveHandlerCooldown(t *testing.T) {
+	tests := []struct {
+		name       string
+		lastRun    string // empty means no recorded run
+		wantStatus int
+	}{
+		{"no recorded run", "", http.StatusOK},
+		{"recent run", time.Now().Add(-2 * time.Minute).UTC().Format(time.RFC3339Nano), http.StatusConflict},
+		{"run before cooldown", time.Now().Add(-time.Hour).UTC().Format(time.RFC3339Nano), http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writers := map[string]*storage.MockGCSWriter{}
+			var markerConds *storage.GCSConditions
+			mockGCS := &storage.MockGCSClient{
+				BucketFunc: func(bucket string) storage.GCSBucketHandle {
+					return &storage.MockGCSBucketHandle{
+						ObjectFunc: func(name string) storage.GCSObjectHandle {
+							obj := &storage.MockGCSObjectHandle{
+								NewWriterFunc: func(ctx context.Context) storage.GCSWriter {
+									writers[name] = &storage.MockGCSWriter{}
+									return writers[name]
+								},
+							}
+							if name == "runs/2024-01-15" {
+								obj.IfFunc = func(conds storage.GCSConditions) storage.GCSObjectHandle {
+									markerConds = &conds
+									return obj
+								}
+								obj.DeleteFunc = func(ctx context.Context) error {
+									t.Error("expected a successful run to keep its marker")
+									return nil
+								}
+							}
+							if tt.lastRun != "" && name == "runs/2024-01-15" {
+								obj.AttrsFunc = func(ctx context.Context) (*storage.GCSObjectAttrs, error) {
+									return &storage.GCSObjectAttrs{Name: name, Generation: 7, Metadata: map[string]string{lastRunMetadataKey: tt.lastRun}}, nil
+								}
+							}
+							return obj
+						},
+					}
+				},
+			}
+			queried := false
+			store := &mockAlertStore{
+				GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+					queried = true
+					return []models.PoliceAlert{{UUID: "alert-1"}}, nil
+				},
+			}
+			s := createTestServer(store, mockGCS)
+			s.cooldown = 10 * time.Minute
+
+			rr := httptest.NewRecorder()
+			s.archiveHandler(rr, httptest.NewRequest("POST", "/", strings.NewReader(`{"date":"2024-01-15"}`)))
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+
+			if tt.wantStatus == http.StatusConflict {
+				if queried || writers["2024-01-15.jsonl"] != nil {
+					t.Error("expected a run within the cooldown not to query Firestore or write the archive")
+				}
+				if writers["runs/2024-01-15"] != nil {
+					t.Error("expected a refused run not to be recorded")
+				}
+				return
+			}
+
+			marker := writers["runs/2024-01-15"]
+			if marker == nil {
+				t.Fatal("expected the run to be recorded")
+			}
+			wantConds := storage.GCSConditions{DoesNotExist: true}
+			if tt.lastRun != "" {
+				wantConds = storage.GCSConditions{GenerationMatch: 7}
+			}
+			if markerConds == nil || *markerConds != wantConds {
+				t.Errorf("expected the marker to be written with conditions %+v, got %+v", wantConds, markerConds)
+			}
+			recorded, err := time.Parse(time.RFC3339Nano, marker.Metadata[lastRunMetadataKey])
+			if err != nil || time.Since(recorded) > time.Minute {
+				t.Errorf("expected the run start time to be recorded, got %v", marker.Metadata)
+			}
+			if writers["2024-01-15.jsonl"] == nil {
+				t.Error("expected the archive to be written")
+			}
+		})
+	}
+}
+
+// TestArchiveHandlerCooldownConcurrentRun tests that a run losing the race to
+// record its marker is refused like a run within the cooldown
+func TestArchiveHandlerCooldownConcurrentRun(t *testing.T) {
+	wrote := false
+	mockGCS := &storage.MockGCSClient{
+		BucketFunc: func(bucket string) storage.GCSBucketHandle {
+			return &storage.MockGCSBucketHandle{
+				ObjectFunc: func(name string) storage.GCSObjectHandle {
+					obj := &storage.MockGCSObjectHandle{
+						NewWriterFunc: func(ctx context.Context) storage.GCSWriter {
+							wrote = true
+							return &storage.MockGCSWriter{}
+						},
+					}
+					if name == "runs/2024-01-15" {
+						// Another instance creates the marker between the read and the write
+						obj.IfFunc = func(conds storage.GCSConditions) storage.GCSObjectHandle {
+							return &storage.MockGCSObjectHandle{
+								NewWriterFunc: func(ctx context.Context) storage.GCSWriter {
+									return &storage.MockGCSWriter{CloseFunc: func() error { return storage.ErrPreconditionFailed }}
+								},
+							}
+						}
+					}
+					return obj
+				},
+			}
+		},
+	}
+	queried := false
+	store := &mockAlertStore{
+		GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+			queried = true
+			return []models.PoliceAlert{{UUID: "alert-1"}}, nil
+		},
+	}
+	s := createTestServer(store, mockGCS)
+	s.cooldown = 10 * time.Minute
+
+	rr := httptest.NewRecorder()
+	s.archiveHandler(rr, httptest.NewRequest("POST", "/", strings.NewReader(`{"date":"2024-01-15"}`)))
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if queried || wrote {
+		t.Error("expected the losing run not to query Firestore or write the archive")
+	}
+}
+
+// TestArchiveHandlerCooldownReleasedOnFailure tests that a run that doesn't
+// write its archive deletes its marker so it can be retried
+func TestArchiveHandlerCooldownReleasedOnFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		alerts     []models.PoliceAlert
+		err        error
+		wantStatus int
+	}{
+		{"firestore error", nil, errors.New("unavailable"), http.StatusInternalServerError},
+		{"no alerts", nil, nil, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deleted := false
+			mockGCS := &storage.MockGCSClient{
+				BucketFunc: func(bucket string) storage.GCSBucketHandle {
+					return &storage.MockGCSBucketHandle{
+						ObjectFunc: func(name string) storage.GCSObjectHandle {
+							obj := &storage.MockGCSObjectHandle{}
+							if name == "runs/2024-01-15" {
+								obj.DeleteFunc = func(ctx context.Context) error {
+									deleted = true
+									return nil
+								}
+							}
+							return obj
+						},
+					}
+				},
+			}
+			store := &mockAlertStore{
+				GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+					return tt.alerts, tt.err
+				},
+			}
+			s := createTestServer(store, mockGCS)
+			s.cooldown = 10 * time.Minute
+
+			rr := httptest.NewRecorder()
+			s.archiveHandler(rr, httptest.NewRequest("POST", "/", strings.NewReader(`{"date":"2024-01-15"}`)))
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if !deleted {
+				t.Error("expected the run marker to be deleted")
+			}
+		})
+	}
+}
+
+// TestArchiveHandlerLastRun tests that /health/last-run reports the outcome of the latest archive run
+func TestArchiveHandlerLastRun(t *testing.T) {
+	var storeErr error
+	mockStore := &mockAlertStore{
+		GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+			return []models.PoliceAlert{{UUID: "alert-1", Type: "POLICE"}}, storeErr
+		},
+	}
+	mockGCS := &storage.MockGCSClient{
+		BucketFunc: func(name string) storage.GCSBucketHandle {
+			return &storage.MockGCSBucketHandle{
+				ObjectFunc: func(name string) storage.GCSObjectHandle {
+					return &storage.MockGCSObjectHandle{
+						AttrsFunc: func(ctx context.Context) (*storage.GCSObjectAttrs, error) {
+							return nil, storage.ErrObjectNotExist
+						},
+						NewWriterFunc: func(ctx context.Context) storage.GCSWriter {
+							return &storage.MockGCSWriter{}
+						},
+					}
+				},
+			}
+		},
+	}
+	s := createTestServer(mockStore, mockGCS)
+
+	readLastRun := func() models.LastRun {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		s.lastRun.handler(rr, httptest.NewRequest(http.MethodGet, "/health/last-run", nil))
+		var run models.LastRun
+		if err := json.Unmarshal(rr.Body.Bytes(), &run); err != nil {
+			t.Fatalf("last run is not valid JSON: %v", err)
+		}
+		return run
+	}
+	archive := func() {
+		rr := httptest.NewRecorder()
+		s.archiveHandler(rr, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"date": "2024-01-15"}`)))
+	}
+
+	if run := readLastRun(); run.Status != "none" {
+		t.Errorf("expected status none before the first run, got %+v", run)
+	}
+
+	before := time.Now()
+	archive()
+	run := readLastRun()
+	if run.Status != "success" || run.FinishedAt == nil || run.FinishedAt.Before(before) || !strings.Contains(run.Message, "archived 1 alerts for 2024-01-15") {
+		t.Errorf("expected a success after %v, got %+v", before, run)
+	}
+
+	storeErr = errors.New("firestore down")
+	archive()
+	run = readLastRun()
+	if run.Status != "failure" || !strings.Contains(run.Message, "firestore down") {
+		t.Errorf("expected a failure naming the store error, got %+v", run)
+	}
+}
+
+// TestArchiveHandlerPartialDay tests that an hour range queries only that window and names the archive after it
+func TestArchiveHandlerPartialDay(t *testing.T) {
+	loc, err := time.LoadLocation("Australia/Canberra")
+	if err != nil {
+		t.Fatalf("failed to load location: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		body      string
+		wantStart time.Time
+		wantEnd   time.Time
+		wantFile  string
+	}{
+		{
+			name:      "afternoon window",
+			body:      `{"date":"2024-01-15","start_hour":14,"end_hour":18}`,
+			wantStart: time.Date(2024, 1, 15, 14, 0, 0, 0, loc),
+			wantEnd:   time.Date(2024, 1, 15, 17, 59, 59, 0, loc),
+			wantFile:  "2024-01-15_14-18.jsonl",
+		},
+		{
+			name:      "until midnight",
+			body:      `{"date":"2024-01-15","start_hour":0,"end_hour":24}`,
+			wantStart: time.Date(2024, 1, 15, 0, 0, 0, 0, loc),
+			wantEnd:   time.Date(2024, 1, 15, 23, 59, 59, 0, loc),
+			wantFile:  "2024-01-15_00-24.jsonl",
+		},
+		{
+			name:      "no hours archives the whole day",
+			body:      `{"date":"2024-01-15"}`,
+			wantStart: time.Date(2024, 1, 15, 0, 0, 0, 0, loc),
+			wantEnd:   time.Date(2024, 1, 15, 23, 59, 59, 0, loc),
+			wantFile:  "2024-01-15.jsonl",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotStart, gotEnd time.Time
+			store := &mockAlertStore{
+				GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+					gotStart, gotEnd = start, end
+					return []models.PoliceAlert{{UUID: "alert-1"}}, nil
+				},
+			}
+			writers := map[string]*storage.MockGCSWriter{}
+			mockGCS := &storage.MockGCSClient{
+				BucketFunc: func(bucket string) storage.GCSBucketHandle {
+					return &storage.MockGCSBucketHandle{
+						ObjectFunc: func(name string) storage.GCSObjectHandle {
+							return &storage.MockGCSObjectHandle{
+								AttrsFunc: func(ctx context.Context) (*storage.GCSObjectAttrs, error) {
+									return nil, storage.ErrObjectNotExist
+								},
+								NewWriterFunc: func(ctx context.Context) storage.GCSWriter {
+									writers[name] = &storage.MockGCSWriter{}
+									return writers[name]
+								},
+							}
+						},
+					}
+				},
+			}
+			s := createTestServer(store, mockGCS)
+			s.partialDays = true
+
+			rr := httptest.NewRecorder()
+			s.archiveHandler(rr, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)))
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+			if !gotStart.Equal(tt.wantStart) || !gotEnd.Equal(tt.wantEnd) {
+				t.Errorf("expected query from %v to %v, got %v to %v", tt.wantStart, tt.wantEnd, gotStart, gotEnd)
+			}
+			if len(writers) != 1 || writers[tt.wantFile] == nil {
+				t.Errorf("expected only %s to be written, got %v", tt.wantFile, writers)
+			}
+		})
+	}
+}
+
+// TestArchiveHandlerPartialDayValidation tests that invalid or disabled hour ranges are rejected before querying
+func TestArchiveHandlerPartialDayValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		body    string
+	}{
+		{"disabled", false, `{"date":"2024-01-15","start_hour":14,"end_hour":18}`},
+		{"missing end", true, `{"date":"2024-01-15","start_hour":14}`},
+		{"missing start", true, `{"date":"2024-01-15","end_hour":18}`},
+		{"negative start", true, `{"date":"2024-01-15","start_hour":-1,"end_hour":18}`},
+		{"end past midnight", true, `{"date":"2024-01-15","start_hour":14,"end_hour":25}`},
+		{"reversed", true, `{"date":"2024-01-15","start_hour":18,"end_hour":14}`},
+		{"empty", true, `{"date":"2024-01-15","start_hour":14,"end_hour":14}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &mockAlertStore{
+				GetPoliceAlertsByDateRangeFunc: func(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
+					t.Error("expected Firestore not to be queried")
+					return nil, nil
+				},
+			}
+			s := createTestServer(store, &storage.MockGCSClient{})
+			s.partialDays = tt.enabled
+
+			rr := httptest.NewRecorder()
+			s.archiveHandler(rr, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)))
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
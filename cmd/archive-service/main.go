@@ -6,40 +6,153 @@
 //
 // Key behaviors:
 //   - Idempotent: Skips dates that are already archived
-//   - JSONL format: Stores alerts as newline-delimited JSON
+//   - JSONL format: Stores alerts as newline-delimited JSON, or as MessagePack
+//     when ARCHIVE_FORMAT is "msgpack"
 //   - Timezone-aware: Uses Australia/Canberra timezone for date boundaries
 //
+// Day-spanning alerts (e.g. active 23:55 to 00:10) are assigned according to
+// ARCHIVE_SPAN_POLICY:
+//   - "overlap": included in the archive of every day the alert was active,
+//     so it appears in more than one file
+//   - "publish_day": included only in the archive of the day it was published
+//
 // Environment Variables:
 //   - GCP_PROJECT_ID: Google Cloud project ID (required)
 //   - FIRESTORE_COLLECTION: Firestore collection name (default: "police_alerts")
 //   - GCS_BUCKET_NAME: GCS bucket for archives (required)
+//   - ARCHIVE_SPAN_POLICY: How alerts spanning midnight are assigned to days (default: "overlap")
+//   - ARCHIVE_FORMAT: "jsonl" or "msgpack". MessagePack archives are smaller and faster to
+//     parse but not human-readable; they keep the <date>.jsonl name and are read back as
+//     JSONL by the alerts service (default: "jsonl")
+//   - ARCHIVE_CHUNK_BYTES: Size of the buffer used to stream archives to GCS (default: 262144)
+//   - ARCHIVE_MIN_CONFIDENCE: Leave alerts with a lower confidence out of archives. This makes
+//     archives lossy: excluded alerts are not recoverable once Firestore expires them (default: 0, keep all)
+//   - ARCHIVE_MAX_SHRINK: Fraction (0-1) by which a forced re-archive may reduce a day's
+//     alert count before it is refused without "allow_shrink" (default: 0.1)
+//   - CONTENT_ADDRESSED_ARCHIVES: Set to "true" to also write each archive to an immutable
+//     sha256/<hash>.jsonl object, recorded in the date archive's metadata (optional)
+//   - COMMENTS_STORAGE: Where alert comments are stored: "inline" on the alert document or in a
+//     "subcollection" of it. Must match across services (default: "inline")
+//   - ARCHIVE_COOLDOWN: Minimum time (e.g. "10m") between archive runs for the same date. Runs
+//     are recorded in GCS, so a double-fired schedule is refused across instances. A run that
+//     fails or archives nothing clears its record so it can be retried (default: 0, disabled)
+//   - PARTIAL_DAY_ARCHIVES: Set to "true" to accept "start_hour" and "end_hour" (0-24, end
+//     exclusive) in the request body, archiving only that window of the day to
+//     <date>_<start>-<end>.jsonl (e.g. 2024-01-15_14-18.jsonl) for investigating an
+//     incident. Daily archives are unaffected (optional)
+//   - STRICT_BODY: Set to "true" to reject requests without a valid JSON body naming a date,
+//     instead of archiving yesterday. Cloud Scheduler requests (X-CloudScheduler: true) still
+//     default to yesterday (optional)
+//   - ALERT_WEBHOOK_URL: Webhook notified when an archive run fails or finds no alerts (optional)
+//   - CLOUD_MONITORING_METRICS: Set to "true" to write archive metrics to Cloud Monitoring (optional)
+//   - STARTUP_PING: Set to "true" to verify Firestore connectivity at startup (optional)
+//   - LOG_LEVEL: Minimum log level: "debug" (adds per-alert detail), "info", "warn" or "error" (default: "info")
 //   - PORT: HTTP server port (default: "8080")
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	_ "time/tzdata"
 
 	gcs "cloud.google.com/go/storage"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/logging"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/metrics"
 	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/notify"
 	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/storage"
 )
 
+// Archive span policies for alerts active across a day boundary
+const (
+	spanPolicyOverlap    = "overlap"
+	spanPolicyPublishDay = "publish_day"
+)
+
+// Archive formats
+const (
+	archiveFormatJSONL   = "jsonl"
+	archiveFormatMsgpack = "msgpack"
+)
+
+// formatMetadataKey is the object metadata key naming the format of an archive
+// that is not JSONL
+const formatMetadataKey = "format"
+
+// defaultArchiveChunkBytes is the default amount of an archive buffered in
+// memory before it is written to GCS
+const defaultArchiveChunkBytes = 256 * 1024
+
+// defaultMaxShrink is the default fraction by which a forced re-archive may
+// reduce a day's alert count
+const defaultMaxShrink = 0.1
+
+// alertCountMetadataKey is the object metadata key recording how many alerts
+// an archive holds
+const alertCountMetadataKey = "alert_count"
+
+// filtersMetadataKey is the object metadata key listing the settings that left
+// alerts overlapping the day out of an archive (e.g.
+// "span_policy=publish_day,min_confidence=5"). It is absent when none did.
+const filtersMetadataKey = "filters"
+
+// Archive runs are recorded as empty runs/<date> objects whose lastRunMetadataKey
+// holds the start time of the latest run for that date
+const (
+	runMarkerPrefix    = "runs/"
+	lastRunMetadataKey = "last_run"
+)
+
+// Object metadata keys linking a date archive to its content-addressed copy
+const (
+	contentHashMetadataKey   = "content_sha256"
+	contentObjectMetadataKey = "content_object"
+)
+
 type server struct {
 	alertStore   storage.AlertStore
 	gcsClient    storage.GCSClient
 	bucketName   string
 	loadLocation func(name string) (*time.Location, error)
+	spanPolicy   string // empty means spanPolicyOverlap
+	format       string // empty means archiveFormatJSONL
+	notifier     notify.Notifier
+	metrics      metrics.Writer
+	chunkBytes   int     // zero means defaultArchiveChunkBytes
+	maxShrink    float64 // zero refuses any shrinking re-archive
+	minConf      int     // alerts below this confidence are not archived
+	// contentAddressed also writes each archive to sha256/<hash>.jsonl
+	contentAddressed bool
+	cooldown         time.Duration // zero allows back-to-back runs for a date
+	// strictBody requires an explicit date from callers other than Cloud Scheduler
+	strictBody bool
+	// partialDays accepts start_hour and end_hour to archive part of a day
+	partialDays bool
+	// lastRun holds the outcome of the most recent archive run for /health/last-run
+	lastRun lastRun
 }
 
 func main() {
+	logLevel, err := logging.ParseLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		log.Fatalf("Invalid LOG_LEVEL: %v", err)
+	}
+	logging.SetLevel(logLevel)
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -60,13 +173,84 @@ func main() {
 		log.Fatal("GCS_BUCKET_NAME environment variable not set")
 	}
 
+	spanPolicy := os.Getenv("ARCHIVE_SPAN_POLICY")
+	if spanPolicy == "" {
+		spanPolicy = spanPolicyOverlap
+	}
+	if spanPolicy != spanPolicyOverlap && spanPolicy != spanPolicyPublishDay {
+		log.Fatalf("Invalid ARCHIVE_SPAN_POLICY %q (use %q or %q)", spanPolicy, spanPolicyOverlap, spanPolicyPublishDay)
+	}
+
+	format := os.Getenv("ARCHIVE_FORMAT")
+	if format == "" {
+		format = archiveFormatJSONL
+	}
+	if format != archiveFormatJSONL && format != archiveFormatMsgpack {
+		log.Fatalf("Invalid ARCHIVE_FORMAT %q (use %q or %q)", format, archiveFormatJSONL, archiveFormatMsgpack)
+	}
+
+	chunkBytes := defaultArchiveChunkBytes
+	if v := os.Getenv("ARCHIVE_CHUNK_BYTES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Fatalf("Invalid ARCHIVE_CHUNK_BYTES %q: must be a positive integer", v)
+		}
+		chunkBytes = n
+	}
+
+	minConf := 0
+	if v := os.Getenv("ARCHIVE_MIN_CONFIDENCE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			log.Fatalf("Invalid ARCHIVE_MIN_CONFIDENCE %q: must be a non-negative integer", v)
+		}
+		minConf = n
+	}
+
+	maxShrink := defaultMaxShrink
+	if v := os.Getenv("ARCHIVE_MAX_SHRINK"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 1 {
+			log.Fatalf("Invalid ARCHIVE_MAX_SHRINK %q: must be a number between 0 and 1", v)
+		}
+		maxShrink = f
+	}
+
+	var cooldown time.Duration
+	if v := os.Getenv("ARCHIVE_COOLDOWN"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			log.Fatalf("Invalid ARCHIVE_COOLDOWN %q: must be a non-negative duration", v)
+		}
+		cooldown = d
+	}
+
+	var storeOpts []storage.Option
+	if v := os.Getenv("COMMENTS_STORAGE"); v != "" {
+		if v != storage.CommentsInline && v != storage.CommentsSubcollection {
+			log.Fatalf("Invalid COMMENTS_STORAGE %q: must be %q or %q", v, storage.CommentsInline, storage.CommentsSubcollection)
+		}
+		logging.Infof("Storing alert comments %s", v)
+		storeOpts = append(storeOpts, storage.WithCommentsStorage(v))
+	}
+
 	ctx := context.Background()
-	firestoreClient, err := storage.NewFirestoreClient(ctx, projectID, collectionName)
+	firestoreClient, err := storage.NewFirestoreClient(ctx, projectID, collectionName, storeOpts...)
 	if err != nil {
 		log.Fatalf("Failed to create Firestore client: %v", err)
 	}
 	defer firestoreClient.Close()
 
+	if os.Getenv("STARTUP_PING") == "true" {
+		pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		err := firestoreClient.Ping(pingCtx)
+		cancel()
+		if err != nil {
+			log.Fatalf("Firestore startup ping failed (check GCP_PROJECT_ID and credentials): %v", err)
+		}
+		logging.Infof("Firestore startup ping succeeded")
+	}
+
 	storageClient, err := gcs.NewClient(ctx)
 	if err != nil {
 		log.Fatalf("Failed to create Storage client: %v", err)
@@ -78,17 +262,76 @@ func main() {
 		gcsClient:    &storage.GCSClientAdapter{Client: storageClient},
 		bucketName:   bucketName,
 		loadLocation: time.LoadLocation,
+		spanPolicy:   spanPolicy,
+		format:       format,
+		chunkBytes:   chunkBytes,
+		maxShrink:    maxShrink,
+		minConf:      minConf,
+		cooldown:     cooldown,
+	}
+	if os.Getenv("CONTENT_ADDRESSED_ARCHIVES") == "true" {
+		logging.Infof("Writing content-addressed archive copies under sha256/")
+		s.contentAddressed = true
+	}
+	if os.Getenv("PARTIAL_DAY_ARCHIVES") == "true" {
+		logging.Infof("Accepting hour ranges for partial-day archives")
+		s.partialDays = true
+	}
+	if os.Getenv("STRICT_BODY") == "true" {
+		logging.Infof("Requiring an explicit date outside scheduled runs")
+		s.strictBody = true
+	}
+	if webhookURL := os.Getenv("ALERT_WEBHOOK_URL"); webhookURL != "" {
+		logging.Infof("Failure notifications enabled")
+		s.notifier = notify.NewWebhookNotifier(webhookURL)
+	}
+	if os.Getenv("CLOUD_MONITORING_METRICS") == "true" {
+		metricsWriter, err := metrics.NewCloudMonitoringWriter(ctx, projectID)
+		if err != nil {
+			log.Fatalf("Failed to create Cloud Monitoring writer: %v", err)
+		}
+		defer metricsWriter.Close()
+		logging.Infof("Cloud Monitoring metrics enabled")
+		s.metrics = metricsWriter
 	}
 
-	log.Printf("Starting Archive Service on port %s", port)
+	logging.Infof("Starting Archive Service on port %s", port)
+	logging.Infof("Archive span policy: %s", spanPolicy)
+	logging.Infof("Archive format: %s", format)
+	if minConf > 0 {
+		logging.Infof("Archiving only alerts with confidence >= %d (archives are lossy)", minConf)
+	}
 
 	http.HandleFunc("/", s.archiveHandler)
 	http.HandleFunc("/health", healthHandler)
+	http.HandleFunc("/health/last-run", s.lastRun.handler)
 
 	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
 
+// archivePaths are the paths that trigger an archive run (after normalization)
+var archivePaths = map[string]bool{
+	"/":        true,
+	"/archive": true,
+}
+
+// normalizePath strips trailing slashes so "/archive/" matches "/archive" and
+// "//" matches "/"
+func normalizePath(p string) string {
+	trimmed := strings.TrimRight(p, "/")
+	if trimmed == "" {
+		return "/"
+	}
+	return trimmed
+}
+
 func (s *server) archiveHandler(w http.ResponseWriter, r *http.Request) {
+	// The handler is registered on "/", so reject path typos instead of archiving
+	if !archivePaths[normalizePath(r.URL.Path)] {
+		http.NotFound(w, r)
+		return
+	}
+
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed. Use POST", http.StatusMethodNotAllowed)
 		return
@@ -99,20 +342,36 @@ func (s *server) archiveHandler(w http.ResponseWriter, r *http.Request) {
 	// Get Canberra location
 	loc, err := s.loadLocation("Australia/Canberra")
 	if err != nil {
-		log.Printf("Error loading location: %v", err)
+		logging.Errorf("Error loading location: %v", err)
+		s.notify(ctx, notify.KindFailure, fmt.Sprintf("Error loading location: %v", err))
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	// Check for a date in the request body
+	// Check for a date in the request body. "force" re-archives a day that is
+	// already archived; "allow_shrink" lets it write noticeably fewer alerts.
+	// "start_hour" and "end_hour" archive part of the day when enabled.
 	var requestBody struct {
-		Date string `json:"date"`
+		Date        string `json:"date"`
+		Force       bool   `json:"force"`
+		AllowShrink bool   `json:"allow_shrink"`
+		StartHour   *int   `json:"start_hour"`
+		EndHour     *int   `json:"end_hour"`
 	}
 
+	// Cloud Scheduler marks its requests with this header. It is not proof of
+	// origin, only a guard against manual calls archiving the wrong day.
+	strict := s.strictBody && r.Header.Get("X-CloudScheduler") != "true"
+
 	var targetDate time.Time
 	if r.Body != nil {
 		decoder := json.NewDecoder(r.Body)
-		if err := decoder.Decode(&requestBody); err == nil && requestBody.Date != "" {
+		err := decoder.Decode(&requestBody)
+		if strict && (err != nil || requestBody.Date == "") {
+			http.Error(w, `Request body must be JSON with a "date" (YYYY-MM-DD)`, http.StatusBadRequest)
+			return
+		}
+		if err == nil && requestBody.Date != "" {
 			targetDate, err = time.ParseInLocation("2006-01-02", requestBody.Date, loc)
 			if err != nil {
 				http.Error(w, "Invalid date format, use YYYY-MM-DD", http.StatusBadRequest)
@@ -122,6 +381,9 @@ func (s *server) archiveHandler(w http.ResponseWriter, r *http.Request) {
 			// Default to yesterday if no date is provided
 			targetDate = time.Now().In(loc).AddDate(0, 0, -1)
 		}
+	} else if strict {
+		http.Error(w, `Request body must be JSON with a "date" (YYYY-MM-DD)`, http.StatusBadRequest)
+		return
 	} else {
 		// Default to yesterday if no body is provided
 		targetDate = time.Now().In(loc).AddDate(0, 0, -1)
@@ -130,79 +392,480 @@ func (s *server) archiveHandler(w http.ResponseWriter, r *http.Request) {
 	startOfDay := time.Date(targetDate.Year(), targetDate.Month(), targetDate.Day(), 0, 0, 0, 0, loc)
 	endOfDay := startOfDay.Add(24*time.Hour - time.Second)
 
+	// A partial-day archive queries only its window and is named after it, so
+	// it never replaces or blocks the day's full archive
+	archiveName := targetDate.Format("2006-01-02")
+	windowStart, windowEnd := startOfDay, endOfDay
+	if requestBody.StartHour != nil || requestBody.EndHour != nil {
+		if !s.partialDays {
+			http.Error(w, "Partial-day archives are not enabled", http.StatusBadRequest)
+			return
+		}
+		if requestBody.StartHour == nil || requestBody.EndHour == nil {
+			http.Error(w, `Both "start_hour" and "end_hour" are required for a partial-day archive`, http.StatusBadRequest)
+			return
+		}
+		startHour, endHour := *requestBody.StartHour, *requestBody.EndHour
+		if startHour < 0 || endHour > 24 || startHour >= endHour {
+			http.Error(w, fmt.Sprintf("Invalid hour range %d-%d: need 0 <= start_hour < end_hour <= 24", startHour, endHour), http.StatusBadRequest)
+			return
+		}
+		windowStart = time.Date(targetDate.Year(), targetDate.Month(), targetDate.Day(), startHour, 0, 0, 0, loc)
+		windowEnd = time.Date(targetDate.Year(), targetDate.Month(), targetDate.Day(), endHour, 0, 0, 0, loc).Add(-time.Second)
+		archiveName = partialArchiveName(targetDate, startHour, endHour)
+	}
+
 	// Idempotency check
-	fileName := fmt.Sprintf("%s.jsonl", targetDate.Format("2006-01-02"))
+	fileName := fmt.Sprintf("%s.jsonl", archiveName)
 	obj := s.gcsClient.Bucket(s.bucketName).Object(fileName)
-	_, err = obj.Attrs(ctx)
+	previousCount := -1
+	attrs, err := obj.Attrs(ctx)
 	if err == nil {
-		log.Printf("Archive for %s already exists. Skipping.", targetDate.Format("2006-01-02"))
-		fmt.Fprintf(w, "Archive for %s already exists. Nothing to do.", targetDate.Format("2006-01-02"))
-		return
-	}
-	if !storage.IsObjectNotExist(err) {
-		log.Printf("Error checking for existing archive: %v", err)
+		if !requestBody.Force {
+			logging.Infof("Archive for %s already exists. Skipping.", archiveName)
+			fmt.Fprintf(w, "Archive for %s already exists. Nothing to do.", archiveName)
+			return
+		}
+		previousCount, err = archivedAlertCount(ctx, obj, attrs)
+		if err != nil {
+			logging.Errorf("Error reading existing archive: %v", err)
+			s.notify(ctx, notify.KindFailure, fmt.Sprintf("Error reading existing archive: %v", err))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		logging.Infof("Force re-archiving %s (existing archive has %d alerts)", archiveName, previousCount)
+	} else if !storage.IsObjectNotExist(err) {
+		logging.Errorf("Error checking for existing archive: %v", err)
+		s.notify(ctx, notify.KindFailure, fmt.Sprintf("Error checking for existing archive: %v", err))
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Archiving alerts for %s (from %s to %s)", targetDate.Format("2006-01-02"), startOfDay, endOfDay)
+	archived := false
+	if s.cooldown > 0 {
+		lastRun, err := s.recordRun(ctx, archiveName, time.Now())
+		if err != nil {
+			logging.Errorf("Error recording archive run: %v", err)
+			s.notify(ctx, notify.KindFailure, fmt.Sprintf("Error recording archive run: %v", err))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !lastRun.IsZero() {
+			msg := fmt.Sprintf("Refusing to archive %s: last run started at %s, within the %s cooldown",
+				archiveName, lastRun.Format(time.RFC3339), s.cooldown)
+			logging.Warnf("%s", msg)
+			http.Error(w, msg, http.StatusConflict)
+			return
+		}
+		// A run that doesn't write the archive must not block retries
+		defer func() {
+			if !archived {
+				s.releaseRun(ctx, archiveName)
+			}
+		}()
+	}
+
+	logging.Infof("Archiving alerts for %s (from %s to %s)", archiveName, windowStart, windowEnd)
 
 	// Get alerts from Firestore
-	alerts, err := s.alertStore.GetPoliceAlertsByDateRange(ctx, startOfDay, endOfDay)
+	alerts, err := s.alertStore.GetPoliceAlertsByDateRange(ctx, windowStart, windowEnd)
 	if err != nil {
-		log.Printf("Error getting alerts from Firestore: %v", err)
+		logging.Errorf("Error getting alerts from Firestore: %v", err)
+		s.notify(ctx, notify.KindFailure, fmt.Sprintf("Error getting alerts from Firestore: %v", err))
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
+	alerts = applySpanPolicy(alerts, startOfDay, s.spanPolicy)
+	if s.minConf > 0 {
+		total := len(alerts)
+		alerts = filterByConfidence(alerts, s.minConf)
+		logging.Infof("Excluded %d of %d alerts below confidence %d", total-len(alerts), total, s.minConf)
+	}
+
 	if len(alerts) == 0 {
-		log.Println("No alerts to archive")
-		fmt.Fprintf(w, "No alerts to archive for %s", targetDate.Format("2006-01-02"))
+		logging.Infof("No alerts to archive")
+		s.notify(ctx, notify.KindZeroAlerts, fmt.Sprintf("No alerts to archive for %s", archiveName))
+		fmt.Fprintf(w, "No alerts to archive for %s", archiveName)
 		return
 	}
 
-	// Create JSONL data
-	jsonlData, err := createJSONL(alerts)
-	if err != nil {
-		log.Printf("Error creating JSONL data: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	if previousCount >= 0 && !requestBody.AllowShrink && shrinksTooMuch(previousCount, len(alerts), s.maxShrink) {
+		msg := fmt.Sprintf("Refusing to re-archive %s: alert count would shrink from %d to %d (set allow_shrink to override)",
+			archiveName, previousCount, len(alerts))
+		logging.Warnf("%s", msg)
+		s.notify(ctx, notify.KindFailure, msg)
+		http.Error(w, msg, http.StatusConflict)
 		return
 	}
 
-	// Upload to GCS
-	wc := obj.NewWriter(ctx)
+	metadata := map[string]string{alertCountMetadataKey: strconv.Itoa(len(alerts))}
+	if filters := s.archiveFilters(); filters != "" {
+		metadata[filtersMetadataKey] = filters
+	}
+	if s.format == archiveFormatMsgpack {
+		metadata[formatMetadataKey] = archiveFormatMsgpack
+	}
+	// With content addressing the archive is marshalled once, up front, so it
+	// can be hashed and written to both objects from the same bytes
+	var content []byte
+	if s.contentAddressed {
+		var buf bytes.Buffer
+		if err := s.writeArchive(&buf, alerts); err != nil {
+			logging.Errorf("Error marshalling archive: %v", err)
+			s.notify(ctx, notify.KindFailure, fmt.Sprintf("Error marshalling archive: %v", err))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		content = buf.Bytes()
+		hash := archiveContentHash(content)
+		contentName, err := s.writeContentObject(ctx, hash, content, len(alerts))
+		if err != nil {
+			logging.Errorf("Error writing content-addressed archive: %v", err)
+			s.notify(ctx, notify.KindFailure, fmt.Sprintf("Error writing content-addressed archive: %v", err))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		metadata[contentHashMetadataKey] = hash
+		metadata[contentObjectMetadataKey] = contentName
+	}
+
+	// Stream the archive to GCS. Cancelling the writer's context on failure aborts the
+	// upload, so a partial archive is never created and a retry can run again.
+	writeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	wc := obj.NewWriter(writeCtx)
+	wc.SetMetadata(metadata)
+	counter := &countingWriter{w: wc}
 
-	if _, err := wc.Write(jsonlData); err != nil {
-		log.Printf("Error writing to GCS: %v", err)
+	if content != nil {
+		_, err = counter.Write(content)
+	} else {
+		err = s.writeArchive(counter, alerts)
+	}
+	if err != nil {
+		cancel()
+		logging.Errorf("Error writing to GCS: %v", err)
+		s.notify(ctx, notify.KindFailure, fmt.Sprintf("Error writing to GCS: %v", err))
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
 	if err := wc.Close(); err != nil {
-		log.Printf("Error closing GCS writer: %v", err)
+		logging.Errorf("Error closing GCS writer: %v", err)
+		s.notify(ctx, notify.KindFailure, fmt.Sprintf("Error closing GCS writer: %v", err))
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Successfully uploaded %s to GCS", fileName)
+	archived = true
+	logging.Infof("Successfully uploaded %s to GCS", fileName)
+	s.recordMetrics(ctx,
+		metrics.Point{Name: metrics.ArchiveBytes, Value: counter.n},
+		metrics.Point{Name: metrics.ArchiveAlerts, Value: int64(len(alerts))},
+	)
+
+	msg := fmt.Sprintf("Successfully archived %d alerts for %s", len(alerts), archiveName)
+	s.lastRun.record("success", msg, time.Now())
+	fmt.Fprint(w, msg)
+}
+
+// archiveFilters describes the settings that leave alerts overlapping a day out
+// of its archive, or returns "" when every overlapping alert is archived
+func (s *server) archiveFilters() string {
+	var filters []string
+	if s.spanPolicy == spanPolicyPublishDay {
+		filters = append(filters, "span_policy="+s.spanPolicy)
+	}
+	if s.minConf > 0 {
+		filters = append(filters, "min_confidence="+strconv.Itoa(s.minConf))
+	}
+	return strings.Join(filters, ",")
+}
+
+// partialArchiveName names the archive of the hours [startHour, endHour) of
+// date, e.g. "2024-01-15_14-18"
+func partialArchiveName(date time.Time, startHour, endHour int) string {
+	return fmt.Sprintf("%s_%02d-%02d", date.Format("2006-01-02"), startHour, endHour)
+}
+
+// recordRun records that an archive run for date starts at now. If a previous
+// run started within the cooldown, nothing is recorded and that run's start
+// time is returned so the caller can refuse this one. The marker is written
+// only if it is unchanged since it was read, so when instances race for the
+// same date just one of them records its run; the others get now back.
+func (s *server) recordRun(ctx context.Context, date string, now time.Time) (time.Time, error) {
+	obj := s.gcsClient.Bucket(s.bucketName).Object(runMarkerPrefix + date)
+	conds := storage.GCSConditions{DoesNotExist: true}
+	attrs, err := obj.Attrs(ctx)
+	if err == nil {
+		if v, ok := attrs.Metadata[lastRunMetadataKey]; ok {
+			lastRun, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				logging.Warnf("Ignoring invalid %s metadata %q", lastRunMetadataKey, v)
+			} else if now.Sub(lastRun) < s.cooldown {
+				return lastRun, nil
+			}
+		}
+		conds = storage.GCSConditions{GenerationMatch: attrs.Generation}
+	} else if !storage.IsObjectNotExist(err) {
+		return time.Time{}, fmt.Errorf("failed to check last archive run: %w", err)
+	}
+
+	wc := obj.If(conds).NewWriter(ctx)
+	wc.SetMetadata(map[string]string{lastRunMetadataKey: now.UTC().Format(time.RFC3339Nano)})
+	if err := wc.Close(); err != nil {
+		if storage.IsPreconditionFailed(err) {
+			logging.Warnf("Another run for %s was recorded concurrently", date)
+			return now, nil
+		}
+		return time.Time{}, fmt.Errorf("failed to record archive run: %w", err)
+	}
+	return time.Time{}, nil
+}
+
+// releaseRun removes the run marker for date, so a run that failed or wrote
+// nothing can be retried within the cooldown
+func (s *server) releaseRun(ctx context.Context, date string) {
+	err := s.gcsClient.Bucket(s.bucketName).Object(runMarkerPrefix + date).Delete(context.WithoutCancel(ctx))
+	if err != nil && !storage.IsObjectNotExist(err) {
+		logging.Errorf("Error releasing archive run marker for %s: %v", date, err)
+	}
+}
+
+// notify records a failed or empty run as the last run outcome and sends an
+// event if a notifier is configured. Delivery failures are
+// logged rather than changing the archive response.
+func (s *server) notify(ctx context.Context, kind, message string) {
+	s.lastRun.record(kind, message, time.Now())
+	if s.notifier == nil {
+		return
+	}
+
+	notifyCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
 
-	fmt.Fprintf(w, "Successfully archived %d alerts for %s", len(alerts), targetDate.Format("2006-01-02"))
+	err := s.notifier.Notify(notifyCtx, notify.Event{
+		Service: "archive-service",
+		Kind:    kind,
+		Message: message,
+		Time:    time.Now(),
+	})
+	if err != nil {
+		logging.Warnf("Failed to send %s notification: %v", kind, err)
+	}
+}
+
+// recordMetrics writes points if a metrics writer is configured. Write failures
+// are logged rather than changing the archive response.
+func (s *server) recordMetrics(ctx context.Context, points ...metrics.Point) {
+	if s.metrics == nil {
+		return
+	}
+
+	metricsCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	for i := range points {
+		points[i].Labels = map[string]string{"service": "archive-service"}
+		points[i].Time = now
+	}
+	if err := s.metrics.Write(metricsCtx, points...); err != nil {
+		logging.Warnf("Failed to write metrics: %v", err)
+	}
 }
 
-func createJSONL(alerts []models.PoliceAlert) ([]byte, error) {
-	var data []byte
+// applySpanPolicy filters alerts active during the day starting at startOfDay.
+// Under spanPolicyPublishDay, alerts published before the day (still active
+// past midnight) are dropped because they belong to an earlier archive.
+func applySpanPolicy(alerts []models.PoliceAlert, startOfDay time.Time, policy string) []models.PoliceAlert {
+	if policy != spanPolicyPublishDay {
+		return alerts
+	}
+
+	kept := make([]models.PoliceAlert, 0, len(alerts))
+	for _, alert := range alerts {
+		if !alert.PublishTime.Before(startOfDay) {
+			kept = append(kept, alert)
+		}
+	}
+	return kept
+}
+
+// filterByConfidence keeps alerts whose confidence is at least minConf
+func filterByConfidence(alerts []models.PoliceAlert, minConf int) []models.PoliceAlert {
+	kept := make([]models.PoliceAlert, 0, len(alerts))
+	for _, alert := range alerts {
+		if alert.Confidence >= minConf {
+			kept = append(kept, alert)
+		}
+	}
+	return kept
+}
+
+// archivedAlertCount returns the number of alerts in an existing archive, from
+// its recorded metadata or, for archives written before the count was
+// recorded, by counting its non-blank lines, decompressing it if gzipped
+func archivedAlertCount(ctx context.Context, obj storage.GCSObjectHandle, attrs *storage.GCSObjectAttrs) (int, error) {
+	if v, ok := attrs.Metadata[alertCountMetadataKey]; ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n, nil
+		}
+		logging.Warnf("Ignoring invalid %s metadata %q", alertCountMetadataKey, v)
+	}
+
+	raw, err := obj.NewReader(ctx)
+	if err != nil {
+		return 0, err
+	}
+	reader, err := storage.OpenArchive(raw)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) > 0 {
+			count++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// shrinksTooMuch reports whether replacing previous alerts with current would
+// drop more than maxShrink of them
+func shrinksTooMuch(previous, current int, maxShrink float64) bool {
+	return float64(current) < float64(previous)*(1-maxShrink)
+}
+
+// archiveChunkBytes returns the configured archive buffer size, or the default
+func (s *server) archiveChunkBytes() int {
+	if s.chunkBytes > 0 {
+		return s.chunkBytes
+	}
+	return defaultArchiveChunkBytes
+}
+
+// writeArchive writes alerts into w in the configured format
+func (s *server) writeArchive(w io.Writer, alerts []models.PoliceAlert) error {
+	if s.format != archiveFormatMsgpack {
+		return writeJSONL(w, alerts, s.archiveChunkBytes())
+	}
+	bw := bufio.NewWriterSize(w, s.archiveChunkBytes())
+	if err := storage.WriteMsgpackAlerts(bw, alerts); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// writeJSONL marshals alerts one line at a time into w, buffering at most
+// chunkBytes before each write so a large day is never held in memory whole
+func writeJSONL(w io.Writer, alerts []models.PoliceAlert, chunkBytes int) error {
+	bw := bufio.NewWriterSize(w, chunkBytes)
 	for _, alert := range alerts {
 		jsonData, err := json.Marshal(alert)
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("failed to marshal alert %s: %w", alert.UUID, err)
+		}
+		if _, err := bw.Write(jsonData); err != nil {
+			return err
 		}
-		data = append(data, jsonData...)
-		data = append(data, '\n')
+		if err := bw.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// archiveContentHash returns the hex SHA-256 of an archive. Identical alerts
+// marshal, and so hash, identically.
+func archiveContentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// contentObjectName is the name of the immutable copy of an archive with the given hash
+func contentObjectName(hash string) string {
+	return "sha256/" + hash + ".jsonl"
+}
+
+// writeContentObject writes content, an archive of count alerts, to the
+// content-addressed object for hash and returns its name. An existing object
+// already holds identical content, so it is left untouched and identical days
+// share one copy.
+func (s *server) writeContentObject(ctx context.Context, hash string, content []byte, count int) (string, error) {
+	name := contentObjectName(hash)
+	obj := s.gcsClient.Bucket(s.bucketName).Object(name)
+	if _, err := obj.Attrs(ctx); err == nil {
+		logging.Infof("Content-addressed archive %s already exists", name)
+		return name, nil
+	} else if !storage.IsObjectNotExist(err) {
+		return "", fmt.Errorf("failed to check %s: %w", name, err)
 	}
-	return data, nil
+
+	writeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	wc := obj.NewWriter(writeCtx)
+	wc.SetMetadata(map[string]string{alertCountMetadataKey: strconv.Itoa(count)})
+	if _, err := wc.Write(content); err != nil {
+		cancel()
+		return "", fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if err := wc.Close(); err != nil {
+		return "", fmt.Errorf("failed to close %s: %w", name, err)
+	}
+	logging.Infof("Wrote content-addressed archive %s", name)
+	return name, nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, "OK")
 }
+
+// lastRun holds the outcome of the most recent archive run on this instance
+type lastRun struct {
+	mu  sync.Mutex
+	run models.LastRun
+}
+
+// record stores the outcome of a run that finished at finishedAt
+func (l *lastRun) record(status, message string, finishedAt time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.run = models.LastRun{Status: status, FinishedAt: &finishedAt, Message: message}
+}
+
+// handler reports the last outcome as JSON, with status "none" before the first run
+func (l *lastRun) handler(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	run := l.run
+	l.mu.Unlock()
+	if run.Status == "" {
+		run.Status = "none"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(run); err != nil {
+		logging.Errorf("Error encoding last run: %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+// Package main implements the archive-upload tool for backfilling archives
+// from local JSONL exports.
+//
+// When a day's alerts are available locally (e.g. recovered from a backup)
+// this tool uploads them as that day's archive without re-querying Firestore.
+// Every line must parse as a PoliceAlert; a file with any bad line is rejected
+// before anything is written. Like the archive service, an existing archive is
+// left untouched unless -force is given.
+//
+// Usage:
+//
+//	go run ./cmd/archive-upload -bucket my-archive-bucket -date 2024-01-01 -file 2024-01-01.jsonl
+//
+// Flags:
+//   - -bucket: GCS bucket containing the archives (default: GCS_BUCKET_NAME)
+//   - -date: Date the file holds alerts for, YYYY-MM-DD (required)
+//   - -file: Local JSONL file to upload (required)
+//   - -force: Overwrite an existing archive for the date
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/storage"
+)
+
+// alertCountMetadataKey is the object metadata key recording how many alerts
+// an archive holds, matching the archive service
+const alertCountMetadataKey = "alert_count"
+
+// errArchiveExists is returned when the date already has an archive and the
+// upload is not forced
+var errArchiveExists = errors.New("archive already exists")
+
+// uploader writes validated exports to dated archive objects
+type uploader struct {
+	gcsClient  storage.GCSClient
+	bucketName string
+}
+
+func main() {
+	bucket := flag.String("bucket", os.Getenv("GCS_BUCKET_NAME"), "GCS bucket containing the archives")
+	date := flag.String("date", "", "date the file holds alerts for (YYYY-MM-DD)")
+	file := flag.String("file", "", "local JSONL file to upload")
+	force := flag.Bool("force", false, "overwrite an existing archive for the date")
+	flag.Parse()
+
+	if *bucket == "" {
+		log.Fatal("-bucket or GCS_BUCKET_NAME is required")
+	}
+	if *file == "" {
+		log.Fatal("-file is required")
+	}
+	if _, err := time.Parse("2006-01-02", *date); err != nil {
+		log.Fatalf("Invalid -date %q: must be YYYY-MM-DD", *date)
+	}
+
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", *file, err)
+	}
+
+	ctx := context.Background()
+	storageClient, err := gcs.NewClient(ctx)
+	if err != nil {
+		log.Fatalf("Failed to create Storage client: %v", err)
+	}
+	defer storageClient.Close()
+
+	u := &uploader{
+		gcsClient:  &storage.GCSClientAdapter{Client: storageClient},
+		bucketName: *bucket,
+	}
+
+	count, err := u.upload(ctx, *date, data, *force)
+	if errors.Is(err, errArchiveExists) {
+		fmt.Printf("%s: archive already exists, nothing to do (use -force to overwrite)\n", *date)
+		return
+	}
+	if err != nil {
+		log.Fatalf("Failed to upload %s: %v", *file, err)
+	}
+	fmt.Printf("%s: uploaded %d alerts\n", *date, count)
+}
+
+// upload validates an export and writes it as the archive for date, returning
+// the number of alerts written. It returns errArchiveExists without writing
+// when the archive exists and force is false.
+func (u *uploader) upload(ctx context.Context, date string, export []byte, force bool) (int, error) {
+	archive, count, err := validate(export)
+	if err != nil {
+		return 0, err
+	}
+
+	obj := u.gcsClient.Bucket(u.bucketName).Object(fmt.Sprintf("%s.jsonl", date))
+	if _, err := obj.Attrs(ctx); err == nil {
+		if !force {
+			return 0, errArchiveExists
+		}
+		log.Printf("Overwriting existing archive for %s", date)
+	} else if !storage.IsObjectNotExist(err) {
+		return 0, fmt.Errorf("failed to check for existing archive: %w", err)
+	}
+
+	// Cancelling the writer's context on failure aborts the upload, so a
+	// partial archive is never created
+	writeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	wc := obj.NewWriter(writeCtx)
+	wc.SetMetadata(map[string]string{alertCountMetadataKey: strconv.Itoa(count)})
+	if _, err := wc.Write(archive); err != nil {
+		cancel()
+		wc.Close()
+		return 0, fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		return 0, fmt.Errorf("failed to upload archive: %w", err)
+	}
+	return count, nil
+}
+
+// validate parses every non-blank line of an export as a PoliceAlert and
+// re-encodes the alerts as archive JSONL. Any line that does not parse, or
+// parses without a UUID, rejects the whole export.
+func validate(export []byte) ([]byte, int, error) {
+	var out bytes.Buffer
+	count := 0
+	lineNum := 0
+	scanner := bufio.NewScanner(bytes.NewReader(export))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		lineNum++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var alert models.PoliceAlert
+		if err := json.Unmarshal(line, &alert); err != nil {
+			return nil, 0, fmt.Errorf("line %d is not a valid alert: %w", lineNum, err)
+		}
+		if alert.UUID == "" {
+			return nil, 0, fmt.Errorf("line %d has no UUID", lineNum)
+		}
+
+		jsonData, err := json.Marshal(alert)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to marshal alert %s: %w", alert.UUID, err)
+		}
+		out.Write(jsonData)
+		out.WriteByte('\n')
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, 0, fmt.Errorf("line %d is too long", lineNum+1)
+		}
+		return nil, 0, fmt.Errorf("failed to read export: %w", err)
+	}
+	if count == 0 {
+		return nil, 0, errors.New("export contains no alerts")
+	}
+
+	return out.Bytes(), count, nil
+}
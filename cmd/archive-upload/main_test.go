@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/storage"
+)
+
+// TestUploadValidFile tests that a valid export is written as the dated archive
+func TestUploadValidFile(t *testing.T) {
+	export := "{\"UUID\":\"a1\",\"Type\":\"POLICE\"}\r\n\r\n{\"UUID\":\"a2\",\"Type\":\"POLICE\"}"
+	gcs := storage.NewMemGCS()
+	u := &uploader{gcsClient: gcs, bucketName: "test-bucket"}
+
+	count, err := u.upload(context.Background(), "2024-01-01", []byte(export), false)
+	if err != nil {
+		t.Fatalf("expected upload to succeed, got %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 alerts, got %d", count)
+	}
+
+	archive, ok := gcs.Objects["2024-01-01.jsonl"]
+	if !ok {
+		t.Fatal("expected 2024-01-01.jsonl to be written")
+	}
+	lines := strings.Split(strings.TrimSuffix(string(archive), "\n"), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"uuid":"a1"`) || !strings.Contains(lines[1], `"uuid":"a2"`) {
+		t.Errorf("expected 2 normalized JSONL lines, got %q", archive)
+	}
+	if got := gcs.Metadata["2024-01-01.jsonl"][alertCountMetadataKey]; got != "2" {
+		t.Errorf("expected %s metadata 2, got %q", alertCountMetadataKey, got)
+	}
+}
+
+// TestUploadRejectsBadLine tests that a file with an invalid line is rejected
+// without writing anything
+func TestUploadRejectsBadLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		export  string
+		wantErr string
+	}{
+		{"malformed JSON", "{\"UUID\":\"a1\"}\n{\"UUID\":\n", "line 2"},
+		{"wrong field type", "{\"UUID\":\"a1\",\"Reliability\":\"high\"}\n", "line 1"},
+		{"missing UUID", "{\"UUID\":\"a1\"}\n\n{\"Type\":\"POLICE\"}\n", "line 3 has no UUID"},
+		{"empty file", "\n\n", "no alerts"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gcs := storage.NewMemGCS()
+			u := &uploader{gcsClient: gcs, bucketName: "test-bucket"}
+
+			_, err := u.upload(context.Background(), "2024-01-01", []byte(tt.export), false)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+			if len(gcs.Objects) != 0 {
+				t.Errorf("expected nothing written, got %v", gcs.Objects)
+			}
+		})
+	}
+}
+
+// TestUploadIdempotent tests that an existing archive is kept unless forced
+func TestUploadIdempotent(t *testing.T) {
+	existing := []byte("{\"UUID\":\"old\"}\n")
+	gcs := storage.NewMemGCS()
+	gcs.Objects["2024-01-01.jsonl"] = existing
+	u := &uploader{gcsClient: gcs, bucketName: "test-bucket"}
+	export := []byte("{\"UUID\":\"new\"}\n")
+
+	_, err := u.upload(context.Background(), "2024-01-01", export, false)
+	if !errors.Is(err, errArchiveExists) {
+		t.Fatalf("expected errArchiveExists, got %v", err)
+	}
+	if string(gcs.Objects["2024-01-01.jsonl"]) != string(existing) {
+		t.Errorf("expected existing archive untouched, got %q", gcs.Objects["2024-01-01.jsonl"])
+	}
+
+	count, err := u.upload(context.Background(), "2024-01-01", export, true)
+	if err != nil {
+		t.Fatalf("expected forced upload to succeed, got %v", err)
+	}
+	if count != 1 || !strings.Contains(string(gcs.Objects["2024-01-01.jsonl"]), `"uuid":"new"`) {
+		t.Errorf("expected forced upload to overwrite the archive, got %q", gcs.Objects["2024-01-01.jsonl"])
+	}
+}
@@ -0,0 +1,88 @@
+// Package main implements the heartbeat-check tool, a dead man's switch for
+// the scraper.
+//
+// The scraper can keep running and answering Cloud Scheduler while saving
+// nothing, e.g. when every Waze call is refused with 403. With HEARTBEAT_BUCKET
+// set it records each scrape that saves police alerts in heartbeat.json. This
+// tool reports how long ago that was and exits non-zero when it is older than
+// -max-age or missing, so it can back an uptime check or scheduled job.
+//
+// Usage:
+//
+//	go run ./cmd/heartbeat-check -bucket my-heartbeat-bucket -max-age 30m
+//
+// Flags:
+//   - -bucket: GCS bucket holding heartbeat.json (default: HEARTBEAT_BUCKET)
+//   - -max-age: Oldest acceptable last successful save (default: 30m)
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/storage"
+)
+
+// heartbeatReader reads the scraper's heartbeat
+type heartbeatReader interface {
+	Read(ctx context.Context) (models.Heartbeat, error)
+}
+
+func main() {
+	bucket := flag.String("bucket", os.Getenv("HEARTBEAT_BUCKET"), "GCS bucket holding heartbeat.json")
+	maxAge := flag.Duration("max-age", 30*time.Minute, "oldest acceptable last successful save")
+	flag.Parse()
+
+	if *bucket == "" {
+		log.Fatal("-bucket or HEARTBEAT_BUCKET is required")
+	}
+	if *maxAge <= 0 {
+		log.Fatal("-max-age must be positive")
+	}
+
+	ctx := context.Background()
+	storageClient, err := gcs.NewClient(ctx)
+	if err != nil {
+		log.Fatalf("Failed to create Storage client: %v", err)
+	}
+	defer storageClient.Close()
+
+	store := storage.NewHeartbeatStore(&storage.GCSClientAdapter{Client: storageClient}, *bucket)
+	stale, err := check(ctx, os.Stdout, store, time.Now(), *maxAge)
+	if err != nil {
+		log.Fatalf("Failed to check heartbeat: %v", err)
+	}
+	if stale {
+		os.Exit(1)
+	}
+}
+
+// check writes a one-line report of the heartbeat's age and returns whether
+// it is stale: older than maxAge, or never written
+func check(ctx context.Context, w io.Writer, reader heartbeatReader, now time.Time, maxAge time.Duration) (bool, error) {
+	heartbeat, err := reader.Read(ctx)
+	if storage.IsObjectNotExist(err) {
+		fmt.Fprintln(w, "STALE: no heartbeat has been written")
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	age := now.Sub(heartbeat.LastSuccessfulSave).Truncate(time.Second)
+	status := "OK"
+	stale := age > maxAge
+	if stale {
+		status = "STALE"
+	}
+	fmt.Fprintf(w, "%s: last successful save %s (%s ago, %d police alerts), max age %s\n",
+		status, heartbeat.LastSuccessfulSave.UTC().Format(time.RFC3339), age, heartbeat.PoliceAlertsSaved, maxAge)
+	return stale, nil
+}
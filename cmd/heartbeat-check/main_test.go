@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/storage"
+)
+
+// stubReader returns a fixed heartbeat or error
+type stubReader struct {
+	heartbeat models.Heartbeat
+	err       error
+}
+
+func (s stubReader) Read(ctx context.Context) (models.Heartbeat, error) {
+	return s.heartbeat, s.err
+}
+
+// TestCheck tests that a heartbeat older than the max age, or missing, is reported stale
+func TestCheck(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		reader    stubReader
+		wantStale bool
+		wantLine  string
+	}{
+		{
+			name:      "fresh",
+			reader:    stubReader{heartbeat: models.Heartbeat{LastSuccessfulSave: now.Add(-5 * time.Minute), PoliceAlertsSaved: 12}},
+			wantStale: false,
+			wantLine:  "OK: last successful save 2024-01-15T11:55:00Z (5m0s ago, 12 police alerts)",
+		},
+		{
+			name:      "stale",
+			reader:    stubReader{heartbeat: models.Heartbeat{LastSuccessfulSave: now.Add(-3 * time.Hour), PoliceAlertsSaved: 4}},
+			wantStale: true,
+			wantLine:  "STALE: last successful save 2024-01-15T09:00:00Z (3h0m0s ago",
+		},
+		{
+			name:      "never written",
+			reader:    stubReader{err: storage.ErrObjectNotExist},
+			wantStale: true,
+			wantLine:  "STALE: no heartbeat has been written",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			stale, err := check(context.Background(), &out, tt.reader, now, 30*time.Minute)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if stale != tt.wantStale {
+				t.Errorf("expected stale %v, got %v", tt.wantStale, stale)
+			}
+			if !strings.Contains(out.String(), tt.wantLine) {
+				t.Errorf("expected report containing %q, got %q", tt.wantLine, out.String())
+			}
+		})
+	}
+}
+
+// TestCheckReadError tests that a failure to read the heartbeat is returned rather than reported stale
+func TestCheckReadError(t *testing.T) {
+	_, err := check(context.Background(), &bytes.Buffer{}, stubReader{err: errors.New("permission denied")}, time.Now(), time.Minute)
+	if err == nil {
+		t.Fatal("expected read error")
+	}
+}
@@ -0,0 +1,325 @@
+// Package main implements the repack tool for normalizing archived alert data.
+//
+// Archives written over time may differ in format (gzip vs plain, CRLF line
+// endings, blank lines, raw data included or stripped, Go field names rather
+// than snake_case keys). This tool reads each day's archive from GCS,
+// re-serializes every alert with the current PoliceAlert schema as JSONL,
+// and overwrites the archive when the normalized form differs, reporting the
+// size change per day. Rewritten archives are marked with "normalized: true"
+// metadata so the alerts service can serve them as stored. MessagePack
+// archives (written with ARCHIVE_FORMAT=msgpack) already use the current
+// schema and are skipped, so they keep the format the deployment chose.
+//
+// Usage:
+//
+//	go run ./cmd/repack -bucket my-archive-bucket -start 2024-01-01 -end 2024-01-31
+//
+// Flags:
+//   - -bucket: GCS bucket containing the archives (default: GCS_BUCKET_NAME)
+//   - -start, -end: Inclusive date range to repack, YYYY-MM-DD (required)
+//   - -strip-raw: Drop raw_data_initial/raw_data_last from archived alerts
+//   - -gzip: Store normalized archives gzipped rather than plain
+//   - -dry-run: Report size changes without writing
+//   - -concurrency: Number of days processed in parallel (default: 4)
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/storage"
+)
+
+// Per-day repack outcomes
+const (
+	statusRepacked  = "repacked"
+	statusUnchanged = "unchanged"
+	statusSkipped   = "skipped"
+	statusMissing   = "missing"
+	statusError     = "error"
+)
+
+// normalizedMetadataKey is the object metadata key set to "true" on archives
+// written in the normalized form
+const normalizedMetadataKey = "normalized"
+
+// repacker rewrites archives into the normalized JSONL form
+type repacker struct {
+	gcsClient  storage.GCSClient
+	bucketName string
+	stripRaw   bool
+	gzip       bool
+	dryRun     bool
+}
+
+// dayResult reports the outcome of repacking one day's archive
+type dayResult struct {
+	Date    string
+	Status  string
+	Alerts  int
+	OldSize int
+	NewSize int
+	Err     error
+}
+
+func main() {
+	bucket := flag.String("bucket", os.Getenv("GCS_BUCKET_NAME"), "GCS bucket containing the archives")
+	start := flag.String("start", "", "first date to repack (YYYY-MM-DD)")
+	end := flag.String("end", "", "last date to repack (YYYY-MM-DD)")
+	stripRaw := flag.Bool("strip-raw", false, "drop raw data fields from archived alerts")
+	gzipped := flag.Bool("gzip", false, "store normalized archives gzipped")
+	dryRun := flag.Bool("dry-run", false, "report size changes without writing")
+	concurrency := flag.Int("concurrency", 4, "number of days processed in parallel")
+	flag.Parse()
+
+	if *concurrency < 1 {
+		log.Fatal("-concurrency must be at least 1")
+	}
+
+	if *bucket == "" {
+		log.Fatal("-bucket or GCS_BUCKET_NAME is required")
+	}
+
+	dates, err := dateRange(*start, *end)
+	if err != nil {
+		log.Fatalf("Invalid date range: %v", err)
+	}
+
+	ctx := context.Background()
+	storageClient, err := gcs.NewClient(ctx)
+	if err != nil {
+		log.Fatalf("Failed to create Storage client: %v", err)
+	}
+	defer storageClient.Close()
+
+	r := &repacker{
+		gcsClient:  &storage.GCSClientAdapter{Client: storageClient},
+		bucketName: *bucket,
+		stripRaw:   *stripRaw,
+		gzip:       *gzipped,
+		dryRun:     *dryRun,
+	}
+
+	failed := false
+	for _, result := range r.run(ctx, dates, *concurrency) {
+		printResult(os.Stdout, result)
+		if result.Status == statusError {
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// dateRange returns every date from start to end inclusive, formatted YYYY-MM-DD
+func dateRange(start, end string) ([]string, error) {
+	startDate, err := time.Parse("2006-01-02", start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start date %q: %w", start, err)
+	}
+	endDate, err := time.Parse("2006-01-02", end)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end date %q: %w", end, err)
+	}
+	if endDate.Before(startDate) {
+		return nil, fmt.Errorf("end date %s is before start date %s", end, start)
+	}
+
+	var dates []string
+	for d := startDate; !d.After(endDate); d = d.AddDate(0, 0, 1) {
+		dates = append(dates, d.Format("2006-01-02"))
+	}
+	return dates, nil
+}
+
+// run repacks the given dates using up to concurrency workers. Results are
+// returned in the order of dates regardless of completion order.
+func (r *repacker) run(ctx context.Context, dates []string, concurrency int) []dayResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]dayResult, len(dates))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				// Each worker writes only its own slot, so no locking is needed
+				results[idx] = r.repackDay(ctx, dates[idx])
+			}
+		}()
+	}
+
+	for idx := range dates {
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// repackDay normalizes a single day's archive, overwriting it if the normalized
+// form differs from what is stored or the archive isn't marked normalized yet
+func (r *repacker) repackDay(ctx context.Context, date string) dayResult {
+	result := dayResult{Date: date}
+	obj := r.gcsClient.Bucket(r.bucketName).Object(fmt.Sprintf("%s.jsonl", date))
+
+	reader, err := obj.ReadCompressed(true).NewReader(ctx)
+	if err != nil {
+		if storage.IsObjectNotExist(err) {
+			result.Status = statusMissing
+			return result
+		}
+		result.Status = statusError
+		result.Err = fmt.Errorf("failed to open archive: %w", err)
+		return result
+	}
+	original, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		result.Status = statusError
+		result.Err = fmt.Errorf("failed to read archive: %w", err)
+		return result
+	}
+	result.OldSize = len(original)
+	if storage.IsMsgpackArchive(original) {
+		result.Status = statusSkipped
+		return result
+	}
+
+	normalized, count, err := r.normalize(original)
+	if err != nil {
+		result.Status = statusError
+		result.Err = err
+		return result
+	}
+	result.Alerts = count
+	if r.gzip {
+		if normalized, err = gzipArchive(normalized); err != nil {
+			result.Status = statusError
+			result.Err = err
+			return result
+		}
+	}
+	result.NewSize = len(normalized)
+
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		result.Status = statusError
+		result.Err = fmt.Errorf("failed to read archive attributes: %w", err)
+		return result
+	}
+	if bytes.Equal(original, normalized) && attrs.Metadata[normalizedMetadataKey] == "true" {
+		result.Status = statusUnchanged
+		return result
+	}
+	result.Status = statusRepacked
+	if r.dryRun {
+		return result
+	}
+
+	// Overwrite the existing archive (force)
+	wc := obj.NewWriter(ctx)
+	wc.SetMetadata(map[string]string{normalizedMetadataKey: "true"})
+	if _, err := wc.Write(normalized); err != nil {
+		wc.Close()
+		result.Status = statusError
+		result.Err = fmt.Errorf("failed to write archive: %w", err)
+		return result
+	}
+	if err := wc.Close(); err != nil {
+		result.Status = statusError
+		result.Err = fmt.Errorf("failed to upload archive: %w", err)
+	}
+	return result
+}
+
+// normalize decodes an archive in any supported legacy format and re-encodes it
+// as plain LF-terminated JSONL using the current PoliceAlert schema
+func (r *repacker) normalize(archive []byte) ([]byte, int, error) {
+	reader, err := storage.MaybeGunzip(io.NopCloser(bytes.NewReader(archive)))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer reader.Close()
+
+	var out bytes.Buffer
+	count := 0
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var alert models.PoliceAlert
+		if err := json.Unmarshal(line, &alert); err != nil {
+			return nil, 0, fmt.Errorf("failed to parse line %d: %w", count+1, err)
+		}
+		if r.stripRaw {
+			alert.RawDataInitial = ""
+			alert.RawDataLast = ""
+		}
+
+		jsonData, err := json.Marshal(alert)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to marshal alert %s: %w", alert.UUID, err)
+		}
+		out.Write(jsonData)
+		out.WriteByte('\n')
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	return out.Bytes(), count, nil
+}
+
+// gzipArchive compresses a normalized archive
+func gzipArchive(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to gzip archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to gzip archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// printResult writes a one-line report for a day
+func printResult(w io.Writer, result dayResult) {
+	switch result.Status {
+	case statusMissing:
+		fmt.Fprintf(w, "%s: no archive\n", result.Date)
+	case statusSkipped:
+		fmt.Fprintf(w, "%s: MessagePack archive, skipped\n", result.Date)
+	case statusError:
+		fmt.Fprintf(w, "%s: error: %v\n", result.Date, result.Err)
+	default:
+		fmt.Fprintf(w, "%s: %s, %d alerts, %d -> %d bytes (%+d)\n",
+			result.Date, result.Status, result.Alerts, result.OldSize, result.NewSize, result.NewSize-result.OldSize)
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/storage"
+)
+
+func gzipBytes(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(data)); err != nil {
+		t.Fatalf("failed to gzip: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("failed to gzip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestRepackLegacyArchive tests that a gzipped CRLF archive is re-packed to plain JSONL
+func TestRepackLegacyArchive(t *testing.T) {
+	legacy := "{\"UUID\":\"a1\",\"Type\":\"POLICE\",\"LegacyField\":1,\"RawDataLast\":\"{}\"}\r\n" +
+		"\r\n" +
+		"{\"UUID\":\"a2\",\"Type\":\"POLICE\"}"
+	gcs := storage.NewMemGCS()
+	gcs.Objects["2024-01-01.jsonl"] = gzipBytes(t, legacy)
+
+	r := &repacker{gcsClient: gcs, bucketName: "test-bucket"}
+	result := r.repackDay(context.Background(), "2024-01-01")
+
+	if result.Status != statusRepacked {
+		t.Fatalf("expected status %s, got %s (%v)", statusRepacked, result.Status, result.Err)
+	}
+	if result.Alerts != 2 {
+		t.Errorf("expected 2 alerts, got %d", result.Alerts)
+	}
+
+	repacked := string(gcs.Objects["2024-01-01.jsonl"])
+	if strings.Contains(repacked, "\r") || strings.Contains(repacked, "LegacyField") {
+		t.Errorf("expected normalized archive, got %q", repacked)
+	}
+	lines := strings.Split(strings.TrimSuffix(repacked, "\n"), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], `{"uuid":"a1"`) || !strings.HasPrefix(lines[1], `{"uuid":"a2"`) {
+		t.Errorf("unexpected repacked lines: %q", lines)
+	}
+	if !strings.Contains(lines[0], `"raw_data_last":"{}"`) {
+		t.Errorf("expected raw data to be kept by default, got %s", lines[0])
+	}
+	if result.NewSize != len(repacked) {
+		t.Errorf("expected new size %d, got %d", len(repacked), result.NewSize)
+	}
+
+	if gcs.Metadata["2024-01-01.jsonl"][normalizedMetadataKey] != "true" {
+		t.Errorf("expected archive to be marked normalized, got metadata %v", gcs.Metadata["2024-01-01.jsonl"])
+	}
+
+	// Repacking again is a no-op
+	again := r.repackDay(context.Background(), "2024-01-01")
+	if again.Status != statusUnchanged {
+		t.Errorf("expected second repack to be %s, got %s", statusUnchanged, again.Status)
+	}
+}
+
+// TestRepackGzip tests that -gzip stores the normalized archive gzipped, and
+// that an archive already in normalized form is rewritten until it is marked
+func TestRepackGzip(t *testing.T) {
+	plain := "{\"uuid\":\"a1\"}\n"
+	gcs := storage.NewMemGCS()
+	gcs.Objects["2024-01-01.jsonl"] = []byte(plain)
+
+	r := &repacker{gcsClient: gcs, bucketName: "test-bucket"}
+	if result := r.repackDay(context.Background(), "2024-01-01"); result.Status != statusRepacked {
+		t.Fatalf("expected unmarked archive to be %s, got %s (%v)", statusRepacked, result.Status, result.Err)
+	}
+
+	r.gzip = true
+	result := r.repackDay(context.Background(), "2024-01-01")
+	if result.Status != statusRepacked {
+		t.Fatalf("expected status %s, got %s (%v)", statusRepacked, result.Status, result.Err)
+	}
+	stored := gcs.Objects["2024-01-01.jsonl"]
+	gz, err := gzip.NewReader(bytes.NewReader(stored))
+	if err != nil {
+		t.Fatalf("expected gzipped archive: %v", err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("failed to gunzip archive: %v", err)
+	}
+	if !strings.HasPrefix(string(data), `{"uuid":"a1"`) || !strings.HasSuffix(string(data), "}\n") {
+		t.Errorf("unexpected gzipped lines: %q", data)
+	}
+	if result.NewSize != len(stored) {
+		t.Errorf("expected new size %d, got %d", len(stored), result.NewSize)
+	}
+	if gcs.Metadata["2024-01-01.jsonl"][normalizedMetadataKey] != "true" {
+		t.Errorf("expected archive to be marked normalized, got metadata %v", gcs.Metadata["2024-01-01.jsonl"])
+	}
+
+	if again := r.repackDay(context.Background(), "2024-01-01"); again.Status != statusUnchanged {
+		t.Errorf("expected second repack to be %s, got %s", statusUnchanged, again.Status)
+	}
+}
+
+// TestRepackStripRaw tests that raw data fields are dropped with -strip-raw
+func TestRepackStripRaw(t *testing.T) {
+	gcs := storage.NewMemGCS()
+	gcs.Objects["2024-01-01.jsonl"] = []byte(`{"UUID":"a1","RawDataInitial":"{\"x\":1}","RawDataLast":"{\"x\":2}"}` + "\n")
+
+	r := &repacker{gcsClient: gcs, bucketName: "test-bucket", stripRaw: true}
+	result := r.repackDay(context.Background(), "2024-01-01")
+
+	if result.Status != statusRepacked {
+		t.Fatalf("expected status %s, got %s", statusRepacked, result.Status)
+	}
+	if !strings.Contains(string(gcs.Objects["2024-01-01.jsonl"]), `"raw_data_initial":"","raw_data_last":""`) {
+		t.Errorf("expected empty raw data fields, got %s", gcs.Objects["2024-01-01.jsonl"])
+	}
+	if strings.Contains(string(gcs.Objects["2024-01-01.jsonl"]), `\"x\"`) {
+		t.Errorf("expected raw data to be stripped, got %s", gcs.Objects["2024-01-01.jsonl"])
+	}
+}
+
+// TestRepackDryRun tests that dry runs report changes without writing
+func TestRepackDryRun(t *testing.T) {
+	original := []byte("{\"UUID\":\"a1\"}\r\n")
+	gcs := storage.NewMemGCS()
+	gcs.Objects["2024-01-01.jsonl"] = original
+
+	r := &repacker{gcsClient: gcs, bucketName: "test-bucket", dryRun: true}
+	result := r.repackDay(context.Background(), "2024-01-01")
+
+	if result.Status != statusRepacked {
+		t.Errorf("expected status %s, got %s", statusRepacked, result.Status)
+	}
+	if !bytes.Equal(gcs.Objects["2024-01-01.jsonl"], original) {
+		t.Error("expected archive to be left untouched in dry run")
+	}
+}
+
+// TestRepackMissingAndErrors tests missing archives, MessagePack archives, read
+// errors and malformed lines
+func TestRepackMissingAndErrors(t *testing.T) {
+	gcs := storage.NewMemGCS()
+	gcs.Objects["2024-01-02.jsonl"] = []byte("not json\n")
+	r := &repacker{gcsClient: gcs, bucketName: "test-bucket"}
+
+	if result := r.repackDay(context.Background(), "2024-01-01"); result.Status != statusMissing {
+		t.Errorf("expected %s for missing archive, got %s", statusMissing, result.Status)
+	}
+
+	result := r.repackDay(context.Background(), "2024-01-02")
+	if result.Status != statusError || result.Err == nil {
+		t.Errorf("expected error for malformed archive, got %s", result.Status)
+	}
+	if string(gcs.Objects["2024-01-02.jsonl"]) != "not json\n" {
+		t.Error("expected malformed archive to be left untouched")
+	}
+
+	failing := &storage.MockGCSClient{
+		BucketFunc: func(bucket string) storage.GCSBucketHandle {
+			return &storage.MockGCSBucketHandle{
+				ObjectFunc: func(name string) storage.GCSObjectHandle {
+					return &storage.MockGCSObjectHandle{
+						NewReaderFunc: func(ctx context.Context) (io.ReadCloser, error) {
+							return nil, errors.New("permission denied")
+						},
+					}
+				},
+			}
+		},
+	}
+	var msgpackArchive bytes.Buffer
+	if err := storage.WriteMsgpackAlerts(&msgpackArchive, []models.PoliceAlert{{UUID: "a1"}}); err != nil {
+		t.Fatalf("failed to write MessagePack archive: %v", err)
+	}
+	gcs.Objects["2024-01-03.jsonl"] = msgpackArchive.Bytes()
+	if result := r.repackDay(context.Background(), "2024-01-03"); result.Status != statusSkipped {
+		t.Errorf("expected %s for MessagePack archive, got %s (%v)", statusSkipped, result.Status, result.Err)
+	}
+	if !bytes.Equal(gcs.Objects["2024-01-03.jsonl"], msgpackArchive.Bytes()) {
+		t.Error("expected MessagePack archive to be left untouched")
+	}
+
+	r = &repacker{gcsClient: failing, bucketName: "test-bucket"}
+	if result := r.repackDay(context.Background(), "2024-01-01"); result.Status != statusError {
+		t.Errorf("expected %s for read error, got %s", statusError, result.Status)
+	}
+}
+
+func TestDateRange(t *testing.T) {
+	dates, err := dateRange("2024-02-28", "2024-03-01")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(dates, ",") != "2024-02-28,2024-02-29,2024-03-01" {
+		t.Errorf("unexpected dates: %v", dates)
+	}
+
+	for _, tt := range [][2]string{{"", "2024-01-01"}, {"2024-01-01", "bad"}, {"2024-01-02", "2024-01-01"}} {
+		if _, err := dateRange(tt[0], tt[1]); err == nil {
+			t.Errorf("expected error for range %v", tt)
+		}
+	}
+}
+
+func TestPrintResult(t *testing.T) {
+	var buf bytes.Buffer
+	printResult(&buf, dayResult{Date: "2024-01-01", Status: statusRepacked, Alerts: 3, OldSize: 100, NewSize: 80})
+	printResult(&buf, dayResult{Date: "2024-01-02", Status: statusMissing})
+	printResult(&buf, dayResult{Date: "2024-01-03", Status: statusSkipped})
+
+	want := "2024-01-01: repacked, 3 alerts, 100 -> 80 bytes (-20)\n2024-01-02: no archive\n2024-01-03: MessagePack archive, skipped\n"
+	if buf.String() != want {
+		t.Errorf("expected %q, got %q", want, buf.String())
+	}
+}
+
+// TestRunConcurrentDeterministicOrder tests that concurrent repacking reports days in date order
+func TestRunConcurrentDeterministicOrder(t *testing.T) {
+	dates, _ := dateRange("2024-01-01", "2024-01-30")
+
+	gcs := storage.NewMemGCS()
+	for i, date := range dates {
+		switch i % 3 {
+		case 0:
+			gcs.Objects[date+".jsonl"] = []byte("{\"UUID\":\"" + date + "\"}\r\n") // needs repacking
+		case 1:
+			gcs.Objects[date+".jsonl"] = []byte("not json\n") // malformed
+		}
+		// i%3 == 2: missing
+	}
+
+	r := &repacker{gcsClient: gcs, bucketName: "test-bucket"}
+	results := r.run(context.Background(), dates, 8)
+
+	if len(results) != len(dates) {
+		t.Fatalf("expected %d results, got %d", len(dates), len(results))
+	}
+	for i, result := range results {
+		if result.Date != dates[i] {
+			t.Errorf("result %d: expected date %s, got %s", i, dates[i], result.Date)
+		}
+		want := []string{statusRepacked, statusError, statusMissing}[i%3]
+		if result.Status != want {
+			t.Errorf("%s: expected status %s, got %s", result.Date, want, result.Status)
+		}
+	}
+
+	// A second run finds every repacked archive already normalized
+	for i, result := range r.run(context.Background(), dates, 8) {
+		if i%3 == 0 && result.Status != statusUnchanged {
+			t.Errorf("%s: expected %s on second run, got %s", result.Date, statusUnchanged, result.Status)
+		}
+	}
+}
+
+// TestRunRespectsConcurrencyLimit tests that no more than the configured number of days run at once
+func TestRunRespectsConcurrencyLimit(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int64
+	gcs := &storage.MockGCSClient{
+		BucketFunc: func(bucket string) storage.GCSBucketHandle {
+			return &storage.MockGCSBucketHandle{
+				ObjectFunc: func(name string) storage.GCSObjectHandle {
+					return &storage.MockGCSObjectHandle{
+						NewReaderFunc: func(ctx context.Context) (io.ReadCloser, error) {
+							n := inFlight.Add(1)
+							defer inFlight.Add(-1)
+							for {
+								max := maxInFlight.Load()
+								if n <= max || maxInFlight.CompareAndSwap(max, n) {
+									break
+								}
+							}
+							time.Sleep(5 * time.Millisecond)
+							return nil, storage.ErrObjectNotExist
+						},
+					}
+				},
+			}
+		},
+	}
+
+	dates, _ := dateRange("2024-01-01", "2024-01-20")
+	r := &repacker{gcsClient: gcs, bucketName: "test-bucket"}
+	results := r.run(context.Background(), dates, 3)
+
+	if len(results) != 20 {
+		t.Fatalf("expected 20 results, got %d", len(results))
+	}
+	if got := maxInFlight.Load(); got > 3 || got < 2 {
+		t.Errorf("expected between 2 and 3 concurrent reads, got %d", got)
+	}
+}
@@ -4,12 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/metrics"
 	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/notify"
 	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/storage"
 	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/waze"
 )
@@ -96,8 +100,8 @@ func TestMakeScraperHandler_Success(t *testing.T) {
 	}
 
 	mockStore := &storage.MockAlertStore{
-		SavePoliceAlertsFunc: func(ctx context.Context, alerts []models.WazeAlert, scrapeTime time.Time) error {
-			return nil
+		SavePoliceAlertsFunc: func(ctx context.Context, alerts []models.WazeAlert, scrapeTime time.Time) (int, error) {
+			return 1, nil
 		},
 	}
 
@@ -186,8 +190,8 @@ func TestMakeScraperHandler_SaveError(t *testing.T) {
 	}
 
 	mockStore := &storage.MockAlertStore{
-		SavePoliceAlertsFunc: func(ctx context.Context, alerts []models.WazeAlert, scrapeTime time.Time) error {
-			return errors.New("firestore connection timeout")
+		SavePoliceAlertsFunc: func(ctx context.Context, alerts []models.WazeAlert, scrapeTime time.Time) (int, error) {
+			return 0, errors.New("firestore connection timeout")
 		},
 	}
 
@@ -226,8 +230,8 @@ func TestMakeScraperHandler_EmptyAlerts(t *testing.T) {
 	}
 
 	mockStore := &storage.MockAlertStore{
-		SavePoliceAlertsFunc: func(ctx context.Context, alerts []models.WazeAlert, scrapeTime time.Time) error {
-			return nil
+		SavePoliceAlertsFunc: func(ctx context.Context, alerts []models.WazeAlert, scrapeTime time.Time) (int, error) {
+			return 0, nil
 		},
 	}
 
@@ -566,3 +570,623 @@ func TestHTTPRequestHeaders(t *testing.T) {
 		t.Errorf("expected GET method, got %s", capturedRequest.Method)
 	}
 }
+
+// TestMakeScraperHandler_StableOutput tests that identical input produces byte-identical responses
+func TestMakeScraperHandler_StableOutput(t *testing.T) {
+	lastRun := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	mockFetcher := &waze.MockAlertFetcher{
+		GetAlertsMultipleBBoxesFunc: func(bboxes []string) ([]models.WazeAlert, error) {
+			return []models.WazeAlert{
+				{UUID: "a1", Type: "POLICE"},
+				{UUID: "a2", Type: "JAM"},
+			}, nil
+		},
+		GetStatsFunc: func() *models.ScrapingStats {
+			return &models.ScrapingStats{TotalRequests: 2, SuccessfulCalls: 2, TotalAlerts: 2, UniqueAlerts: 2, LastSuccessfulRun: lastRun}
+		},
+	}
+	handler := makeScraperHandler(mockFetcher, &storage.MockAlertStore{}, []string{"1,2,3,4", "5,6,7,8"})
+
+	var outputs []string
+	for i := 0; i < 20; i++ {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		outputs = append(outputs, w.Body.String())
+	}
+
+	for i, out := range outputs {
+		if out != outputs[0] {
+			t.Fatalf("run %d produced different output:\n%s\nvs\n%s", i, out, outputs[0])
+		}
+	}
+
+	want := `{"status":"success","alerts_found":2,"police_alerts_saved":1,` +
+		`"stats":{"total_requests":2,"successful_calls":2,"failed_calls":0,"total_alerts":2,"unique_alerts":2,"last_successful_run":"2024-01-15T10:00:00Z"},` +
+		`"bboxes_used":2}` + "\n"
+	if outputs[0] != want {
+		t.Errorf("unexpected key order:\n got %s\nwant %s", outputs[0], want)
+	}
+}
+
+// =============================================================================
+// Failure Notification Tests
+// =============================================================================
+
+func TestMakeScraperHandler_NotifiesOnFetchError(t *testing.T) {
+	mockFetcher := &waze.MockAlertFetcher{
+		GetAlertsMultipleBBoxesFunc: func(bboxes []string) ([]models.WazeAlert, error) {
+			return nil, errors.New("no successful API calls")
+		},
+	}
+	notifier := &notify.MockNotifier{}
+	handler := makeScraperHandler(mockFetcher, &storage.MockAlertStore{}, []string{"1,2,3,4"}, withNotifier(notifier))
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	events := notifier.Events()
+	if len(events) != 1 || events[0].Kind != notify.KindFailure || events[0].Service != "scraper-service" {
+		t.Fatalf("Expected one failure event, got %+v", events)
+	}
+	if !strings.Contains(events[0].Message, "no successful API calls") {
+		t.Errorf("Expected error in message, got %q", events[0].Message)
+	}
+}
+
+func TestMakeScraperHandler_NotifiesOnForbidden(t *testing.T) {
+	mockFetcher := &waze.MockAlertFetcher{
+		GetAlertsMultipleBBoxesFunc: func(bboxes []string) ([]models.WazeAlert, error) {
+			return nil, fmt.Errorf("no successful API calls from 1 attempts, first error: %w", &waze.HTTPError{StatusCode: http.StatusForbidden})
+		},
+	}
+	notifier := &notify.MockNotifier{}
+	handler := makeScraperHandler(mockFetcher, &storage.MockAlertStore{}, []string{"1,2,3,4"}, withNotifier(notifier))
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	events := notifier.Events()
+	if len(events) != 1 || events[0].Kind != notify.KindFailure {
+		t.Fatalf("Expected one failure event, got %+v", events)
+	}
+	if !strings.Contains(events[0].Message, "403 Forbidden") {
+		t.Errorf("Expected the message to call out the block, got %q", events[0].Message)
+	}
+}
+
+func TestMakeScraperHandler_NotifiesOnSaveError(t *testing.T) {
+	mockFetcher := &waze.MockAlertFetcher{
+		GetAlertsMultipleBBoxesFunc: func(bboxes []string) ([]models.WazeAlert, error) {
+			return []models.WazeAlert{{UUID: "a1", Type: "POLICE"}}, nil
+		},
+	}
+	mockStore := &storage.MockAlertStore{
+		SavePoliceAlertsFunc: func(ctx context.Context, alerts []models.WazeAlert, scrapeTime time.Time) (int, error) {
+			return 0, errors.New("firestore timeout")
+		},
+	}
+	notifier := &notify.MockNotifier{}
+	handler := makeScraperHandler(mockFetcher, mockStore, []string{"1,2,3,4"}, withNotifier(notifier))
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if events := notifier.Events(); len(events) != 1 || events[0].Kind != notify.KindFailure {
+		t.Errorf("Expected one failure event, got %+v", events)
+	}
+}
+
+func TestMakeScraperHandler_NotifiesOnZeroAlerts(t *testing.T) {
+	notifier := &notify.MockNotifier{}
+	handler := makeScraperHandler(&waze.MockAlertFetcher{}, &storage.MockAlertStore{}, []string{"1,2,3,4"}, withNotifier(notifier))
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if events := notifier.Events(); len(events) != 1 || events[0].Kind != notify.KindZeroAlerts {
+		t.Errorf("Expected one zero-alerts event, got %+v", events)
+	}
+}
+
+func TestMakeScraperHandler_NoNotificationOnSuccess(t *testing.T) {
+	mockFetcher := &waze.MockAlertFetcher{
+		GetAlertsMultipleBBoxesFunc: func(bboxes []string) ([]models.WazeAlert, error) {
+			return []models.WazeAlert{{UUID: "a1", Type: "POLICE"}}, nil
+		},
+	}
+	notifier := &notify.MockNotifier{}
+	handler := makeScraperHandler(mockFetcher, &storage.MockAlertStore{}, []string{"1,2,3,4"}, withNotifier(notifier))
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if events := notifier.Events(); len(events) != 0 {
+		t.Errorf("Expected no notifications, got %+v", events)
+	}
+}
+
+// =============================================================================
+// Metrics Tests
+// =============================================================================
+
+func TestMakeScraperHandler_WritesMetricsOnSuccess(t *testing.T) {
+	mockFetcher := &waze.MockAlertFetcher{
+		GetAlertsMultipleBBoxesFunc: func(bboxes []string) ([]models.WazeAlert, error) {
+			return []models.WazeAlert{
+				{UUID: "a1", Type: "POLICE"},
+				{UUID: "a2", Type: "POLICE"},
+				{UUID: "a3", Type: "JAM"},
+			}, nil
+		},
+	}
+	writer := &metrics.MockWriter{}
+	handler := makeScraperHandler(mockFetcher, &storage.MockAlertStore{}, []string{"1,2,3,4"}, withMetrics(writer))
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	want := map[string]int64{
+		metrics.ScrapeSuccess:     1,
+		metrics.AlertsFound:       3,
+		metrics.PoliceAlertsSaved: 2,
+	}
+	points := writer.Points()
+	if len(points) != len(want) {
+		t.Fatalf("Expected %d points, got %+v", len(want), points)
+	}
+	for _, p := range points {
+		if v, ok := want[p.Name]; !ok || v != p.Value {
+			t.Errorf("Unexpected point %s=%d", p.Name, p.Value)
+		}
+		if p.Labels["service"] != "scraper-service" || p.Time.IsZero() {
+			t.Errorf("Expected service label and timestamp on %+v", p)
+		}
+	}
+}
+
+func TestMakeScraperHandler_WritesFailureMetricOnFetchError(t *testing.T) {
+	mockFetcher := &waze.MockAlertFetcher{
+		GetAlertsMultipleBBoxesFunc: func(bboxes []string) ([]models.WazeAlert, error) {
+			return nil, errors.New("no successful API calls")
+		},
+	}
+	writer := &metrics.MockWriter{}
+	handler := makeScraperHandler(mockFetcher, &storage.MockAlertStore{}, []string{"1,2,3,4"}, withMetrics(writer))
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	points := writer.Points()
+	if len(points) != 1 || points[0].Name != metrics.ScrapeSuccess || points[0].Value != 0 {
+		t.Errorf("Expected a single scrape_success=0 point, got %+v", points)
+	}
+}
+
+func TestMakeScraperHandler_WritesFailureMetricOnSaveError(t *testing.T) {
+	mockFetcher := &waze.MockAlertFetcher{
+		GetAlertsMultipleBBoxesFunc: func(bboxes []string) ([]models.WazeAlert, error) {
+			return []models.WazeAlert{{UUID: "a1", Type: "POLICE"}}, nil
+		},
+	}
+	mockStore := &storage.MockAlertStore{
+		SavePoliceAlertsFunc: func(ctx context.Context, alerts []models.WazeAlert, scrapeTime time.Time) (int, error) {
+			return 0, errors.New("firestore timeout")
+		},
+	}
+	writer := &metrics.MockWriter{}
+	handler := makeScraperHandler(mockFetcher, mockStore, []string{"1,2,3,4"}, withMetrics(writer))
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	values := writer.Values()
+	if len(values) != 2 || values[metrics.ScrapeSuccess] != 0 || values[metrics.AlertsFound] != 1 {
+		t.Errorf("Expected scrape_success=0 and alerts_found=1, got %v", values)
+	}
+}
+
+func TestMakeScraperHandler_MetricsWriteErrorDoesNotFailScrape(t *testing.T) {
+	writer := &metrics.MockWriter{
+		WriteFunc: func(ctx context.Context, points ...metrics.Point) error {
+			return errors.New("monitoring unavailable")
+		},
+	}
+	handler := makeScraperHandler(&waze.MockAlertFetcher{}, &storage.MockAlertStore{}, []string{"1,2,3,4"}, withMetrics(writer))
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 despite metrics failure, got %d", w.Code)
+	}
+}
+
+// =============================================================================
+// Run Log Tests
+// =============================================================================
+
+// runSummaries decodes every run-logs/ object that was written
+func runSummaries(t *testing.T, objects map[string][]byte) []models.RunSummary {
+	t.Helper()
+	var summaries []models.RunSummary
+	for name, body := range objects {
+		if !strings.HasPrefix(name, "run-logs/") || !strings.HasSuffix(name, ".json") {
+			t.Errorf("Unexpected object %s", name)
+			continue
+		}
+		var summary models.RunSummary
+		if err := json.Unmarshal(body, &summary); err != nil {
+			t.Fatalf("Run summary %s is not valid JSON: %v", name, err)
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+func TestMakeScraperHandler_WritesRunSummary(t *testing.T) {
+	// Stats are cumulative across runs, so the summary must report only this run's calls
+	stats := &models.ScrapingStats{TotalRequests: 10, SuccessfulCalls: 9, FailedCalls: 1}
+	mockFetcher := &waze.MockAlertFetcher{
+		GetAlertsMultipleBBoxesFunc: func(bboxes []string) ([]models.WazeAlert, error) {
+			stats.TotalRequests += 2
+			stats.SuccessfulCalls++
+			stats.FailedCalls++
+			return []models.WazeAlert{
+				{UUID: "a1", Type: "POLICE"},
+				{UUID: "a2", Type: "JAM"},
+			}, nil
+		},
+		GetStatsFunc: func() *models.ScrapingStats { return stats },
+	}
+	gcs := storage.NewMemGCS()
+	runLog := storage.NewRunLogWriter(gcs, "run-bucket")
+	bboxes := []string{"1,2,3,4", "5,6,7,8"}
+	handler := makeScraperHandler(mockFetcher, &storage.MockAlertStore{}, bboxes, withRunLog(runLog))
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	summaries := runSummaries(t, gcs.Objects)
+	if len(summaries) != 1 {
+		t.Fatalf("Expected 1 run summary, got %d", len(summaries))
+	}
+	got := summaries[0]
+	if got.Status != "success" || got.Error != "" {
+		t.Errorf("Expected success without error, got %q %q", got.Status, got.Error)
+	}
+	if got.StartedAt.IsZero() || got.DurationMs < 0 {
+		t.Errorf("Expected start time and duration, got %v %d", got.StartedAt, got.DurationMs)
+	}
+	if len(got.BBoxes) != 2 || got.BBoxes[1] != "5,6,7,8" {
+		t.Errorf("Expected bboxes %v, got %v", bboxes, got.BBoxes)
+	}
+	if got.Requests != 2 || got.SuccessfulCalls != 1 || got.FailedCalls != 1 {
+		t.Errorf("Expected this run's calls (2 requests, 1 ok, 1 failed), got %d/%d/%d", got.Requests, got.SuccessfulCalls, got.FailedCalls)
+	}
+	if got.AlertsFound != 2 || got.PoliceAlertsSaved != 1 {
+		t.Errorf("Expected 2 alerts found and 1 saved, got %d and %d", got.AlertsFound, got.PoliceAlertsSaved)
+	}
+}
+
+func TestMakeScraperHandler_WritesRunSummaryOnFailure(t *testing.T) {
+	mockFetcher := &waze.MockAlertFetcher{
+		GetAlertsMultipleBBoxesFunc: func(bboxes []string) ([]models.WazeAlert, error) {
+			return nil, errors.New("no successful API calls")
+		},
+	}
+	gcs := storage.NewMemGCS()
+	runLog := storage.NewRunLogWriter(gcs, "run-bucket")
+	handler := makeScraperHandler(mockFetcher, &storage.MockAlertStore{}, []string{"1,2,3,4"}, withRunLog(runLog))
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", w.Code)
+	}
+	summaries := runSummaries(t, gcs.Objects)
+	if len(summaries) != 1 {
+		t.Fatalf("Expected 1 run summary, got %d", len(summaries))
+	}
+	if summaries[0].Status != "failure" || !strings.Contains(summaries[0].Error, "no successful API calls") {
+		t.Errorf("Expected failure with error, got %+v", summaries[0])
+	}
+}
+
+// TestMakeScraperHandler_Heartbeat tests that the heartbeat advances only on
+// scrapes that save police alerts, so a stalled scraper leaves it stale
+func TestMakeScraperHandler_Heartbeat(t *testing.T) {
+	var fetchErr, saveErr error
+	allowlisted := true
+	alerts := []models.WazeAlert{{UUID: "a1", Type: "POLICE"}, {UUID: "a2", Type: "POLICE"}}
+	mockFetcher := &waze.MockAlertFetcher{
+		GetAlertsMultipleBBoxesFunc: func(bboxes []string) ([]models.WazeAlert, error) {
+			return alerts, fetchErr
+		},
+	}
+	mockStore := &storage.MockAlertStore{
+		SavePoliceAlertsFunc: func(ctx context.Context, alerts []models.WazeAlert, scrapeTime time.Time) (int, error) {
+			if saveErr != nil || !allowlisted {
+				return 0, saveErr
+			}
+			saved := 0
+			for _, alert := range alerts {
+				if alert.Type == "POLICE" {
+					saved++
+				}
+			}
+			return saved, nil
+		},
+	}
+	gcs := storage.NewMemGCS()
+	heartbeat := storage.NewHeartbeatStore(gcs, "heartbeat-bucket")
+	handler := makeScraperHandler(mockFetcher, mockStore, []string{"1,2,3,4"}, withHeartbeat(heartbeat))
+
+	readHeartbeat := func() models.Heartbeat {
+		t.Helper()
+		var hb models.Heartbeat
+		body, ok := gcs.Objects[storage.HeartbeatObjectName]
+		if !ok {
+			return hb
+		}
+		if err := json.Unmarshal(body, &hb); err != nil {
+			t.Fatalf("Heartbeat is not valid JSON: %v", err)
+		}
+		return hb
+	}
+
+	before := time.Now()
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	saved := readHeartbeat()
+	if saved.LastSuccessfulSave.Before(before) || saved.PoliceAlertsSaved != 2 {
+		t.Fatalf("Expected a heartbeat for 2 alerts saved after %v, got %+v", before, saved)
+	}
+
+	// A 403 on every bbox, a failed save, no police alerts, or police alerts
+	// the store skipped leave it untouched
+	stalls := []struct {
+		name   string
+		setup  func()
+		alerts []models.WazeAlert
+	}{
+		{"fetch failure", func() { fetchErr = errors.New("API returned status 403") }, alerts},
+		{"save failure", func() { fetchErr, saveErr = nil, errors.New("firestore down") }, alerts},
+		{"no police alerts", func() { fetchErr, saveErr = nil, nil }, []models.WazeAlert{{UUID: "j1", Type: "JAM"}}},
+		{"nothing written", func() { allowlisted = false }, alerts},
+	}
+	for _, stall := range stalls {
+		stall.setup()
+		alerts = stall.alerts
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		if got := readHeartbeat(); !got.LastSuccessfulSave.Equal(saved.LastSuccessfulSave) {
+			t.Errorf("%s: expected heartbeat to stay at %v, got %v", stall.name, saved.LastSuccessfulSave, got.LastSuccessfulSave)
+		}
+	}
+}
+
+// TestMakeScraperHandler_FlushesRawSamples tests that responses held by the
+// fetch hook are uploaded once the fetch is done, even when it fails
+func TestMakeScraperHandler_FlushesRawSamples(t *testing.T) {
+	gcs := storage.NewMemGCS()
+	sampler := storage.NewRawResponseSampler(gcs, "raw-bucket", 1)
+	var fetchErr error
+	mockFetcher := &waze.MockAlertFetcher{
+		GetAlertsMultipleBBoxesFunc: func(bboxes []string) ([]models.WazeAlert, error) {
+			sampler.Hold(bboxes[0], []byte(`{"alerts":[]}`))
+			return nil, fetchErr
+		},
+	}
+	handler := makeScraperHandler(mockFetcher, &storage.MockAlertStore{}, []string{"1,2,3,4"}, withRawSampler(sampler))
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if len(gcs.Objects) != 1 {
+		t.Fatalf("Expected 1 raw sample uploaded after a scrape, got %d", len(gcs.Objects))
+	}
+
+	fetchErr = errors.New("Waze returned HTML")
+	time.Sleep(time.Millisecond) // distinct sample object names
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if len(gcs.Objects) != 2 {
+		t.Errorf("Expected the sample from a failed fetch to be uploaded too, got %d objects", len(gcs.Objects))
+	}
+}
+
+// TestMakeScraperHandler_SkipsUnchangedAlerts tests that an unchanged alert seen
+// on consecutive scrapes is only written once, while a changed one is rewritten
+func TestMakeScraperHandler_SkipsUnchangedAlerts(t *testing.T) {
+	thumbsUp := 1
+	mockFetcher := &waze.MockAlertFetcher{
+		GetAlertsMultipleBBoxesFunc: func(bboxes []string) ([]models.WazeAlert, error) {
+			return []models.WazeAlert{
+				{UUID: "unchanged", Type: "POLICE", NThumbsUp: 3},
+				{UUID: "changing", Type: "POLICE", NThumbsUp: thumbsUp},
+			}, nil
+		},
+	}
+	var saved [][]string
+	mockStore := &storage.MockAlertStore{
+		SavePoliceAlertsFunc: func(ctx context.Context, alerts []models.WazeAlert, scrapeTime time.Time) (int, error) {
+			var uuids []string
+			for _, alert := range alerts {
+				uuids = append(uuids, alert.UUID)
+			}
+			saved = append(saved, uuids)
+			return len(alerts), nil
+		},
+	}
+
+	handler := makeScraperHandler(mockFetcher, mockStore, []string{"150.0,-34.0,151.0,-33.0"},
+		withRecentAlerts(newRecentAlerts(10, time.Hour)))
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("scrape %d: expected status 200, got %d", i+1, w.Code)
+		}
+		thumbsUp++
+	}
+
+	if len(saved) != 2 {
+		t.Fatalf("expected 2 saves, got %d", len(saved))
+	}
+	if strings.Join(saved[0], ",") != "unchanged,changing" {
+		t.Errorf("expected both alerts written on the first scrape, got %v", saved[0])
+	}
+	if strings.Join(saved[1], ",") != "changing" {
+		t.Errorf("expected only the changed alert written on the second scrape, got %v", saved[1])
+	}
+}
+
+// TestMakeScraperHandler_RetriesAlertsAfterSaveError tests that alerts from a
+// failed write are not remembered, so the next scrape writes them again
+func TestMakeScraperHandler_RetriesAlertsAfterSaveError(t *testing.T) {
+	mockFetcher := &waze.MockAlertFetcher{
+		GetAlertsMultipleBBoxesFunc: func(bboxes []string) ([]models.WazeAlert, error) {
+			return []models.WazeAlert{{UUID: "a1", Type: "POLICE"}}, nil
+		},
+	}
+	saveErr := errors.New("firestore unavailable")
+	mockStore := &storage.MockAlertStore{
+		SavePoliceAlertsFunc: func(ctx context.Context, alerts []models.WazeAlert, scrapeTime time.Time) (int, error) {
+			return 0, saveErr
+		},
+	}
+
+	handler := makeScraperHandler(mockFetcher, mockStore, []string{"150.0,-34.0,151.0,-33.0"},
+		withRecentAlerts(newRecentAlerts(10, time.Hour)))
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	saveErr = nil
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if mockStore.CallLog.LastSaveAlertsCount != 1 {
+		t.Errorf("expected the alert to be retried after a failed save, got %d alerts", mockStore.CallLog.LastSaveAlertsCount)
+	}
+}
+
+// TestRecentAlerts tests change detection, expiry and eviction of the recent alert cache
+func TestRecentAlerts(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	uuids := func(alerts []models.WazeAlert) string {
+		var out []string
+		for _, alert := range alerts {
+			out = append(out, alert.UUID)
+		}
+		return strings.Join(out, ",")
+	}
+
+	r := newRecentAlerts(2, time.Minute)
+	r.remember([]models.WazeAlert{
+		{UUID: "a", Type: "POLICE", NThumbsUp: 1},
+		{UUID: "b", Type: "POLICE", NComments: 2},
+		{UUID: "jam", Type: "JAM"},
+	}, now)
+
+	got := uuids(r.unseen([]models.WazeAlert{
+		{UUID: "a", Type: "POLICE", NThumbsUp: 1},
+		{UUID: "b", Type: "POLICE", NComments: 3},
+		{UUID: "jam", Type: "JAM"},
+	}, now.Add(30*time.Second)))
+	if got != "b,jam" {
+		t.Errorf("expected new comments and non-police alerts to be written, got %q", got)
+	}
+
+	if got := uuids(r.unseen([]models.WazeAlert{{UUID: "a", Type: "POLICE", NThumbsUp: 1}}, now.Add(time.Minute))); got != "a" {
+		t.Errorf("expected an alert to be written again once its entry expires, got %q", got)
+	}
+
+	// Writing c evicts a, the least recently written
+	r.remember([]models.WazeAlert{{UUID: "b", Type: "POLICE"}}, now)
+	r.remember([]models.WazeAlert{{UUID: "c", Type: "POLICE"}}, now)
+	got = uuids(r.unseen([]models.WazeAlert{
+		{UUID: "a", Type: "POLICE", NThumbsUp: 1},
+		{UUID: "b", Type: "POLICE"},
+		{UUID: "c", Type: "POLICE"},
+	}, now))
+	if got != "a" {
+		t.Errorf("expected only the evicted alert to be written, got %q", got)
+	}
+}
+
+// TestMakeScraperHandler_LastRun tests that /health/last-run reports the outcome of the latest scrape
+func TestMakeScraperHandler_LastRun(t *testing.T) {
+	var saveErr error
+	mockFetcher := &waze.MockAlertFetcher{
+		GetAlertsMultipleBBoxesFunc: func(bboxes []string) ([]models.WazeAlert, error) {
+			return []models.WazeAlert{{UUID: "a1", Type: "POLICE"}}, nil
+		},
+	}
+	mockStore := &storage.MockAlertStore{
+		SavePoliceAlertsFunc: func(ctx context.Context, alerts []models.WazeAlert, scrapeTime time.Time) (int, error) {
+			return 0, saveErr
+		},
+	}
+	runOutcome := &lastRun{}
+	handler := makeScraperHandler(mockFetcher, mockStore, []string{"1,2,3,4"}, withLastRun(runOutcome))
+
+	readLastRun := func() models.LastRun {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		runOutcome.handler(rr, httptest.NewRequest(http.MethodGet, "/health/last-run", nil))
+		var run models.LastRun
+		if err := json.Unmarshal(rr.Body.Bytes(), &run); err != nil {
+			t.Fatalf("Last run is not valid JSON: %v", err)
+		}
+		return run
+	}
+
+	if run := readLastRun(); run.Status != "none" || run.FinishedAt != nil {
+		t.Errorf("Expected status none before the first run, got %+v", run)
+	}
+
+	before := time.Now()
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	run := readLastRun()
+	if run.Status != "success" || run.FinishedAt == nil || run.FinishedAt.Before(before) || run.Message != "" {
+		t.Errorf("Expected a success after %v, got %+v", before, run)
+	}
+
+	saveErr = errors.New("firestore down")
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	run = readLastRun()
+	if run.Status != "failure" || !strings.Contains(run.Message, "firestore down") {
+		t.Errorf("Expected a failure naming the save error, got %+v", run)
+	}
+}
+
+// TestMakeScraperHandler_FetchUsesRequestContext tests that the fetch is tied to
+// the request context, so a cancelled request stops the scrape before saving
+func TestMakeScraperHandler_FetchUsesRequestContext(t *testing.T) {
+	mockFetcher := &waze.MockAlertFetcher{
+		GetAlertsMultipleBBoxesContextFunc: func(ctx context.Context, bboxes []string) ([]models.WazeAlert, error) {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			return []models.WazeAlert{{UUID: "a1", Type: "POLICE"}}, nil
+		},
+	}
+	mockStore := &storage.MockAlertStore{}
+	handler := makeScraperHandler(mockFetcher, mockStore, []string{"1,2,3,4"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "context canceled") {
+		t.Errorf("Expected a 500 reporting the cancellation, got %d: %s", w.Code, w.Body.String())
+	}
+	if mockStore.CallLog.SavePoliceAlertsCalls != 0 {
+		t.Errorf("Expected SavePoliceAlerts not to be called, got %d calls", mockStore.CallLog.SavePoliceAlertsCalls)
+	}
+}
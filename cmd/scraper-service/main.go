@@ -7,24 +7,87 @@
 // Environment Variables:
 //   - GCP_PROJECT_ID: Google Cloud project ID (required)
 //   - FIRESTORE_COLLECTION: Firestore collection name (default: "police_alerts")
+//   - STARTUP_PING: Set to "true" to verify Firestore connectivity at startup (optional)
+//   - LOG_LEVEL: Minimum log level: "debug" (adds per-alert detail), "info", "warn" or "error" (default: "info")
 //   - PORT: HTTP server port (default: "8080")
-//   - WAZE_BBOXES: Semicolon-separated bounding boxes (optional)
+//   - WAZE_BBOXES: Semicolon-separated "west,south,east,north" bounding boxes, validated at
+//     startup (optional)
+//   - BBOX_WORKERS: Number of bounding boxes fetched from Waze at once (default: 4)
+//   - SUBDIVIDE_THRESHOLD: Alert count at which a bbox's response is treated as truncated and
+//     the bbox is re-fetched as four quadrants (optional, e.g. 200)
+//   - SUBDIVIDE_MAX_DEPTH: Most times a truncated bbox is split (default: 2)
+//   - MIN_BBOX_SUCCESS_RATIO: Fraction (0-1) of bounding boxes that must succeed for a scrape to succeed (default: 0, any one)
+//   - DUPLICATE_CONFLICT_POLICY: How copies of an alert with conflicting streets/cities from
+//     different bboxes are resolved: "keep_first" or "prefer_complete" (default: "keep_first")
+//   - LOG_DUPLICATES: Set to "true" to log every alert returned by more than one bbox instead
+//     of a count per scrape (optional, verbose)
+//   - TRACKED_TYPES: Comma-separated alert types kept while fetching, dropping others before
+//     deduplication (e.g. "POLICE") (default: all types)
+//   - PUB_TIME_UNIT: Unit of pubMillis in Waze responses: "millis", "seconds", or "auto" to
+//     treat values too small to be milliseconds as seconds (default: "auto")
+//   - PRESERVE_RAW_ALERTS: Set to "true" to store the exact bytes Waze sent for each alert in
+//     raw_data_initial/raw_data_last instead of the alert re-encoded as JSON. Comments in
+//     these copies are not capped by MAX_STORED_COMMENTS (optional)
+//   - WAZE_RETRY_ATTEMPTS: Most requests per bbox when Waze returns 429, 500, 502 or 503,
+//     retried with exponential backoff and jitter (default: 1, no retries)
+//   - WAZE_RETRY_BASE_DELAY: Delay before the first retry, doubling for each retry after (default: "500ms")
+//   - WAZE_RETRY_MAX_DELAY: Longest delay between retries (default: "5s")
+//   - WAZE_USER_AGENT: User-Agent sent to Waze (default: a desktop Chrome User-Agent)
+//   - WAZE_HEADERS: JSON object of extra headers sent to Waze, e.g. {"Accept-Language":"en-AU"}.
+//     A User-Agent here overrides WAZE_USER_AGENT (optional)
+//   - MAX_STORED_COMMENTS: Maximum comments stored per alert, newest kept (default: 50)
+//   - STORE_SUBTYPES: Comma-separated POLICE subtypes to store (default: all subtypes)
+//   - COMPOSITE_DOC_IDS: Set to "true" to key documents by UUID + Canberra publish day (default: UUID only)
+//   - STORE_SOURCE_BBOX: Set to "true" to store the bbox that first returned each alert (optional)
+//   - STORE_FINGERPRINTS: Set to "true" to store a hash of each alert's UUID, pubMillis, subtype
+//     and rounded location as fingerprint (optional)
+//   - TRACK_PEAK_RELIABILITY: Set to "true" to store the highest reliability and confidence seen
+//     across scrapes as reliability_max and confidence_max (optional)
+//   - STORE_SCRAPER_REVISION: Set to "true" to store the scraper's build revision (set with
+//     -ldflags "-X main.version=<revision>") as scraped_by_revision on every alert it creates or
+//     updates (optional)
+//   - COMMENTS_STORAGE: Where alert comments are stored: "inline" on the alert document or in a
+//     "subcollection" of it. Must match across services (default: "inline")
+//   - ALERT_WEBHOOK_URL: Webhook notified when a scrape fails or finds no alerts (optional)
+//   - CLOUD_MONITORING_METRICS: Set to "true" to write scrape metrics to Cloud Monitoring (optional)
+//   - RAW_SAMPLE_BUCKET: GCS bucket for sampled raw Waze responses (optional)
+//   - RAW_SAMPLE_RATE: Store 1 in N raw responses to RAW_SAMPLE_BUCKET, uploaded after each
+//     fetch; a positive integer, required when RAW_SAMPLE_BUCKET is set
+//   - RUN_LOG_BUCKET: GCS bucket for a JSON summary of every run under run-logs/ (optional)
+//   - HEARTBEAT_BUCKET: GCS bucket for a heartbeat.json updated after every scrape that saves at
+//     least one police alert, checked by cmd/heartbeat-check (optional)
+//   - RECENT_ALERT_CACHE_SIZE: Remember up to this many recently written alerts and skip rewriting
+//     them while unchanged (default: 0, disabled)
+//   - RECENT_ALERT_CACHE_TTL: How long an unchanged alert is skipped before it is written again,
+//     refreshing its expire_time (default: "5m")
 package main
 
 import (
+	"container/list"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	gcs "cloud.google.com/go/storage"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/logging"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/metrics"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/notify"
 	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/storage"
 	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/waze"
 )
 
+// version is the build revision, set with -ldflags "-X main.version=<revision>"
+var version = "dev"
+
 var (
 	projectID      string
 	collectionName string
@@ -39,6 +102,12 @@ var (
 )
 
 func main() {
+	logLevel, err := logging.ParseLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		log.Fatalf("Invalid LOG_LEVEL: %v", err)
+	}
+	logging.SetLevel(logLevel)
+
 	// Get configuration from environment
 	projectID = os.Getenv("GCP_PROJECT_ID")
 	if projectID == "" {
@@ -61,79 +130,603 @@ func main() {
 	if bboxesEnv != "" {
 		bboxes = strings.Split(bboxesEnv, ";")
 	}
+	for _, bbox := range bboxes {
+		if err := waze.ValidateBBox(bbox); err != nil {
+			log.Fatalf("Invalid WAZE_BBOXES entry %q: %v", bbox, err)
+		}
+	}
 
-	log.Printf("Starting Waze Scraper on port %s", port)
-	log.Printf("Project ID: %s", projectID)
-	log.Printf("Collection: %s", collectionName)
-	log.Printf("Bounding boxes: %v", bboxes)
+	logging.Infof("Starting Waze Scraper on port %s", port)
+	logging.Infof("Project ID: %s", projectID)
+	logging.Infof("Collection: %s", collectionName)
+	logging.Infof("Bounding boxes: %v", bboxes)
 
 	// Initialize dependencies
 	ctx := context.Background()
-	wazeClient := waze.NewClient()
-	firestoreClient, err := storage.NewFirestoreClient(ctx, projectID, collectionName)
+
+	// One Cloud Storage client, created on first use, is shared by the
+	// optional features that write to GCS
+	var storageClient *gcs.Client
+	defer func() {
+		if storageClient != nil {
+			storageClient.Close()
+		}
+	}()
+	gcsClient := func() storage.GCSClient {
+		if storageClient == nil {
+			client, err := gcs.NewClient(ctx)
+			if err != nil {
+				log.Fatalf("Failed to create Cloud Storage client: %v", err)
+			}
+			storageClient = client
+		}
+		return &storage.GCSClientAdapter{Client: storageClient}
+	}
+
+	var clientOpts []waze.Option
+	var rawSampler *storage.RawResponseSampler
+	if sampleBucket := os.Getenv("RAW_SAMPLE_BUCKET"); sampleBucket != "" {
+		v := os.Getenv("RAW_SAMPLE_RATE")
+		sampleRate, err := strconv.Atoi(v)
+		if err != nil || sampleRate < 1 {
+			log.Fatalf("Invalid RAW_SAMPLE_RATE %q: must be a positive integer when RAW_SAMPLE_BUCKET is set", v)
+		}
+		// Sampled responses are held by the fetch workers and uploaded once
+		// the fetch is done, so uploads never slow down a scrape's requests
+		rawSampler = storage.NewRawResponseSampler(gcsClient(), sampleBucket, sampleRate)
+		clientOpts = append(clientOpts, waze.WithResponseHook(func(bbox string, body []byte) {
+			rawSampler.Hold(bbox, body)
+		}))
+		logging.Infof("Sampling 1 in %d raw responses to gs://%s", sampleRate, sampleBucket)
+	}
+	if v := os.Getenv("BBOX_WORKERS"); v != "" {
+		workers, err := strconv.Atoi(v)
+		if err != nil || workers < 1 {
+			log.Fatalf("Invalid BBOX_WORKERS %q: must be a positive integer", v)
+		}
+		logging.Infof("Fetching up to %d bounding boxes at once", workers)
+		clientOpts = append(clientOpts, waze.WithWorkers(workers))
+	}
+	if v := os.Getenv("SUBDIVIDE_THRESHOLD"); v != "" {
+		threshold, err := strconv.Atoi(v)
+		if err != nil || threshold < 1 {
+			log.Fatalf("Invalid SUBDIVIDE_THRESHOLD %q: must be a positive integer", v)
+		}
+		depth := waze.DefaultSubdivideDepth
+		if d := os.Getenv("SUBDIVIDE_MAX_DEPTH"); d != "" {
+			depth, err = strconv.Atoi(d)
+			if err != nil || depth < 1 {
+				log.Fatalf("Invalid SUBDIVIDE_MAX_DEPTH %q: must be a positive integer", d)
+			}
+		}
+		logging.Infof("Subdividing bboxes returning %d or more alerts, up to %d levels", threshold, depth)
+		clientOpts = append(clientOpts, waze.WithSubdivision(threshold, depth))
+	}
+	if v := os.Getenv("MIN_BBOX_SUCCESS_RATIO"); v != "" {
+		ratio, err := strconv.ParseFloat(v, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			log.Fatalf("Invalid MIN_BBOX_SUCCESS_RATIO %q: must be a number between 0 and 1", v)
+		}
+		logging.Infof("Requiring %.0f%% of bounding boxes to succeed", ratio*100)
+		clientOpts = append(clientOpts, waze.WithMinSuccessRatio(ratio))
+	}
+	if policy := os.Getenv("DUPLICATE_CONFLICT_POLICY"); policy != "" {
+		if policy != waze.ConflictKeepFirst && policy != waze.ConflictPreferComplete {
+			log.Fatalf("Invalid DUPLICATE_CONFLICT_POLICY %q (use %q or %q)", policy, waze.ConflictKeepFirst, waze.ConflictPreferComplete)
+		}
+		logging.Infof("Duplicate conflict policy: %s", policy)
+		clientOpts = append(clientOpts, waze.WithConflictPolicy(policy))
+	}
+	if os.Getenv("LOG_DUPLICATES") == "true" {
+		clientOpts = append(clientOpts, waze.WithDuplicateLogging(true))
+	}
+	if v := os.Getenv("TRACKED_TYPES"); v != "" {
+		var types []string
+		for _, alertType := range strings.Split(v, ",") {
+			if alertType = strings.TrimSpace(alertType); alertType != "" {
+				types = append(types, alertType)
+			}
+		}
+		logging.Infof("Keeping only alert types: %v", types)
+		clientOpts = append(clientOpts, waze.WithTrackedTypes(types))
+	}
+	if v := os.Getenv("PUB_TIME_UNIT"); v != "" {
+		if v != waze.PubTimeAuto && v != waze.PubTimeMillis && v != waze.PubTimeSeconds {
+			log.Fatalf("Invalid PUB_TIME_UNIT %q (use %q, %q or %q)", v, waze.PubTimeAuto, waze.PubTimeMillis, waze.PubTimeSeconds)
+		}
+		logging.Infof("Reading pubMillis as: %s", v)
+		clientOpts = append(clientOpts, waze.WithPubTimeUnit(v))
+	}
+	if os.Getenv("PRESERVE_RAW_ALERTS") == "true" {
+		logging.Infof("Preserving the raw bytes of each alert")
+		clientOpts = append(clientOpts, waze.WithRawAlerts(true))
+	}
+	if v := os.Getenv("WAZE_RETRY_ATTEMPTS"); v != "" {
+		attempts, err := strconv.Atoi(v)
+		if err != nil || attempts < 1 {
+			log.Fatalf("Invalid WAZE_RETRY_ATTEMPTS %q: must be a positive integer", v)
+		}
+		policy := waze.RetryPolicy{MaxAttempts: attempts, BaseDelay: 500 * time.Millisecond, MaxDelay: 5 * time.Second}
+		if v := os.Getenv("WAZE_RETRY_BASE_DELAY"); v != "" {
+			if policy.BaseDelay, err = time.ParseDuration(v); err != nil || policy.BaseDelay < 0 {
+				log.Fatalf("Invalid WAZE_RETRY_BASE_DELAY %q: must be a duration such as \"500ms\"", v)
+			}
+		}
+		if v := os.Getenv("WAZE_RETRY_MAX_DELAY"); v != "" {
+			if policy.MaxDelay, err = time.ParseDuration(v); err != nil || policy.MaxDelay < 0 {
+				log.Fatalf("Invalid WAZE_RETRY_MAX_DELAY %q: must be a duration such as \"5s\"", v)
+			}
+		}
+		logging.Infof("Retrying transient Waze errors up to %d attempts (base delay %v, max delay %v)", policy.MaxAttempts, policy.BaseDelay, policy.MaxDelay)
+		clientOpts = append(clientOpts, waze.WithRetryPolicy(policy))
+	}
+	if v := os.Getenv("WAZE_USER_AGENT"); v != "" {
+		logging.Infof("Sending User-Agent %q to Waze", v)
+		clientOpts = append(clientOpts, waze.WithUserAgent(v))
+	}
+	if v := os.Getenv("WAZE_HEADERS"); v != "" {
+		var headers map[string]string
+		if err := json.Unmarshal([]byte(v), &headers); err != nil {
+			log.Fatalf("Invalid WAZE_HEADERS %q: must be a JSON object of header names to values: %v", v, err)
+		}
+		logging.Infof("Sending %d extra headers to Waze", len(headers))
+		clientOpts = append(clientOpts, waze.WithHeaders(headers))
+	}
+	wazeClient := waze.NewClient(clientOpts...)
+	var storeOpts []storage.Option
+	if v := os.Getenv("MAX_STORED_COMMENTS"); v != "" {
+		maxComments, err := strconv.Atoi(v)
+		if err != nil || maxComments < 1 {
+			log.Fatalf("Invalid MAX_STORED_COMMENTS %q: must be a positive integer", v)
+		}
+		storeOpts = append(storeOpts, storage.WithMaxComments(maxComments))
+	}
+	if v := os.Getenv("STORE_SUBTYPES"); v != "" {
+		var subtypes []string
+		for _, subtype := range strings.Split(v, ",") {
+			if subtype = strings.TrimSpace(subtype); subtype != "" {
+				subtypes = append(subtypes, subtype)
+			}
+		}
+		logging.Infof("Storing only POLICE subtypes: %v", subtypes)
+		storeOpts = append(storeOpts, storage.WithStoreSubtypes(subtypes))
+	}
+	if os.Getenv("COMPOSITE_DOC_IDS") == "true" {
+		logging.Infof("Keying alert documents by UUID and publish day")
+		storeOpts = append(storeOpts, storage.WithCompositeIDs(true))
+	}
+	if os.Getenv("STORE_SOURCE_BBOX") == "true" {
+		logging.Infof("Storing source bounding box on new alerts")
+		storeOpts = append(storeOpts, storage.WithSourceBBox(true))
+	}
+	if os.Getenv("STORE_FINGERPRINTS") == "true" {
+		logging.Infof("Storing alert fingerprints")
+		storeOpts = append(storeOpts, storage.WithFingerprints(true))
+	}
+	if os.Getenv("TRACK_PEAK_RELIABILITY") == "true" {
+		logging.Infof("Tracking peak reliability and confidence")
+		storeOpts = append(storeOpts, storage.WithPeakReliability(true))
+	}
+	if os.Getenv("STORE_SCRAPER_REVISION") == "true" {
+		logging.Infof("Storing scraper revision %s on saved alerts", version)
+		storeOpts = append(storeOpts, storage.WithRevision(version))
+	}
+	if v := os.Getenv("COMMENTS_STORAGE"); v != "" {
+		if v != storage.CommentsInline && v != storage.CommentsSubcollection {
+			log.Fatalf("Invalid COMMENTS_STORAGE %q: must be %q or %q", v, storage.CommentsInline, storage.CommentsSubcollection)
+		}
+		logging.Infof("Storing alert comments %s", v)
+		storeOpts = append(storeOpts, storage.WithCommentsStorage(v))
+	}
+	firestoreClient, err := storage.NewFirestoreClient(ctx, projectID, collectionName, storeOpts...)
 	if err != nil {
 		log.Fatalf("Failed to create Firestore client: %v", err)
 	}
 	defer firestoreClient.Close()
 
+	if os.Getenv("STARTUP_PING") == "true" {
+		pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		err := firestoreClient.Ping(pingCtx)
+		cancel()
+		if err != nil {
+			log.Fatalf("Firestore startup ping failed (check GCP_PROJECT_ID and credentials): %v", err)
+		}
+		logging.Infof("Firestore startup ping succeeded")
+	}
+
 	// Setup HTTP handlers with dependency injection
-	http.HandleFunc("/", makeScraperHandler(wazeClient, firestoreClient, bboxes))
+	var handlerOpts []handlerOption
+	if webhookURL := os.Getenv("ALERT_WEBHOOK_URL"); webhookURL != "" {
+		logging.Infof("Failure notifications enabled")
+		handlerOpts = append(handlerOpts, withNotifier(notify.NewWebhookNotifier(webhookURL)))
+	}
+	if os.Getenv("CLOUD_MONITORING_METRICS") == "true" {
+		metricsWriter, err := metrics.NewCloudMonitoringWriter(ctx, projectID)
+		if err != nil {
+			log.Fatalf("Failed to create Cloud Monitoring writer: %v", err)
+		}
+		defer metricsWriter.Close()
+		logging.Infof("Cloud Monitoring metrics enabled")
+		handlerOpts = append(handlerOpts, withMetrics(metricsWriter))
+	}
+	if runLogBucket := os.Getenv("RUN_LOG_BUCKET"); runLogBucket != "" {
+		logging.Infof("Writing run summaries to gs://%s/run-logs/", runLogBucket)
+		handlerOpts = append(handlerOpts, withRunLog(storage.NewRunLogWriter(gcsClient(), runLogBucket)))
+	}
+	if heartbeatBucket := os.Getenv("HEARTBEAT_BUCKET"); heartbeatBucket != "" {
+		logging.Infof("Writing heartbeat to gs://%s/%s", heartbeatBucket, storage.HeartbeatObjectName)
+		handlerOpts = append(handlerOpts, withHeartbeat(storage.NewHeartbeatStore(gcsClient(), heartbeatBucket)))
+	}
+	if rawSampler != nil {
+		handlerOpts = append(handlerOpts, withRawSampler(rawSampler))
+	}
+	if v := os.Getenv("RECENT_ALERT_CACHE_SIZE"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 0 {
+			log.Fatalf("Invalid RECENT_ALERT_CACHE_SIZE %q: must be a non-negative integer", v)
+		}
+		ttl := defaultRecentAlertTTL
+		if v := os.Getenv("RECENT_ALERT_CACHE_TTL"); v != "" {
+			ttl, err = time.ParseDuration(v)
+			if err != nil || ttl <= 0 {
+				log.Fatalf("Invalid RECENT_ALERT_CACHE_TTL %q: must be a positive duration", v)
+			}
+		}
+		if size > 0 {
+			logging.Infof("Skipping unchanged alerts written in the last %s (cache size %d)", ttl, size)
+			handlerOpts = append(handlerOpts, withRecentAlerts(newRecentAlerts(size, ttl)))
+		}
+	}
+	runOutcome := &lastRun{}
+	handlerOpts = append(handlerOpts, withLastRun(runOutcome))
+	http.HandleFunc("/", makeScraperHandler(wazeClient, firestoreClient, bboxes, handlerOpts...))
 	http.HandleFunc("/health", healthHandler)
+	http.HandleFunc("/health/last-run", runOutcome.handler)
 
 	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
 
-func makeScraperHandler(fetcher waze.AlertFetcher, store storage.AlertStore, bboxes []string) http.HandlerFunc {
+// handlerOptions holds optional scraper handler behaviour
+type handlerOptions struct {
+	notifier   notify.Notifier
+	metrics    metrics.Writer
+	runLog     *storage.RunLogWriter
+	recent     *recentAlerts
+	heartbeat  *storage.HeartbeatStore
+	lastRun    *lastRun
+	rawSampler *storage.RawResponseSampler
+}
+
+// handlerOption configures the scraper handler
+type handlerOption func(*handlerOptions)
+
+// withNotifier sends an event when a scrape fails or Waze returns no alerts
+func withNotifier(n notify.Notifier) handlerOption {
+	return func(o *handlerOptions) {
+		o.notifier = n
+	}
+}
+
+// withMetrics records scrape success and alert counts after every scrape
+func withMetrics(w metrics.Writer) handlerOption {
+	return func(o *handlerOptions) {
+		o.metrics = w
+	}
+}
+
+// withRunLog writes a summary of every run, successful or not, to GCS
+func withRunLog(w *storage.RunLogWriter) handlerOption {
+	return func(o *handlerOptions) {
+		o.runLog = w
+	}
+}
+
+// withHeartbeat records the time of every scrape that saves at least one
+// police alert, so a scraper that stops saving can be detected
+func withHeartbeat(s *storage.HeartbeatStore) handlerOption {
+	return func(o *handlerOptions) {
+		o.heartbeat = s
+	}
+}
+
+// withLastRun records the outcome of every run for /health/last-run
+func withLastRun(l *lastRun) handlerOption {
+	return func(o *handlerOptions) {
+		o.lastRun = l
+	}
+}
+
+// withRawSampler uploads the raw responses sampled during a scrape once its
+// fetch is done
+func withRawSampler(s *storage.RawResponseSampler) handlerOption {
+	return func(o *handlerOptions) {
+		o.rawSampler = s
+	}
+}
+
+// withRecentAlerts skips writing alerts that were written recently and have
+// not changed since
+func withRecentAlerts(r *recentAlerts) handlerOption {
+	return func(o *handlerOptions) {
+		o.recent = r
+	}
+}
+
+func makeScraperHandler(fetcher waze.AlertFetcher, store storage.AlertStore, bboxes []string, opts ...handlerOption) http.HandlerFunc {
+	options := &handlerOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
 	return func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("Received scrape request from %s", r.RemoteAddr)
+		logging.Infof("Received scrape request from %s", r.RemoteAddr)
 
 		ctx := context.Background()
 
-		// Step 1: Fetch alerts using injected fetcher
-		alerts, err := fetcher.GetAlertsMultipleBBoxes(bboxes)
+		summary := models.RunSummary{StartedAt: time.Now(), Status: "failure", BBoxes: bboxes}
+		statsBefore := snapshotStats(fetcher.GetStats())
+		defer func() {
+			options.lastRun.record(summary.Status, summary.Error, time.Now())
+			options.writeRunLog(ctx, summary, statsBefore, snapshotStats(fetcher.GetStats()))
+		}()
+
+		// Step 1: Fetch alerts using injected fetcher, abandoning them if the
+		// request is cancelled
+		alerts, err := fetcher.GetAlertsMultipleBBoxesContext(r.Context(), bboxes)
+		options.flushRawSamples(ctx)
 		if err != nil {
-			log.Printf("Error fetching alerts: %v", err)
+			summary.Error = fmt.Sprintf("Failed to fetch alerts: %v", err)
+			logging.Errorf("Error fetching alerts: %v", err)
+			message := fmt.Sprintf("Failed to fetch alerts: %v", err)
+			if errors.Is(err, waze.ErrForbidden) {
+				logging.Errorf("Waze refused every bounding box with 403 Forbidden. No alerts are being collected until Waze accepts requests again; retrying will not help")
+				message = fmt.Sprintf("Waze is blocking the scraper (403 Forbidden), no alerts are being collected: %v", err)
+			}
+			options.notify(ctx, notify.KindFailure, message)
+			options.recordMetrics(ctx, metrics.Point{Name: metrics.ScrapeSuccess, Value: 0})
 			http.Error(w, fmt.Sprintf("Failed to fetch alerts: %v", err), http.StatusInternalServerError)
 			return
 		}
 
-		log.Printf("Fetched %d unique alerts from Waze", len(alerts))
+		logging.Infof("Fetched %d unique alerts from Waze", len(alerts))
+		summary.AlertsFound = len(alerts)
+		if len(alerts) == 0 {
+			options.notify(ctx, notify.KindZeroAlerts, fmt.Sprintf("Waze returned no alerts across %d bounding boxes", len(bboxes)))
+		}
 
 		// Step 2: Save police alerts using injected store
 		scrapeTime := time.Now()
-		err = store.SavePoliceAlerts(ctx, alerts, scrapeTime)
+		toSave := alerts
+		if options.recent != nil {
+			toSave = options.recent.unseen(alerts, scrapeTime)
+			if skipped := len(alerts) - len(toSave); skipped > 0 {
+				logging.Infof("Skipping %d unchanged alerts written recently", skipped)
+			}
+		}
+		policeCount, err := store.SavePoliceAlerts(ctx, toSave, scrapeTime)
 		if err != nil {
-			log.Printf("Error saving police alerts to Firestore: %v", err)
+			summary.Error = fmt.Sprintf("Failed to save alerts: %v", err)
+			logging.Errorf("Error saving police alerts to Firestore: %v", err)
+			options.notify(ctx, notify.KindFailure, fmt.Sprintf("Failed to save alerts: %v", err))
+			options.recordMetrics(ctx,
+				metrics.Point{Name: metrics.ScrapeSuccess, Value: 0},
+				metrics.Point{Name: metrics.AlertsFound, Value: int64(len(alerts))},
+			)
 			http.Error(w, fmt.Sprintf("Failed to save alerts: %v", err), http.StatusInternalServerError)
 			return
 		}
 
-		// Count how many police alerts were actually saved
-		policeCount := 0
-		for _, alert := range alerts {
-			if alert.Type == "POLICE" {
-				policeCount++
-			}
+		if options.recent != nil {
+			options.recent.remember(toSave, scrapeTime)
+		}
+
+		summary.Status = "success"
+		summary.PoliceAlertsSaved = policeCount
+		if policeCount > 0 {
+			options.writeHeartbeat(ctx, models.Heartbeat{LastSuccessfulSave: scrapeTime, PoliceAlertsSaved: policeCount})
 		}
+		options.recordMetrics(ctx,
+			metrics.Point{Name: metrics.ScrapeSuccess, Value: 1},
+			metrics.Point{Name: metrics.AlertsFound, Value: int64(len(alerts))},
+			metrics.Point{Name: metrics.PoliceAlertsSaved, Value: int64(policeCount)},
+		)
 
 		// Step 3: Return success response
 		stats := fetcher.GetStats()
-		response := map[string]interface{}{
-			"status":              "success",
-			"alerts_found":        len(alerts),
-			"police_alerts_saved": policeCount,
-			"stats":               stats,
-			"bboxes_used":         len(bboxes),
+		response := models.ScrapeResponse{
+			Status:            "success",
+			AlertsFound:       len(alerts),
+			PoliceAlertsSaved: policeCount,
+			Stats:             stats,
+			BBoxesUsed:        len(bboxes),
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(response); err != nil {
-			log.Printf("Error encoding response: %v", err)
+			logging.Errorf("Error encoding response: %v", err)
 			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 			return
 		}
 
-		log.Printf("✅ Successfully scraped and saved %d police alerts (out of %d total alerts)", policeCount, len(alerts))
+		logging.Infof("✅ Successfully scraped and saved %d police alerts (out of %d total alerts)", policeCount, len(alerts))
+	}
+}
+
+// notify sends an event if a notifier is configured. Delivery failures are
+// logged rather than failing the scrape.
+func (o *handlerOptions) notify(ctx context.Context, kind, message string) {
+	if o.notifier == nil {
+		return
+	}
+
+	notifyCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	err := o.notifier.Notify(notifyCtx, notify.Event{
+		Service: "scraper-service",
+		Kind:    kind,
+		Message: message,
+		Time:    time.Now(),
+	})
+	if err != nil {
+		logging.Warnf("Failed to send %s notification: %v", kind, err)
+	}
+}
+
+// recordMetrics writes points if a metrics writer is configured. Write failures
+// are logged rather than failing the scrape.
+func (o *handlerOptions) recordMetrics(ctx context.Context, points ...metrics.Point) {
+	if o.metrics == nil {
+		return
+	}
+
+	metricsCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	for i := range points {
+		points[i].Labels = map[string]string{"service": "scraper-service"}
+		points[i].Time = now
+	}
+	if err := o.metrics.Write(metricsCtx, points...); err != nil {
+		logging.Warnf("Failed to write metrics: %v", err)
+	}
+}
+
+// writeRunLog uploads the run summary if a run log is configured, filling in
+// the duration and this run's share of the fetcher's cumulative call counts.
+// Upload failures are logged rather than failing the scrape.
+func (o *handlerOptions) writeRunLog(ctx context.Context, summary models.RunSummary, before, after models.ScrapingStats) {
+	if o.runLog == nil {
+		return
+	}
+
+	summary.DurationMs = time.Since(summary.StartedAt).Milliseconds()
+	summary.Requests = after.TotalRequests - before.TotalRequests
+	summary.SuccessfulCalls = after.SuccessfulCalls - before.SuccessfulCalls
+	summary.FailedCalls = after.FailedCalls - before.FailedCalls
+	summary.RetriedCalls = after.RetriedCalls - before.RetriedCalls
+	summary.SubdividedBoxes = after.SubdividedBoxes - before.SubdividedBoxes
+
+	uploadCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if err := o.runLog.Write(uploadCtx, summary); err != nil {
+		logging.Warnf("Failed to write run summary: %v", err)
+	}
+}
+
+// writeHeartbeat updates the heartbeat if one is configured. Upload failures
+// are logged rather than failing the scrape.
+func (o *handlerOptions) writeHeartbeat(ctx context.Context, heartbeat models.Heartbeat) {
+	if o.heartbeat == nil {
+		return
+	}
+
+	uploadCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if err := o.heartbeat.Write(uploadCtx, heartbeat); err != nil {
+		logging.Warnf("Failed to write heartbeat: %v", err)
+	}
+}
+
+// flushRawSamples uploads the raw responses sampled during the fetch if a
+// sampler is configured. Upload failures are logged rather than failing the scrape.
+func (o *handlerOptions) flushRawSamples(ctx context.Context) {
+	if o.rawSampler == nil {
+		return
+	}
+
+	uploadCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if _, err := o.rawSampler.Flush(uploadCtx); err != nil {
+		logging.Warnf("Failed to store raw response samples: %v", err)
+	}
+}
+
+// snapshotStats copies the fetcher's stats, treating nil as zero
+func snapshotStats(stats *models.ScrapingStats) models.ScrapingStats {
+	if stats == nil {
+		return models.ScrapingStats{}
+	}
+	return *stats
+}
+
+// defaultRecentAlertTTL is how long an unchanged alert is skipped by default
+const defaultRecentAlertTTL = 5 * time.Minute
+
+// recentAlerts is a bounded LRU of recently written alerts, keyed by UUID and
+// holding the engagement counts they were written with. The service is long
+// lived, so it lets consecutive scrapes skip Firestore writes for alerts that
+// have not changed. Entries expire after ttl so expire_time still advances.
+type recentAlerts struct {
+	mu      sync.Mutex
+	order   *list.List // front is most recently written
+	entries map[string]*list.Element
+	size    int
+	ttl     time.Duration
+}
+
+// recentAlert is what an alert looked like when it was last written
+type recentAlert struct {
+	uuid      string
+	thumbsUp  int
+	comments  int
+	writtenAt time.Time
+}
+
+func newRecentAlerts(size int, ttl time.Duration) *recentAlerts {
+	return &recentAlerts{
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		size:    size,
+		ttl:     ttl,
+	}
+}
+
+// unseen returns the alerts that were not written within ttl with the same
+// thumbs-up and comment counts
+func (r *recentAlerts) unseen(alerts []models.WazeAlert, now time.Time) []models.WazeAlert {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var out []models.WazeAlert
+	for _, alert := range alerts {
+		if el, ok := r.entries[alert.UUID]; ok {
+			seen := el.Value.(recentAlert)
+			if seen.thumbsUp == alert.NThumbsUp && seen.comments == alert.NComments && now.Sub(seen.writtenAt) < r.ttl {
+				continue
+			}
+		}
+		out = append(out, alert)
+	}
+	return out
+}
+
+// remember records police alerts as written, evicting the least recently
+// written alerts when full. Call it only once the write succeeded.
+func (r *recentAlerts) remember(alerts []models.WazeAlert, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, alert := range alerts {
+		if alert.Type != "POLICE" {
+			continue // Only police alerts are stored
+		}
+		entry := recentAlert{uuid: alert.UUID, thumbsUp: alert.NThumbsUp, comments: alert.NComments, writtenAt: now}
+		if el, ok := r.entries[alert.UUID]; ok {
+			el.Value = entry
+			r.order.MoveToFront(el)
+			continue
+		}
+		r.entries[alert.UUID] = r.order.PushFront(entry)
+		if r.order.Len() > r.size {
+			oldest := r.order.Back()
+			r.order.Remove(oldest)
+			delete(r.entries, oldest.Value.(recentAlert).uuid)
+		}
 	}
 }
 
@@ -141,3 +734,35 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, "OK")
 }
+
+// lastRun holds the outcome of the most recent scrape on this instance. A nil
+// lastRun records nothing.
+type lastRun struct {
+	mu  sync.Mutex
+	run models.LastRun
+}
+
+// record stores the outcome of a run that finished at finishedAt
+func (l *lastRun) record(status, message string, finishedAt time.Time) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.run = models.LastRun{Status: status, FinishedAt: &finishedAt, Message: message}
+}
+
+// handler reports the last outcome as JSON, with status "none" before the first run
+func (l *lastRun) handler(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	run := l.run
+	l.mu.Unlock()
+	if run.Status == "" {
+		run.Status = "none"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(run); err != nil {
+		logging.Errorf("Error encoding last run: %v", err)
+	}
+}
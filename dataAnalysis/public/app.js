@@ -329,6 +329,37 @@ async function loadAlertsForSelectedDates() {
     }
 }
 
+// Map an archived alert line to the fields the UI uses. Archives written
+// before PoliceAlert had JSON tags use Go field names ("PublishTime",
+// "LocationGeo" with latitude/longitude) instead of snake_case keys.
+function processRawAlert(rawAlert) {
+    const pick = (key, legacyKey) => rawAlert[key] !== undefined ? rawAlert[key] : rawAlert[legacyKey];
+    const uuid = pick('uuid', 'UUID');
+    const location = rawAlert.location
+        ? { latitude: rawAlert.location.lat, longitude: rawAlert.location.lng }
+        : rawAlert.LocationGeo;
+    const lastVerificationMillis = pick('last_verification_millis', 'LastVerificationMillis');
+    return {
+        id: uuid,
+        UUID: uuid,
+        Type: pick('type', 'Type'),
+        Subtype: pick('subtype', 'Subtype') || '',
+        Street: pick('street', 'Street') || '',
+        City: pick('city', 'City') || '',
+        Country: pick('country', 'Country'),
+        LocationGeo: location || { latitude: 0, longitude: 0 },
+        Reliability: pick('reliability', 'Reliability'),
+        Confidence: pick('confidence', 'Confidence'),
+        PublishTime: new Date(pick('publish_time', 'PublishTime')).getTime(),
+        ExpireTime: new Date(pick('expire_time', 'ExpireTime')).getTime(),
+        ScrapeTime: new Date(pick('scrape_time', 'ScrapeTime')).getTime(),
+        ActiveMillis: pick('active_millis', 'ActiveMillis'),
+        LastVerificationMillis: lastVerificationMillis ? new Date(lastVerificationMillis).getTime() : null,
+        NThumbsUpLast: pick('n_thumbs_up_last', 'NThumbsUpLast'),
+        ReportRating: pick('report_rating', 'ReportRating')
+    };
+}
+
 // Load alerts from API
 async function loadAlertsFromAPI() {
     const loadingMessage = document.getElementById('loading-message');
@@ -385,25 +416,7 @@ async function loadAlertsFromAPI() {
 
                 try {
                     const rawAlert = JSON.parse(line);
-                    const processedAlert = {
-                        id: rawAlert.UUID,
-                        UUID: rawAlert.UUID,
-                        Type: rawAlert.Type,
-                        Subtype: rawAlert.Subtype || '',
-                        Street: rawAlert.Street || '',
-                        City: rawAlert.City || '',
-                        Country: rawAlert.Country,
-                        LocationGeo: rawAlert.LocationGeo || { latitude: 0, longitude: 0 },
-                        Reliability: rawAlert.Reliability,
-                        Confidence: rawAlert.Confidence,
-                        PublishTime: new Date(rawAlert.PublishTime).getTime(),
-                        ExpireTime: new Date(rawAlert.ExpireTime).getTime(),
-                        ScrapeTime: new Date(rawAlert.ScrapeTime).getTime(),
-                        ActiveMillis: rawAlert.ActiveMillis,
-                        LastVerificationMillis: rawAlert.LastVerificationMillis ? new Date(rawAlert.LastVerificationMillis).getTime() : null,
-                        NThumbsUpLast: rawAlert.NThumbsUpLast,
-                        ReportRating: rawAlert.ReportRating
-                    };
+                    const processedAlert = processRawAlert(rawAlert);
 
                     // Deduplication
                     const existingAlert = alertsMap.get(processedAlert.UUID);
@@ -424,25 +437,7 @@ async function loadAlertsFromAPI() {
         if (buffer.trim() !== '') {
             try {
                 const rawAlert = JSON.parse(buffer);
-                const processedAlert = {
-                    id: rawAlert.UUID,
-                    UUID: rawAlert.UUID,
-                    Type: rawAlert.Type,
-                    Subtype: rawAlert.Subtype || '',
-                    Street: rawAlert.Street || '',
-                    City: rawAlert.City || '',
-                    Country: rawAlert.Country,
-                    LocationGeo: rawAlert.LocationGeo || { latitude: 0, longitude: 0 },
-                    Reliability: rawAlert.Reliability,
-                    Confidence: rawAlert.Confidence,
-                    PublishTime: new Date(rawAlert.PublishTime).getTime(),
-                    ExpireTime: new Date(rawAlert.ExpireTime).getTime(),
-                    ScrapeTime: new Date(rawAlert.ScrapeTime).getTime(),
-                    ActiveMillis: rawAlert.ActiveMillis,
-                    LastVerificationMillis: rawAlert.LastVerificationMillis ? new Date(rawAlert.LastVerificationMillis).getTime() : null,
-                    NThumbsUpLast: rawAlert.NThumbsUpLast,
-                    ReportRating: rawAlert.ReportRating
-                };
+                const processedAlert = processRawAlert(rawAlert);
                 const existingAlert = alertsMap.get(processedAlert.UUID);
                 if (!existingAlert || processedAlert.ExpireTime > existingAlert.ExpireTime) {
                     alertsMap.set(processedAlert.UUID, processedAlert);
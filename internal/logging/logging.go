@@ -0,0 +1,101 @@
+// Package logging adds verbosity levels to the standard logger.
+//
+// Messages below the configured level are dropped, so per-alert detail can be
+// logged at debug level without flooding production logs. Messages at or above
+// the level are written through the standard log package, keeping its flags
+// and output destination.
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is a logging verbosity level
+type Level int32
+
+// Levels in increasing order of severity
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// level is the minimum level that is logged (default LevelInfo)
+var level atomic.Int32
+
+func init() {
+	level.Store(int32(LevelInfo))
+}
+
+// String returns the level name as accepted by ParseLevel
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int32(l))
+}
+
+// ParseLevel parses a level name (debug, info, warn or error, case-insensitive).
+// An empty name is LevelInfo.
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q (use debug, info, warn or error)", name)
+}
+
+// SetLevel sets the minimum level that is logged
+func SetLevel(l Level) {
+	level.Store(int32(l))
+}
+
+// Enabled reports whether messages at the given level are logged
+func Enabled(l Level) bool {
+	return int32(l) >= level.Load()
+}
+
+// Debugf logs per-item detail such as individual alert writes
+func Debugf(format string, v ...interface{}) {
+	output(LevelDebug, "[DEBUG] ", format, v...)
+}
+
+// Infof logs run-level progress and summaries
+func Infof(format string, v ...interface{}) {
+	output(LevelInfo, "", format, v...)
+}
+
+// Warnf logs recoverable problems
+func Warnf(format string, v ...interface{}) {
+	output(LevelWarn, "[WARN] ", format, v...)
+}
+
+// Errorf logs failures
+func Errorf(format string, v ...interface{}) {
+	output(LevelError, "[ERROR] ", format, v...)
+}
+
+func output(l Level, prefix, format string, v ...interface{}) {
+	if !Enabled(l) {
+		return
+	}
+	// Depth 3 attributes the message to the caller of Debugf/Infof/...
+	_ = log.Output(3, prefix+fmt.Sprintf(format, v...))
+}
@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureLogs redirects the standard logger for the duration of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		SetLevel(LevelInfo)
+	})
+	return &buf
+}
+
+func TestLevelsBelowConfiguredAreSuppressed(t *testing.T) {
+	tests := []struct {
+		level Level
+		want  []string
+		skip  []string
+	}{
+		{LevelDebug, []string{"debug msg", "info msg", "warn msg", "error msg"}, nil},
+		{LevelInfo, []string{"info msg", "warn msg", "error msg"}, []string{"debug msg"}},
+		{LevelWarn, []string{"warn msg", "error msg"}, []string{"debug msg", "info msg"}},
+		{LevelError, []string{"error msg"}, []string{"debug msg", "info msg", "warn msg"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			buf := captureLogs(t)
+			SetLevel(tt.level)
+
+			Debugf("debug msg")
+			Infof("info msg")
+			Warnf("warn msg")
+			Errorf("error msg")
+
+			output := buf.String()
+			for _, msg := range tt.want {
+				if !strings.Contains(output, msg) {
+					t.Errorf("expected %q to be logged, got:\n%s", msg, output)
+				}
+			}
+			for _, msg := range tt.skip {
+				if strings.Contains(output, msg) {
+					t.Errorf("expected %q to be suppressed, got:\n%s", msg, output)
+				}
+			}
+		})
+	}
+}
+
+func TestLevelPrefixes(t *testing.T) {
+	buf := captureLogs(t)
+	SetLevel(LevelDebug)
+
+	Debugf("alert %s", "a1")
+	Infof("summary")
+	Warnf("careful")
+	Errorf("failed")
+
+	output := buf.String()
+	for _, want := range []string{"[DEBUG] alert a1", "[WARN] careful", "[ERROR] failed"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q, got:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "] summary") {
+		t.Errorf("expected info messages without a prefix, got:\n%s", output)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Level
+		wantErr bool
+	}{
+		{"debug", LevelDebug, false},
+		{"INFO", LevelInfo, false},
+		{"", LevelInfo, false},
+		{"warning", LevelWarn, false},
+		{" error ", LevelError, false},
+		{"verbose", LevelInfo, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLevel(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ParseLevel(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultLevelIsInfo(t *testing.T) {
+	if Enabled(LevelDebug) || !Enabled(LevelInfo) {
+		t.Error("expected the default level to be info")
+	}
+}
@@ -0,0 +1,113 @@
+// Package metrics records custom service metrics such as scrape success,
+// alert counts and archive sizes.
+//
+// Metrics are written through the Writer interface so services can push them to
+// Cloud Monitoring in production and to a mock in tests. Recording metrics is
+// optional and disabled unless a writer is configured.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3/v2"
+	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Metric names
+const (
+	ScrapeSuccess     = "scrape_success"
+	AlertsFound       = "alerts_found"
+	PoliceAlertsSaved = "police_alerts_saved"
+	ArchiveBytes      = "archive_bytes"
+	ArchiveAlerts     = "archive_alerts"
+)
+
+// metricTypePrefix namespaces the custom metrics in Cloud Monitoring
+const metricTypePrefix = "custom.googleapis.com/waze/"
+
+// Point is a single sample of a metric
+type Point struct {
+	Name   string
+	Labels map[string]string
+	Value  int64
+	Time   time.Time
+}
+
+// Writer records metric points.
+// This interface enables dependency injection and mocking for testing.
+type Writer interface {
+	// Write records the points, returning an error if they could not be written.
+	Write(ctx context.Context, points ...Point) error
+}
+
+// CloudMonitoringWriter writes points as custom gauge metrics to Cloud Monitoring
+type CloudMonitoringWriter struct {
+	client    *monitoring.MetricClient
+	projectID string
+}
+
+// NewCloudMonitoringWriter creates a writer for the given project
+func NewCloudMonitoringWriter(ctx context.Context, projectID string) (*CloudMonitoringWriter, error) {
+	client, err := monitoring.NewMetricClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create monitoring client: %w", err)
+	}
+	return &CloudMonitoringWriter{client: client, projectID: projectID}, nil
+}
+
+// Write implements Writer.Write.
+func (c *CloudMonitoringWriter) Write(ctx context.Context, points ...Point) error {
+	if len(points) == 0 {
+		return nil
+	}
+	req := &monitoringpb.CreateTimeSeriesRequest{
+		Name:       "projects/" + c.projectID,
+		TimeSeries: make([]*monitoringpb.TimeSeries, 0, len(points)),
+	}
+	for _, p := range points {
+		req.TimeSeries = append(req.TimeSeries, timeSeries(c.projectID, p))
+	}
+	if err := c.client.CreateTimeSeries(ctx, req); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	return nil
+}
+
+// Close releases the underlying monitoring client
+func (c *CloudMonitoringWriter) Close() error {
+	return c.client.Close()
+}
+
+// timeSeries converts a point into a single-sample gauge time series
+func timeSeries(projectID string, p Point) *monitoringpb.TimeSeries {
+	ts := p.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	return &monitoringpb.TimeSeries{
+		Metric: &metricpb.Metric{
+			Type:   metricTypePrefix + p.Name,
+			Labels: p.Labels,
+		},
+		Resource: &monitoredrespb.MonitoredResource{
+			Type:   "global",
+			Labels: map[string]string{"project_id": projectID},
+		},
+		MetricKind: metricpb.MetricDescriptor_GAUGE,
+		ValueType:  metricpb.MetricDescriptor_INT64,
+		Points: []*monitoringpb.Point{{
+			Interval: &monitoringpb.TimeInterval{EndTime: timestamppb.New(ts)},
+			Value: &monitoringpb.TypedValue{
+				Value: &monitoringpb.TypedValue_Int64Value{Int64Value: p.Value},
+			},
+		}},
+	}
+}
+
+// Ensure CloudMonitoringWriter implements Writer.
+var _ Writer = (*CloudMonitoringWriter)(nil)
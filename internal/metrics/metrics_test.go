@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+)
+
+func TestTimeSeries_BuildsGauge(t *testing.T) {
+	at := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	ts := timeSeries("my-project", Point{
+		Name:   ArchiveBytes,
+		Labels: map[string]string{"service": "archive-service"},
+		Value:  2048,
+		Time:   at,
+	})
+
+	if ts.Metric.Type != "custom.googleapis.com/waze/archive_bytes" {
+		t.Errorf("unexpected metric type %q", ts.Metric.Type)
+	}
+	if ts.Metric.Labels["service"] != "archive-service" {
+		t.Errorf("expected service label, got %v", ts.Metric.Labels)
+	}
+	if ts.Resource.Type != "global" || ts.Resource.Labels["project_id"] != "my-project" {
+		t.Errorf("unexpected resource %v", ts.Resource)
+	}
+	if ts.MetricKind != metricpb.MetricDescriptor_GAUGE || ts.ValueType != metricpb.MetricDescriptor_INT64 {
+		t.Errorf("expected INT64 gauge, got %v %v", ts.MetricKind, ts.ValueType)
+	}
+	if len(ts.Points) != 1 {
+		t.Fatalf("expected 1 point, got %d", len(ts.Points))
+	}
+	if got := ts.Points[0].Value.Value.(*monitoringpb.TypedValue_Int64Value).Int64Value; got != 2048 {
+		t.Errorf("expected value 2048, got %d", got)
+	}
+	if !ts.Points[0].Interval.EndTime.AsTime().Equal(at) {
+		t.Errorf("expected end time %v, got %v", at, ts.Points[0].Interval.EndTime.AsTime())
+	}
+}
+
+func TestTimeSeries_DefaultsTimeToNow(t *testing.T) {
+	before := time.Now()
+	ts := timeSeries("my-project", Point{Name: ScrapeSuccess, Value: 1})
+	if ts.Points[0].Interval.EndTime.AsTime().Before(before.Truncate(time.Second)) {
+		t.Errorf("expected end time to default to now, got %v", ts.Points[0].Interval.EndTime.AsTime())
+	}
+}
+
+func TestMockWriter_RecordsPoints(t *testing.T) {
+	wantErr := errors.New("boom")
+	m := &MockWriter{WriteFunc: func(ctx context.Context, points ...Point) error { return wantErr }}
+
+	err := m.Write(context.Background(), Point{Name: AlertsFound, Value: 3}, Point{Name: AlertsFound, Value: 5})
+	if !errors.Is(err, wantErr) {
+		t.Errorf("expected WriteFunc error, got %v", err)
+	}
+	if got := len(m.Points()); got != 2 {
+		t.Errorf("expected 2 points recorded, got %d", got)
+	}
+	if got := m.Values()[AlertsFound]; got != 5 {
+		t.Errorf("expected last value 5, got %d", got)
+	}
+}
@@ -0,0 +1,52 @@
+// Package metrics records custom service metrics such as scrape success,
+// alert counts and archive sizes.
+package metrics
+
+import (
+	"context"
+	"sync"
+)
+
+// MockWriter is a mock implementation of Writer for testing.
+type MockWriter struct {
+	// WriteFunc is called when Write is invoked.
+	// If nil, returns nil (success).
+	WriteFunc func(ctx context.Context, points ...Point) error
+
+	mu     sync.Mutex
+	points []Point
+}
+
+// Write implements Writer.Write.
+func (m *MockWriter) Write(ctx context.Context, points ...Point) error {
+	m.mu.Lock()
+	m.points = append(m.points, points...)
+	m.mu.Unlock()
+
+	if m.WriteFunc != nil {
+		return m.WriteFunc(ctx, points...)
+	}
+	return nil
+}
+
+// Points returns a copy of all points received.
+func (m *MockWriter) Points() []Point {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Point(nil), m.points...)
+}
+
+// Values returns the received points keyed by metric name. If a metric was
+// written more than once the last value wins.
+func (m *MockWriter) Values() map[string]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	values := make(map[string]int64, len(m.points))
+	for _, p := range m.points {
+		values[p.Name] = p.Value
+	}
+	return values
+}
+
+// Ensure MockWriter implements Writer.
+var _ Writer = (*MockWriter)(nil)
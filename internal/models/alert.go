@@ -7,6 +7,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"google.golang.org/genproto/googleapis/type/latlng"
@@ -20,9 +21,9 @@ type Location struct {
 
 // Comment represents a user comment on an alert
 type Comment struct {
-	ReportMillis int64  `json:"reportMillis"`
-	Text         string `json:"text"`
-	IsThumbsUp   bool   `json:"isThumbsUp"`
+	ReportMillis int64  `json:"reportMillis" firestore:"report_millis"`
+	Text         string `json:"text" firestore:"text"`
+	IsThumbsUp   bool   `json:"isThumbsUp" firestore:"is_thumbs_up"`
 }
 
 // WazeAlert represents a single alert from Waze API
@@ -73,47 +74,131 @@ type WazeAlert struct {
 	AdditionalInfo string `json:"additionalInfo,omitempty" firestore:"additional_info,omitempty"`
 	WazeData       string `json:"wazeData,omitempty" firestore:"waze_data,omitempty"`
 	Inscale        bool   `json:"inscale,omitempty" firestore:"inscale,omitempty"`
+
+	// Provenance (set by the client, not part of the Waze response)
+	SourceBBox string          `json:"-" firestore:"-"` // First configured bbox that returned the alert
+	Raw        json.RawMessage `json:"-" firestore:"-"` // Exact bytes Waze sent for the alert, when preserved
 }
 
 // PoliceAlert represents a tracked police alert with full lifecycle tracking
 // This is what gets stored in Firestore for POLICE type alerts
 type PoliceAlert struct {
 	// Core alert data (from Waze API)
-	UUID    string `firestore:"uuid"`
-	ID      string `firestore:"id,omitempty"`
-	Type    string `firestore:"type"`
-	Subtype string `firestore:"subtype"`
-	Street  string `firestore:"street,omitempty"`
-	City    string `firestore:"city,omitempty"`
-	Country string `firestore:"country,omitempty"`
+	UUID    string `json:"uuid" firestore:"uuid"`
+	ID      string `json:"id,omitempty" firestore:"id,omitempty"`
+	Type    string `json:"type" firestore:"type"`
+	Subtype string `json:"subtype" firestore:"subtype"`
+	Street  string `json:"street,omitempty" firestore:"street,omitempty"`
+	City    string `json:"city,omitempty" firestore:"city,omitempty"`
+	Country string `json:"country,omitempty" firestore:"country,omitempty"`
 
-	// Location as GeoPoint for geospatial queries
-	LocationGeo *latlng.LatLng `firestore:"location_geo"`
+	// Location as GeoPoint for geospatial queries, written to JSON as a
+	// GeoPoint under "location"
+	LocationGeo *latlng.LatLng `json:"-" firestore:"location_geo"`
 
 	// Reliability metrics
-	Reliability  int `firestore:"reliability,omitempty"`
-	Confidence   int `firestore:"confidence,omitempty"`
-	ReportRating int `firestore:"report_rating,omitempty"`
+	Reliability  int `json:"reliability,omitempty" firestore:"reliability,omitempty"`
+	Confidence   int `json:"confidence,omitempty" firestore:"confidence,omitempty"`
+	ReportRating int `json:"report_rating,omitempty" firestore:"report_rating,omitempty"`
+
+	// Peak reliability (only stored when peak tracking is enabled)
+	ReliabilityMax int `json:"reliability_max,omitempty" firestore:"reliability_max,omitempty"` // Highest reliability seen across scrapes
+	ConfidenceMax  int `json:"confidence_max,omitempty" firestore:"confidence_max,omitempty"`   // Highest confidence seen across scrapes
 
 	// Time tracking (all as Firestore Timestamps)
-	PublishTime time.Time `firestore:"publish_time"` // Converted from pubMillis
-	ScrapeTime  time.Time `firestore:"scrape_time"`  // First time seen
-	ExpireTime  time.Time `firestore:"expire_time"`  // Last time seen (assumes expired after)
+	PublishTime time.Time `json:"publish_time" firestore:"publish_time"` // Converted from pubMillis
+	ScrapeTime  time.Time `json:"scrape_time" firestore:"scrape_time"`   // First time seen
+	ExpireTime  time.Time `json:"expire_time" firestore:"expire_time"`   // Last time seen (assumes expired after)
 
 	// Verification tracking
-	LastVerificationTime *time.Time `firestore:"last_verification_time,omitempty"` // Latest comment timestamp
+	LastVerificationTime *time.Time `json:"last_verification_time,omitempty" firestore:"last_verification_time,omitempty"` // Latest comment timestamp
 
 	// Duration tracking (in milliseconds for consistency with Waze)
-	ActiveMillis           int64  `firestore:"active_millis"`                      // expireMillis - pubMillis
-	LastVerificationMillis *int64 `firestore:"last_verification_millis,omitempty"` // Latest comment reportMillis
+	ActiveMillis           int64  `json:"active_millis" firestore:"active_millis"`                                           // expireMillis - pubMillis
+	LastVerificationMillis *int64 `json:"last_verification_millis,omitempty" firestore:"last_verification_millis,omitempty"` // Latest comment reportMillis
+
+	// DurationHuman is ActiveMillis formatted for display (e.g. "2h 15m"). It is
+	// only filled in by the alerts service when enabled and is never stored.
+	DurationHuman string `json:"duration_human,omitempty" firestore:"-"`
+
+	// DayOfWeek (e.g. "Saturday") and ISOWeek (e.g. "2024-W01") are derived from
+	// PublishTime in the alerts service's time zone. They are only filled in by
+	// the alerts service when enabled and are never stored.
+	DayOfWeek string `json:"day_of_week,omitempty" firestore:"-"`
+	ISOWeek   string `json:"iso_week,omitempty" firestore:"-"`
+
+	// DocPath is the alert's Firestore document path (e.g. "police_alerts/<uuid>").
+	// It is only filled in by the alerts service for ?debug=true and is never stored.
+	DocPath string `json:"doc_path,omitempty" firestore:"-"`
+
+	// SourcePath is the path of the Firestore document the alert was read from,
+	// relative to the database (e.g. "police_alerts/<uuid>_2024-01-02" with
+	// composite IDs). It is empty for alerts read from archives and is never
+	// stored or written to JSON.
+	SourcePath string `json:"-" firestore:"-"`
+
+	// SecondsSinceLastSeen is the time since ExpireTime, when the scraper last
+	// saw the alert. It is only filled in by the alerts service when enabled and
+	// is never stored.
+	SecondsSinceLastSeen *int64 `json:"seconds_since_last_seen,omitempty" firestore:"-"`
 
 	// Community engagement tracking
-	NThumbsUpInitial int `firestore:"n_thumbs_up_initial"` // Initial thumbs up count
-	NThumbsUpLast    int `firestore:"n_thumbs_up_last"`    // Most recent thumbs up count
+	NThumbsUpInitial int `json:"n_thumbs_up_initial" firestore:"n_thumbs_up_initial"` // Initial thumbs up count
+	NThumbsUpLast    int `json:"n_thumbs_up_last" firestore:"n_thumbs_up_last"`       // Most recent thumbs up count
+
+	// Comments (capped to the most recent N, oldest first)
+	Comments          []Comment `json:"comments,omitempty" firestore:"comments,omitempty"`
+	CommentsTruncated bool      `json:"comments_truncated,omitempty" firestore:"comments_truncated,omitempty"` // Older comments were dropped
+
+	// Provenance (only stored when source bbox tracking is enabled)
+	SourceBBox string `json:"source_bbox,omitempty" firestore:"source_bbox,omitempty"` // First configured bbox that returned the alert
+
+	// Identity (only stored when fingerprints are enabled)
+	Fingerprint string `json:"fingerprint,omitempty" firestore:"fingerprint,omitempty"` // Hash of UUID, pubMillis, subtype and rounded location
+
+	// Deploy attribution (only stored when revision tagging is enabled)
+	ScrapedByRevision string `json:"scraped_by_revision,omitempty" firestore:"scraped_by_revision,omitempty"` // Scraper revision that last saved the alert
 
 	// Raw data preservation
-	RawDataInitial string `firestore:"raw_data_initial"` // First scrape JSON
-	RawDataLast    string `firestore:"raw_data_last"`    // Most recent scrape JSON
+	RawDataInitial string `json:"raw_data_initial" firestore:"raw_data_initial"` // First scrape JSON
+	RawDataLast    string `json:"raw_data_last" firestore:"raw_data_last"`       // Most recent scrape JSON
+}
+
+// PoliceAlertSummary is the latest state of a PoliceAlert without its
+// lifecycle history, comments or raw data. It is served for view=summary.
+// Field names match PoliceAlert so clients can read either view.
+type PoliceAlertSummary struct {
+	UUID    string `json:"uuid"`
+	Type    string `json:"type"`
+	Subtype string `json:"subtype"`
+	Street  string `json:"street,omitempty"`
+	City    string `json:"city,omitempty"`
+	Country string `json:"country,omitempty"`
+
+	LocationGeo *latlng.LatLng `json:"-"`
+
+	Reliability int `json:"reliability,omitempty"`
+	Confidence  int `json:"confidence,omitempty"`
+
+	PublishTime   time.Time `json:"publish_time"`
+	ExpireTime    time.Time `json:"expire_time"`
+	ActiveMillis  int64     `json:"active_millis"`
+	DurationHuman string    `json:"duration_human,omitempty"`
+	DayOfWeek     string    `json:"day_of_week,omitempty"`
+	ISOWeek       string    `json:"iso_week,omitempty"`
+
+	SecondsSinceLastSeen *int64 `json:"seconds_since_last_seen,omitempty"`
+
+	NThumbsUpLast int `json:"n_thumbs_up_last"`
+}
+
+// MarshalJSON writes LocationGeo as a GeoPoint under "location", like PoliceAlert
+func (s PoliceAlertSummary) MarshalJSON() ([]byte, error) {
+	type summary PoliceAlertSummary // Without this method
+	return json.Marshal(struct {
+		summary
+		Location *GeoPoint `json:"location"`
+	}{summary(s), newGeoPoint(s.LocationGeo)})
 }
 
 // WazeGeoRSSResponse is the response from Waze API
@@ -129,6 +214,8 @@ type ScrapingStats struct {
 	TotalRequests     int       `json:"total_requests"`
 	SuccessfulCalls   int       `json:"successful_calls"`
 	FailedCalls       int       `json:"failed_calls"`
+	RetriedCalls      int       `json:"retried_calls,omitempty"`    // Requests repeated after a transient error status
+	SubdividedBoxes   int       `json:"subdivided_boxes,omitempty"` // Bboxes split into quadrants after a truncated response
 	TotalAlerts       int       `json:"total_alerts"`
 	UniqueAlerts      int       `json:"unique_alerts"`
 	LastSuccessfulRun time.Time `json:"last_successful_run"`
@@ -0,0 +1,119 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"google.golang.org/genproto/googleapis/type/latlng"
+)
+
+// GeoPoint is how an alert's LocationGeo is written in JSON
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// newGeoPoint converts a Firestore GeoPoint, returning nil for nil
+func newGeoPoint(l *latlng.LatLng) *GeoPoint {
+	if l == nil {
+		return nil
+	}
+	return &GeoPoint{Lat: l.Latitude, Lng: l.Longitude}
+}
+
+// policeAlertFields is PoliceAlert without its JSON methods
+type policeAlertFields PoliceAlert
+
+// policeAlertJSON is the JSON form of a PoliceAlert
+type policeAlertJSON struct {
+	policeAlertFields
+	Location *GeoPoint `json:"location"`
+}
+
+// legacyPoliceAlert is PoliceAlert as written to JSON before it had json
+// tags, with Go field names as keys and LocationGeo as
+// {"latitude":...,"longitude":...}. Its fields must stay identical to
+// PoliceAlert's so one converts to the other.
+type legacyPoliceAlert struct {
+	UUID                   string
+	ID                     string
+	Type                   string
+	Subtype                string
+	Street                 string
+	City                   string
+	Country                string
+	LocationGeo            *latlng.LatLng
+	Reliability            int
+	Confidence             int
+	ReportRating           int
+	ReliabilityMax         int
+	ConfidenceMax          int
+	PublishTime            time.Time
+	ScrapeTime             time.Time
+	ExpireTime             time.Time
+	LastVerificationTime   *time.Time
+	ActiveMillis           int64
+	LastVerificationMillis *int64
+	DurationHuman          string `json:"duration_human,omitempty"`
+	DayOfWeek              string `json:"day_of_week,omitempty"`
+	ISOWeek                string `json:"iso_week,omitempty"`
+	DocPath                string `json:"doc_path,omitempty"`
+	SourcePath             string `json:"-"`
+	SecondsSinceLastSeen   *int64 `json:"seconds_since_last_seen,omitempty"`
+	NThumbsUpInitial       int
+	NThumbsUpLast          int
+	Comments               []Comment
+	CommentsTruncated      bool
+	SourceBBox             string
+	Fingerprint            string
+	ScrapedByRevision      string
+	RawDataInitial         string
+	RawDataLast            string
+}
+
+// isLegacyPoliceAlert reports whether data is an alert written with Go field
+// names. Only its first key is read: records written with json tags have only
+// lower-case keys, while older ones start with "UUID".
+func isLegacyPoliceAlert(data []byte) bool {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return false
+	}
+	key, err := dec.Token()
+	if err != nil {
+		return false
+	}
+	name, ok := key.(string)
+	return ok && name != "" && name[0] >= 'A' && name[0] <= 'Z'
+}
+
+// MarshalJSON writes the alert with snake_case keys and LocationGeo as a
+// GeoPoint under "location"
+func (a PoliceAlert) MarshalJSON() ([]byte, error) {
+	return json.Marshal(policeAlertJSON{policeAlertFields(a), newGeoPoint(a.LocationGeo)})
+}
+
+// UnmarshalJSON reads an alert written by MarshalJSON, or one written with Go
+// field names (e.g. "PublishTime" and "LocationGeo") before PoliceAlert had
+// json tags
+func (a *PoliceAlert) UnmarshalJSON(data []byte) error {
+	if isLegacyPoliceAlert(data) {
+		var legacy legacyPoliceAlert
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return err
+		}
+		*a = PoliceAlert(legacy)
+		return nil
+	}
+
+	var in policeAlertJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	*a = PoliceAlert(in.policeAlertFields)
+	if in.Location != nil {
+		a.LocationGeo = &latlng.LatLng{Latitude: in.Location.Lat, Longitude: in.Location.Lng}
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 
@@ -141,3 +143,100 @@ func TestScrapingStats(t *testing.T) {
 		t.Errorf("Expected UniqueAlerts 75, got %d", stats.UniqueAlerts)
 	}
 }
+
+func TestPoliceAlertJSON(t *testing.T) {
+	publish := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	alert := PoliceAlert{
+		UUID:          "a1",
+		Type:          "POLICE",
+		Subtype:       "POLICE_VISIBLE",
+		LocationGeo:   &latlng.LatLng{Latitude: -33.8688, Longitude: 151.2093},
+		PublishTime:   publish,
+		NThumbsUpLast: 3,
+	}
+
+	data, err := json.Marshal(alert)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	for _, key := range []string{"uuid", "subtype", "publish_time", "n_thumbs_up_last"} {
+		if _, ok := keys[key]; !ok {
+			t.Errorf("Expected key %s in %s", key, data)
+		}
+	}
+	if string(keys["location"]) != `{"lat":-33.8688,"lng":151.2093}` {
+		t.Errorf("Expected location as lat/lng, got %s", keys["location"])
+	}
+	if _, ok := keys["LocationGeo"]; ok {
+		t.Errorf("Expected no LocationGeo key in %s", data)
+	}
+
+	var decoded PoliceAlert
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if decoded.UUID != "a1" || !decoded.PublishTime.Equal(publish) || decoded.NThumbsUpLast != 3 {
+		t.Errorf("Unexpected round trip: %+v", decoded)
+	}
+	if decoded.LocationGeo == nil || decoded.LocationGeo.Latitude != -33.8688 || decoded.LocationGeo.Longitude != 151.2093 {
+		t.Errorf("Expected location to round trip, got %v", decoded.LocationGeo)
+	}
+
+	noLocation, err := json.Marshal(PoliceAlert{UUID: "a2"})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if !strings.Contains(string(noLocation), `"location":null`) {
+		t.Errorf("Expected null location, got %s", noLocation)
+	}
+}
+
+func TestPoliceAlertJSONLegacyKeys(t *testing.T) {
+	legacy := `{"UUID":"a1","Subtype":"POLICE_HIDING","PublishTime":"2024-01-01T00:00:00Z",` +
+		`"LocationGeo":{"latitude":-33.8688,"longitude":151.2093},"NThumbsUpLast":2,"LegacyField":1}`
+
+	var alert PoliceAlert
+	if err := json.Unmarshal([]byte(legacy), &alert); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if alert.UUID != "a1" || alert.Subtype != "POLICE_HIDING" || alert.NThumbsUpLast != 2 {
+		t.Errorf("Unexpected alert: %+v", alert)
+	}
+	if !alert.PublishTime.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected PublishTime to be read, got %v", alert.PublishTime)
+	}
+	if alert.LocationGeo == nil || alert.LocationGeo.Latitude != -33.8688 || alert.LocationGeo.Longitude != 151.2093 {
+		t.Errorf("Expected LocationGeo to be read, got %v", alert.LocationGeo)
+	}
+
+	if err := json.Unmarshal([]byte(`{"uuid":"a1","reliability":"high"}`), &alert); err == nil {
+		t.Error("Expected an error for a mistyped field")
+	}
+	if err := json.Unmarshal([]byte(`{"UUID":"a1","Reliability":"high"}`), &alert); err == nil {
+		t.Error("Expected an error for a mistyped legacy field")
+	}
+}
+
+func TestIsLegacyPoliceAlert(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{`{"UUID":"a1","PublishTime":"2024-01-01T00:00:00Z"}`, true},
+		{` {"LocationGeo":null}`, true},
+		{`{"uuid":"a1","publish_time":"2024-01-01T00:00:00Z"}`, false},
+		{`{"extra":1,"UUID":"a1"}`, false},
+		{`{}`, false},
+		{`[]`, false},
+		{`not json`, false},
+	}
+	for _, tt := range tests {
+		if got := isLegacyPoliceAlert([]byte(tt.data)); got != tt.want {
+			t.Errorf("isLegacyPoliceAlert(%s) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // AlertsRequest represents the request body for fetching alerts
 type AlertsRequest struct {
 	// Dates is an array of date strings in YYYY-MM-DD format
@@ -8,6 +10,31 @@ type AlertsRequest struct {
 	// Optional filters
 	Subtypes []string `json:"subtypes,omitempty"` // Filter by alert subtypes
 	Streets  []string `json:"streets,omitempty"`  // Filter by street names
+	Cities   []string `json:"cities,omitempty"`   // Filter by city names
+
+	// Keep only alerts with (PresenceNamed) or without (PresenceUnnamed) a street or city
+	StreetPresence string `json:"street_presence,omitempty"`
+	CityPresence   string `json:"city_presence,omitempty"`
+}
+
+// Presence filters on whether an alert has a street or city name
+const (
+	PresenceAny     = ""        // Named and unnamed alerts
+	PresenceNamed   = "named"   // Only alerts with a name
+	PresenceUnnamed = "unnamed" // Only alerts without a name, e.g. on unnamed roads
+)
+
+// AlertFilters are the optional filters applied when querying alerts by date.
+// Empty lists and presences match every alert.
+type AlertFilters struct {
+	Subtypes []string // Alert subtypes
+	Streets  []string // Street names
+	Cities   []string // City names
+
+	// StreetPresence and CityPresence keep only named or unnamed alerts. They
+	// apply in addition to Streets and Cities.
+	StreetPresence string
+	CityPresence   string
 }
 
 // AlertsResponse represents the response containing alerts and metadata
@@ -25,3 +52,184 @@ type ResponseStats struct {
 	SubtypesFiltered []string `json:"subtypes_filtered,omitempty"`
 	StreetsFiltered  []string `json:"streets_filtered,omitempty"`
 }
+
+// HeatmapRequest represents the request body for the street heatmap endpoint
+type HeatmapRequest struct {
+	// Dates is an array of date strings in YYYY-MM-DD format
+	Dates []string `json:"dates"`
+}
+
+// StreetCount represents the number of alerts on a street and its representative
+// location (the average of the alerts' coordinates)
+type StreetCount struct {
+	Street    string  `json:"street"`
+	Count     int     `json:"count"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// HeatmapResponse represents the response containing streets sorted by alert count
+type HeatmapResponse struct {
+	Streets      []StreetCount `json:"streets"`
+	DatesQueried []string      `json:"dates_queried"`
+}
+
+// DiffRequest represents the request body for comparing two days
+type DiffRequest struct {
+	// DateA and DateB are date strings in YYYY-MM-DD format
+	DateA string `json:"date_a"`
+	DateB string `json:"date_b"`
+}
+
+// AlertDelta holds the change in an alert's metrics between two days (B minus A)
+type AlertDelta struct {
+	UUID             string `json:"uuid"`
+	ThumbsUpDelta    int    `json:"thumbs_up_delta"`
+	ReliabilityDelta int    `json:"reliability_delta"`
+	ConfidenceDelta  int    `json:"confidence_delta"`
+}
+
+// DiffResponse describes what changed between two days
+type DiffResponse struct {
+	DateA     string       `json:"date_a"`
+	DateB     string       `json:"date_b"`
+	Added     []string     `json:"added"`     // UUIDs present on B but not A
+	Removed   []string     `json:"removed"`   // UUIDs present on A but not B
+	Changed   []AlertDelta `json:"changed"`   // Alerts on both days whose metrics changed
+	Unchanged int          `json:"unchanged"` // Alerts on both days with identical metrics
+}
+
+// ScrapeResponse is returned by the scraper service after a scrape run.
+// Fields are serialized in declaration order so output is byte-stable.
+type ScrapeResponse struct {
+	Status            string         `json:"status"`
+	AlertsFound       int            `json:"alerts_found"`
+	PoliceAlertsSaved int            `json:"police_alerts_saved"`
+	Stats             *ScrapingStats `json:"stats"`
+	BBoxesUsed        int            `json:"bboxes_used"`
+}
+
+// GeoJSONFeature is an RFC 7946 Feature for a single alert
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"` // always "Feature"
+	Geometry   GeoJSONPoint           `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// GeoJSONPoint is an RFC 7946 Point geometry
+type GeoJSONPoint struct {
+	Type        string     `json:"type"`        // always "Point"
+	Coordinates [2]float64 `json:"coordinates"` // [longitude, latitude]
+}
+
+// RunSummary records the outcome of a single scraper run for historical
+// analysis of scraping health. Call counts cover this run only.
+type RunSummary struct {
+	StartedAt         time.Time `json:"started_at"`
+	DurationMs        int64     `json:"duration_ms"`
+	Status            string    `json:"status"` // "success" or "failure"
+	Error             string    `json:"error,omitempty"`
+	BBoxes            []string  `json:"bboxes"`
+	Requests          int       `json:"requests"`
+	SuccessfulCalls   int       `json:"successful_calls"`
+	FailedCalls       int       `json:"failed_calls"`
+	RetriedCalls      int       `json:"retried_calls"`
+	SubdividedBoxes   int       `json:"subdivided_boxes"`
+	AlertsFound       int       `json:"alerts_found"`
+	PoliceAlertsSaved int       `json:"police_alerts_saved"`
+}
+
+// Heartbeat records the scraper's last save of at least one police alert
+type Heartbeat struct {
+	LastSuccessfulSave time.Time `json:"last_successful_save"`
+	PoliceAlertsSaved  int       `json:"police_alerts_saved"`
+}
+
+// LastRun reports the outcome of the most recent run handled by a service
+// instance. It is held in memory, so it resets when the instance restarts.
+type LastRun struct {
+	Status     string     `json:"status"` // "none" before the first run, then "success", "failure" or "zero_alerts"
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Message    string     `json:"message,omitempty"`
+}
+
+// SyncResponse represents a page of alerts updated since a client's last sync
+type SyncResponse struct {
+	Alerts []PoliceAlert `json:"alerts"`
+	// NextSince is the cursor to pass as since on the next sync request
+	NextSince time.Time `json:"next_since"`
+}
+
+// SyncSummaryResponse is a SyncResponse with alerts in the summary view
+type SyncSummaryResponse struct {
+	Alerts    []PoliceAlertSummary `json:"alerts"`
+	NextSince time.Time            `json:"next_since"`
+}
+
+// ActiveAtResponse lists the alerts active at an instant
+type ActiveAtResponse struct {
+	At     time.Time     `json:"at"`
+	Alerts []PoliceAlert `json:"alerts"`
+}
+
+// TimeSeriesBucket counts the police alerts published in one interval
+type TimeSeriesBucket struct {
+	Start time.Time `json:"start"`
+	Count int64     `json:"count"`
+}
+
+// TimeSeriesResponse lists alert counts per interval for a date range
+type TimeSeriesResponse struct {
+	Interval string             `json:"interval"`
+	Buckets  []TimeSeriesBucket `json:"buckets"`
+}
+
+// StreamSummary describes what a /police_alerts stream contained, so clients
+// can check they received every alert
+type StreamSummary struct {
+	Dates   []string      `json:"dates"` // Dates served, excluding those outside the collection period
+	Total   int64         `json:"total"`
+	Sources StreamSources `json:"sources"`
+}
+
+// StreamSources splits a StreamSummary's total by where the alerts were read from
+type StreamSources struct {
+	Archive   int64 `json:"archive"`
+	Firestore int64 `json:"firestore"`
+}
+
+// StreamSummaryLine is the final line of a /police_alerts stream requested with
+// summary=true. Its "_summary" key cannot collide with an alert field.
+type StreamSummaryLine struct {
+	Summary StreamSummary `json:"_summary"`
+}
+
+// ServeStats reports how /police_alerts requests have been served since the
+// alerts service started
+type ServeStats struct {
+	Requests           int64 `json:"requests"`
+	ArchiveHits        int64 `json:"archive_hits"`        // Dates served from a GCS archive
+	FirestoreFallbacks int64 `json:"firestore_fallbacks"` // Dates queried from Firestore because no archive existed
+	AlertsStreamed     int64 `json:"alerts_streamed"`
+	BytesStreamed      int64 `json:"bytes_streamed"` // Before compression
+	InvalidLines       int64 `json:"invalid_lines"`  // Archive lines skipped as invalid JSON, when validated
+
+	AlertTypes *AlertTypeCounts `json:"alert_types,omitempty"` // Only when subtype counting is enabled
+}
+
+// AlertTypeCounts splits streamed alerts by subtype and by the category each
+// subtype rolls up into
+type AlertTypeCounts struct {
+	Subtypes   map[string]int64 `json:"subtypes"`
+	Categories map[string]int64 `json:"categories"`
+}
+
+// CollectionStats reports the number of documents in a Firestore collection and
+// an estimate of their storage size
+type CollectionStats struct {
+	Collection       string `json:"collection"`
+	DocumentCount    int64  `json:"document_count"`
+	SampledDocuments int    `json:"sampled_documents"`  // Documents read to estimate the average size
+	AvgDocumentBytes int64  `json:"avg_document_bytes"` // Average stored size of the sampled documents
+	EstimatedBytes   int64  `json:"estimated_bytes"`    // AvgDocumentBytes × DocumentCount
+}
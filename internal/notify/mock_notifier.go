@@ -0,0 +1,39 @@
+// Package notify sends operational alerts when scrape or archive runs fail.
+package notify
+
+import (
+	"context"
+	"sync"
+)
+
+// MockNotifier is a mock implementation of Notifier for testing.
+type MockNotifier struct {
+	// NotifyFunc is called when Notify is invoked.
+	// If nil, returns nil (success).
+	NotifyFunc func(ctx context.Context, event Event) error
+
+	mu     sync.Mutex
+	events []Event
+}
+
+// Notify implements Notifier.Notify.
+func (m *MockNotifier) Notify(ctx context.Context, event Event) error {
+	m.mu.Lock()
+	m.events = append(m.events, event)
+	m.mu.Unlock()
+
+	if m.NotifyFunc != nil {
+		return m.NotifyFunc(ctx, event)
+	}
+	return nil
+}
+
+// Events returns a copy of all events received.
+func (m *MockNotifier) Events() []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Event(nil), m.events...)
+}
+
+// Ensure MockNotifier implements Notifier.
+var _ Notifier = (*MockNotifier)(nil)
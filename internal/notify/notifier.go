@@ -0,0 +1,96 @@
+// Package notify sends operational alerts when scrape or archive runs fail.
+//
+// Alerts are posted to a webhook (Slack, Discord or any endpoint accepting a
+// JSON POST) so failures are noticed without watching the logs.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Event kinds
+const (
+	KindFailure    = "failure"
+	KindZeroAlerts = "zero_alerts"
+)
+
+// Event describes something that needs attention
+type Event struct {
+	Service string    `json:"service"`
+	Kind    string    `json:"kind"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// Text returns a one-line human readable summary of the event
+func (e Event) Text() string {
+	return fmt.Sprintf("[%s] %s: %s", e.Service, e.Kind, e.Message)
+}
+
+// Notifier sends events to an external channel.
+// This interface enables dependency injection and mocking for testing.
+type Notifier interface {
+	// Notify delivers the event, returning an error if delivery failed.
+	Notify(ctx context.Context, event Event) error
+}
+
+// WebhookNotifier posts events as JSON to a webhook URL
+type WebhookNotifier struct {
+	url        string
+	httpClient *http.Client
+}
+
+// NewWebhookNotifier creates a notifier for the given webhook URL
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url: url,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// webhookPayload carries the summary under both "text" (Slack) and "content"
+// (Discord) alongside the structured event for generic receivers
+type webhookPayload struct {
+	Text    string `json:"text"`
+	Content string `json:"content"`
+	Event
+}
+
+// Notify implements Notifier.Notify.
+func (n *WebhookNotifier) Notify(ctx context.Context, event Event) error {
+	body, err := json.Marshal(webhookPayload{
+		Text:    event.Text(),
+		Content: event.Text(),
+		Event:   event,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook call failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Ensure WebhookNotifier implements Notifier.
+var _ Notifier = (*WebhookNotifier)(nil)
@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotifier_PostsEvent(t *testing.T) {
+	var received map[string]interface{}
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	event := Event{
+		Service: "archive-service",
+		Kind:    KindFailure,
+		Message: "upload failed",
+		Time:    time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC),
+	}
+	if err := NewWebhookNotifier(server.URL).Notify(context.Background(), event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if contentType != "application/json" {
+		t.Errorf("expected JSON content type, got %q", contentType)
+	}
+	want := "[archive-service] failure: upload failed"
+	if received["text"] != want || received["content"] != want {
+		t.Errorf("expected Slack/Discord text %q, got %v", want, received)
+	}
+	if received["service"] != "archive-service" || received["kind"] != KindFailure || received["message"] != "upload failed" {
+		t.Errorf("expected structured event fields, got %v", received)
+	}
+}
+
+func TestWebhookNotifier_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	err := NewWebhookNotifier(server.URL).Notify(context.Background(), Event{Service: "s", Kind: KindFailure})
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("expected status error, got %v", err)
+	}
+}
+
+func TestWebhookNotifier_Unreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	if err := NewWebhookNotifier(url).Notify(context.Background(), Event{}); err == nil {
+		t.Error("expected error for unreachable webhook")
+	}
+}
+
+func TestMockNotifier_RecordsEvents(t *testing.T) {
+	m := &MockNotifier{}
+	_ = m.Notify(context.Background(), Event{Kind: KindFailure})
+	_ = m.Notify(context.Background(), Event{Kind: KindZeroAlerts})
+
+	events := m.Events()
+	if len(events) != 2 || events[0].Kind != KindFailure || events[1].Kind != KindZeroAlerts {
+		t.Errorf("unexpected events: %+v", events)
+	}
+}
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MessagePack archives hold one MessagePack map per alert, keyed by
+// PoliceAlert field name with empty fields left out. They are smaller and
+// faster to parse than JSONL but not human-readable.
+
+// WriteMsgpackAlerts encodes alerts into w as a MessagePack archive. Each
+// alert takes several small writes, so w should be buffered.
+func WriteMsgpackAlerts(w io.Writer, alerts []models.PoliceAlert) error {
+	enc := msgpack.NewEncoder(w)
+	enc.SetOmitEmpty(true)
+	enc.UseCompactInts(true)
+	for _, alert := range alerts {
+		if err := enc.Encode(&alert); err != nil {
+			return fmt.Errorf("failed to encode alert %s: %w", alert.UUID, err)
+		}
+	}
+	return nil
+}
+
+// ReadMsgpackAlerts decodes every alert of a MessagePack archive
+func ReadMsgpackAlerts(r io.Reader) ([]models.PoliceAlert, error) {
+	dec := msgpack.NewDecoder(bufio.NewReader(r))
+	var alerts []models.PoliceAlert
+	for {
+		alert, err := decodeMsgpackAlert(dec)
+		if err == io.EOF {
+			return alerts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+}
+
+// decodeMsgpackAlert decodes the next alert, returning io.EOF at the end of
+// the archive. Times are decoded in the local zone, so they are converted
+// back to UTC as Firestore returns them.
+func decodeMsgpackAlert(dec *msgpack.Decoder) (models.PoliceAlert, error) {
+	var alert models.PoliceAlert
+	if _, err := dec.PeekCode(); err == io.EOF {
+		return alert, io.EOF
+	}
+	if err := dec.Decode(&alert); err != nil {
+		if errors.Is(err, io.EOF) {
+			// The archive ends part way through an alert
+			err = io.ErrUnexpectedEOF
+		}
+		return alert, fmt.Errorf("failed to decode MessagePack archive: %w", err)
+	}
+	alert.PublishTime = alert.PublishTime.UTC()
+	alert.ScrapeTime = alert.ScrapeTime.UTC()
+	alert.ExpireTime = alert.ExpireTime.UTC()
+	if alert.LastVerificationTime != nil {
+		t := alert.LastVerificationTime.UTC()
+		alert.LastVerificationTime = &t
+	}
+	return alert, nil
+}
+
+// isMsgpackMap reports whether b starts a MessagePack map (fixmap, map 16 or
+// map 32). No JSONL line starts with these bytes.
+func isMsgpackMap(b byte) bool {
+	return b&0xf0 == 0x80 || b == 0xde || b == 0xdf
+}
+
+// IsMsgpackArchive reports whether archive content is a MessagePack archive
+func IsMsgpackArchive(content []byte) bool {
+	return len(content) > 0 && isMsgpackMap(content[0])
+}
+
+// MaybeDecodeMsgpack returns a MessagePack archive read from reader as JSONL,
+// one marshaled alert per line, so callers can read either format line by
+// line. Other content is returned unchanged.
+func MaybeDecodeMsgpack(reader io.ReadCloser) io.ReadCloser {
+	br := bufio.NewReader(reader)
+	first, err := br.Peek(1)
+	if err != nil || !isMsgpackMap(first[0]) {
+		// Empty or JSONL content; any read error resurfaces on the next Read
+		return struct {
+			io.Reader
+			io.Closer
+		}{br, reader}
+	}
+	return &msgpackJSONLReader{dec: msgpack.NewDecoder(br), underlying: reader}
+}
+
+// msgpackJSONLReader converts a MessagePack archive to JSONL one alert at a time
+type msgpackJSONLReader struct {
+	dec        *msgpack.Decoder
+	buf        bytes.Buffer
+	err        error
+	underlying io.Closer
+}
+
+func (r *msgpackJSONLReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		alert, err := decodeMsgpackAlert(r.dec)
+		if err != nil {
+			r.err = err
+			continue
+		}
+		line, err := json.Marshal(alert)
+		if err != nil {
+			r.err = fmt.Errorf("failed to marshal alert %s: %w", alert.UUID, err)
+			continue
+		}
+		r.buf.Write(line)
+		r.buf.WriteByte('\n')
+	}
+	return r.buf.Read(p)
+}
+
+func (r *msgpackJSONLReader) Close() error {
+	return r.underlying.Close()
+}
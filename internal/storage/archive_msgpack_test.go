@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+	"google.golang.org/genproto/googleapis/type/latlng"
+)
+
+// msgpackTestAlerts returns a fully populated alert and a sparse one
+func msgpackTestAlerts() []models.PoliceAlert {
+	verified := time.Date(2024, 1, 15, 10, 30, 0, 123456789, time.UTC)
+	verifiedMillis := verified.UnixMilli()
+	return []models.PoliceAlert{
+		{
+			UUID:                   "a1",
+			ID:                     "alert-1",
+			Type:                   "POLICE",
+			Subtype:                "POLICE_HIDING",
+			Street:                 "Northbourne Ave",
+			City:                   "Canberra",
+			Country:                "AS",
+			LocationGeo:            &latlng.LatLng{Latitude: -35.2809, Longitude: 149.13},
+			Reliability:            8,
+			Confidence:             3,
+			ReportRating:           2,
+			ReliabilityMax:         9,
+			ConfidenceMax:          4,
+			PublishTime:            time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC),
+			ScrapeTime:             time.Date(2024, 1, 15, 9, 2, 0, 0, time.UTC),
+			ExpireTime:             time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC),
+			LastVerificationTime:   &verified,
+			ActiveMillis:           7200000,
+			LastVerificationMillis: &verifiedMillis,
+			NThumbsUpInitial:       1,
+			NThumbsUpLast:          5,
+			Comments: []models.Comment{
+				{ReportMillis: verifiedMillis, Text: "still there", IsThumbsUp: true},
+			},
+			CommentsTruncated: true,
+			SourceBBox:        "-35.5,149.0,-35.1,149.3",
+			Fingerprint:       "f1",
+			ScrapedByRevision: "scraper-00042",
+			RawDataInitial:    `{"uuid":"a1"}`,
+			RawDataLast:       `{"uuid":"a1","nThumbsUp":5}`,
+		},
+		{UUID: "a2", Type: "POLICE", Subtype: "POLICE_VISIBLE", PublishTime: time.Date(2024, 1, 15, 23, 59, 0, 0, time.UTC)},
+	}
+}
+
+// TestMsgpackRoundTrip tests that alerts encode and decode losslessly
+func TestMsgpackRoundTrip(t *testing.T) {
+	alerts := msgpackTestAlerts()
+
+	var buf bytes.Buffer
+	if err := WriteMsgpackAlerts(&buf, alerts); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+	if !IsMsgpackArchive(buf.Bytes()) {
+		t.Fatalf("expected a MessagePack archive, got % x", buf.Bytes()[:8])
+	}
+
+	got, err := ReadMsgpackAlerts(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to read archive: %v", err)
+	}
+	if !reflect.DeepEqual(got, alerts) {
+		t.Errorf("round trip changed the alerts\n got %+v\nwant %+v", got, alerts)
+	}
+
+	var jsonl bytes.Buffer
+	for _, alert := range alerts {
+		line, _ := json.Marshal(alert)
+		jsonl.Write(line)
+		jsonl.WriteByte('\n')
+	}
+	if buf.Len() >= jsonl.Len() {
+		t.Errorf("expected the MessagePack archive (%d bytes) to be smaller than JSONL (%d bytes)", buf.Len(), jsonl.Len())
+	}
+}
+
+// TestOpenArchiveMsgpack tests that plain and gzipped MessagePack archives are
+// read as the JSONL lines of the same alerts, and JSONL archives as stored
+func TestOpenArchiveMsgpack(t *testing.T) {
+	alerts := msgpackTestAlerts()
+	var archive, jsonl bytes.Buffer
+	if err := WriteMsgpackAlerts(&archive, alerts); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+	for _, alert := range alerts {
+		line, _ := json.Marshal(alert)
+		jsonl.Write(line)
+		jsonl.WriteByte('\n')
+	}
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write(archive.Bytes())
+	gz.Close()
+
+	tests := []struct {
+		name    string
+		content []byte
+		want    string
+	}{
+		{"msgpack", archive.Bytes(), jsonl.String()},
+		{"gzipped msgpack", gzipped.Bytes(), jsonl.String()},
+		{"jsonl", []byte("{\"uuid\":\"a\"}\r\n\n"), "{\"uuid\":\"a\"}\r\n\n"},
+		{"empty", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := OpenArchive(io.NopCloser(bytes.NewReader(tt.content)))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer reader.Close()
+			got, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("unexpected read error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestMaybeDecodeMsgpackTruncated tests that a truncated MessagePack archive
+// fails after the alerts before the damage
+func TestMaybeDecodeMsgpackTruncated(t *testing.T) {
+	var archive bytes.Buffer
+	if err := WriteMsgpackAlerts(&archive, msgpackTestAlerts()); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+	truncated := archive.Bytes()[:archive.Len()-5]
+
+	got, err := io.ReadAll(MaybeDecodeMsgpack(io.NopCloser(bytes.NewReader(truncated))))
+	if err == nil || !strings.Contains(err.Error(), "failed to decode MessagePack archive") {
+		t.Errorf("expected a decode error, got %v", err)
+	}
+	if !strings.HasPrefix(string(got), `{"uuid":"a1"`) || strings.Count(string(got), "\n") != 1 {
+		t.Errorf("expected the first alert's line before the error, got %q", got)
+	}
+	if _, err := ReadMsgpackAlerts(bytes.NewReader(truncated)); err == nil {
+		t.Error("expected ReadMsgpackAlerts to fail on a truncated archive")
+	}
+}
@@ -0,0 +1,52 @@
+// Package storage provides data persistence abstractions for Firestore and GCS.
+package storage
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// gzipReadCloser closes both the gzip reader and the underlying object reader
+type gzipReadCloser struct {
+	*gzip.Reader
+	underlying io.Closer
+}
+
+func (g *gzipReadCloser) Close() error {
+	g.Reader.Close()
+	return g.underlying.Close()
+}
+
+// MaybeGunzip wraps reader in a gzip decompressor if its content starts with the
+// gzip magic bytes; otherwise the content is returned unchanged. Archives uploaded
+// with Content-Encoding: gzip are not always transcoded by GCS on read.
+func MaybeGunzip(reader io.ReadCloser) (io.ReadCloser, error) {
+	br := bufio.NewReader(reader)
+	magic, err := br.Peek(2)
+	if err != nil || magic[0] != 0x1f || magic[1] != 0x8b {
+		// Short or plain content; any read error resurfaces on the next Read
+		return struct {
+			io.Reader
+			io.Closer
+		}{br, reader}, nil
+	}
+
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		reader.Close()
+		return nil, fmt.Errorf("failed to open gzipped archive: %w", err)
+	}
+	return &gzipReadCloser{Reader: gz, underlying: reader}, nil
+}
+
+// OpenArchive prepares an archive object's content for reading line by line:
+// gzipped archives are decompressed and MessagePack archives converted to JSONL
+func OpenArchive(reader io.ReadCloser) (io.ReadCloser, error) {
+	reader, err := MaybeGunzip(reader)
+	if err != nil {
+		return nil, err
+	}
+	return MaybeDecodeMsgpack(reader), nil
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMaybeGunzip(t *testing.T) {
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	_, _ = gz.Write([]byte("{\"UUID\":\"b\"}\n"))
+	_ = gz.Close()
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"plain", "{\"UUID\":\"a\"}\n", "{\"UUID\":\"a\"}\n"},
+		{"gzipped", gzipped.String(), "{\"UUID\":\"b\"}\n"},
+		{"empty", "", ""},
+		{"single byte", "x", "x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := MaybeGunzip(io.NopCloser(strings.NewReader(tt.content)))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer reader.Close()
+
+			got, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("unexpected read error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMaybeGunzip_InvalidHeader(t *testing.T) {
+	if _, err := MaybeGunzip(io.NopCloser(strings.NewReader("\x1f\x8bnot gzip"))); err == nil {
+		t.Error("expected error for invalid gzip header")
+	}
+}
@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/logging"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+)
+
+// Comment storage modes
+const (
+	// CommentsInline stores comments as an array field on the alert document
+	CommentsInline = "inline"
+	// CommentsSubcollection stores each comment as its own document in the
+	// alert's comments subcollection, so heavily discussed alerts don't grow
+	// the alert document
+	CommentsSubcollection = "subcollection"
+)
+
+// commentsCollection is the name of an alert's comment subcollection
+const commentsCollection = "comments"
+
+// WithCommentsStorage chooses where comments are stored: CommentsInline (the
+// default) or CommentsSubcollection. Alerts read back through the client carry
+// their comments in either mode, capped to the most recent MaxComments. Every
+// service sharing a collection must use the same mode.
+func WithCommentsStorage(mode string) Option {
+	return func(fc *FirestoreClient) {
+		fc.commentsStorage = mode
+	}
+}
+
+// commentsInSubcollection reports whether comments are stored in a subcollection
+func (fc *FirestoreClient) commentsInSubcollection() bool {
+	return fc.commentsStorage == CommentsSubcollection
+}
+
+// commentsBatchSize is the most alerts whose comments are read by one
+// collection group query, the limit on values in a Firestore "in" filter
+const commentsBatchSize = 30
+
+// commentDoc is a comment as stored in a subcollection. AlertPath lets the
+// comments of many alerts be read with one collection group query.
+type commentDoc struct {
+	models.Comment
+	AlertPath string `firestore:"alert_path"`
+}
+
+// commentDocID identifies a comment by its report time and text, so the same
+// comment seen on later scrapes overwrites its own document
+func commentDocID(comment models.Comment) string {
+	h := fnv.New32a()
+	h.Write([]byte(comment.Text))
+	return fmt.Sprintf("%d_%08x", comment.ReportMillis, h.Sum32())
+}
+
+// saveComments writes the comments reported after afterMillis to the alert's
+// comment subcollection, then deletes all but the most recent MaxComments
+func (fc *FirestoreClient) saveComments(ctx context.Context, docRef *firestore.DocumentRef, comments []models.Comment, afterMillis int64) error {
+	saved := 0
+	for _, comment := range comments {
+		if comment.ReportMillis <= afterMillis {
+			continue
+		}
+		doc := commentDoc{Comment: comment, AlertPath: docRef.Path}
+		if _, err := docRef.Collection(commentsCollection).Doc(commentDocID(comment)).Set(ctx, doc); err != nil {
+			return fmt.Errorf("failed to save comment: %w", err)
+		}
+		saved++
+	}
+	if saved == 0 || fc.maxComments < 1 {
+		return nil
+	}
+
+	stale, err := docRef.Collection(commentsCollection).
+		OrderBy("report_millis", firestore.Desc).
+		Offset(fc.maxComments).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to find old comments: %w", err)
+	}
+	for _, doc := range stale {
+		if _, err := doc.Ref.Delete(ctx); err != nil {
+			return fmt.Errorf("failed to delete old comment %s: %w", doc.Ref.ID, err)
+		}
+	}
+	return nil
+}
+
+// loadComments reads the most recent comments from an alert's comment
+// subcollection, oldest first as they are stored inline
+func (fc *FirestoreClient) loadComments(ctx context.Context, docRef *firestore.DocumentRef) ([]models.Comment, error) {
+	query := docRef.Collection(commentsCollection).OrderBy("report_millis", firestore.Desc)
+	if fc.maxComments > 0 {
+		query = query.Limit(fc.maxComments)
+	}
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load comments: %w", err)
+	}
+	if len(docs) == 0 {
+		return nil, nil
+	}
+
+	comments := make([]models.Comment, len(docs))
+	for i, doc := range docs {
+		if err := doc.DataTo(&comments[len(docs)-1-i]); err != nil {
+			return nil, fmt.Errorf("failed to parse comment %s: %w", doc.Ref.ID, err)
+		}
+	}
+	return comments, nil
+}
+
+// decodeAlerts parses alert documents, skipping any that cannot be parsed, and
+// returns each alert with its document reference
+func decodeAlerts(docs []*firestore.DocumentSnapshot) ([]models.PoliceAlert, []*firestore.DocumentRef) {
+	alerts := make([]models.PoliceAlert, 0, len(docs))
+	refs := make([]*firestore.DocumentRef, 0, len(docs))
+	for _, doc := range docs {
+		var alert models.PoliceAlert
+		if err := doc.DataTo(&alert); err != nil {
+			logging.Warnf("Failed to parse alert %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		alert.SourcePath = relativeDocPath(doc.Ref)
+		alerts = append(alerts, alert)
+		refs = append(refs, doc.Ref)
+	}
+	return alerts, refs
+}
+
+// relativeDocPath returns the path of a document relative to its database,
+// e.g. "police_alerts/<id>" for "projects/p/databases/(default)/documents/police_alerts/<id>"
+func relativeDocPath(ref *firestore.DocumentRef) string {
+	if i := strings.Index(ref.Path, "/documents/"); i >= 0 {
+		return ref.Path[i+len("/documents/"):]
+	}
+	return ref.Path
+}
+
+// attachComments fills in the comments of alerts, stored at refs, from their
+// subcollections when comments are stored there. Comments are read with one
+// collection group query per commentsBatchSize alerts. Alerts with no
+// subcollection comments keep any written inline before the mode was
+// switched, and alerts whose comment documents predate alert_path are read one
+// by one.
+func (fc *FirestoreClient) attachComments(ctx context.Context, alerts []models.PoliceAlert, refs []*firestore.DocumentRef) error {
+	if !fc.commentsInSubcollection() || len(refs) == 0 {
+		return nil
+	}
+
+	byAlert := make(map[string][]models.Comment)
+	for start := 0; start < len(refs); start += commentsBatchSize {
+		batch := refs[start:min(start+commentsBatchSize, len(refs))]
+		paths := make([]string, len(batch))
+		for i, ref := range batch {
+			paths[i] = ref.Path
+		}
+		docs, err := fc.client.CollectionGroup(commentsCollection).
+			Where("alert_path", "in", paths).
+			Documents(ctx).GetAll()
+		if err != nil {
+			return fmt.Errorf("failed to load comments: %w", missingIndex(err))
+		}
+		for _, doc := range docs {
+			var comment commentDoc
+			if err := doc.DataTo(&comment); err != nil {
+				return fmt.Errorf("failed to parse comment %s: %w", doc.Ref.ID, err)
+			}
+			byAlert[comment.AlertPath] = append(byAlert[comment.AlertPath], comment.Comment)
+		}
+	}
+
+	for i, ref := range refs {
+		comments := byAlert[ref.Path]
+		switch {
+		case len(comments) > 0:
+			alerts[i].Comments = latestComments(comments, fc.maxComments)
+		case len(alerts[i].Comments) > 0:
+			// Stored inline before comments moved to subcollections
+		case alerts[i].LastVerificationMillis != nil:
+			// Commented on, but its comment documents have no alert_path
+			loaded, err := fc.loadComments(ctx, ref)
+			if err != nil {
+				return err
+			}
+			alerts[i].Comments = loaded
+		}
+	}
+	return nil
+}
+
+// latestComments sorts comments oldest first and returns the most recent n
+// (all of them when n < 1)
+func latestComments(comments []models.Comment, n int) []models.Comment {
+	sort.Slice(comments, func(i, j int) bool {
+		return comments[i].ReportMillis < comments[j].ReportMillis
+	})
+	if n > 0 && len(comments) > n {
+		comments = comments[len(comments)-n:]
+	}
+	return comments
+}
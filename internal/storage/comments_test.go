@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+)
+
+func TestCommentDocID(t *testing.T) {
+	a := models.Comment{ReportMillis: 1704067200000, Text: "Still there!"}
+	b := models.Comment{ReportMillis: 1704067200000, Text: "Gone now"}
+
+	if commentDocID(a) != commentDocID(a) {
+		t.Error("Expected the same comment to get the same ID")
+	}
+	if commentDocID(a) == commentDocID(b) {
+		t.Errorf("Expected comments with different text to get different IDs, both got %q", commentDocID(a))
+	}
+	later := a
+	later.ReportMillis++
+	if commentDocID(a) == commentDocID(later) {
+		t.Errorf("Expected comments at different times to get different IDs, both got %q", commentDocID(a))
+	}
+}
+
+func TestWithCommentsStorage(t *testing.T) {
+	fc := &FirestoreClient{}
+	if fc.commentsInSubcollection() {
+		t.Error("Expected comments inline by default")
+	}
+	WithCommentsStorage(CommentsInline)(fc)
+	if fc.commentsInSubcollection() {
+		t.Error("Expected comments inline with CommentsInline")
+	}
+	WithCommentsStorage(CommentsSubcollection)(fc)
+	if !fc.commentsInSubcollection() {
+		t.Error("Expected comments in a subcollection with CommentsSubcollection")
+	}
+}
+
+func TestLatestComments(t *testing.T) {
+	comments := []models.Comment{
+		{ReportMillis: 3, Text: "third"},
+		{ReportMillis: 1, Text: "first"},
+		{ReportMillis: 4, Text: "fourth"},
+		{ReportMillis: 2, Text: "second"},
+	}
+
+	got := latestComments(append([]models.Comment(nil), comments...), 2)
+	if len(got) != 2 || got[0].Text != "third" || got[1].Text != "fourth" {
+		t.Errorf("Expected the 2 most recent comments oldest first, got %+v", got)
+	}
+
+	got = latestComments(append([]models.Comment(nil), comments...), 0)
+	if len(got) != 4 || got[0].Text != "first" || got[3].Text != "fourth" {
+		t.Errorf("Expected every comment oldest first, got %+v", got)
+	}
+}
+
+func TestRelativeDocPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"projects/p/databases/(default)/documents/police_alerts/a1_2024-01-02", "police_alerts/a1_2024-01-02"},
+		{"projects/p/databases/(default)/documents/police_alerts/a1/comments/c1", "police_alerts/a1/comments/c1"},
+		{"police_alerts/a1", "police_alerts/a1"},
+	}
+
+	for _, tt := range tests {
+		if got := relativeDocPath(&firestore.DocumentRef{Path: tt.path}); got != tt.want {
+			t.Errorf("relativeDocPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
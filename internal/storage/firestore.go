@@ -8,19 +8,142 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
+	"strings"
+	"sync"
 
 	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// DefaultMaxComments is the default number of comments stored per alert
+const DefaultMaxComments = 50
+
+// DefaultMaxFilterValues is the default number of values allowed in each
+// subtype, street or city filter list
+const DefaultMaxFilterValues = 100
+
 // FirestoreClient handles all Firestore operations
 type FirestoreClient struct {
-	client         *firestore.Client
-	collectionName string
+	client          *firestore.Client
+	collectionName  string
+	maxComments     int
+	storeSubtypes   map[string]bool // nil stores all POLICE subtypes
+	compositeIDs    bool            // key documents by UUID + publish day
+	sourceBBox      bool            // store the bbox that first returned each alert
+	normalizeNames  bool            // match street and city filters by normalized name
+	commentsStorage string          // CommentsInline (or empty) or CommentsSubcollection
+	fingerprints    bool            // store a fingerprint of each alert's immutable fields
+	maxFilterValues int             // values allowed per filter list (zero allows any number)
+	peakReliability bool            // track the highest reliability and confidence seen
+	revision        string          // stored as scraped_by_revision on saved alerts (empty disables)
+
+	// legacyDocs maps composite document IDs to the legacy UUID-keyed documents
+	// they resolved to, so each scrape reads those with one Get. Only alerts
+	// saved before composite IDs were enabled are added, so it stays small.
+	legacyDocs sync.Map
+}
+
+// Option configures optional FirestoreClient behaviour
+type Option func(*FirestoreClient)
+
+// WithMaxComments caps the number of comments stored per alert. Only the most
+// recent n comments (by ReportMillis) are kept; n < 1 keeps the default.
+func WithMaxComments(n int) Option {
+	return func(fc *FirestoreClient) {
+		if n > 0 {
+			fc.maxComments = n
+		}
+	}
+}
+
+// WithMaxFilterValues caps the number of values in each subtype, street or
+// city filter list, so one query cannot make every alert be compared against
+// thousands of values. n < 1 keeps the default.
+func WithMaxFilterValues(n int) Option {
+	return func(fc *FirestoreClient) {
+		if n > 0 {
+			fc.maxFilterValues = n
+		}
+	}
+}
+
+// WithStoreSubtypes restricts saved POLICE alerts to the given subtypes.
+// An empty list stores all subtypes.
+func WithStoreSubtypes(subtypes []string) Option {
+	return func(fc *FirestoreClient) {
+		if len(subtypes) == 0 {
+			fc.storeSubtypes = nil
+			return
+		}
+		fc.storeSubtypes = make(map[string]bool, len(subtypes))
+		for _, subtype := range subtypes {
+			fc.storeSubtypes[subtype] = true
+		}
+	}
+}
+
+// WithCompositeIDs keys new alert documents by UUID plus Canberra publish day
+// (e.g. "abc-123_2024-01-15") instead of the UUID alone, so a UUID reused by
+// Waze on a later day starts a new document rather than overwriting the old
+// one's history. Existing UUID-keyed documents for the same publish day are
+// still updated in place.
+func WithCompositeIDs(enabled bool) Option {
+	return func(fc *FirestoreClient) {
+		fc.compositeIDs = enabled
+	}
+}
+
+// WithSourceBBox stores the bounding box that first returned each new alert
+// as source_bbox, for debugging scrape coverage
+func WithSourceBBox(enabled bool) Option {
+	return func(fc *FirestoreClient) {
+		fc.sourceBBox = enabled
+	}
+}
+
+// WithFingerprints stores a deterministic fingerprint of each alert's
+// immutable fields as fingerprint, for joins with other systems and
+// idempotent re-ingest. Existing alerts without one gain it on their next update.
+func WithFingerprints(enabled bool) Option {
+	return func(fc *FirestoreClient) {
+		fc.fingerprints = enabled
+	}
+}
+
+// WithPeakReliability stores the highest reliability and confidence any scrape
+// reported for an alert as reliability_max and confidence_max, while reliability
+// and confidence keep the values first scraped. Existing alerts without peaks
+// start from their stored initial values on their next update.
+func WithPeakReliability(enabled bool) Option {
+	return func(fc *FirestoreClient) {
+		fc.peakReliability = enabled
+	}
+}
+
+// WithRevision stores revision as scraped_by_revision on every alert the
+// client creates or updates, so data problems can be traced to the deploy
+// that wrote them. An empty revision stores nothing.
+func WithRevision(revision string) Option {
+	return func(fc *FirestoreClient) {
+		fc.revision = revision
+	}
+}
+
+// WithNormalizedFilters makes street and city filters ignore case, extra
+// whitespace and common road abbreviations, so "hume hwy" matches
+// "Hume Highway". Filters are exact matches by default.
+func WithNormalizedFilters(enabled bool) Option {
+	return func(fc *FirestoreClient) {
+		fc.normalizeNames = enabled
+	}
 }
 
 // NewFirestoreClient creates a new Firestore client
-func NewFirestoreClient(ctx context.Context, projectID, collectionName string) (*FirestoreClient, error) {
+func NewFirestoreClient(ctx context.Context, projectID, collectionName string, opts ...Option) (*FirestoreClient, error) {
 	client, err := firestore.NewClient(ctx, projectID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create firestore client: %w", err)
@@ -31,10 +154,86 @@ func NewFirestoreClient(ctx context.Context, projectID, collectionName string) (
 		collectionName = "police_alerts"
 	}
 
-	return &FirestoreClient{
-		client:         client,
-		collectionName: collectionName,
-	}, nil
+	fc := &FirestoreClient{
+		client:          client,
+		collectionName:  collectionName,
+		maxComments:     DefaultMaxComments,
+		maxFilterValues: DefaultMaxFilterValues,
+	}
+	for _, opt := range opts {
+		opt(fc)
+	}
+
+	return fc, nil
+}
+
+// Ping performs a cheap read against the collection to validate connectivity and
+// credentials. NewFirestoreClient succeeds even with bad credentials because the
+// error only surfaces on first use, so services can call this at startup to fail fast.
+func (fc *FirestoreClient) Ping(ctx context.Context) error {
+	_, err := fc.client.Collection(fc.collectionName).Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return fmt.Errorf("firestore ping failed for collection %s: %w", fc.collectionName, err)
+	}
+	return nil
+}
+
+// IsUnavailable reports whether err indicates Firestore itself could not be
+// reached (service unavailable or timed out), as opposed to a bad query.
+// Wrapped errors are unwrapped.
+func IsUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &grpcErr) {
+		switch grpcErr.GRPCStatus().Code() {
+		case codes.Unavailable, codes.DeadlineExceeded:
+			return true
+		}
+	}
+	return false
+}
+
+// indexURLPattern matches the index-creation link Firestore includes when it
+// rejects a query for a missing composite index
+var indexURLPattern = regexp.MustCompile(`https://console\.firebase\.google\.com/\S+`)
+
+// MissingIndexError reports a query Firestore rejected with FailedPrecondition
+// because it needs a composite index that has not been created
+type MissingIndexError struct {
+	URL string // index-creation link, empty if Firestore did not include one
+	Err error
+}
+
+func (e *MissingIndexError) Error() string {
+	if e.URL == "" {
+		return "firestore query requires a missing composite index; add it to firestore.indexes.json and deploy"
+	}
+	return "firestore query requires a missing composite index; create it at " + e.URL
+}
+
+func (e *MissingIndexError) Unwrap() error {
+	return e.Err
+}
+
+// missingIndex wraps err in a MissingIndexError when Firestore rejected the
+// query for a missing index, and returns any other error unchanged.
+// FailedPrecondition is also used for unrelated failures, so the message must
+// mention an index.
+func missingIndex(err error) error {
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &grpcErr) || grpcErr.GRPCStatus().Code() != codes.FailedPrecondition {
+		return err
+	}
+	msg := grpcErr.GRPCStatus().Message()
+	if !strings.Contains(strings.ToLower(msg), "index") {
+		return err
+	}
+	return &MissingIndexError{URL: indexURLPattern.FindString(msg), Err: err}
 }
 
 // Close closes the Firestore client
@@ -16,8 +16,12 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"math"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -114,6 +118,12 @@ func createTestWazeAlert(uuid string, alertType string, overrides map[string]int
 	if v, ok := overrides["NThumbsUp"].(int); ok {
 		alert.NThumbsUp = v
 	}
+	if v, ok := overrides["Reliability"].(int); ok {
+		alert.Reliability = v
+	}
+	if v, ok := overrides["Confidence"].(int); ok {
+		alert.Confidence = v
+	}
 	if v, ok := overrides["Comments"].([]models.Comment); ok {
 		alert.Comments = v
 	}
@@ -141,7 +151,7 @@ func TestIntegration_SavePoliceAlerts_NewAlert(t *testing.T) {
 	scrapeTime := time.Now()
 
 	// Save the alert
-	err := h.client.SavePoliceAlerts(h.ctx, alerts, scrapeTime)
+	_, err := h.client.SavePoliceAlerts(h.ctx, alerts, scrapeTime)
 	if err != nil {
 		t.Fatalf("SavePoliceAlerts failed: %v", err)
 	}
@@ -192,10 +202,13 @@ func TestIntegration_SavePoliceAlerts_FiltersNonPolice(t *testing.T) {
 		createTestWazeAlert("hazard-001", "HAZARD", nil),
 	}
 
-	err := h.client.SavePoliceAlerts(h.ctx, alerts, time.Now())
+	saved, err := h.client.SavePoliceAlerts(h.ctx, alerts, time.Now())
 	if err != nil {
 		t.Fatalf("SavePoliceAlerts failed: %v", err)
 	}
+	if saved != 2 {
+		t.Errorf("Expected SavePoliceAlerts to report 2 saved, got %d", saved)
+	}
 
 	// Count documents in collection
 	docs, err := h.client.client.Collection(h.collectionName).Documents(h.ctx).GetAll()
@@ -240,7 +253,7 @@ func TestIntegration_SavePoliceAlerts_UpdatesExisting(t *testing.T) {
 	}
 
 	scrapeTime1 := time.Now().Add(-1 * time.Hour)
-	err := h.client.SavePoliceAlerts(h.ctx, alerts1, scrapeTime1)
+	_, err := h.client.SavePoliceAlerts(h.ctx, alerts1, scrapeTime1)
 	if err != nil {
 		t.Fatalf("First SavePoliceAlerts failed: %v", err)
 	}
@@ -254,7 +267,7 @@ func TestIntegration_SavePoliceAlerts_UpdatesExisting(t *testing.T) {
 	}
 
 	scrapeTime2 := time.Now()
-	err = h.client.SavePoliceAlerts(h.ctx, alerts2, scrapeTime2)
+	_, err = h.client.SavePoliceAlerts(h.ctx, alerts2, scrapeTime2)
 	if err != nil {
 		t.Fatalf("Second SavePoliceAlerts failed: %v", err)
 	}
@@ -295,7 +308,7 @@ func TestIntegration_SavePoliceAlerts_EmptyList(t *testing.T) {
 	defer h.cleanup()
 
 	// Save empty list - should not error
-	err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{}, time.Now())
+	_, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{}, time.Now())
 	if err != nil {
 		t.Fatalf("SavePoliceAlerts with empty list should not error: %v", err)
 	}
@@ -321,7 +334,7 @@ func TestIntegration_SavePoliceAlerts_WithVerificationComments(t *testing.T) {
 		}),
 	}
 
-	err := h.client.SavePoliceAlerts(h.ctx, alerts, time.Now())
+	_, err := h.client.SavePoliceAlerts(h.ctx, alerts, time.Now())
 	if err != nil {
 		t.Fatalf("SavePoliceAlerts failed: %v", err)
 	}
@@ -339,6 +352,100 @@ func TestIntegration_SavePoliceAlerts_WithVerificationComments(t *testing.T) {
 	}
 }
 
+func TestIntegration_SavePoliceAlerts_CapsStoredComments(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.cleanup()
+	h.client.maxComments = 2
+
+	base := time.Now().Add(-30 * time.Minute).UnixMilli()
+	alerts := []models.WazeAlert{
+		createTestWazeAlert("capped-001", "POLICE", map[string]interface{}{
+			"Comments": []models.Comment{
+				{ReportMillis: base + 2000, Text: "third"},
+				{ReportMillis: base, Text: "first"},
+				{ReportMillis: base + 1000, Text: "second"},
+			},
+		}),
+	}
+
+	if _, err := h.client.SavePoliceAlerts(h.ctx, alerts, time.Now()); err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+
+	doc, err := h.client.client.Collection(h.collectionName).Doc("capped-001").Get(h.ctx)
+	if err != nil {
+		t.Fatalf("Failed to get document: %v", err)
+	}
+
+	var stored models.PoliceAlert
+	if err := doc.DataTo(&stored); err != nil {
+		t.Fatalf("Failed to parse document: %v", err)
+	}
+
+	if !stored.CommentsTruncated {
+		t.Error("Expected comments_truncated to be true")
+	}
+	if len(stored.Comments) != 2 || stored.Comments[0].Text != "second" || stored.Comments[1].Text != "third" {
+		t.Errorf("Expected newest 2 comments [second third], got %+v", stored.Comments)
+	}
+}
+
+func TestIntegration_SavePoliceAlerts_StoreSubtypesAllowlist(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.cleanup()
+	WithStoreSubtypes([]string{"POLICE_VISIBLE", "POLICE_HIDING"})(h.client)
+
+	alerts := []models.WazeAlert{
+		createTestWazeAlert("allow-visible", "POLICE", map[string]interface{}{"Subtype": "POLICE_VISIBLE"}),
+		createTestWazeAlert("allow-hiding", "POLICE", map[string]interface{}{"Subtype": "POLICE_HIDING"}),
+		createTestWazeAlert("drop-camera", "POLICE", map[string]interface{}{"Subtype": "POLICE_WITH_MOBILE_CAMERA"}),
+		createTestWazeAlert("drop-empty", "POLICE", map[string]interface{}{"Subtype": ""}),
+		createTestWazeAlert("drop-jam", "JAM", map[string]interface{}{"Subtype": "POLICE_VISIBLE"}),
+	}
+
+	count, err := h.client.SavePoliceAlerts(h.ctx, alerts, time.Now())
+	if err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected SavePoliceAlerts to report 2 saved, got %d", count)
+	}
+
+	docs, err := h.client.client.Collection(h.collectionName).Documents(h.ctx).GetAll()
+	if err != nil {
+		t.Fatalf("Failed to list documents: %v", err)
+	}
+
+	saved := make(map[string]bool)
+	for _, doc := range docs {
+		saved[doc.Ref.ID] = true
+	}
+
+	if len(saved) != 2 || !saved["allow-visible"] || !saved["allow-hiding"] {
+		t.Errorf("Expected only allow-visible and allow-hiding to be saved, got %v", saved)
+	}
+}
+
+func TestIntegration_SavePoliceAlerts_DefaultStoresAllSubtypes(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.cleanup()
+
+	alerts := []models.WazeAlert{
+		createTestWazeAlert("all-visible", "POLICE", map[string]interface{}{"Subtype": "POLICE_VISIBLE"}),
+		createTestWazeAlert("all-hiding", "POLICE", map[string]interface{}{"Subtype": "POLICE_HIDING"}),
+		createTestWazeAlert("all-camera", "POLICE", map[string]interface{}{"Subtype": "POLICE_WITH_MOBILE_CAMERA"}),
+	}
+
+	if _, err := h.client.SavePoliceAlerts(h.ctx, alerts, time.Now()); err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+
+	docs, _ := h.client.client.Collection(h.collectionName).Documents(h.ctx).GetAll()
+	if len(docs) != 3 {
+		t.Errorf("Expected 3 documents without an allowlist, got %d", len(docs))
+	}
+}
+
 // =============================================================================
 // GetPoliceAlertsByDateRange Tests
 // =============================================================================
@@ -365,7 +472,7 @@ func TestIntegration_GetPoliceAlertsByDateRange_ReturnsActiveAlerts(t *testing.T
 	}
 
 	// Save alerts (sets expire_time to scrape time)
-	err := h.client.SavePoliceAlerts(h.ctx, alerts, now)
+	_, err := h.client.SavePoliceAlerts(h.ctx, alerts, now)
 	if err != nil {
 		t.Fatalf("SavePoliceAlerts failed: %v", err)
 	}
@@ -396,7 +503,7 @@ func TestIntegration_GetPoliceAlertsByDateRange_EmptyResult(t *testing.T) {
 		}),
 	}
 
-	err := h.client.SavePoliceAlerts(h.ctx, alerts, time.Now())
+	_, err := h.client.SavePoliceAlerts(h.ctx, alerts, time.Now())
 	if err != nil {
 		t.Fatalf("SavePoliceAlerts failed: %v", err)
 	}
@@ -442,7 +549,7 @@ func TestIntegration_GetPoliceAlertsByDatesWithFilters_SubtypeFilter(t *testing.
 		}),
 	}
 
-	err := h.client.SavePoliceAlerts(h.ctx, alerts, now)
+	_, err := h.client.SavePoliceAlerts(h.ctx, alerts, now)
 	if err != nil {
 		t.Fatalf("SavePoliceAlerts failed: %v", err)
 	}
@@ -452,8 +559,7 @@ func TestIntegration_GetPoliceAlertsByDatesWithFilters_SubtypeFilter(t *testing.
 	results, err := h.client.GetPoliceAlertsByDatesWithFilters(
 		h.ctx,
 		[]string{today},
-		[]string{"POLICE_VISIBLE", "POLICE_HIDING"}, // Filter to 2 subtypes
-		[]string{}, // No street filter
+		models.AlertFilters{Subtypes: []string{"POLICE_VISIBLE", "POLICE_HIDING"}}, // Filter to 2 subtypes
 	)
 	if err != nil {
 		t.Fatalf("GetPoliceAlertsByDatesWithFilters failed: %v", err)
@@ -502,7 +608,7 @@ func TestIntegration_GetPoliceAlertsByDatesWithFilters_StreetFilter(t *testing.T
 		}),
 	}
 
-	err := h.client.SavePoliceAlerts(h.ctx, alerts, now)
+	_, err := h.client.SavePoliceAlerts(h.ctx, alerts, now)
 	if err != nil {
 		t.Fatalf("SavePoliceAlerts failed: %v", err)
 	}
@@ -512,8 +618,7 @@ func TestIntegration_GetPoliceAlertsByDatesWithFilters_StreetFilter(t *testing.T
 	results, err := h.client.GetPoliceAlertsByDatesWithFilters(
 		h.ctx,
 		[]string{today},
-		[]string{},               // No subtype filter
-		[]string{"Hume Highway"}, // Only Hume Highway
+		models.AlertFilters{Streets: []string{"Hume Highway"}}, // Only Hume Highway
 	)
 	if err != nil {
 		t.Fatalf("GetPoliceAlertsByDatesWithFilters failed: %v", err)
@@ -528,6 +633,121 @@ func TestIntegration_GetPoliceAlertsByDatesWithFilters_StreetFilter(t *testing.T
 	}
 }
 
+func TestIntegration_GetPoliceAlertsByDatesWithFilters_CityFilter(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.cleanup()
+
+	now := time.Now()
+
+	// Create alerts in different cities, two of them in Canberra
+	alerts := []models.WazeAlert{
+		createTestWazeAlert("canberra-001", "POLICE", map[string]interface{}{
+			"City":      "Canberra",
+			"PubMillis": now.Add(-1 * time.Hour).UnixMilli(),
+		}),
+		createTestWazeAlert("canberra-002", "POLICE", map[string]interface{}{
+			"City":      "Canberra",
+			"PubMillis": now.Add(-30 * time.Minute).UnixMilli(),
+		}),
+		createTestWazeAlert("sydney-001", "POLICE", map[string]interface{}{
+			"City":      "Sydney",
+			"PubMillis": now.Add(-1 * time.Hour).UnixMilli(),
+		}),
+		createTestWazeAlert("goulburn-001", "POLICE", map[string]interface{}{
+			"City":      "Goulburn",
+			"PubMillis": now.Add(-1 * time.Hour).UnixMilli(),
+		}),
+	}
+
+	_, err := h.client.SavePoliceAlerts(h.ctx, alerts, now)
+	if err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+
+	// Query with city filter
+	today := now.Format("2006-01-02")
+	results, err := h.client.GetPoliceAlertsByDatesWithFilters(
+		h.ctx,
+		[]string{today},
+		models.AlertFilters{Cities: []string{"Canberra"}}, // Only Canberra
+	)
+	if err != nil {
+		t.Fatalf("GetPoliceAlertsByDatesWithFilters failed: %v", err)
+	}
+
+	if len(results) != 2 {
+		t.Errorf("Expected 2 alerts (Canberra only), got %d", len(results))
+	}
+
+	for _, alert := range results {
+		if alert.City != "Canberra" {
+			t.Errorf("Expected city 'Canberra', got %q for alert %s", alert.City, alert.UUID)
+		}
+	}
+}
+
+func TestIntegration_GetPoliceAlertsByDatesWithFilters_StreetPresence(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.cleanup()
+
+	now := time.Now()
+
+	// Create alerts on named and unnamed roads
+	alerts := []models.WazeAlert{
+		createTestWazeAlert("named-001", "POLICE", map[string]interface{}{
+			"Street":    "Hume Highway",
+			"PubMillis": now.Add(-1 * time.Hour).UnixMilli(),
+		}),
+		createTestWazeAlert("named-002", "POLICE", map[string]interface{}{
+			"Street":    "Federal Highway",
+			"PubMillis": now.Add(-1 * time.Hour).UnixMilli(),
+		}),
+		createTestWazeAlert("unnamed-001", "POLICE", map[string]interface{}{
+			"Street":    "",
+			"PubMillis": now.Add(-1 * time.Hour).UnixMilli(),
+		}),
+	}
+
+	_, err := h.client.SavePoliceAlerts(h.ctx, alerts, now)
+	if err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+
+	today := now.Format("2006-01-02")
+	tests := []struct {
+		name      string
+		filters   models.AlertFilters
+		wantUUIDs map[string]bool
+	}{
+		{"only named", models.AlertFilters{StreetPresence: models.PresenceNamed}, map[string]bool{"named-001": true, "named-002": true}},
+		{"only unnamed", models.AlertFilters{StreetPresence: models.PresenceUnnamed}, map[string]bool{"unnamed-001": true}},
+		{"named combined with street filter", models.AlertFilters{Streets: []string{"Hume Highway"}, StreetPresence: models.PresenceNamed}, map[string]bool{"named-001": true}},
+		{"any", models.AlertFilters{}, map[string]bool{"named-001": true, "named-002": true, "unnamed-001": true}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := h.client.GetPoliceAlertsByDatesWithFilters(h.ctx, []string{today}, tc.filters)
+			if err != nil {
+				t.Fatalf("GetPoliceAlertsByDatesWithFilters failed: %v", err)
+			}
+			if len(results) != len(tc.wantUUIDs) {
+				t.Errorf("Expected %d alerts, got %d", len(tc.wantUUIDs), len(results))
+			}
+			for _, alert := range results {
+				if !tc.wantUUIDs[alert.UUID] {
+					t.Errorf("Unexpected alert %s (street %q)", alert.UUID, alert.Street)
+				}
+			}
+		})
+	}
+
+	_, err = h.client.GetPoliceAlertsByDatesWithFilters(h.ctx, []string{today}, models.AlertFilters{StreetPresence: "sometimes"})
+	if err == nil {
+		t.Error("Expected an error for an invalid street presence")
+	}
+}
+
 func TestIntegration_GetPoliceAlertsByDatesWithFilters_MultipleDates(t *testing.T) {
 	h := newTestHelper(t)
 	defer h.cleanup()
@@ -541,7 +761,7 @@ func TestIntegration_GetPoliceAlertsByDatesWithFilters_MultipleDates(t *testing.
 			"PubMillis": yesterday.UnixMilli(),
 		}),
 	}
-	err := h.client.SavePoliceAlerts(h.ctx, alertsYesterday, yesterday.Add(1*time.Hour))
+	_, err := h.client.SavePoliceAlerts(h.ctx, alertsYesterday, yesterday.Add(1*time.Hour))
 	if err != nil {
 		t.Fatalf("SavePoliceAlerts (yesterday) failed: %v", err)
 	}
@@ -552,7 +772,7 @@ func TestIntegration_GetPoliceAlertsByDatesWithFilters_MultipleDates(t *testing.
 			"PubMillis": now.Add(-1 * time.Hour).UnixMilli(),
 		}),
 	}
-	err = h.client.SavePoliceAlerts(h.ctx, alertsToday, now)
+	_, err = h.client.SavePoliceAlerts(h.ctx, alertsToday, now)
 	if err != nil {
 		t.Fatalf("SavePoliceAlerts (today) failed: %v", err)
 	}
@@ -564,8 +784,7 @@ func TestIntegration_GetPoliceAlertsByDatesWithFilters_MultipleDates(t *testing.
 	results, err := h.client.GetPoliceAlertsByDatesWithFilters(
 		h.ctx,
 		[]string{yesterdayStr, todayStr},
-		[]string{},
-		[]string{},
+		models.AlertFilters{},
 	)
 	if err != nil {
 		t.Fatalf("GetPoliceAlertsByDatesWithFilters failed: %v", err)
@@ -591,7 +810,7 @@ func TestIntegration_GetPoliceAlertsByDatesWithFilters_DeduplicatesAcrossDates(t
 	}
 
 	// Save with current time (so it's "active" from yesterday to now)
-	err := h.client.SavePoliceAlerts(h.ctx, alerts, now)
+	_, err := h.client.SavePoliceAlerts(h.ctx, alerts, now)
 	if err != nil {
 		t.Fatalf("SavePoliceAlerts failed: %v", err)
 	}
@@ -603,8 +822,7 @@ func TestIntegration_GetPoliceAlertsByDatesWithFilters_DeduplicatesAcrossDates(t
 	results, err := h.client.GetPoliceAlertsByDatesWithFilters(
 		h.ctx,
 		[]string{yesterdayStr, todayStr},
-		[]string{},
-		[]string{},
+		models.AlertFilters{},
 	)
 	if err != nil {
 		t.Fatalf("GetPoliceAlertsByDatesWithFilters failed: %v", err)
@@ -627,8 +845,7 @@ func TestIntegration_GetPoliceAlertsByDatesWithFilters_EmptyDatesError(t *testin
 	_, err := h.client.GetPoliceAlertsByDatesWithFilters(
 		h.ctx,
 		[]string{}, // Empty dates
-		[]string{},
-		[]string{},
+		models.AlertFilters{},
 	)
 
 	if err == nil {
@@ -655,7 +872,7 @@ func TestIntegration_GetPoliceAlertsByDatesWithFilters_NoFiltersReturnsAll(t *te
 		}),
 	}
 
-	err := h.client.SavePoliceAlerts(h.ctx, alerts, now)
+	_, err := h.client.SavePoliceAlerts(h.ctx, alerts, now)
 	if err != nil {
 		t.Fatalf("SavePoliceAlerts failed: %v", err)
 	}
@@ -665,8 +882,7 @@ func TestIntegration_GetPoliceAlertsByDatesWithFilters_NoFiltersReturnsAll(t *te
 	results, err := h.client.GetPoliceAlertsByDatesWithFilters(
 		h.ctx,
 		[]string{today},
-		[]string{}, // No subtype filter
-		[]string{}, // No street filter
+		models.AlertFilters{}, // No filters
 	)
 	if err != nil {
 		t.Fatalf("GetPoliceAlertsByDatesWithFilters failed: %v", err)
@@ -692,7 +908,7 @@ func TestIntegration_SavePoliceAlerts_ContinuesOnIndividualError(t *testing.T) {
 		createTestWazeAlert("valid-003", "POLICE", nil),
 	}
 
-	err := h.client.SavePoliceAlerts(h.ctx, alerts, time.Now())
+	_, err := h.client.SavePoliceAlerts(h.ctx, alerts, time.Now())
 	if err != nil {
 		t.Fatalf("SavePoliceAlerts failed: %v", err)
 	}
@@ -745,7 +961,7 @@ func TestIntegration_SavePoliceAlerts_PreservesAllFields(t *testing.T) {
 	}
 
 	scrapeTime := time.Now()
-	err := h.client.SavePoliceAlerts(h.ctx, alerts, scrapeTime)
+	_, err := h.client.SavePoliceAlerts(h.ctx, alerts, scrapeTime)
 	if err != nil {
 		t.Fatalf("SavePoliceAlerts failed: %v", err)
 	}
@@ -810,7 +1026,7 @@ func TestIntegration_SavePoliceAlerts_ConcurrentUpdates(t *testing.T) {
 
 	// First scrape - create the alert
 	scrapeTime1 := time.Now().Add(-30 * time.Minute)
-	err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{baseAlert}, scrapeTime1)
+	_, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{baseAlert}, scrapeTime1)
 	if err != nil {
 		t.Fatalf("Initial SavePoliceAlerts failed: %v", err)
 	}
@@ -826,7 +1042,7 @@ func TestIntegration_SavePoliceAlerts_ConcurrentUpdates(t *testing.T) {
 				"NThumbsUp": thumbsUp,
 			})
 			scrapeTime := time.Now().Add(time.Duration(thumbsUp) * time.Millisecond)
-			err := h.client.SavePoliceAlerts(context.Background(), []models.WazeAlert{alert}, scrapeTime)
+			_, err := h.client.SavePoliceAlerts(context.Background(), []models.WazeAlert{alert}, scrapeTime)
 			done <- err
 		}(i + 2)
 	}
@@ -906,7 +1122,7 @@ func TestIntegration_SavePoliceAlerts_LargeBatch(t *testing.T) {
 	// Save the large batch
 	scrapeTime := time.Now()
 	start := time.Now()
-	err := h.client.SavePoliceAlerts(h.ctx, alerts, scrapeTime)
+	_, err := h.client.SavePoliceAlerts(h.ctx, alerts, scrapeTime)
 	duration := time.Since(start)
 
 	if err != nil {
@@ -965,7 +1181,7 @@ func TestIntegration_GetPoliceAlertsByDateRange_LargeResult(t *testing.T) {
 
 	// Save all alerts
 	scrapeTime := time.Now()
-	err := h.client.SavePoliceAlerts(h.ctx, alerts, scrapeTime)
+	_, err := h.client.SavePoliceAlerts(h.ctx, alerts, scrapeTime)
 	if err != nil {
 		t.Fatalf("SavePoliceAlerts failed: %v", err)
 	}
@@ -1047,7 +1263,7 @@ func TestIntegration_SavePoliceAlerts_UnicodeStreets(t *testing.T) {
 	}
 
 	// Save all unicode alerts
-	err := h.client.SavePoliceAlerts(h.ctx, alerts, time.Now())
+	_, err := h.client.SavePoliceAlerts(h.ctx, alerts, time.Now())
 	if err != nil {
 		t.Fatalf("SavePoliceAlerts with unicode failed: %v", err)
 	}
@@ -1101,7 +1317,7 @@ func TestIntegration_GetPoliceAlertsByDatesWithFilters_UnicodeStreetFilter(t *te
 		}),
 	}
 
-	err := h.client.SavePoliceAlerts(h.ctx, alerts, time.Now())
+	_, err := h.client.SavePoliceAlerts(h.ctx, alerts, time.Now())
 	if err != nil {
 		t.Fatalf("SavePoliceAlerts failed: %v", err)
 	}
@@ -1122,8 +1338,7 @@ func TestIntegration_GetPoliceAlertsByDatesWithFilters_UnicodeStreetFilter(t *te
 		results, err := h.client.GetPoliceAlertsByDatesWithFilters(
 			h.ctx,
 			[]string{today},
-			[]string{}, // No subtype filter
-			[]string{tc.street},
+			models.AlertFilters{Streets: []string{tc.street}},
 		)
 
 		if err != nil {
@@ -1147,3 +1362,871 @@ func TestIntegration_GetPoliceAlertsByDatesWithFilters_UnicodeStreetFilter(t *te
 
 	t.Logf("Unicode street filtering working correctly")
 }
+
+// =============================================================================
+// Startup Ping Tests
+// =============================================================================
+
+func TestIntegration_Ping_Succeeds(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.cleanup()
+
+	ctx, cancel := context.WithTimeout(h.ctx, 5*time.Second)
+	defer cancel()
+
+	if err := h.client.Ping(ctx); err != nil {
+		t.Errorf("Expected ping to succeed, got: %v", err)
+	}
+}
+
+func TestIntegration_Ping_BadConfigReturnsError(t *testing.T) {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST not set, skipping integration test")
+	}
+
+	// Point the client at an address where no Firestore is listening
+	t.Setenv("FIRESTORE_EMULATOR_HOST", "localhost:1")
+
+	client, err := NewFirestoreClient(context.Background(), "nonexistent-project", "ping_test")
+	if err != nil {
+		t.Fatalf("Expected client creation to succeed lazily, got: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx); err == nil {
+		t.Error("Expected ping to fail for unreachable Firestore")
+	}
+}
+
+func TestIntegration_NewFirestoreClient_EmptyProjectReturnsError(t *testing.T) {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST not set, skipping integration test")
+	}
+
+	if _, err := NewFirestoreClient(context.Background(), "", "ping_test"); err == nil {
+		t.Error("Expected error for empty project ID")
+	}
+}
+
+// =============================================================================
+// Street Heatmap Tests
+// =============================================================================
+
+func TestIntegration_GetStreetHeatmap_CountsAndAveragesCoordinates(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.cleanup()
+
+	now := time.Now()
+	pub := now.Add(-1 * time.Hour).UnixMilli()
+
+	located := func(uuid, street string, lat, lng float64) models.WazeAlert {
+		alert := createTestWazeAlert(uuid, "POLICE", map[string]interface{}{
+			"Street":    street,
+			"PubMillis": pub,
+		})
+		alert.Location = models.Location{Latitude: lat, Longitude: lng}
+		return alert
+	}
+
+	alerts := []models.WazeAlert{
+		located("heat-hume-1", "Hume Highway", -35.0, 149.0),
+		located("heat-hume-2", "Hume Highway", -35.2, 149.2),
+		located("heat-hume-3", "Hume Highway", -35.4, 149.4),
+		located("heat-federal-1", "Federal Highway", -35.1, 149.1),
+		located("heat-federal-2", "Federal Highway", -35.3, 149.3),
+		located("heat-george-1", "George Street", -33.8, 151.2),
+	}
+
+	if _, err := h.client.SavePoliceAlerts(h.ctx, alerts, now); err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+
+	today := now.Format("2006-01-02")
+	streets, err := h.client.GetStreetHeatmap(h.ctx, []string{today, today})
+	if err != nil {
+		t.Fatalf("GetStreetHeatmap failed: %v", err)
+	}
+
+	expected := []models.StreetCount{
+		{Street: "Hume Highway", Count: 3, Latitude: -35.2, Longitude: 149.2},
+		{Street: "Federal Highway", Count: 2, Latitude: -35.2, Longitude: 149.2},
+		{Street: "George Street", Count: 1, Latitude: -33.8, Longitude: 151.2},
+	}
+
+	if len(streets) != len(expected) {
+		t.Fatalf("Expected %d streets, got %d: %+v", len(expected), len(streets), streets)
+	}
+
+	for i, want := range expected {
+		got := streets[i]
+		if got.Street != want.Street || got.Count != want.Count {
+			t.Errorf("Position %d: expected %s (%d), got %s (%d)", i, want.Street, want.Count, got.Street, got.Count)
+		}
+		if math.Abs(got.Latitude-want.Latitude) > 1e-9 || math.Abs(got.Longitude-want.Longitude) > 1e-9 {
+			t.Errorf("%s: expected (%f, %f), got (%f, %f)", want.Street, want.Latitude, want.Longitude, got.Latitude, got.Longitude)
+		}
+	}
+}
+
+func TestIntegration_GetStreetHeatmap_EmptyDatesError(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.cleanup()
+
+	if _, err := h.client.GetStreetHeatmap(h.ctx, []string{}); err == nil {
+		t.Error("Expected error for empty dates, got nil")
+	}
+}
+
+// =============================================================================
+// Composite Document ID Tests
+// =============================================================================
+
+func TestIntegration_CompositeIDs_ReusedUUIDAcrossDays(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.cleanup()
+	WithCompositeIDs(true)(h.client)
+
+	now := time.Now().UTC()
+	earlier := now.AddDate(0, 0, -30)
+
+	// First sighting, 30 days ago
+	first := createTestWazeAlert("reused-001", "POLICE", map[string]interface{}{
+		"Street":    "Old Sighting Road",
+		"PubMillis": earlier.Add(-1 * time.Hour).UnixMilli(),
+	})
+	if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{first}, earlier); err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+
+	// Waze reuses the UUID today
+	second := createTestWazeAlert("reused-001", "POLICE", map[string]interface{}{
+		"Street":    "New Sighting Road",
+		"PubMillis": now.Add(-1 * time.Hour).UnixMilli(),
+	})
+	if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{second}, now); err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+
+	docs, err := h.client.client.Collection(h.collectionName).Documents(h.ctx).GetAll()
+	if err != nil {
+		t.Fatalf("Failed to list documents: %v", err)
+	}
+	if len(docs) != 2 {
+		t.Fatalf("Expected 2 documents for the reused UUID, got %d", len(docs))
+	}
+
+	// The original sighting's history must be intact
+	oldID := compositeDocID("reused-001", first.PubMillis)
+	doc, err := h.client.client.Collection(h.collectionName).Doc(oldID).Get(h.ctx)
+	if err != nil {
+		t.Fatalf("Failed to get %s: %v", oldID, err)
+	}
+	var old models.PoliceAlert
+	if err := doc.DataTo(&old); err != nil {
+		t.Fatalf("Failed to parse %s: %v", oldID, err)
+	}
+	if old.Street != "Old Sighting Road" || !old.ExpireTime.Equal(earlier.Truncate(time.Microsecond)) {
+		t.Errorf("Expected first sighting to be untouched, got street %q expire %v", old.Street, old.ExpireTime)
+	}
+
+	// Queries return each sighting on its own day, and both across the range
+	results, err := h.client.GetPoliceAlertsByDatesWithFilters(h.ctx,
+		[]string{earlier.Format("2006-01-02"), now.Format("2006-01-02")}, models.AlertFilters{})
+	if err != nil {
+		t.Fatalf("GetPoliceAlertsByDatesWithFilters failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("Expected both sightings to be returned, got %d", len(results))
+	}
+}
+
+func TestIntegration_CompositeIDs_SameDayUpdatesInPlace(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.cleanup()
+	WithCompositeIDs(true)(h.client)
+
+	now := time.Now().UTC()
+	alert := createTestWazeAlert("sameday-001", "POLICE", map[string]interface{}{
+		"PubMillis": now.Add(-2 * time.Hour).UnixMilli(),
+	})
+
+	for _, scrapeTime := range []time.Time{now.Add(-1 * time.Hour), now} {
+		if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{alert}, scrapeTime); err != nil {
+			t.Fatalf("SavePoliceAlerts failed: %v", err)
+		}
+	}
+
+	docs, _ := h.client.client.Collection(h.collectionName).Documents(h.ctx).GetAll()
+	if len(docs) != 1 {
+		t.Fatalf("Expected 1 document, got %d", len(docs))
+	}
+	if docs[0].Ref.ID != compositeDocID("sameday-001", alert.PubMillis) {
+		t.Errorf("Expected composite document ID, got %s", docs[0].Ref.ID)
+	}
+}
+
+func TestIntegration_CompositeIDs_UpdatesLegacyDocument(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.cleanup()
+
+	now := time.Now().UTC()
+	alert := createTestWazeAlert("legacy-001", "POLICE", map[string]interface{}{
+		"PubMillis": now.Add(-2 * time.Hour).UnixMilli(),
+	})
+
+	// Saved before composite IDs were enabled
+	if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{alert}, now.Add(-1*time.Hour)); err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+
+	WithCompositeIDs(true)(h.client)
+	if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{alert}, now); err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+
+	docs, _ := h.client.client.Collection(h.collectionName).Documents(h.ctx).GetAll()
+	if len(docs) != 1 || docs[0].Ref.ID != "legacy-001" {
+		t.Fatalf("Expected the legacy document to be updated in place, got %d documents", len(docs))
+	}
+
+	var stored models.PoliceAlert
+	if err := docs[0].DataTo(&stored); err != nil {
+		t.Fatalf("Failed to parse document: %v", err)
+	}
+	if !stored.ExpireTime.Equal(now.Truncate(time.Microsecond)) {
+		t.Errorf("Expected expire_time to be updated to %v, got %v", now, stored.ExpireTime)
+	}
+
+	// The legacy document is remembered and keeps being updated in place
+	if _, ok := h.client.legacyDocs.Load(compositeDocID(alert.UUID, alert.PubMillis)); !ok {
+		t.Error("Expected the resolved legacy document to be cached")
+	}
+	if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{alert}, now.Add(time.Minute)); err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+	docs, _ = h.client.client.Collection(h.collectionName).Documents(h.ctx).GetAll()
+	if len(docs) != 1 || docs[0].Ref.ID != "legacy-001" {
+		t.Fatalf("Expected the cached legacy document to be updated in place, got %d documents", len(docs))
+	}
+
+	// Once it is deleted, the alert gets a composite document again
+	if _, err := docs[0].Ref.Delete(h.ctx); err != nil {
+		t.Fatalf("Failed to delete legacy document: %v", err)
+	}
+	if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{alert}, now.Add(2*time.Minute)); err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+	docs, _ = h.client.client.Collection(h.collectionName).Documents(h.ctx).GetAll()
+	if len(docs) != 1 || docs[0].Ref.ID != compositeDocID(alert.UUID, alert.PubMillis) {
+		t.Errorf("Expected a composite document after the legacy one was deleted, got %d documents", len(docs))
+	}
+}
+
+// =============================================================================
+// Incremental Sync Tests
+// =============================================================================
+
+func TestIntegration_GetPoliceAlertsUpdatedSince_OnlyReturnsLaterUpdates(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.cleanup()
+
+	firstScrape := time.Now().Add(-10 * time.Minute).Truncate(time.Millisecond)
+	secondScrape := firstScrape.Add(5 * time.Minute)
+
+	first := []models.WazeAlert{
+		createTestWazeAlert("sync-stale", "POLICE", nil),
+		createTestWazeAlert("sync-updated", "POLICE", nil),
+	}
+	if _, err := h.client.SavePoliceAlerts(h.ctx, first, firstScrape); err != nil {
+		t.Fatalf("First SavePoliceAlerts failed: %v", err)
+	}
+
+	second := []models.WazeAlert{
+		createTestWazeAlert("sync-updated", "POLICE", nil),
+		createTestWazeAlert("sync-new", "POLICE", nil),
+	}
+	if _, err := h.client.SavePoliceAlerts(h.ctx, second, secondScrape); err != nil {
+		t.Fatalf("Second SavePoliceAlerts failed: %v", err)
+	}
+
+	alerts, nextSince, err := h.client.GetPoliceAlertsUpdatedSince(h.ctx, firstScrape, 100)
+	if err != nil {
+		t.Fatalf("GetPoliceAlertsUpdatedSince failed: %v", err)
+	}
+
+	got := make(map[string]bool)
+	for _, alert := range alerts {
+		got[alert.UUID] = true
+	}
+	if len(alerts) != 2 || !got["sync-updated"] || !got["sync-new"] {
+		t.Errorf("Expected sync-updated and sync-new, got %v", got)
+	}
+	if !nextSince.Equal(secondScrape) {
+		t.Errorf("Expected next_since %v, got %v", secondScrape, nextSince)
+	}
+
+	// Syncing from the returned cursor finds nothing new and keeps the cursor
+	alerts, again, err := h.client.GetPoliceAlertsUpdatedSince(h.ctx, nextSince, 100)
+	if err != nil {
+		t.Fatalf("GetPoliceAlertsUpdatedSince failed: %v", err)
+	}
+	if len(alerts) != 0 {
+		t.Errorf("Expected no alerts after cursor, got %d", len(alerts))
+	}
+	if !again.Equal(nextSince) {
+		t.Errorf("Expected cursor to stay at %v, got %v", nextSince, again)
+	}
+}
+
+func TestIntegration_GetPoliceAlertsUpdatedSince_PagesOnScrapeBoundaries(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.cleanup()
+
+	firstScrape := time.Now().Add(-10 * time.Minute).Truncate(time.Millisecond)
+	secondScrape := firstScrape.Add(5 * time.Minute)
+
+	if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{
+		createTestWazeAlert("page-a", "POLICE", nil),
+		createTestWazeAlert("page-b", "POLICE", nil),
+	}, firstScrape); err != nil {
+		t.Fatalf("First SavePoliceAlerts failed: %v", err)
+	}
+	if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{
+		createTestWazeAlert("page-c", "POLICE", nil),
+		createTestWazeAlert("page-d", "POLICE", nil),
+	}, secondScrape); err != nil {
+		t.Fatalf("Second SavePoliceAlerts failed: %v", err)
+	}
+
+	since := firstScrape.Add(-time.Minute)
+
+	// A limit smaller than one scrape is widened to the whole scrape
+	alerts, nextSince, err := h.client.GetPoliceAlertsUpdatedSince(h.ctx, since, 1)
+	if err != nil {
+		t.Fatalf("GetPoliceAlertsUpdatedSince failed: %v", err)
+	}
+	if len(alerts) != 2 || !nextSince.Equal(firstScrape) {
+		t.Errorf("Expected first scrape's 2 alerts up to %v, got %d up to %v", firstScrape, len(alerts), nextSince)
+	}
+
+	// A limit splitting the second scrape stops at the end of the first
+	alerts, nextSince, err = h.client.GetPoliceAlertsUpdatedSince(h.ctx, since, 3)
+	if err != nil {
+		t.Fatalf("GetPoliceAlertsUpdatedSince failed: %v", err)
+	}
+	if len(alerts) != 2 || !nextSince.Equal(firstScrape) {
+		t.Errorf("Expected 2 alerts up to %v, got %d up to %v", firstScrape, len(alerts), nextSince)
+	}
+
+	// The next page returns the whole second scrape
+	alerts, nextSince, err = h.client.GetPoliceAlertsUpdatedSince(h.ctx, nextSince, 3)
+	if err != nil {
+		t.Fatalf("GetPoliceAlertsUpdatedSince failed: %v", err)
+	}
+	if len(alerts) != 2 || !nextSince.Equal(secondScrape) {
+		t.Errorf("Expected second scrape's 2 alerts up to %v, got %d up to %v", secondScrape, len(alerts), nextSince)
+	}
+}
+
+func TestIntegration_GetPoliceAlertsActiveAt_ReturnsAlertsSpanningInstant(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.cleanup()
+
+	instant := time.Now().Add(-2 * time.Hour).Truncate(time.Millisecond)
+
+	// Each alert is seen by two scrapes, so it is active from its publish
+	// time until the second scrape
+	windows := []struct {
+		uuid      string
+		published time.Time
+		lastSeen  time.Time
+		active    bool
+	}{
+		{"spans-instant", instant.Add(-30 * time.Minute), instant.Add(30 * time.Minute), true},
+		{"published-at-instant", instant, instant.Add(10 * time.Minute), true},
+		{"last-seen-at-instant", instant.Add(-20 * time.Minute), instant, true},
+		{"ended-before", instant.Add(-time.Hour), instant.Add(-time.Minute), false},
+		{"published-after", instant.Add(time.Minute), instant.Add(20 * time.Minute), false},
+	}
+
+	for _, w := range windows {
+		alert := createTestWazeAlert(w.uuid, "POLICE", map[string]interface{}{
+			"PubMillis": w.published.UnixMilli(),
+		})
+		for _, scrapeTime := range []time.Time{w.published, w.lastSeen} {
+			if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{alert}, scrapeTime); err != nil {
+				t.Fatalf("SavePoliceAlerts failed for %s: %v", w.uuid, err)
+			}
+		}
+	}
+
+	alerts, err := h.client.GetPoliceAlertsActiveAt(h.ctx, instant)
+	if err != nil {
+		t.Fatalf("GetPoliceAlertsActiveAt failed: %v", err)
+	}
+
+	got := make(map[string]bool)
+	for _, alert := range alerts {
+		got[alert.UUID] = true
+	}
+	for _, w := range windows {
+		if got[w.uuid] != w.active {
+			t.Errorf("%s: expected active at instant %v, got %v", w.uuid, w.active, got[w.uuid])
+		}
+	}
+}
+
+func TestIntegration_CountPoliceAlertsPublished_CountsPerBucket(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.cleanup()
+
+	base := time.Now().Add(-72 * time.Hour).Truncate(time.Hour)
+	edges := []time.Time{base, base.Add(24 * time.Hour), base.Add(48 * time.Hour), base.Add(72 * time.Hour)}
+	published := []time.Time{
+		base.Add(-time.Minute), // before the first bucket
+		base,
+		base.Add(23 * time.Hour),
+		base.Add(24 * time.Hour), // a bucket's end belongs to the next bucket
+		base.Add(60 * time.Hour),
+		base.Add(61 * time.Hour),
+	}
+	for i, p := range published {
+		alert := createTestWazeAlert(fmt.Sprintf("count-%03d", i), "POLICE", map[string]interface{}{
+			"PubMillis": p.UnixMilli(),
+		})
+		if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{alert}, p); err != nil {
+			t.Fatalf("SavePoliceAlerts failed: %v", err)
+		}
+	}
+
+	counts, err := h.client.CountPoliceAlertsPublished(h.ctx, edges)
+	if err != nil {
+		t.Fatalf("CountPoliceAlertsPublished failed: %v", err)
+	}
+	if !reflect.DeepEqual(counts, []int64{2, 1, 2}) {
+		t.Errorf("expected counts [2 1 2], got %v", counts)
+	}
+
+	if _, err := h.client.CountPoliceAlertsPublished(h.ctx, edges[:1]); err == nil {
+		t.Error("expected an error for a single edge")
+	}
+}
+
+func TestIntegration_CountPoliceAlertsByDateRange_MatchesQuery(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.cleanup()
+
+	dayStart := time.Now().Add(-48 * time.Hour).Truncate(time.Hour)
+	dayEnd := dayStart.Add(24*time.Hour - time.Second)
+	scrapes := []time.Time{
+		dayStart.Add(-2 * time.Hour), // expired before the day
+		dayStart.Add(time.Hour),
+		dayStart.Add(12 * time.Hour),
+		dayEnd.Add(time.Hour), // published after the day
+	}
+	for i, scrape := range scrapes {
+		alert := createTestWazeAlert(fmt.Sprintf("range-count-%03d", i), "POLICE", map[string]interface{}{
+			"PubMillis": scrape.UnixMilli(),
+		})
+		if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{alert}, scrape); err != nil {
+			t.Fatalf("SavePoliceAlerts failed: %v", err)
+		}
+	}
+
+	alerts, err := h.client.GetPoliceAlertsByDateRange(h.ctx, dayStart, dayEnd)
+	if err != nil {
+		t.Fatalf("GetPoliceAlertsByDateRange failed: %v", err)
+	}
+	count, err := h.client.CountPoliceAlertsByDateRange(h.ctx, dayStart, dayEnd)
+	if err != nil {
+		t.Fatalf("CountPoliceAlertsByDateRange failed: %v", err)
+	}
+	if count != 2 || count != int64(len(alerts)) {
+		t.Errorf("expected a count of 2 matching the %d alerts queried, got %d", len(alerts), count)
+	}
+}
+
+// =============================================================================
+// Source BBox Tests
+// =============================================================================
+
+func TestIntegration_SourceBBox_StoredOnlyWhenEnabled(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.cleanup()
+
+	now := time.Now()
+	untracked := createTestWazeAlert("bbox-off-001", "POLICE", nil)
+	untracked.SourceBBox = "149.0,-35.5,149.3,-35.2"
+	if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{untracked}, now); err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+
+	WithSourceBBox(true)(h.client)
+	north := createTestWazeAlert("bbox-on-north", "POLICE", nil)
+	north.SourceBBox = "149.0,-35.2,149.3,-34.9"
+	south := createTestWazeAlert("bbox-on-south", "POLICE", nil)
+	south.SourceBBox = "149.0,-35.5,149.3,-35.2"
+	if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{north, south}, now); err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"bbox-off-001":  "",
+		"bbox-on-north": "149.0,-35.2,149.3,-34.9",
+		"bbox-on-south": "149.0,-35.5,149.3,-35.2",
+	}
+	for uuid, want := range expected {
+		doc, err := h.client.client.Collection(h.collectionName).Doc(uuid).Get(h.ctx)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", uuid, err)
+		}
+		var stored models.PoliceAlert
+		if err := doc.DataTo(&stored); err != nil {
+			t.Fatalf("Failed to parse %s: %v", uuid, err)
+		}
+		if stored.SourceBBox != want {
+			t.Errorf("%s: expected source_bbox %q, got %q", uuid, want, stored.SourceBBox)
+		}
+		if want != "" && strings.Contains(stored.RawDataInitial, want) {
+			t.Errorf("%s: expected source bbox to stay out of raw data", uuid)
+		}
+	}
+}
+
+func TestIntegration_PeakReliability_RetainsMaximum(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.cleanup()
+	WithPeakReliability(true)(h.client)
+
+	// Reliability rises then falls; confidence falls then rises
+	scrapes := []struct{ reliability, confidence int }{
+		{5, 4},
+		{8, 2},
+		{10, 3},
+		{6, 7},
+		{3, 1},
+	}
+	base := time.Now().Add(-time.Hour)
+	for i, scrape := range scrapes {
+		alert := createTestWazeAlert("peak-001", "POLICE", map[string]interface{}{
+			"Reliability": scrape.reliability,
+			"Confidence":  scrape.confidence,
+		})
+		if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{alert}, base.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatalf("SavePoliceAlerts failed: %v", err)
+		}
+	}
+
+	doc, err := h.client.client.Collection(h.collectionName).Doc("peak-001").Get(h.ctx)
+	if err != nil {
+		t.Fatalf("Failed to get alert: %v", err)
+	}
+	var stored models.PoliceAlert
+	if err := doc.DataTo(&stored); err != nil {
+		t.Fatalf("Failed to parse alert: %v", err)
+	}
+	if stored.ReliabilityMax != 10 || stored.ConfidenceMax != 7 {
+		t.Errorf("expected peaks reliability 10 and confidence 7, got %d and %d", stored.ReliabilityMax, stored.ConfidenceMax)
+	}
+	if stored.Reliability != 5 || stored.Confidence != 4 {
+		t.Errorf("expected initial reliability 5 and confidence 4 kept, got %d and %d", stored.Reliability, stored.Confidence)
+	}
+}
+
+func TestIntegration_PeakReliability_StartsFromInitialValues(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.cleanup()
+
+	now := time.Now()
+	alert := createTestWazeAlert("peak-002", "POLICE", map[string]interface{}{"Reliability": 9, "Confidence": 6})
+	if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{alert}, now); err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+
+	// Enabled after the alert was first stored, with a lower later scrape
+	WithPeakReliability(true)(h.client)
+	alert = createTestWazeAlert("peak-002", "POLICE", map[string]interface{}{"Reliability": 4, "Confidence": 8})
+	if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{alert}, now.Add(time.Minute)); err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+
+	doc, err := h.client.client.Collection(h.collectionName).Doc("peak-002").Get(h.ctx)
+	if err != nil {
+		t.Fatalf("Failed to get alert: %v", err)
+	}
+	var stored models.PoliceAlert
+	if err := doc.DataTo(&stored); err != nil {
+		t.Fatalf("Failed to parse alert: %v", err)
+	}
+	if stored.ReliabilityMax != 9 || stored.ConfidenceMax != 8 {
+		t.Errorf("expected peaks reliability 9 and confidence 8, got %d and %d", stored.ReliabilityMax, stored.ConfidenceMax)
+	}
+}
+
+func TestIntegration_Revision_StoredFromConfiguredRevision(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.cleanup()
+
+	now := time.Now()
+	untagged := createTestWazeAlert("revision-off-001", "POLICE", nil)
+	existing := createTestWazeAlert("revision-existing-001", "POLICE", nil)
+	if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{untagged, existing}, now); err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+
+	// A new alert is tagged when created, and an existing one when updated
+	WithRevision("rev-abc123")(h.client)
+	created := createTestWazeAlert("revision-on-001", "POLICE", nil)
+	if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{created, existing}, now.Add(time.Minute)); err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"revision-off-001":      "",
+		"revision-on-001":       "rev-abc123",
+		"revision-existing-001": "rev-abc123",
+	}
+	for uuid, want := range expected {
+		doc, err := h.client.client.Collection(h.collectionName).Doc(uuid).Get(h.ctx)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", uuid, err)
+		}
+		var stored models.PoliceAlert
+		if err := doc.DataTo(&stored); err != nil {
+			t.Fatalf("Failed to parse %s: %v", uuid, err)
+		}
+		if stored.ScrapedByRevision != want {
+			t.Errorf("%s: expected scraped_by_revision %q, got %q", uuid, want, stored.ScrapedByRevision)
+		}
+	}
+
+	// A later deploy re-tags alerts it updates
+	WithRevision("rev-def456")(h.client)
+	if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{created}, now.Add(2*time.Minute)); err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+	doc, err := h.client.client.Collection(h.collectionName).Doc("revision-on-001").Get(h.ctx)
+	if err != nil {
+		t.Fatalf("Failed to get alert: %v", err)
+	}
+	revision, err := doc.DataAt("scraped_by_revision")
+	if err != nil || revision != "rev-def456" {
+		t.Errorf("expected scraped_by_revision rev-def456, got %v (%v)", revision, err)
+	}
+}
+
+func TestIntegration_RawAlertBytes_StoredVerbatim(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.cleanup()
+
+	now := time.Now()
+	alert := createTestWazeAlert("raw-bytes-001", "POLICE", nil)
+	initial := fmt.Sprintf(`{"type":"POLICE","uuid":"raw-bytes-001", "pubMillis":%d,"unmodeled":true}`, alert.PubMillis)
+	alert.Raw = json.RawMessage(initial)
+	if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{alert}, now); err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+
+	last := fmt.Sprintf(`{"uuid":"raw-bytes-001","type":"POLICE","pubMillis":%d,"nThumbsUp":9}`, alert.PubMillis)
+	alert.Raw = json.RawMessage(last)
+	if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{alert}, now.Add(time.Minute)); err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+
+	// Alerts without raw bytes are re-encoded as before
+	plain := createTestWazeAlert("raw-bytes-002", "POLICE", nil)
+	if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{plain}, now); err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+	encoded, err := json.Marshal(plain)
+	if err != nil {
+		t.Fatalf("failed to marshal alert: %v", err)
+	}
+
+	for uuid, want := range map[string][2]string{
+		"raw-bytes-001": {initial, last},
+		"raw-bytes-002": {string(encoded), string(encoded)},
+	} {
+		doc, err := h.client.client.Collection(h.collectionName).Doc(uuid).Get(h.ctx)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", uuid, err)
+		}
+		var stored models.PoliceAlert
+		if err := doc.DataTo(&stored); err != nil {
+			t.Fatalf("Failed to parse %s: %v", uuid, err)
+		}
+		if stored.RawDataInitial != want[0] || stored.RawDataLast != want[1] {
+			t.Errorf("%s: expected raw data %q / %q, got %q / %q", uuid, want[0], want[1], stored.RawDataInitial, stored.RawDataLast)
+		}
+	}
+}
+
+func TestIntegration_CommentsStorage_ModesReadBackSameComments(t *testing.T) {
+	base := time.Now().Add(-30 * time.Minute)
+	first := []models.Comment{
+		{ReportMillis: base.UnixMilli(), Text: "first", IsThumbsUp: true},
+		{ReportMillis: base.Add(time.Minute).UnixMilli(), Text: "second"},
+	}
+	// The second scrape repeats the earlier comments and adds a newer one
+	second := append(append([]models.Comment(nil), first...),
+		models.Comment{ReportMillis: base.Add(2 * time.Minute).UnixMilli(), Text: "third", IsThumbsUp: true})
+
+	read := make(map[string][]models.Comment)
+	for _, mode := range []string{CommentsInline, CommentsSubcollection} {
+		t.Run(mode, func(t *testing.T) {
+			h := newTestHelper(t)
+			defer h.cleanup()
+			WithCommentsStorage(mode)(h.client)
+
+			alert := createTestWazeAlert("comments-001", "POLICE", map[string]interface{}{
+				"PubMillis": base.Add(-time.Hour).UnixMilli(),
+				"Comments":  first,
+			})
+			if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{alert}, base); err != nil {
+				t.Fatalf("SavePoliceAlerts failed: %v", err)
+			}
+			alert.Comments = second
+			if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{alert}, base.Add(5*time.Minute)); err != nil {
+				t.Fatalf("SavePoliceAlerts failed: %v", err)
+			}
+
+			docRef := h.client.client.Collection(h.collectionName).Doc("comments-001")
+			doc, err := docRef.Get(h.ctx)
+			if err != nil {
+				t.Fatalf("Failed to get document: %v", err)
+			}
+			_, inline := doc.Data()["comments"]
+			if inline != (mode == CommentsInline) {
+				t.Errorf("Expected comments field on the alert document: %v, got %v", mode == CommentsInline, inline)
+			}
+			if mode == CommentsSubcollection {
+				defer func() {
+					subDocs, _ := docRef.Collection(commentsCollection).Documents(h.ctx).GetAll()
+					for _, subDoc := range subDocs {
+						_, _ = subDoc.Ref.Delete(h.ctx)
+					}
+				}()
+			}
+
+			alerts, err := h.client.GetPoliceAlertsByDateRange(h.ctx, base.Add(-2*time.Hour), base.Add(time.Hour))
+			if err != nil {
+				t.Fatalf("GetPoliceAlertsByDateRange failed: %v", err)
+			}
+			if len(alerts) != 1 {
+				t.Fatalf("Expected 1 alert, got %d", len(alerts))
+			}
+			read[mode] = alerts[0].Comments
+		})
+	}
+
+	if len(read[CommentsInline]) != 3 {
+		t.Fatalf("Expected 3 inline comments, got %+v", read[CommentsInline])
+	}
+	if !reflect.DeepEqual(read[CommentsInline], read[CommentsSubcollection]) {
+		t.Errorf("Expected both modes to read back the same comments:\ninline:        %+v\nsubcollection: %+v",
+			read[CommentsInline], read[CommentsSubcollection])
+	}
+}
+
+func TestIntegration_CommentsStorage_SwitchKeepsInlineComments(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.cleanup()
+
+	base := time.Now().Add(-30 * time.Minute)
+	inline := []models.Comment{
+		{ReportMillis: base.UnixMilli(), Text: "first"},
+		{ReportMillis: base.Add(time.Minute).UnixMilli(), Text: "second"},
+	}
+	alert := createTestWazeAlert("comments-switch-001", "POLICE", map[string]interface{}{
+		"PubMillis": base.Add(-time.Hour).UnixMilli(),
+		"Comments":  inline,
+	})
+	if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{alert}, base); err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+
+	docRef := h.client.client.Collection(h.collectionName).Doc("comments-switch-001")
+	defer func() {
+		subDocs, _ := docRef.Collection(commentsCollection).Documents(h.ctx).GetAll()
+		for _, subDoc := range subDocs {
+			_, _ = subDoc.Ref.Delete(h.ctx)
+		}
+	}()
+
+	// Switched with no new comments yet: the inline comments are still read
+	WithCommentsStorage(CommentsSubcollection)(h.client)
+	alerts, err := h.client.GetPoliceAlertsByDateRange(h.ctx, base.Add(-2*time.Hour), base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetPoliceAlertsByDateRange failed: %v", err)
+	}
+	if len(alerts) != 1 || !reflect.DeepEqual(alerts[0].Comments, inline) {
+		t.Fatalf("Expected the inline comments after switching, got %+v", alerts)
+	}
+
+	// A later scrape moves them into the subcollection alongside the new one
+	alert.Comments = append(append([]models.Comment(nil), inline...),
+		models.Comment{ReportMillis: base.Add(2 * time.Minute).UnixMilli(), Text: "third"})
+	if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{alert}, base.Add(5*time.Minute)); err != nil {
+		t.Fatalf("SavePoliceAlerts failed: %v", err)
+	}
+	doc, err := docRef.Get(h.ctx)
+	if err != nil {
+		t.Fatalf("Failed to get document: %v", err)
+	}
+	if _, ok := doc.Data()["comments"]; ok {
+		t.Error("Expected the inline comments field to be removed")
+	}
+	alerts, err = h.client.GetPoliceAlertsByDateRange(h.ctx, base.Add(-2*time.Hour), base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetPoliceAlertsByDateRange failed: %v", err)
+	}
+	if len(alerts) != 1 || !reflect.DeepEqual(alerts[0].Comments, alert.Comments) {
+		t.Errorf("Expected all three comments from the subcollection, got %+v", alerts)
+	}
+}
+
+func TestIntegration_CommentsStorage_SubcollectionPrunedOnWrite(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.cleanup()
+	WithCommentsStorage(CommentsSubcollection)(h.client)
+	WithMaxComments(2)(h.client)
+
+	base := time.Now().Add(-30 * time.Minute)
+	var comments []models.Comment
+	docRef := h.client.client.Collection(h.collectionName).Doc("comments-prune-001")
+	defer func() {
+		subDocs, _ := docRef.Collection(commentsCollection).Documents(h.ctx).GetAll()
+		for _, subDoc := range subDocs {
+			_, _ = subDoc.Ref.Delete(h.ctx)
+		}
+	}()
+	for i := 0; i < 4; i++ {
+		comments = append(comments, models.Comment{ReportMillis: base.Add(time.Duration(i) * time.Minute).UnixMilli(), Text: fmt.Sprintf("comment %d", i)})
+		alert := createTestWazeAlert("comments-prune-001", "POLICE", map[string]interface{}{
+			"PubMillis": base.Add(-time.Hour).UnixMilli(),
+			"Comments":  comments,
+		})
+		if _, err := h.client.SavePoliceAlerts(h.ctx, []models.WazeAlert{alert}, base.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatalf("SavePoliceAlerts failed: %v", err)
+		}
+	}
+
+	subDocs, err := docRef.Collection(commentsCollection).Documents(h.ctx).GetAll()
+	if err != nil {
+		t.Fatalf("Failed to list comments: %v", err)
+	}
+	if len(subDocs) != 2 {
+		t.Errorf("Expected the subcollection pruned to 2 comments, got %d", len(subDocs))
+	}
+
+	alerts, err := h.client.GetPoliceAlertsByDateRange(h.ctx, base.Add(-2*time.Hour), base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetPoliceAlertsByDateRange failed: %v", err)
+	}
+	if len(alerts) != 1 || !reflect.DeepEqual(alerts[0].Comments, comments[2:]) {
+		t.Errorf("Expected the 2 most recent comments, got %+v", alerts)
+	}
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsUnavailable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"unavailable", status.Error(codes.Unavailable, "connection refused"), true},
+		{"deadline exceeded status", status.Error(codes.DeadlineExceeded, "timeout"), true},
+		{"context deadline", context.DeadlineExceeded, true},
+		{"wrapped unavailable", fmt.Errorf("failed to query police alerts: %w", status.Error(codes.Unavailable, "down")), true},
+		{"failed precondition", status.Error(codes.FailedPrecondition, "index required"), false},
+		{"plain error", errors.New("boom"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsUnavailable(tt.err); got != tt.want {
+				t.Errorf("IsUnavailable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingIndex(t *testing.T) {
+	const url = "https://console.firebase.google.com/v1/r/project/demo/firestore/indexes?create_composite=ClRwcm9q"
+	indexErr := status.Error(codes.FailedPrecondition, "The query requires an index. You can create it here: "+url)
+
+	err := fmt.Errorf("failed to query police alerts: %w", missingIndex(indexErr))
+	var got *MissingIndexError
+	if !errors.As(err, &got) {
+		t.Fatalf("expected a MissingIndexError, got %v", err)
+	}
+	if got.URL != url {
+		t.Errorf("expected URL %q, got %q", url, got.URL)
+	}
+	want := "failed to query police alerts: firestore query requires a missing composite index; create it at " + url
+	if err.Error() != want {
+		t.Errorf("expected error %q, got %q", want, err.Error())
+	}
+	if status.Code(errors.Unwrap(got)) != codes.FailedPrecondition {
+		t.Error("expected the original status error to stay wrapped")
+	}
+
+	noURL := missingIndex(status.Error(codes.FailedPrecondition, "The query requires an index."))
+	if !errors.As(noURL, &got) || got.URL != "" || !strings.Contains(got.Error(), "firestore.indexes.json") {
+		t.Errorf("expected a MissingIndexError pointing at firestore.indexes.json, got %v", noURL)
+	}
+
+	for _, other := range []error{
+		status.Error(codes.FailedPrecondition, "transaction aborted"),
+		status.Error(codes.Unavailable, "index service down"),
+		errors.New("boom"),
+	} {
+		if err := missingIndex(other); err != other {
+			t.Errorf("expected %v to be returned unchanged, got %v", other, err)
+		}
+	}
+}
@@ -3,9 +3,12 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"io"
+	"net/http"
 
 	gcs "cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
 )
 
 // GCSClientAdapter wraps a real GCS client to implement the GCSClient interface.
@@ -51,19 +54,55 @@ func (a *GCSObjectHandleAdapter) Attrs(ctx context.Context) (*GCSObjectAttrs, er
 		return nil, err
 	}
 	return &GCSObjectAttrs{
-		Name: attrs.Name,
-		Size: attrs.Size,
+		Name:       attrs.Name,
+		Size:       attrs.Size,
+		Generation: attrs.Generation,
+		Metadata:   attrs.Metadata,
 	}, nil
 }
 
 // NewWriter implements GCSObjectHandle.NewWriter.
 func (a *GCSObjectHandleAdapter) NewWriter(ctx context.Context) GCSWriter {
-	return a.Handle.NewWriter(ctx)
+	return &GCSWriterAdapter{Writer: a.Handle.NewWriter(ctx)}
+}
+
+// If implements GCSObjectHandle.If.
+func (a *GCSObjectHandleAdapter) If(conds GCSConditions) GCSObjectHandle {
+	if conds == (GCSConditions{}) {
+		return a
+	}
+	return &GCSObjectHandleAdapter{Handle: a.Handle.If(gcs.Conditions{
+		DoesNotExist:    conds.DoesNotExist,
+		GenerationMatch: conds.GenerationMatch,
+	})}
+}
+
+// ReadCompressed implements GCSObjectHandle.ReadCompressed.
+func (a *GCSObjectHandleAdapter) ReadCompressed(compressed bool) GCSObjectHandle {
+	return &GCSObjectHandleAdapter{Handle: a.Handle.ReadCompressed(compressed)}
+}
+
+// Delete implements GCSObjectHandle.Delete.
+func (a *GCSObjectHandleAdapter) Delete(ctx context.Context) error {
+	return a.Handle.Delete(ctx)
 }
 
 // Ensure GCSObjectHandleAdapter implements GCSObjectHandle.
 var _ GCSObjectHandle = (*GCSObjectHandleAdapter)(nil)
 
+// GCSWriterAdapter wraps a real GCS writer to implement the GCSWriter interface.
+type GCSWriterAdapter struct {
+	*gcs.Writer
+}
+
+// SetMetadata implements GCSWriter.SetMetadata.
+func (a *GCSWriterAdapter) SetMetadata(metadata map[string]string) {
+	a.Writer.Metadata = metadata
+}
+
+// Ensure GCSWriterAdapter implements GCSWriter.
+var _ GCSWriter = (*GCSWriterAdapter)(nil)
+
 // IsObjectNotExist checks if an error indicates that a GCS object does not exist.
 // This works for both the real GCS error and our mock error.
 func IsObjectNotExist(err error) bool {
@@ -79,3 +118,14 @@ func IsObjectNotExist(err error) bool {
 	}
 	return false
 }
+
+// IsPreconditionFailed checks if an error indicates that a conditional GCS
+// write or delete was rejected because its preconditions did not hold.
+// This works for both the real GCS error and our mock error.
+func IsPreconditionFailed(err error) bool {
+	if errors.Is(err, ErrPreconditionFailed) {
+		return true
+	}
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed
+}
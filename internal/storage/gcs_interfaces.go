@@ -25,17 +25,45 @@ type GCSObjectHandle interface {
 
 	// NewWriter creates a new Writer to write the object's contents.
 	NewWriter(ctx context.Context) GCSWriter
+
+	// If returns a handle whose writes and deletes only apply when conds
+	// hold. Otherwise they fail with an error reported by IsPreconditionFailed.
+	If(conds GCSConditions) GCSObjectHandle
+
+	// ReadCompressed returns a handle whose readers return the stored bytes
+	// as is, without decompressing objects uploaded with gzip content encoding.
+	ReadCompressed(compressed bool) GCSObjectHandle
+
+	// Delete removes the object.
+	// Returns ErrObjectNotExist if the object does not exist.
+	Delete(ctx context.Context) error
 }
 
 // GCSObjectAttrs represents attributes of a GCS object.
 type GCSObjectAttrs struct {
-	Name string
-	Size int64
+	Name       string
+	Size       int64
+	Generation int64
+	Metadata   map[string]string
+}
+
+// GCSConditions are preconditions on a GCS object operation. The zero value
+// applies no conditions.
+type GCSConditions struct {
+	// DoesNotExist requires that the object does not exist yet.
+	DoesNotExist bool
+
+	// GenerationMatch requires the object's generation to equal it, when non-zero.
+	GenerationMatch int64
 }
 
 // GCSWriter represents a writer for uploading data to GCS.
 type GCSWriter interface {
 	io.WriteCloser
+
+	// SetMetadata sets custom metadata on the object being written.
+	// It must be called before the first Write.
+	SetMetadata(metadata map[string]string)
 }
 
 // GCSClient represents a client for interacting with Google Cloud Storage.
@@ -0,0 +1,72 @@
+// Package storage provides data persistence abstractions for Firestore and GCS.
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+)
+
+// HeartbeatObjectName is the GCS object holding the scraper's heartbeat
+const HeartbeatObjectName = "heartbeat.json"
+
+// HeartbeatStore keeps the time of the scraper's last successful save in a
+// single GCS object, so a scraper that keeps running but stops saving (e.g.
+// every Waze call is refused) can be detected by how stale it is.
+type HeartbeatStore struct {
+	gcsClient  GCSClient
+	bucketName string
+}
+
+// NewHeartbeatStore creates a store for the heartbeat object in the given bucket
+func NewHeartbeatStore(gcsClient GCSClient, bucketName string) *HeartbeatStore {
+	return &HeartbeatStore{
+		gcsClient:  gcsClient,
+		bucketName: bucketName,
+	}
+}
+
+// Write replaces the heartbeat
+func (s *HeartbeatStore) Write(ctx context.Context, heartbeat models.Heartbeat) error {
+	body, err := json.Marshal(heartbeat)
+	if err != nil {
+		return fmt.Errorf("failed to marshal heartbeat: %w", err)
+	}
+
+	writer := s.gcsClient.Bucket(s.bucketName).Object(HeartbeatObjectName).NewWriter(ctx)
+	if _, err := writer.Write(body); err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to write heartbeat: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to upload heartbeat: %w", err)
+	}
+	return nil
+}
+
+// Read returns the latest heartbeat. If none has been written the error
+// satisfies IsObjectNotExist.
+func (s *HeartbeatStore) Read(ctx context.Context) (models.Heartbeat, error) {
+	var heartbeat models.Heartbeat
+
+	reader, err := s.gcsClient.Bucket(s.bucketName).Object(HeartbeatObjectName).NewReader(ctx)
+	if err != nil {
+		if IsObjectNotExist(err) {
+			return heartbeat, err
+		}
+		return heartbeat, fmt.Errorf("failed to open heartbeat: %w", err)
+	}
+	defer reader.Close()
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return heartbeat, fmt.Errorf("failed to read heartbeat: %w", err)
+	}
+	if err := json.Unmarshal(body, &heartbeat); err != nil {
+		return heartbeat, fmt.Errorf("failed to parse heartbeat: %w", err)
+	}
+	return heartbeat, nil
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+)
+
+func TestHeartbeatStore_RoundTrip(t *testing.T) {
+	gcs := NewMemGCS()
+	store := NewHeartbeatStore(gcs, "heartbeat-bucket")
+
+	first := models.Heartbeat{LastSuccessfulSave: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), PoliceAlertsSaved: 3}
+	second := models.Heartbeat{LastSuccessfulSave: first.LastSuccessfulSave.Add(time.Minute), PoliceAlertsSaved: 5}
+	for _, heartbeat := range []models.Heartbeat{first, second} {
+		if err := store.Write(context.Background(), heartbeat); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if len(gcs.Objects) != 1 {
+		t.Fatalf("expected a single heartbeat object, got %d", len(gcs.Objects))
+	}
+	got, err := store.Read(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.LastSuccessfulSave.Equal(second.LastSuccessfulSave) || got.PoliceAlertsSaved != 5 {
+		t.Errorf("expected the latest heartbeat %+v, got %+v", second, got)
+	}
+}
+
+func TestHeartbeatStore_ReadMissing(t *testing.T) {
+	store := NewHeartbeatStore(NewMemGCS(), "heartbeat-bucket")
+
+	_, err := store.Read(context.Background())
+	if !IsObjectNotExist(err) {
+		t.Errorf("expected an object not exist error, got %v", err)
+	}
+}
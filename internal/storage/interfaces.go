@@ -14,15 +14,40 @@ type AlertStore interface {
 	// SavePoliceAlerts processes and saves POLICE type alerts with lifecycle tracking.
 	// For new alerts: Initializes all tracking fields.
 	// For existing alerts: Updates only lifecycle/tracking fields.
-	SavePoliceAlerts(ctx context.Context, alerts []models.WazeAlert, scrapeTime time.Time) error
+	// Returns the number of alert documents written, or an error if none could be.
+	SavePoliceAlerts(ctx context.Context, alerts []models.WazeAlert, scrapeTime time.Time) (int, error)
 
 	// GetPoliceAlertsByDateRange retrieves police alerts that were active within a date range.
 	// An alert is considered active if: expire_time >= startDate AND publish_time <= endDate.
 	GetPoliceAlertsByDateRange(ctx context.Context, startDate, endDate time.Time) ([]models.PoliceAlert, error)
 
+	// GetPoliceAlertsActiveAt retrieves police alerts that were active at an instant.
+	// An alert is considered active if: publish_time <= t AND expire_time >= t.
+	GetPoliceAlertsActiveAt(ctx context.Context, t time.Time) ([]models.PoliceAlert, error)
+
 	// GetPoliceAlertsByDatesWithFilters retrieves police alerts for multiple specific dates with optional filters.
 	// Each date should be in YYYY-MM-DD format.
-	GetPoliceAlertsByDatesWithFilters(ctx context.Context, dates []string, subtypes []string, streets []string) ([]models.PoliceAlert, error)
+	GetPoliceAlertsByDatesWithFilters(ctx context.Context, dates []string, filters models.AlertFilters) ([]models.PoliceAlert, error)
+
+	// GetPoliceAlertsUpdatedSince retrieves up to limit alerts whose expire_time is after since,
+	// ordered by expire_time, along with the cursor to pass as since on the next call.
+	GetPoliceAlertsUpdatedSince(ctx context.Context, since time.Time, limit int) ([]models.PoliceAlert, time.Time, error)
+
+	// GetStreetHeatmap aggregates police alerts active on the given dates by street.
+	// Results are sorted by alert count (descending) with averaged coordinates per street.
+	GetStreetHeatmap(ctx context.Context, dates []string) ([]models.StreetCount, error)
+
+	// CountPoliceAlertsPublished counts police alerts published in each bucket
+	// [edges[i], edges[i+1]) with count aggregations, without reading the documents.
+	// It returns len(edges)-1 counts.
+	CountPoliceAlertsPublished(ctx context.Context, edges []time.Time) ([]int64, error)
+
+	// CountPoliceAlertsByDateRange counts the alerts GetPoliceAlertsByDateRange would
+	// return for the same range with a count aggregation, without reading the documents.
+	CountPoliceAlertsByDateRange(ctx context.Context, startDate, endDate time.Time) (int64, error)
+
+	// GetCollectionStats counts the documents in the collection and estimates their storage size.
+	GetCollectionStats(ctx context.Context) (models.CollectionStats, error)
 
 	// Close closes the underlying storage client.
 	Close() error
@@ -2,8 +2,11 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"io"
+	"sync"
 )
 
 // MockGCSClient is a mock implementation of GCSClient for testing.
@@ -55,6 +58,18 @@ type MockGCSObjectHandle struct {
 	// NewWriterFunc is called when NewWriter is invoked.
 	// If nil, returns a MockGCSWriter with default behavior.
 	NewWriterFunc func(ctx context.Context) GCSWriter
+
+	// IfFunc is called when If is invoked.
+	// If nil, returns this handle, ignoring the conditions.
+	IfFunc func(conds GCSConditions) GCSObjectHandle
+
+	// ReadCompressedFunc is called when ReadCompressed is invoked.
+	// If nil, returns this handle.
+	ReadCompressedFunc func(compressed bool) GCSObjectHandle
+
+	// DeleteFunc is called when Delete is invoked.
+	// If nil, returns nil (success).
+	DeleteFunc func(ctx context.Context) error
 }
 
 // NewReader implements GCSObjectHandle.NewReader.
@@ -81,6 +96,30 @@ func (m *MockGCSObjectHandle) NewWriter(ctx context.Context) GCSWriter {
 	return &MockGCSWriter{}
 }
 
+// If implements GCSObjectHandle.If.
+func (m *MockGCSObjectHandle) If(conds GCSConditions) GCSObjectHandle {
+	if m.IfFunc != nil {
+		return m.IfFunc(conds)
+	}
+	return m
+}
+
+// ReadCompressed implements GCSObjectHandle.ReadCompressed.
+func (m *MockGCSObjectHandle) ReadCompressed(compressed bool) GCSObjectHandle {
+	if m.ReadCompressedFunc != nil {
+		return m.ReadCompressedFunc(compressed)
+	}
+	return m
+}
+
+// Delete implements GCSObjectHandle.Delete.
+func (m *MockGCSObjectHandle) Delete(ctx context.Context) error {
+	if m.DeleteFunc != nil {
+		return m.DeleteFunc(ctx)
+	}
+	return nil
+}
+
 // Ensure MockGCSObjectHandle implements GCSObjectHandle.
 var _ GCSObjectHandle = (*MockGCSObjectHandle)(nil)
 
@@ -96,6 +135,9 @@ type MockGCSWriter struct {
 
 	// Written stores all data written to this writer.
 	Written []byte
+
+	// Metadata stores the metadata set on this writer.
+	Metadata map[string]string
 }
 
 // Write implements io.Writer.
@@ -115,6 +157,11 @@ func (m *MockGCSWriter) Close() error {
 	return nil
 }
 
+// SetMetadata implements GCSWriter.SetMetadata.
+func (m *MockGCSWriter) SetMetadata(metadata map[string]string) {
+	m.Metadata = metadata
+}
+
 // Ensure MockGCSWriter implements GCSWriter.
 var _ GCSWriter = (*MockGCSWriter)(nil)
 
@@ -127,3 +174,148 @@ type objectNotExistError struct{}
 func (e *objectNotExistError) Error() string {
 	return "storage: object doesn't exist"
 }
+
+// ErrPreconditionFailed is a sentinel error indicating a conditional write or
+// delete was rejected. It mirrors the HTTP 412 error returned by GCS for testing.
+var ErrPreconditionFailed = errors.New("storage: precondition failed")
+
+// MemGCS is an in-memory GCSClient for testing. Objects are kept by name,
+// whatever the bucket, in Objects with their metadata in Metadata, and a write
+// lands when its writer is closed. It is safe for concurrent use; read the maps
+// directly only once no writers are open.
+type MemGCS struct {
+	Objects  map[string][]byte
+	Metadata map[string]map[string]string
+
+	mu          sync.Mutex
+	generations map[string]int64
+}
+
+// NewMemGCS returns an empty MemGCS
+func NewMemGCS() *MemGCS {
+	return &MemGCS{
+		Objects:     make(map[string][]byte),
+		Metadata:    make(map[string]map[string]string),
+		generations: make(map[string]int64),
+	}
+}
+
+// Bucket implements GCSClient.Bucket.
+func (m *MemGCS) Bucket(name string) GCSBucketHandle {
+	return &MockGCSBucketHandle{
+		ObjectFunc: func(name string) GCSObjectHandle {
+			return &memGCSObject{gcs: m, name: name}
+		},
+	}
+}
+
+// Ensure MemGCS implements GCSClient.
+var _ GCSClient = (*MemGCS)(nil)
+
+// generation returns the generation of an existing object, starting objects
+// put in Objects directly at 1. The caller holds mu.
+func (m *MemGCS) generation(name string) int64 {
+	if m.generations[name] == 0 {
+		m.generations[name] = 1
+	}
+	return m.generations[name]
+}
+
+// memGCSObject is an object handle of a MemGCS
+type memGCSObject struct {
+	gcs   *MemGCS
+	name  string
+	conds GCSConditions
+}
+
+// NewReader implements GCSObjectHandle.NewReader.
+func (o *memGCSObject) NewReader(ctx context.Context) (io.ReadCloser, error) {
+	o.gcs.mu.Lock()
+	defer o.gcs.mu.Unlock()
+	data, ok := o.gcs.Objects[o.name]
+	if !ok {
+		return nil, ErrObjectNotExist
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Attrs implements GCSObjectHandle.Attrs.
+func (o *memGCSObject) Attrs(ctx context.Context) (*GCSObjectAttrs, error) {
+	o.gcs.mu.Lock()
+	defer o.gcs.mu.Unlock()
+	data, ok := o.gcs.Objects[o.name]
+	if !ok {
+		return nil, ErrObjectNotExist
+	}
+	return &GCSObjectAttrs{
+		Name:       o.name,
+		Size:       int64(len(data)),
+		Generation: o.gcs.generation(o.name),
+		Metadata:   o.gcs.Metadata[o.name],
+	}, nil
+}
+
+// NewWriter implements GCSObjectHandle.NewWriter. The handle's conditions
+// are checked when the writer is closed.
+func (o *memGCSObject) NewWriter(ctx context.Context) GCSWriter {
+	w := &MockGCSWriter{}
+	w.CloseFunc = func() error {
+		o.gcs.mu.Lock()
+		defer o.gcs.mu.Unlock()
+		if err := o.check(); err != nil {
+			return err
+		}
+		generation := int64(1)
+		if _, exists := o.gcs.Objects[o.name]; exists {
+			generation = o.gcs.generation(o.name) + 1
+		}
+		o.gcs.Objects[o.name] = w.Written
+		o.gcs.Metadata[o.name] = w.Metadata
+		o.gcs.generations[o.name] = generation
+		return nil
+	}
+	return w
+}
+
+// If implements GCSObjectHandle.If.
+func (o *memGCSObject) If(conds GCSConditions) GCSObjectHandle {
+	return &memGCSObject{gcs: o.gcs, name: o.name, conds: conds}
+}
+
+// ReadCompressed implements GCSObjectHandle.ReadCompressed. MemGCS never
+// decompresses, so readers always return the stored bytes.
+func (o *memGCSObject) ReadCompressed(compressed bool) GCSObjectHandle {
+	return o
+}
+
+// Delete implements GCSObjectHandle.Delete.
+func (o *memGCSObject) Delete(ctx context.Context) error {
+	o.gcs.mu.Lock()
+	defer o.gcs.mu.Unlock()
+	if _, ok := o.gcs.Objects[o.name]; !ok {
+		return ErrObjectNotExist
+	}
+	if err := o.check(); err != nil {
+		return err
+	}
+	delete(o.gcs.Objects, o.name)
+	delete(o.gcs.Metadata, o.name)
+	delete(o.gcs.generations, o.name)
+	return nil
+}
+
+// check returns ErrPreconditionFailed if the handle's conditions don't hold.
+// The caller holds mu.
+func (o *memGCSObject) check() error {
+	_, exists := o.gcs.Objects[o.name]
+	if o.conds.DoesNotExist && exists {
+		return ErrPreconditionFailed
+	}
+	if o.conds.GenerationMatch != 0 && (!exists || o.gcs.generation(o.name) != o.conds.GenerationMatch) {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// Ensure memGCSObject implements GCSObjectHandle.
+var _ GCSObjectHandle = (*memGCSObject)(nil)
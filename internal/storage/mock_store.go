@@ -11,8 +11,8 @@ import (
 // MockAlertStore is a mock implementation of AlertStore for testing.
 type MockAlertStore struct {
 	// SavePoliceAlertsFunc is called when SavePoliceAlerts is invoked.
-	// If nil, returns no error.
-	SavePoliceAlertsFunc func(ctx context.Context, alerts []models.WazeAlert, scrapeTime time.Time) error
+	// If nil, reports every POLICE alert as saved with no error.
+	SavePoliceAlertsFunc func(ctx context.Context, alerts []models.WazeAlert, scrapeTime time.Time) (int, error)
 
 	// GetPoliceAlertsByDateRangeFunc is called when GetPoliceAlertsByDateRange is invoked.
 	// If nil, returns empty slice with no error.
@@ -20,7 +20,31 @@ type MockAlertStore struct {
 
 	// GetPoliceAlertsByDatesWithFiltersFunc is called when GetPoliceAlertsByDatesWithFilters is invoked.
 	// If nil, returns empty slice with no error.
-	GetPoliceAlertsByDatesWithFiltersFunc func(ctx context.Context, dates []string, subtypes []string, streets []string) ([]models.PoliceAlert, error)
+	GetPoliceAlertsByDatesWithFiltersFunc func(ctx context.Context, dates []string, filters models.AlertFilters) ([]models.PoliceAlert, error)
+
+	// GetPoliceAlertsActiveAtFunc is called when GetPoliceAlertsActiveAt is invoked.
+	// If nil, returns empty slice with no error.
+	GetPoliceAlertsActiveAtFunc func(ctx context.Context, t time.Time) ([]models.PoliceAlert, error)
+
+	// GetPoliceAlertsUpdatedSinceFunc is called when GetPoliceAlertsUpdatedSince is invoked.
+	// If nil, returns empty slice with since as the cursor and no error.
+	GetPoliceAlertsUpdatedSinceFunc func(ctx context.Context, since time.Time, limit int) ([]models.PoliceAlert, time.Time, error)
+
+	// GetStreetHeatmapFunc is called when GetStreetHeatmap is invoked.
+	// If nil, returns empty slice with no error.
+	GetStreetHeatmapFunc func(ctx context.Context, dates []string) ([]models.StreetCount, error)
+
+	// CountPoliceAlertsPublishedFunc is called when CountPoliceAlertsPublished is invoked.
+	// If nil, returns zero counts with no error.
+	CountPoliceAlertsPublishedFunc func(ctx context.Context, edges []time.Time) ([]int64, error)
+
+	// CountPoliceAlertsByDateRangeFunc is called when CountPoliceAlertsByDateRange is invoked.
+	// If nil, returns zero with no error.
+	CountPoliceAlertsByDateRangeFunc func(ctx context.Context, startDate, endDate time.Time) (int64, error)
+
+	// GetCollectionStatsFunc is called when GetCollectionStats is invoked.
+	// If nil, returns zero stats with no error.
+	GetCollectionStatsFunc func(ctx context.Context) (models.CollectionStats, error)
 
 	// CloseFunc is called when Close is invoked.
 	// If nil, returns no error.
@@ -31,6 +55,12 @@ type MockAlertStore struct {
 		SavePoliceAlertsCalls                  int
 		GetPoliceAlertsByDateRangeCalls        int
 		GetPoliceAlertsByDatesWithFiltersCalls int
+		GetPoliceAlertsActiveAtCalls           int
+		GetPoliceAlertsUpdatedSinceCalls       int
+		GetStreetHeatmapCalls                  int
+		CountPoliceAlertsPublishedCalls        int
+		CountPoliceAlertsByDateRangeCalls      int
+		GetCollectionStatsCalls                int
 		CloseCalls                             int
 		LastSaveAlertsCount                    int
 		LastGetDateRangeArgs                   []time.Time
@@ -39,14 +69,20 @@ type MockAlertStore struct {
 }
 
 // SavePoliceAlerts implements AlertStore.SavePoliceAlerts.
-func (m *MockAlertStore) SavePoliceAlerts(ctx context.Context, alerts []models.WazeAlert, scrapeTime time.Time) error {
+func (m *MockAlertStore) SavePoliceAlerts(ctx context.Context, alerts []models.WazeAlert, scrapeTime time.Time) (int, error) {
 	m.CallLog.SavePoliceAlertsCalls++
 	m.CallLog.LastSaveAlertsCount = len(alerts)
 
 	if m.SavePoliceAlertsFunc != nil {
 		return m.SavePoliceAlertsFunc(ctx, alerts, scrapeTime)
 	}
-	return nil
+	saved := 0
+	for _, alert := range alerts {
+		if alert.Type == "POLICE" {
+			saved++
+		}
+	}
+	return saved, nil
 }
 
 // GetPoliceAlertsByDateRange implements AlertStore.GetPoliceAlertsByDateRange.
@@ -61,16 +97,79 @@ func (m *MockAlertStore) GetPoliceAlertsByDateRange(ctx context.Context, startDa
 }
 
 // GetPoliceAlertsByDatesWithFilters implements AlertStore.GetPoliceAlertsByDatesWithFilters.
-func (m *MockAlertStore) GetPoliceAlertsByDatesWithFilters(ctx context.Context, dates []string, subtypes []string, streets []string) ([]models.PoliceAlert, error) {
+func (m *MockAlertStore) GetPoliceAlertsByDatesWithFilters(ctx context.Context, dates []string, filters models.AlertFilters) ([]models.PoliceAlert, error) {
 	m.CallLog.GetPoliceAlertsByDatesWithFiltersCalls++
 	m.CallLog.LastGetDatesWithFiltersArgs = dates
 
 	if m.GetPoliceAlertsByDatesWithFiltersFunc != nil {
-		return m.GetPoliceAlertsByDatesWithFiltersFunc(ctx, dates, subtypes, streets)
+		return m.GetPoliceAlertsByDatesWithFiltersFunc(ctx, dates, filters)
 	}
 	return []models.PoliceAlert{}, nil
 }
 
+// GetPoliceAlertsActiveAt implements AlertStore.GetPoliceAlertsActiveAt.
+func (m *MockAlertStore) GetPoliceAlertsActiveAt(ctx context.Context, t time.Time) ([]models.PoliceAlert, error) {
+	m.CallLog.GetPoliceAlertsActiveAtCalls++
+
+	if m.GetPoliceAlertsActiveAtFunc != nil {
+		return m.GetPoliceAlertsActiveAtFunc(ctx, t)
+	}
+	return []models.PoliceAlert{}, nil
+}
+
+// GetPoliceAlertsUpdatedSince implements AlertStore.GetPoliceAlertsUpdatedSince.
+func (m *MockAlertStore) GetPoliceAlertsUpdatedSince(ctx context.Context, since time.Time, limit int) ([]models.PoliceAlert, time.Time, error) {
+	m.CallLog.GetPoliceAlertsUpdatedSinceCalls++
+
+	if m.GetPoliceAlertsUpdatedSinceFunc != nil {
+		return m.GetPoliceAlertsUpdatedSinceFunc(ctx, since, limit)
+	}
+	return []models.PoliceAlert{}, since, nil
+}
+
+// GetStreetHeatmap implements AlertStore.GetStreetHeatmap.
+func (m *MockAlertStore) GetStreetHeatmap(ctx context.Context, dates []string) ([]models.StreetCount, error) {
+	m.CallLog.GetStreetHeatmapCalls++
+
+	if m.GetStreetHeatmapFunc != nil {
+		return m.GetStreetHeatmapFunc(ctx, dates)
+	}
+	return []models.StreetCount{}, nil
+}
+
+// CountPoliceAlertsPublished implements AlertStore.CountPoliceAlertsPublished.
+func (m *MockAlertStore) CountPoliceAlertsPublished(ctx context.Context, edges []time.Time) ([]int64, error) {
+	m.CallLog.CountPoliceAlertsPublishedCalls++
+
+	if m.CountPoliceAlertsPublishedFunc != nil {
+		return m.CountPoliceAlertsPublishedFunc(ctx, edges)
+	}
+	if len(edges) < 2 {
+		return nil, nil
+	}
+	return make([]int64, len(edges)-1), nil
+}
+
+// CountPoliceAlertsByDateRange implements AlertStore.CountPoliceAlertsByDateRange.
+func (m *MockAlertStore) CountPoliceAlertsByDateRange(ctx context.Context, startDate, endDate time.Time) (int64, error) {
+	m.CallLog.CountPoliceAlertsByDateRangeCalls++
+
+	if m.CountPoliceAlertsByDateRangeFunc != nil {
+		return m.CountPoliceAlertsByDateRangeFunc(ctx, startDate, endDate)
+	}
+	return 0, nil
+}
+
+// GetCollectionStats implements AlertStore.GetCollectionStats.
+func (m *MockAlertStore) GetCollectionStats(ctx context.Context) (models.CollectionStats, error) {
+	m.CallLog.GetCollectionStatsCalls++
+
+	if m.GetCollectionStatsFunc != nil {
+		return m.GetCollectionStatsFunc(ctx)
+	}
+	return models.CollectionStats{}, nil
+}
+
 // Close implements AlertStore.Close.
 func (m *MockAlertStore) Close() error {
 	m.CallLog.CloseCalls++
@@ -2,13 +2,20 @@ package storage
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"sort"
+	"strings"
 	"time"
+	_ "time/tzdata"
 
 	"cloud.google.com/go/firestore"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/logging"
 	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+	"google.golang.org/api/iterator"
 	"google.golang.org/genproto/googleapis/type/latlng"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -17,49 +24,75 @@ import (
 // SavePoliceAlerts processes and saves POLICE type alerts with lifecycle tracking
 // For new alerts: Initializes all tracking fields
 // For existing alerts: Updates only lifecycle/tracking fields
-func (fc *FirestoreClient) SavePoliceAlerts(ctx context.Context, alerts []models.WazeAlert, scrapeTime time.Time) error {
-	// Filter for POLICE type only
+// Returns the number of alert documents written. A failed alert is logged and
+// skipped, but an error is returned if every alert fails.
+func (fc *FirestoreClient) SavePoliceAlerts(ctx context.Context, alerts []models.WazeAlert, scrapeTime time.Time) (int, error) {
+	// Filter for POLICE type only, restricted to the subtype allowlist if configured
 	policeAlerts := make([]models.WazeAlert, 0)
+	skipped := 0
 	for _, alert := range alerts {
-		if alert.Type == "POLICE" {
-			policeAlerts = append(policeAlerts, alert)
+		if alert.Type != "POLICE" {
+			continue
+		}
+		if fc.storeSubtypes != nil && !fc.storeSubtypes[alert.Subtype] {
+			skipped++
+			continue
 		}
+		policeAlerts = append(policeAlerts, alert)
+	}
+
+	if skipped > 0 {
+		logging.Infof("Skipped %d POLICE alerts with subtypes outside the allowlist", skipped)
 	}
 
 	if len(policeAlerts) == 0 {
-		log.Println("No POLICE alerts to save")
-		return nil
+		logging.Infof("No POLICE alerts to save")
+		return 0, nil
 	}
 
-	log.Printf("Processing %d POLICE alerts", len(policeAlerts))
+	logging.Infof("Processing %d POLICE alerts", len(policeAlerts))
 
 	// Process each alert
+	saved := 0
+	var lastErr error
 	for _, alert := range policeAlerts {
 		if err := fc.processPoliceAlert(ctx, alert, scrapeTime); err != nil {
-			log.Printf("Error processing alert %s: %v", alert.UUID, err)
+			logging.Errorf("Error processing alert %s: %v", alert.UUID, err)
+			lastErr = err
 			// Continue processing other alerts
 			continue
 		}
+		saved++
 	}
 
-	log.Printf("Successfully processed %d POLICE alerts", len(policeAlerts))
-	return nil
+	if saved == 0 {
+		return 0, fmt.Errorf("failed to save any of %d POLICE alerts: %w", len(policeAlerts), lastErr)
+	}
+
+	logging.Infof("Successfully processed %d of %d POLICE alerts", saved, len(policeAlerts))
+	return saved, nil
 }
 
 // processPoliceAlert handles a single police alert (new or existing)
 func (fc *FirestoreClient) processPoliceAlert(ctx context.Context, alert models.WazeAlert, scrapeTime time.Time) error {
-	docRef := fc.client.Collection(fc.collectionName).Doc(alert.UUID)
-
 	// Check if alert already exists
-	docSnap, err := docRef.Get(ctx)
-	if err != nil && status.Code(err) != codes.NotFound {
+	docRef, docSnap, err := fc.lookupAlertDoc(ctx, alert)
+	if err != nil {
 		return fmt.Errorf("failed to check if alert exists: %w", err)
 	}
 
-	// Convert alert to JSON for raw data storage
-	rawJSON, err := json.Marshal(alert)
-	if err != nil {
-		return fmt.Errorf("failed to marshal alert to JSON: %w", err)
+	// Cap comments before anything is stored so re-encoded raw data copies stay bounded too
+	var commentsTruncated bool
+	alert.Comments, commentsTruncated = capComments(alert.Comments, fc.maxComments)
+
+	// Store the bytes Waze sent when the client preserved them, otherwise the
+	// alert re-encoded as JSON
+	rawJSON := []byte(alert.Raw)
+	if rawJSON == nil {
+		rawJSON, err = json.Marshal(alert)
+		if err != nil {
+			return fmt.Errorf("failed to marshal alert to JSON: %w", err)
+		}
 	}
 	rawJSONStr := string(rawJSON)
 
@@ -71,7 +104,7 @@ func (fc *FirestoreClient) processPoliceAlert(ctx context.Context, alert models.
 
 	if !docSnap.Exists() {
 		// NEW ALERT - Initialize all fields
-		log.Printf("New POLICE alert: %s", alert.UUID)
+		logging.Debugf("New POLICE alert: %s", alert.UUID)
 
 		policeAlert := models.PoliceAlert{
 			// Core data
@@ -110,22 +143,48 @@ func (fc *FirestoreClient) processPoliceAlert(ctx context.Context, alert models.
 			NThumbsUpInitial: alert.NThumbsUp,
 			NThumbsUpLast:    alert.NThumbsUp,
 
+			// Comments
+			Comments:          alert.Comments,
+			CommentsTruncated: commentsTruncated,
+
 			// Raw data
 			RawDataInitial: rawJSONStr,
 			RawDataLast:    rawJSONStr,
 		}
 
+		if fc.sourceBBox {
+			policeAlert.SourceBBox = alert.SourceBBox
+		}
+		if fc.fingerprints {
+			policeAlert.Fingerprint = alertFingerprint(alert)
+		}
+		if fc.revision != "" {
+			policeAlert.ScrapedByRevision = fc.revision
+		}
+		if fc.peakReliability {
+			policeAlert.ReliabilityMax = alert.Reliability
+			policeAlert.ConfidenceMax = alert.Confidence
+		}
+		if fc.commentsInSubcollection() {
+			policeAlert.Comments = nil
+		}
+
 		// Save to Firestore
 		_, err = docRef.Set(ctx, policeAlert)
 		if err != nil {
 			return fmt.Errorf("failed to create new police alert: %w", err)
 		}
+		if fc.commentsInSubcollection() {
+			if err := fc.saveComments(ctx, docRef, alert.Comments, 0); err != nil {
+				return err
+			}
+		}
 
-		log.Printf("Created new alert %s in %s, %s", alert.UUID, alert.City, alert.Country)
+		logging.Debugf("Created new alert %s in %s, %s", alert.UUID, alert.City, alert.Country)
 
 	} else {
 		// EXISTING ALERT - Update only tracking fields
-		log.Printf("Updating existing POLICE alert: %s", alert.UUID)
+		logging.Debugf("Updating existing POLICE alert: %s", alert.UUID)
 
 		// Calculate activeMillis: current scrapeTime - original publishTime
 		expireMillis := scrapeTime.UnixMilli()
@@ -146,17 +205,201 @@ func (fc *FirestoreClient) processPoliceAlert(ctx context.Context, alert models.
 			)
 		}
 
+		// The fingerprint is fixed when first stored, so later changes to the
+		// reported location don't alter it
+		if fc.fingerprints {
+			if _, err := docSnap.DataAt("fingerprint"); err != nil {
+				updates = append(updates, firestore.Update{Path: "fingerprint", Value: alertFingerprint(alert)})
+			}
+		}
+
+		if fc.peakReliability {
+			updates = append(updates, peakUpdates(docSnap, alert)...)
+		}
+
+		if fc.revision != "" {
+			updates = append(updates, firestore.Update{Path: "scraped_by_revision", Value: fc.revision})
+		}
+
+		if len(alert.Comments) > 0 {
+			if fc.commentsInSubcollection() {
+				// Only comments newer than the last stored verification are new
+				var existing models.PoliceAlert
+				if err := docSnap.DataTo(&existing); err != nil {
+					return fmt.Errorf("failed to parse existing police alert: %w", err)
+				}
+				var afterMillis int64
+				if existing.LastVerificationMillis != nil {
+					afterMillis = *existing.LastVerificationMillis
+				}
+				comments := alert.Comments
+				if len(existing.Comments) > 0 {
+					// Move comments stored inline before switching to subcollections
+					comments = append(append([]models.Comment(nil), existing.Comments...), alert.Comments...)
+					afterMillis = 0
+					updates = append(updates, firestore.Update{Path: "comments", Value: firestore.Delete})
+				}
+				if err := fc.saveComments(ctx, docRef, comments, afterMillis); err != nil {
+					return err
+				}
+			} else {
+				updates = append(updates, firestore.Update{Path: "comments", Value: alert.Comments})
+			}
+			updates = append(updates, firestore.Update{Path: "comments_truncated", Value: commentsTruncated})
+		}
+
 		_, err = docRef.Update(ctx, updates)
 		if err != nil {
 			return fmt.Errorf("failed to update police alert: %w", err)
 		}
 
-		log.Printf("Updated alert %s (active for %d ms)", alert.UUID, activeMillis)
+		logging.Debugf("Updated alert %s (active for %d ms)", alert.UUID, activeMillis)
 	}
 
 	return nil
 }
 
+// peakUpdates returns updates raising reliability_max and confidence_max to the
+// scraped values where they exceed the stored peaks. A document without a peak
+// yet starts from its initial reliability or confidence.
+func peakUpdates(docSnap *firestore.DocumentSnapshot, alert models.WazeAlert) []firestore.Update {
+	var updates []firestore.Update
+	for _, peak := range []struct {
+		path, initialPath string
+		scraped           int
+	}{
+		{"reliability_max", "reliability", alert.Reliability},
+		{"confidence_max", "confidence", alert.Confidence},
+	} {
+		stored, ok := storedInt(docSnap, peak.path)
+		if !ok {
+			stored, _ = storedInt(docSnap, peak.initialPath)
+		}
+		if int64(peak.scraped) > stored || !ok {
+			updates = append(updates, firestore.Update{Path: peak.path, Value: max(int64(peak.scraped), stored)})
+		}
+	}
+	return updates
+}
+
+// storedInt returns an integer field of a document, reporting false when it is
+// missing or not an integer
+func storedInt(docSnap *firestore.DocumentSnapshot, path string) (int64, bool) {
+	v, err := docSnap.DataAt(path)
+	if err != nil {
+		return 0, false
+	}
+	n, ok := v.(int64)
+	return n, ok
+}
+
+// alertDocID returns the document ID for an alert: its UUID, or in composite ID
+// mode the UUID followed by its publish day in Canberra time
+func (fc *FirestoreClient) alertDocID(alert models.WazeAlert) string {
+	if !fc.compositeIDs {
+		return alert.UUID
+	}
+	return compositeDocID(alert.UUID, alert.PubMillis)
+}
+
+// docIDLocation is the time zone of the publish day in composite document IDs,
+// the same one archives are named in
+var docIDLocation = mustLoadLocation("Australia/Canberra")
+
+// mustLoadLocation loads the named time zone from the embedded tzdata
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(fmt.Sprintf("failed to load location %s: %v", name, err))
+	}
+	return loc
+}
+
+// compositeDocID builds a "UUID_YYYY-MM-DD" document ID from the publish day in
+// Canberra time
+func compositeDocID(uuid string, pubMillis int64) string {
+	return fmt.Sprintf("%s_%s", uuid, time.UnixMilli(pubMillis).In(docIDLocation).Format("2006-01-02"))
+}
+
+// fingerprintPrecision is the number of decimal places coordinates are rounded
+// to in fingerprints (about 11 m), so float noise doesn't change them
+const fingerprintPrecision = 4
+
+// alertFingerprint returns a hex SHA-256 of the fields of an alert that don't
+// change over its lifetime: UUID, pubMillis, subtype and rounded location
+func alertFingerprint(alert models.WazeAlert) string {
+	key := fmt.Sprintf("%s|%d|%s|%.*f|%.*f",
+		alert.UUID, alert.PubMillis, alert.Subtype,
+		fingerprintPrecision, alert.Location.Latitude,
+		fingerprintPrecision, alert.Location.Longitude)
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookupAlertDoc finds the document for an alert. In composite ID mode, a
+// missing composite document falls back to a legacy UUID-keyed document, but
+// only if that document was published on the same day (otherwise the UUID has
+// been reused and a new composite document is created). Legacy documents found
+// this way are remembered, so later scrapes of the alert read them directly
+// instead of looking for the composite document first.
+func (fc *FirestoreClient) lookupAlertDoc(ctx context.Context, alert models.WazeAlert) (*firestore.DocumentRef, *firestore.DocumentSnapshot, error) {
+	collection := fc.client.Collection(fc.collectionName)
+	docRef := collection.Doc(fc.alertDocID(alert))
+
+	if cached, ok := fc.legacyDocs.Load(docRef.ID); ok {
+		legacyRef := cached.(*firestore.DocumentRef)
+		legacySnap, err := legacyRef.Get(ctx)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return nil, nil, err
+		}
+		if legacySnap.Exists() {
+			return legacyRef, legacySnap, nil
+		}
+		// The legacy document was deleted, so look the alert up afresh
+		fc.legacyDocs.Delete(docRef.ID)
+	}
+
+	docSnap, err := docRef.Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return nil, nil, err
+	}
+	if !fc.compositeIDs || docSnap.Exists() {
+		return docRef, docSnap, nil
+	}
+
+	legacyRef := collection.Doc(alert.UUID)
+	legacySnap, err := legacyRef.Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return nil, nil, err
+	}
+	if legacySnap.Exists() {
+		var existing models.PoliceAlert
+		if err := legacySnap.DataTo(&existing); err == nil &&
+			compositeDocID(alert.UUID, existing.PublishTime.UnixMilli()) == docRef.ID {
+			fc.legacyDocs.Store(docRef.ID, legacyRef)
+			return legacyRef, legacySnap, nil
+		}
+	}
+
+	return docRef, docSnap, nil
+}
+
+// capComments keeps the most recent max comments by ReportMillis, returned oldest
+// first, and reports whether any older comments were dropped
+func capComments(comments []models.Comment, max int) ([]models.Comment, bool) {
+	if max < 1 || len(comments) <= max {
+		return comments, false
+	}
+
+	sorted := make([]models.Comment, len(comments))
+	copy(sorted, comments)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ReportMillis < sorted[j].ReportMillis
+	})
+
+	return sorted[len(sorted)-max:], true
+}
+
 // extractLastVerification finds the latest reportMillis from comments
 // Returns nil if no comments or empty comments array
 func extractLastVerification(comments []models.Comment) (*int64, *time.Time) {
@@ -183,59 +426,147 @@ func extractLastVerification(comments []models.Comment) (*int64, *time.Time) {
 // An alert is considered active if: expire_time >= startDate AND publish_time <= endDate
 // This captures all alerts whose lifecycle overlaps with the specified date range
 func (fc *FirestoreClient) GetPoliceAlertsByDateRange(ctx context.Context, startDate, endDate time.Time) ([]models.PoliceAlert, error) {
-	log.Printf("Querying police alerts active from %s to %s", startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
+	logging.Infof("Querying police alerts active from %s to %s", startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
+	return fc.policeAlertsActiveBetween(ctx, startDate, endDate)
+}
+
+// GetPoliceAlertsActiveAt retrieves police alerts that were active at the instant t
+// An alert is considered active if: publish_time <= t AND expire_time >= t
+func (fc *FirestoreClient) GetPoliceAlertsActiveAt(ctx context.Context, t time.Time) ([]models.PoliceAlert, error) {
+	logging.Infof("Querying police alerts active at %s", t.Format(time.RFC3339))
+	return fc.policeAlertsActiveBetween(ctx, t, t)
+}
 
+// policeAlertsActiveBetween retrieves police alerts whose lifecycle overlaps
+// start to end: expire_time >= start AND publish_time <= end
+func (fc *FirestoreClient) policeAlertsActiveBetween(ctx context.Context, start, end time.Time) ([]models.PoliceAlert, error) {
 	query := fc.client.Collection(fc.collectionName).
-		Where("expire_time", ">=", startDate).
-		Where("publish_time", "<=", endDate).
+		Where("expire_time", ">=", start).
+		Where("publish_time", "<=", end).
 		OrderBy("expire_time", firestore.Asc).
 		OrderBy("publish_time", firestore.Asc)
 
 	docs, err := query.Documents(ctx).GetAll()
 	if err != nil {
-		return nil, fmt.Errorf("failed to query police alerts: %w", err)
+		return nil, fmt.Errorf("failed to query police alerts: %w", missingIndex(err))
 	}
 
-	alerts := make([]models.PoliceAlert, 0, len(docs))
-	for _, doc := range docs {
-		var alert models.PoliceAlert
-		if err := doc.DataTo(&alert); err != nil {
-			log.Printf("Failed to parse alert %s: %v", doc.Ref.ID, err)
-			continue
+	alerts, refs := decodeAlerts(docs)
+	if err := fc.attachComments(ctx, alerts, refs); err != nil {
+		return nil, err
+	}
+
+	logging.Infof("Retrieved %d police alerts from Firestore", len(alerts))
+	return alerts, nil
+}
+
+// GetPoliceAlertsUpdatedSince retrieves up to limit police alerts whose
+// expire_time (advanced on every scrape that sees the alert) is after since,
+// ordered by expire_time ascending. It also returns the cursor for the next
+// call: the expire_time of the last alert returned, or since if none were.
+//
+// Every alert seen by a scrape shares that scrape's time, so a page never ends
+// part way through a timestamp: trailing alerts tied with the next page are
+// dropped, and a page that is entirely one timestamp is widened to all of it.
+func (fc *FirestoreClient) GetPoliceAlertsUpdatedSince(ctx context.Context, since time.Time, limit int) ([]models.PoliceAlert, time.Time, error) {
+	if limit < 1 {
+		return nil, since, fmt.Errorf("limit must be positive, got %d", limit)
+	}
+
+	docs, err := fc.client.Collection(fc.collectionName).
+		Where("expire_time", ">", since).
+		OrderBy("expire_time", firestore.Asc).
+		Limit(limit).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, since, fmt.Errorf("failed to query updated police alerts: %w", missingIndex(err))
+	}
+
+	alerts, refs := decodeAlerts(docs)
+	widened := false
+	if len(docs) == limit && len(alerts) > 0 {
+		last := alerts[len(alerts)-1].ExpireTime
+		if alerts[0].ExpireTime.Equal(last) {
+			alerts, err = fc.policeAlertsExpiringAt(ctx, last)
+			if err != nil {
+				return nil, since, err
+			}
+			widened = true
+		} else {
+			for len(alerts) > 0 && alerts[len(alerts)-1].ExpireTime.Equal(last) {
+				alerts, refs = alerts[:len(alerts)-1], refs[:len(refs)-1]
+			}
+		}
+	}
+	if !widened {
+		if err := fc.attachComments(ctx, alerts, refs); err != nil {
+			return nil, since, err
 		}
-		alerts = append(alerts, alert)
 	}
 
-	log.Printf("Retrieved %d police alerts from Firestore", len(alerts))
+	nextSince := since
+	if len(alerts) > 0 {
+		nextSince = alerts[len(alerts)-1].ExpireTime
+	}
+
+	logging.Infof("Retrieved %d police alerts updated since %s", len(alerts), since.Format(time.RFC3339Nano))
+	return alerts, nextSince, nil
+}
+
+// policeAlertsExpiringAt retrieves every police alert whose expire_time is exactly t
+func (fc *FirestoreClient) policeAlertsExpiringAt(ctx context.Context, t time.Time) ([]models.PoliceAlert, error) {
+	docs, err := fc.client.Collection(fc.collectionName).
+		Where("expire_time", "==", t).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query police alerts expiring at %s: %w", t.Format(time.RFC3339Nano), missingIndex(err))
+	}
+
+	alerts, refs := decodeAlerts(docs)
+	if err := fc.attachComments(ctx, alerts, refs); err != nil {
+		return nil, err
+	}
 	return alerts, nil
 }
 
 // GetPoliceAlertsByDatesWithFilters retrieves police alerts for multiple specific dates with optional filters
 // Each date should be in YYYY-MM-DD format. The function queries alerts active on each date
-// and applies optional subtype and street filters.
-func (fc *FirestoreClient) GetPoliceAlertsByDatesWithFilters(ctx context.Context, dates []string, subtypes []string, streets []string) ([]models.PoliceAlert, error) {
+// and applies the optional filters.
+func (fc *FirestoreClient) GetPoliceAlertsByDatesWithFilters(ctx context.Context, dates []string, filters models.AlertFilters) ([]models.PoliceAlert, error) {
 	if len(dates) == 0 {
 		return nil, fmt.Errorf("at least one date is required")
 	}
+	if err := checkFilterCounts(filters, fc.maxFilterValues); err != nil {
+		return nil, err
+	}
+	if !validPresence(filters.StreetPresence) {
+		return nil, fmt.Errorf("invalid street presence %q", filters.StreetPresence)
+	}
+	if !validPresence(filters.CityPresence) {
+		return nil, fmt.Errorf("invalid city presence %q", filters.CityPresence)
+	}
+
+	logging.Infof("Querying police alerts for %d dates with filters %+v", len(dates), filters)
 
-	log.Printf("Querying police alerts for %d dates with filters (subtypes: %v, streets: %v)", len(dates), subtypes, streets)
+	matches := fc.alertFilter(filters)
 
-	// Use a map to deduplicate alerts by UUID across multiple date queries
+	// Use a map to deduplicate alerts by document across multiple date queries
 	alertsMap := make(map[string]models.PoliceAlert)
+	refsMap := make(map[string]*firestore.DocumentRef)
 
 	// Query alerts for each date
 	for _, dateStr := range dates {
 		// Parse the date string (YYYY-MM-DD) explicitly in UTC to avoid timezone issues
 		dayStart, err := time.ParseInLocation("2006-01-02", dateStr, time.UTC)
 		if err != nil {
-			log.Printf("Invalid date format '%s': %v", dateStr, err)
+			logging.Warnf("Invalid date format '%s': %v", dateStr, err)
 			continue
 		}
 
 		// Set end time to end of day (still in UTC)
 		dayEnd := dayStart.Add(24*time.Hour - time.Second)
 
-		log.Printf("Querying alerts for %s (expire_time >= %s AND publish_time <= %s)",
+		logging.Debugf("Querying alerts for %s (expire_time >= %s AND publish_time <= %s)",
 			dateStr, dayStart.Format("2006-01-02 15:04:05"), dayEnd.Format("2006-01-02 15:04:05"))
 
 		// Query alerts where:
@@ -247,52 +578,289 @@ func (fc *FirestoreClient) GetPoliceAlertsByDatesWithFilters(ctx context.Context
 
 		docs, err := query.Documents(ctx).GetAll()
 		if err != nil {
-			log.Printf("Failed to query police alerts for %s: %v", dateStr, err)
+			// Every date runs the same query, so a missing index fails them all
+			var indexErr *MissingIndexError
+			if errors.As(missingIndex(err), &indexErr) {
+				return nil, fmt.Errorf("failed to query police alerts for %s: %w", dateStr, indexErr)
+			}
+			logging.Errorf("Failed to query police alerts for %s: %v", dateStr, err)
 			continue
 		}
 
-		log.Printf("Retrieved %d documents for %s", len(docs), dateStr)
+		logging.Debugf("Retrieved %d documents for %s", len(docs), dateStr)
 
 		// Process documents and deduplicate
-		for _, doc := range docs {
-			var alert models.PoliceAlert
-			if err := doc.DataTo(&alert); err != nil {
-				log.Printf("Failed to parse alert %s: %v", doc.Ref.ID, err)
+		decoded, refs := decodeAlerts(docs)
+		for i, alert := range decoded {
+			if !matches(alert) {
 				continue
 			}
 
-			// Apply filters
-			if len(subtypes) > 0 && !contains(subtypes, alert.Subtype) {
-				continue
+			// Add to map (deduplicates by document ID, which is the UUID
+			// unless composite IDs are enabled)
+			if _, exists := alertsMap[refs[i].ID]; !exists {
+				alertsMap[refs[i].ID] = alert
+				refsMap[refs[i].ID] = refs[i]
 			}
+		}
+	}
 
-			if len(streets) > 0 && !contains(streets, alert.Street) {
-				continue
+	// Convert map to slice, reading comments only for the matching alerts
+	alerts := make([]models.PoliceAlert, 0, len(alertsMap))
+	refs := make([]*firestore.DocumentRef, 0, len(alertsMap))
+	for id, alert := range alertsMap {
+		alerts = append(alerts, alert)
+		refs = append(refs, refsMap[id])
+	}
+	if err := fc.attachComments(ctx, alerts, refs); err != nil {
+		return nil, err
+	}
+
+	logging.Infof("Retrieved %d unique police alerts from Firestore after filtering", len(alerts))
+	return alerts, nil
+}
+
+// GetStreetHeatmap aggregates police alerts active on the given dates by street.
+// Counts and coordinate sums are accumulated while iterating the query results,
+// so alerts are never held in memory as a full slice. Alerts appearing on
+// multiple dates are counted once, and alerts without a street name are skipped.
+func (fc *FirestoreClient) GetStreetHeatmap(ctx context.Context, dates []string) ([]models.StreetCount, error) {
+	if len(dates) == 0 {
+		return nil, fmt.Errorf("at least one date is required")
+	}
+
+	agg := newStreetAggregator()
+
+	for _, dateStr := range dates {
+		// Parse the date string (YYYY-MM-DD) explicitly in UTC, matching GetPoliceAlertsByDatesWithFilters
+		dayStart, err := time.ParseInLocation("2006-01-02", dateStr, time.UTC)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date format '%s': %w", dateStr, err)
+		}
+		dayEnd := dayStart.Add(24*time.Hour - time.Second)
+
+		iter := fc.client.Collection(fc.collectionName).
+			Where("expire_time", ">=", dayStart).
+			Where("publish_time", "<=", dayEnd).
+			Documents(ctx)
+
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				iter.Stop()
+				return nil, fmt.Errorf("failed to query police alerts for %s: %w", dateStr, missingIndex(err))
 			}
 
-			// Add to map (deduplicates by UUID)
-			if _, exists := alertsMap[alert.UUID]; !exists {
-				alertsMap[alert.UUID] = alert
+			var alert models.PoliceAlert
+			if err := doc.DataTo(&alert); err != nil {
+				logging.Warnf("Failed to parse alert %s: %v", doc.Ref.ID, err)
+				continue
 			}
+			agg.add(doc.Ref.ID, alert)
 		}
+		iter.Stop()
 	}
 
-	// Convert map to slice
-	alerts := make([]models.PoliceAlert, 0, len(alertsMap))
-	for _, alert := range alertsMap {
-		alerts = append(alerts, alert)
+	streets := agg.results()
+	logging.Infof("Aggregated %d streets for heatmap across %d dates", len(streets), len(dates))
+	return streets, nil
+}
+
+// streetAggregator accumulates per-street alert counts and coordinate sums
+type streetAggregator struct {
+	seen    map[string]bool
+	streets map[string]*streetTotals
+}
+
+type streetTotals struct {
+	count     int
+	located   int
+	latitude  float64
+	longitude float64
+}
+
+func newStreetAggregator() *streetAggregator {
+	return &streetAggregator{
+		seen:    make(map[string]bool),
+		streets: make(map[string]*streetTotals),
 	}
+}
 
-	log.Printf("Retrieved %d unique police alerts from Firestore after filtering", len(alerts))
-	return alerts, nil
+// add records an alert, ignoring duplicates (by document ID) and alerts without a street
+func (a *streetAggregator) add(docID string, alert models.PoliceAlert) {
+	if alert.Street == "" || a.seen[docID] {
+		return
+	}
+	a.seen[docID] = true
+
+	totals, ok := a.streets[alert.Street]
+	if !ok {
+		totals = &streetTotals{}
+		a.streets[alert.Street] = totals
+	}
+	totals.count++
+
+	if alert.LocationGeo != nil {
+		totals.located++
+		totals.latitude += alert.LocationGeo.Latitude
+		totals.longitude += alert.LocationGeo.Longitude
+	}
 }
 
-// contains checks if a string slice contains a specific value
-func contains(slice []string, value string) bool {
-	for _, item := range slice {
-		if item == value {
-			return true
+// results returns streets sorted by alert count (descending), then street name
+func (a *streetAggregator) results() []models.StreetCount {
+	streets := make([]models.StreetCount, 0, len(a.streets))
+	for name, totals := range a.streets {
+		sc := models.StreetCount{Street: name, Count: totals.count}
+		if totals.located > 0 {
+			sc.Latitude = totals.latitude / float64(totals.located)
+			sc.Longitude = totals.longitude / float64(totals.located)
+		}
+		streets = append(streets, sc)
+	}
+
+	sort.Slice(streets, func(i, j int) bool {
+		if streets[i].Count != streets[j].Count {
+			return streets[i].Count > streets[j].Count
 		}
+		return streets[i].Street < streets[j].Street
+	})
+	return streets
+}
+
+// validPresence reports whether presence is one of the models.Presence values
+func validPresence(presence string) bool {
+	switch presence {
+	case models.PresenceAny, models.PresenceNamed, models.PresenceUnnamed:
+		return true
 	}
 	return false
 }
+
+// matchesPresence reports whether a street or city name satisfies a presence
+// filter. Whitespace-only names count as unnamed.
+func matchesPresence(presence, name string) bool {
+	named := strings.TrimSpace(name) != ""
+	switch presence {
+	case models.PresenceNamed:
+		return named
+	case models.PresenceUnnamed:
+		return !named
+	}
+	return true
+}
+
+// alertFilter returns a function reporting whether an alert passes filters.
+// The subtype, street and city lists are turned into sets once, so checking an
+// alert costs the same however many values were requested.
+func (fc *FirestoreClient) alertFilter(filters models.AlertFilters) func(models.PoliceAlert) bool {
+	subtypes := stringSet(filters.Subtypes)
+	streetMatcher := fc.nameMatcher(filters.Streets)
+	cityMatcher := fc.nameMatcher(filters.Cities)
+
+	return func(alert models.PoliceAlert) bool {
+		if len(subtypes) > 0 {
+			if _, ok := subtypes[alert.Subtype]; !ok {
+				return false
+			}
+		}
+		if len(filters.Streets) > 0 && !streetMatcher(alert.Street) {
+			return false
+		}
+		if len(filters.Cities) > 0 && !cityMatcher(alert.City) {
+			return false
+		}
+		return matchesPresence(filters.StreetPresence, alert.Street) && matchesPresence(filters.CityPresence, alert.City)
+	}
+}
+
+// nameMatcher returns a function reporting whether a street or city name is
+// one of names, comparing normalized names when normalized filters are enabled
+func (fc *FirestoreClient) nameMatcher(names []string) func(string) bool {
+	if !fc.normalizeNames {
+		set := stringSet(names)
+		return func(name string) bool {
+			_, ok := set[name]
+			return ok
+		}
+	}
+	normalized := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		normalized[normalizeName(name)] = struct{}{}
+	}
+	return func(name string) bool {
+		_, ok := normalized[normalizeName(name)]
+		return ok
+	}
+}
+
+// nameAbbreviations maps common Australian road type abbreviations to the
+// word they abbreviate
+var nameAbbreviations = map[string]string{
+	"ave":  "avenue",
+	"bvd":  "boulevard",
+	"blvd": "boulevard",
+	"cct":  "circuit",
+	"cres": "crescent",
+	"dr":   "drive",
+	"fwy":  "freeway",
+	"hwy":  "highway",
+	"la":   "lane",
+	"ln":   "lane",
+	"mwy":  "motorway",
+	"pde":  "parade",
+	"pl":   "place",
+	"rd":   "road",
+	"st":   "street",
+	"tce":  "terrace",
+}
+
+// normalizeName lowercases a street or city name, collapses whitespace and
+// expands abbreviated words (with or without a trailing dot), so "Hume  Hwy."
+// and "hume highway" normalize to the same name
+func normalizeName(name string) string {
+	words := strings.Fields(strings.ToLower(name))
+	for i, word := range words {
+		if full, ok := nameAbbreviations[strings.TrimSuffix(word, ".")]; ok {
+			words[i] = full
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// ErrTooManyFilterValues is returned when a filter list is longer than the
+// client's limit. Callers serving HTTP should answer it with 400 Bad Request.
+var ErrTooManyFilterValues = errors.New("too many filter values")
+
+// checkFilterCounts rejects filters with a list longer than max (zero allows any length)
+func checkFilterCounts(filters models.AlertFilters, max int) error {
+	if max <= 0 {
+		return nil
+	}
+	for _, list := range []struct {
+		name   string
+		values []string
+	}{
+		{"subtypes", filters.Subtypes},
+		{"streets", filters.Streets},
+		{"cities", filters.Cities},
+	} {
+		if len(list.values) > max {
+			return fmt.Errorf("%w: %d %s, maximum is %d", ErrTooManyFilterValues, len(list.values), list.name, max)
+		}
+	}
+	return nil
+}
+
+// stringSet returns the distinct values of a slice as a set for O(1) lookups.
+// The empty string is kept, so a filter of [""] matches alerts with no value.
+func stringSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		set[v] = struct{}{}
+	}
+	return set
+}
@@ -1,10 +1,17 @@
 package storage
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+	"google.golang.org/genproto/googleapis/type/latlng"
 )
 
 func TestExtractLastVerification(t *testing.T) {
@@ -91,7 +98,7 @@ func TestExtractLastVerification(t *testing.T) {
 	}
 }
 
-func TestContains(t *testing.T) {
+func TestStringSet(t *testing.T) {
 	tests := []struct {
 		name     string
 		slice    []string
@@ -150,9 +157,9 @@ func TestContains(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := contains(tt.slice, tt.value)
+			_, result := stringSet(tt.slice)[tt.value]
 			if result != tt.expected {
-				t.Errorf("contains(%v, %q) = %v, expected %v", tt.slice, tt.value, result, tt.expected)
+				t.Errorf("stringSet(%v) has %q = %v, expected %v", tt.slice, tt.value, result, tt.expected)
 			}
 		})
 	}
@@ -377,18 +384,12 @@ func TestPoliceAlertFiltering(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Apply filters manually (simulating the filtering logic)
+			matches := (&FirestoreClient{}).alertFilter(models.AlertFilters{Subtypes: tt.subtypes, Streets: tt.streets})
 			var filtered []models.PoliceAlert
 			for _, alert := range alerts {
-				// Check subtype filter
-				if len(tt.subtypes) > 0 && !contains(tt.subtypes, alert.Subtype) {
-					continue
+				if matches(alert) {
+					filtered = append(filtered, alert)
 				}
-				// Check street filter
-				if len(tt.streets) > 0 && !contains(tt.streets, alert.Street) {
-					continue
-				}
-				filtered = append(filtered, alert)
 			}
 
 			if len(filtered) != tt.expectedCount {
@@ -412,6 +413,67 @@ func TestPoliceAlertFiltering(t *testing.T) {
 	}
 }
 
+func TestAlertFilterEmptyStringValues(t *testing.T) {
+	alerts := []models.PoliceAlert{
+		{UUID: "named", Subtype: "POLICE_VISIBLE", Street: "Hume Highway", City: "Canberra"},
+		{UUID: "blank", Subtype: "", Street: "", City: ""},
+	}
+
+	tests := []struct {
+		name     string
+		filters  models.AlertFilters
+		expected []string
+	}{
+		{"empty subtype matches only blank subtype", models.AlertFilters{Subtypes: []string{""}}, []string{"blank"}},
+		{"empty city matches only blank city", models.AlertFilters{Cities: []string{""}}, []string{"blank"}},
+		{"empty street alongside a name matches both", models.AlertFilters{Streets: []string{"", "Hume Highway"}}, []string{"named", "blank"}},
+		{"duplicate values match once", models.AlertFilters{Subtypes: []string{"POLICE_VISIBLE", "POLICE_VISIBLE"}}, []string{"named"}},
+		{"empty lists match everything", models.AlertFilters{Subtypes: []string{}, Streets: []string{}}, []string{"named", "blank"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches := (&FirestoreClient{}).alertFilter(tt.filters)
+			var got []string
+			for _, alert := range alerts {
+				if matches(alert) {
+					got = append(got, alert.UUID)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("matched %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+// BenchmarkAlertFilter compares the set lookups used by alertFilter with the
+// linear scan they replaced, for filter lists of increasing length
+func BenchmarkAlertFilter(b *testing.B) {
+	alert := models.PoliceAlert{Subtype: "POLICE_VISIBLE", Street: "Not Listed Street"}
+
+	for _, n := range []int{10, 100, 1000} {
+		streets := make([]string, n)
+		for i := range streets {
+			streets[i] = fmt.Sprintf("Street %d", i)
+		}
+		filters := models.AlertFilters{Subtypes: []string{"POLICE_HIDING", "POLICE_VISIBLE"}, Streets: streets}
+
+		b.Run(fmt.Sprintf("linear/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_ = slices.Contains(filters.Subtypes, alert.Subtype) && slices.Contains(filters.Streets, alert.Street)
+			}
+		})
+		b.Run(fmt.Sprintf("set/%d", n), func(b *testing.B) {
+			matches := (&FirestoreClient{}).alertFilter(filters)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_ = matches(alert)
+			}
+		})
+	}
+}
+
 // TestActiveMillisCalculation tests the calculation of active duration
 func TestActiveMillisCalculation(t *testing.T) {
 	tests := []struct {
@@ -479,3 +541,360 @@ func TestPoliceAlertTypeFiltering(t *testing.T) {
 		}
 	}
 }
+
+func TestStreetAggregator(t *testing.T) {
+	geo := func(lat, lng float64) *latlng.LatLng {
+		return &latlng.LatLng{Latitude: lat, Longitude: lng}
+	}
+
+	agg := newStreetAggregator()
+	for _, alert := range []models.PoliceAlert{
+		{UUID: "a1", Street: "Main St", LocationGeo: geo(-35.0, 149.0)},
+		{UUID: "a2", Street: "Main St", LocationGeo: geo(-35.2, 149.2)},
+		{UUID: "a3", Street: "Main St", LocationGeo: geo(-35.4, 149.4)},
+		{UUID: "a1", Street: "Main St", LocationGeo: geo(-36.0, 150.0)}, // duplicate from another date
+		{UUID: "b1", Street: "Side Rd", LocationGeo: geo(-35.5, 149.5)},
+		{UUID: "b2", Street: "Side Rd"}, // no location
+		{UUID: "c1", Street: "Alpha Ave", LocationGeo: geo(-35.1, 149.1)},
+		{UUID: "d1", Street: "", LocationGeo: geo(-35.9, 149.9)}, // unnamed street
+	} {
+		agg.add(alert.UUID, alert)
+	}
+
+	got := agg.results()
+	want := []models.StreetCount{
+		{Street: "Main St", Count: 3, Latitude: -35.2, Longitude: 149.2},
+		{Street: "Side Rd", Count: 2, Latitude: -35.5, Longitude: 149.5},
+		{Street: "Alpha Ave", Count: 1, Latitude: -35.1, Longitude: 149.1},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("expected %d streets, got %d: %+v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i].Street != want[i].Street || got[i].Count != want[i].Count {
+			t.Errorf("street %d: expected %s (%d), got %s (%d)", i, want[i].Street, want[i].Count, got[i].Street, got[i].Count)
+		}
+		if math.Abs(got[i].Latitude-want[i].Latitude) > 1e-9 || math.Abs(got[i].Longitude-want[i].Longitude) > 1e-9 {
+			t.Errorf("%s: expected (%f, %f), got (%f, %f)", want[i].Street,
+				want[i].Latitude, want[i].Longitude, got[i].Latitude, got[i].Longitude)
+		}
+	}
+}
+
+func TestStreetAggregator_TiesSortedByName(t *testing.T) {
+	agg := newStreetAggregator()
+	agg.add("1", models.PoliceAlert{UUID: "1", Street: "Zeta St"})
+	agg.add("2", models.PoliceAlert{UUID: "2", Street: "Beta St"})
+
+	got := agg.results()
+	if len(got) != 2 || got[0].Street != "Beta St" || got[1].Street != "Zeta St" {
+		t.Errorf("expected ties ordered by street name, got %+v", got)
+	}
+	if got[0].Latitude != 0 || got[0].Longitude != 0 {
+		t.Errorf("expected zero coordinates for street without locations, got %+v", got[0])
+	}
+}
+
+func TestCapComments(t *testing.T) {
+	comments := []models.Comment{
+		{ReportMillis: 5000, Text: "fifth"},
+		{ReportMillis: 1000, Text: "first"},
+		{ReportMillis: 4000, Text: "fourth"},
+		{ReportMillis: 2000, Text: "second"},
+		{ReportMillis: 3000, Text: "third"},
+	}
+
+	kept, truncated := capComments(comments, 3)
+	if !truncated {
+		t.Error("expected truncated to be true")
+	}
+	if len(kept) != 3 {
+		t.Fatalf("expected 3 comments, got %d", len(kept))
+	}
+	for i, want := range []string{"third", "fourth", "fifth"} {
+		if kept[i].Text != want {
+			t.Errorf("comment %d: expected %q, got %q", i, want, kept[i].Text)
+		}
+	}
+
+	// Input order must not be modified
+	if comments[0].Text != "fifth" {
+		t.Error("expected input slice to be left untouched")
+	}
+}
+
+func TestCapComments_WithinLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		comments []models.Comment
+		max      int
+	}{
+		{"nil comments", nil, 3},
+		{"fewer than cap", []models.Comment{{ReportMillis: 1}, {ReportMillis: 2}}, 3},
+		{"exactly cap", []models.Comment{{ReportMillis: 1}, {ReportMillis: 2}, {ReportMillis: 3}}, 3},
+		{"cap disabled", []models.Comment{{ReportMillis: 1}, {ReportMillis: 2}}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, truncated := capComments(tt.comments, tt.max)
+			if truncated {
+				t.Error("expected truncated to be false")
+			}
+			if len(kept) != len(tt.comments) {
+				t.Errorf("expected %d comments, got %d", len(tt.comments), len(kept))
+			}
+		})
+	}
+}
+
+func TestWithMaxComments(t *testing.T) {
+	fc := &FirestoreClient{maxComments: DefaultMaxComments}
+
+	WithMaxComments(10)(fc)
+	if fc.maxComments != 10 {
+		t.Errorf("expected maxComments 10, got %d", fc.maxComments)
+	}
+
+	WithMaxComments(0)(fc)
+	if fc.maxComments != 10 {
+		t.Errorf("expected non-positive value to be ignored, got %d", fc.maxComments)
+	}
+}
+
+func TestWithMaxFilterValues(t *testing.T) {
+	fc := &FirestoreClient{maxFilterValues: DefaultMaxFilterValues}
+
+	WithMaxFilterValues(5)(fc)
+	if fc.maxFilterValues != 5 {
+		t.Errorf("expected maxFilterValues 5, got %d", fc.maxFilterValues)
+	}
+
+	WithMaxFilterValues(-1)(fc)
+	if fc.maxFilterValues != 5 {
+		t.Errorf("expected non-positive value to be ignored, got %d", fc.maxFilterValues)
+	}
+}
+
+func TestCheckFilterCounts(t *testing.T) {
+	values := func(n int) []string {
+		out := make([]string, n)
+		for i := range out {
+			out[i] = fmt.Sprintf("value-%d", i)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name    string
+		filters models.AlertFilters
+		max     int
+		wantErr string
+	}{
+		{"no filters", models.AlertFilters{}, 3, ""},
+		{"every list at the cap", models.AlertFilters{Subtypes: values(3), Streets: values(3), Cities: values(3)}, 3, ""},
+		{"too many subtypes", models.AlertFilters{Subtypes: values(4)}, 3, "4 subtypes, maximum is 3"},
+		{"too many streets", models.AlertFilters{Streets: values(4)}, 3, "4 streets, maximum is 3"},
+		{"too many cities", models.AlertFilters{Cities: values(10)}, 3, "10 cities, maximum is 3"},
+		{"no cap", models.AlertFilters{Streets: values(1000)}, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkFilterCounts(tt.filters, tt.max)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrTooManyFilterValues) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected ErrTooManyFilterValues mentioning %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestGetPoliceAlertsByDatesWithFilters_RejectsTooManyValues(t *testing.T) {
+	// The cap is checked before any query, so no Firestore client is needed
+	fc := &FirestoreClient{maxFilterValues: 2}
+	_, err := fc.GetPoliceAlertsByDatesWithFilters(context.Background(), []string{"2024-01-15"},
+		models.AlertFilters{Streets: []string{"A St", "B St", "C St"}})
+	if !errors.Is(err, ErrTooManyFilterValues) {
+		t.Errorf("expected ErrTooManyFilterValues, got %v", err)
+	}
+}
+
+func TestWithStoreSubtypes(t *testing.T) {
+	fc := &FirestoreClient{}
+
+	WithStoreSubtypes([]string{"POLICE_VISIBLE", "POLICE_HIDING"})(fc)
+	if len(fc.storeSubtypes) != 2 || !fc.storeSubtypes["POLICE_VISIBLE"] || !fc.storeSubtypes["POLICE_HIDING"] {
+		t.Errorf("unexpected allowlist: %v", fc.storeSubtypes)
+	}
+
+	WithStoreSubtypes(nil)(fc)
+	if fc.storeSubtypes != nil {
+		t.Errorf("expected empty list to store all subtypes, got %v", fc.storeSubtypes)
+	}
+}
+
+func TestAlertDocID(t *testing.T) {
+	// 2024-01-15 23:30 UTC is already 2024-01-16 in Canberra; the UTC day is used
+	alert := models.WazeAlert{UUID: "abc-123", PubMillis: time.Date(2024, 1, 15, 23, 30, 0, 0, time.UTC).UnixMilli()}
+
+	legacy := &FirestoreClient{}
+	if got := legacy.alertDocID(alert); got != "abc-123" {
+		t.Errorf("expected UUID document ID, got %q", got)
+	}
+
+	composite := &FirestoreClient{}
+	WithCompositeIDs(true)(composite)
+	// 23:30 UTC on the 15th is the morning of the 16th in Canberra
+	if got := composite.alertDocID(alert); got != "abc-123_2024-01-16" {
+		t.Errorf("expected composite document ID, got %q", got)
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Hume Highway", "hume highway"},
+		{"hume hwy", "hume highway"},
+		{"  Hume   HWY.  ", "hume highway"},
+		{"George St", "george street"},
+		{"Northbourne Ave", "northbourne avenue"},
+		{"Canberra", "canberra"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeName(tt.name); got != tt.want {
+			t.Errorf("normalizeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNameMatcher(t *testing.T) {
+	filters := []string{"Hume Highway", "canberra"}
+
+	exact := (&FirestoreClient{}).nameMatcher(filters)
+	normalized := &FirestoreClient{}
+	WithNormalizedFilters(true)(normalized)
+	matches := normalized.nameMatcher(filters)
+
+	tests := []struct {
+		value          string
+		wantExact      bool
+		wantNormalized bool
+	}{
+		{"Hume Highway", true, true},
+		{"hume highway", false, true},
+		{"HUME  HIGHWAY", false, true},
+		{"Hume Hwy", false, true},
+		{"Hume Hwy.", false, true},
+		{"Canberra", false, true},
+		{"Federal Highway", false, false},
+		{"Hume", false, false},
+		{"", false, false},
+	}
+
+	for _, tt := range tests {
+		if got := exact(tt.value); got != tt.wantExact {
+			t.Errorf("exact match of %q = %v, want %v", tt.value, got, tt.wantExact)
+		}
+		if got := matches(tt.value); got != tt.wantNormalized {
+			t.Errorf("normalized match of %q = %v, want %v", tt.value, got, tt.wantNormalized)
+		}
+	}
+}
+
+func TestMatchesPresence(t *testing.T) {
+	tests := []struct {
+		presence string
+		name     string
+		want     bool
+	}{
+		{models.PresenceAny, "Hume Highway", true},
+		{models.PresenceAny, "", true},
+		{models.PresenceNamed, "Hume Highway", true},
+		{models.PresenceNamed, "", false},
+		{models.PresenceNamed, "   ", false},
+		{models.PresenceUnnamed, "Hume Highway", false},
+		{models.PresenceUnnamed, "", true},
+		{models.PresenceUnnamed, "   ", true},
+	}
+
+	for _, tt := range tests {
+		if got := matchesPresence(tt.presence, tt.name); got != tt.want {
+			t.Errorf("matchesPresence(%q, %q) = %v, want %v", tt.presence, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidPresence(t *testing.T) {
+	for _, presence := range []string{models.PresenceAny, models.PresenceNamed, models.PresenceUnnamed} {
+		if !validPresence(presence) {
+			t.Errorf("expected %q to be valid", presence)
+		}
+	}
+	if validPresence("Named") {
+		t.Error("expected presence values to be case-sensitive")
+	}
+}
+
+func TestAlertFingerprint(t *testing.T) {
+	base := models.WazeAlert{
+		UUID:      "abc-123",
+		Subtype:   "POLICE_VISIBLE",
+		PubMillis: 1704067200000,
+		Location:  models.Location{Latitude: -35.28091, Longitude: 149.13012},
+		Street:    "Northbourne Ave",
+		NThumbsUp: 3,
+	}
+	fingerprint := alertFingerprint(base)
+	if len(fingerprint) != 64 {
+		t.Errorf("expected a 64 character hex SHA-256, got %q", fingerprint)
+	}
+
+	same := []struct {
+		name   string
+		modify func(*models.WazeAlert)
+	}{
+		{"identical", func(a *models.WazeAlert) {}},
+		{"mutable fields changed", func(a *models.WazeAlert) { a.Street = "Northbourne Avenue"; a.NThumbsUp = 9 }},
+		{"location noise below precision", func(a *models.WazeAlert) { a.Location.Latitude += 0.000001 }},
+	}
+	for _, tt := range same {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := base
+			tt.modify(&alert)
+			if got := alertFingerprint(alert); got != fingerprint {
+				t.Errorf("expected fingerprint %s, got %s", fingerprint, got)
+			}
+		})
+	}
+
+	different := []struct {
+		name   string
+		modify func(*models.WazeAlert)
+	}{
+		{"uuid", func(a *models.WazeAlert) { a.UUID = "abc-124" }},
+		{"pub millis", func(a *models.WazeAlert) { a.PubMillis++ }},
+		{"subtype", func(a *models.WazeAlert) { a.Subtype = "POLICE_HIDING" }},
+		{"latitude", func(a *models.WazeAlert) { a.Location.Latitude += 0.001 }},
+		{"longitude", func(a *models.WazeAlert) { a.Location.Longitude -= 0.001 }},
+	}
+	for _, tt := range different {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := base
+			tt.modify(&alert)
+			if got := alertFingerprint(alert); got == fingerprint {
+				t.Errorf("expected a different fingerprint when %s changes", tt.name)
+			}
+		})
+	}
+}
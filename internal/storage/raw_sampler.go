@@ -0,0 +1,128 @@
+// Package storage provides data persistence abstractions for Firestore and GCS.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxPendingRawSamples bounds the samples held by Hold between flushes
+const maxPendingRawSamples = 100
+
+// RawResponseSampler stores 1-in-N raw Waze API responses in GCS so the
+// response schema can be audited periodically without keeping every payload.
+type RawResponseSampler struct {
+	gcsClient  GCSClient
+	bucketName string
+	every      int
+	sample     func() bool
+	now        func() time.Time
+
+	// pending holds samples selected by Hold until the next Flush
+	mu      sync.Mutex
+	pending []rawSample
+}
+
+// rawSample is a selected response waiting to be uploaded
+type rawSample struct {
+	objectName string
+	body       []byte
+}
+
+// NewRawResponseSampler creates a sampler that uploads every Nth response to
+// the given bucket. An every value below 1 disables sampling.
+func NewRawResponseSampler(gcsClient GCSClient, bucketName string, every int) *RawResponseSampler {
+	return &RawResponseSampler{
+		gcsClient:  gcsClient,
+		bucketName: bucketName,
+		every:      every,
+		sample:     everyNth(every),
+		now:        time.Now,
+	}
+}
+
+// everyNth returns a deterministic sampler that selects the first call and
+// every Nth call after it.
+func everyNth(n int) func() bool {
+	if n < 1 {
+		return func() bool { return false }
+	}
+	var calls atomic.Int64
+	return func() bool {
+		return (calls.Add(1)-1)%int64(n) == 0
+	}
+}
+
+// Record uploads the response body if it is selected by the sampler.
+// It reports whether the response was sampled.
+func (s *RawResponseSampler) Record(ctx context.Context, bbox string, body []byte) (bool, error) {
+	if !s.sample() {
+		return false, nil
+	}
+
+	return true, s.upload(ctx, rawSample{objectName: RawSampleObjectName(s.now(), bbox), body: body})
+}
+
+// Hold keeps the response body for the next Flush if it is selected by the
+// sampler, so callers on a hot path never wait on an upload. It reports whether
+// the response was sampled; samples beyond maxPendingRawSamples are dropped.
+func (s *RawResponseSampler) Hold(bbox string, body []byte) bool {
+	if !s.sample() {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) >= maxPendingRawSamples {
+		return false
+	}
+	s.pending = append(s.pending, rawSample{objectName: RawSampleObjectName(s.now(), bbox), body: body})
+	return true
+}
+
+// Flush uploads the samples held since the last Flush. Every sample is
+// attempted; it returns how many were uploaded along with any upload errors.
+func (s *RawResponseSampler) Flush(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	uploaded := 0
+	var errs []error
+	for _, sample := range pending {
+		if err := s.upload(ctx, sample); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		uploaded++
+	}
+	return uploaded, errors.Join(errs...)
+}
+
+// upload writes a sample to the bucket
+func (s *RawResponseSampler) upload(ctx context.Context, sample rawSample) error {
+	writer := s.gcsClient.Bucket(s.bucketName).Object(sample.objectName).NewWriter(ctx)
+
+	if _, err := writer.Write(sample.body); err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to write raw sample %s: %w", sample.objectName, err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to upload raw sample %s: %w", sample.objectName, err)
+	}
+	return nil
+}
+
+// RawSampleObjectName builds the GCS object name for a sampled response,
+// e.g. "raw-samples/2024-01-02/150405.000Z_150.1_-34.2_151.0_-33.9.json".
+func RawSampleObjectName(t time.Time, bbox string) string {
+	t = t.UTC()
+	return fmt.Sprintf("raw-samples/%s/%sZ_%s.json",
+		t.Format("2006-01-02"), t.Format("150405.000"), strings.ReplaceAll(bbox, ",", "_"))
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRawResponseSampler_RatioHolds(t *testing.T) {
+	tests := []struct {
+		every    int
+		calls    int
+		expected int
+	}{
+		{every: 1, calls: 50, expected: 50},
+		{every: 10, calls: 1000, expected: 100},
+		{every: 7, calls: 100, expected: 15},
+		{every: 0, calls: 100, expected: 0},
+	}
+
+	for _, tt := range tests {
+		gcs := NewMemGCS()
+		sampler := NewRawResponseSampler(gcs, "raw-bucket", tt.every)
+
+		// Distinct timestamps so every sampled object gets a unique name
+		base := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		call := 0
+		sampler.now = func() time.Time {
+			return base.Add(time.Duration(call) * time.Millisecond)
+		}
+
+		sampled := 0
+		for call = 0; call < tt.calls; call++ {
+			ok, err := sampler.Record(context.Background(), "1,2,3,4", []byte(`{"alerts":[]}`))
+			if err != nil {
+				t.Fatalf("every=%d: unexpected error: %v", tt.every, err)
+			}
+			if ok {
+				sampled++
+			}
+		}
+
+		if sampled != tt.expected {
+			t.Errorf("every=%d: expected %d sampled responses, got %d", tt.every, tt.expected, sampled)
+		}
+		if len(gcs.Objects) != tt.expected {
+			t.Errorf("every=%d: expected %d uploaded objects, got %d", tt.every, tt.expected, len(gcs.Objects))
+		}
+	}
+}
+
+func TestRawResponseSampler_UploadsBody(t *testing.T) {
+	gcs := NewMemGCS()
+	sampler := NewRawResponseSampler(gcs, "raw-bucket", 1)
+	sampler.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	if _, err := sampler.Record(context.Background(), "150.1,-34.2,151.0,-33.9", []byte(`{"alerts":[]}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	name := "raw-samples/2024-01-02/030405.000Z_150.1_-34.2_151.0_-33.9.json"
+	body, ok := gcs.Objects[name]
+	if !ok {
+		t.Fatalf("expected object %s, got %v", name, gcs.Objects)
+	}
+	if string(body) != `{"alerts":[]}` {
+		t.Errorf("unexpected body: %s", body)
+	}
+}
+
+func TestRawResponseSampler_UploadError(t *testing.T) {
+	gcs := &MockGCSClient{
+		BucketFunc: func(bucket string) GCSBucketHandle {
+			return &MockGCSBucketHandle{
+				ObjectFunc: func(name string) GCSObjectHandle {
+					return &MockGCSObjectHandle{
+						NewWriterFunc: func(ctx context.Context) GCSWriter {
+							return &MockGCSWriter{CloseFunc: func() error { return errors.New("upload failed") }}
+						},
+					}
+				},
+			}
+		},
+	}
+	sampler := NewRawResponseSampler(gcs, "raw-bucket", 1)
+
+	sampled, err := sampler.Record(context.Background(), "1,2,3,4", []byte("{}"))
+	if !sampled {
+		t.Error("expected response to be sampled")
+	}
+	if err == nil || !strings.Contains(err.Error(), "upload failed") {
+		t.Errorf("expected upload error, got %v", err)
+	}
+}
+
+func TestRawResponseSampler_HoldUploadsOnFlush(t *testing.T) {
+	gcs := NewMemGCS()
+	sampler := NewRawResponseSampler(gcs, "raw-bucket", 2)
+	sampler.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	for _, bbox := range []string{"1,2,3,4", "5,6,7,8", "9,10,11,12"} {
+		sampler.Hold(bbox, []byte(`{"alerts":[]}`))
+	}
+	if len(gcs.Objects) != 0 {
+		t.Fatalf("expected nothing uploaded before Flush, got %d objects", len(gcs.Objects))
+	}
+
+	uploaded, err := sampler.Flush(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if uploaded != 2 || len(gcs.Objects) != 2 {
+		t.Errorf("expected 2 of 3 responses uploaded, got %d (%d objects)", uploaded, len(gcs.Objects))
+	}
+	if _, ok := gcs.Objects["raw-samples/2024-01-02/030405.000Z_9_10_11_12.json"]; !ok {
+		t.Errorf("expected the third response to be sampled, got %v", gcs.Objects)
+	}
+
+	// Held samples are only uploaded once
+	if uploaded, _ := sampler.Flush(context.Background()); uploaded != 0 {
+		t.Errorf("expected nothing left to flush, got %d", uploaded)
+	}
+}
+
+func TestRawResponseSampler_HoldIsBounded(t *testing.T) {
+	sampler := NewRawResponseSampler(NewMemGCS(), "raw-bucket", 1)
+	call := 0
+	sampler.now = func() time.Time { return time.Unix(0, 0).Add(time.Duration(call) * time.Millisecond) }
+
+	held := 0
+	for call = 0; call < maxPendingRawSamples+10; call++ {
+		if sampler.Hold("1,2,3,4", []byte("{}")) {
+			held++
+		}
+	}
+	if held != maxPendingRawSamples {
+		t.Errorf("expected %d samples held, got %d", maxPendingRawSamples, held)
+	}
+}
+
+func TestRawSampleObjectName(t *testing.T) {
+	loc := time.FixedZone("AEDT", 11*60*60)
+	ts := time.Date(2024, 1, 2, 10, 0, 0, 123000000, loc)
+
+	got := RawSampleObjectName(ts, "1,2,3,4")
+	want := "raw-samples/2024-01-01/230000.123Z_1_2_3_4.json"
+	if got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
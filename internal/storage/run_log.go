@@ -0,0 +1,53 @@
+// Package storage provides data persistence abstractions for Firestore and GCS.
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+)
+
+// RunLogWriter stores a JSON summary of every scraper run in GCS so scraping
+// health (e.g. a gradual rise in failed calls) can be analysed over time.
+type RunLogWriter struct {
+	gcsClient  GCSClient
+	bucketName string
+}
+
+// NewRunLogWriter creates a writer that uploads run summaries to the given bucket
+func NewRunLogWriter(gcsClient GCSClient, bucketName string) *RunLogWriter {
+	return &RunLogWriter{
+		gcsClient:  gcsClient,
+		bucketName: bucketName,
+	}
+}
+
+// Write uploads the summary as a JSON object named after its start time
+func (w *RunLogWriter) Write(ctx context.Context, summary models.RunSummary) error {
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("failed to marshal run summary: %w", err)
+	}
+
+	objectName := RunLogObjectName(summary.StartedAt)
+	writer := w.gcsClient.Bucket(w.bucketName).Object(objectName).NewWriter(ctx)
+
+	if _, err := writer.Write(body); err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to write run summary %s: %w", objectName, err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to upload run summary %s: %w", objectName, err)
+	}
+	return nil
+}
+
+// RunLogObjectName builds the GCS object name for a run summary,
+// e.g. "run-logs/2024-01-02/150405.000Z.json".
+func RunLogObjectName(t time.Time) string {
+	t = t.UTC()
+	return fmt.Sprintf("run-logs/%s/%sZ.json", t.Format("2006-01-02"), t.Format("150405.000"))
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+)
+
+func TestRunLogWriter_WritesSummary(t *testing.T) {
+	gcs := NewMemGCS()
+	writer := NewRunLogWriter(gcs, "run-bucket")
+
+	summary := models.RunSummary{
+		StartedAt:       time.Date(2024, 1, 2, 3, 4, 5, 600_000_000, time.FixedZone("AEDT", 11*3600)),
+		DurationMs:      1500,
+		Status:          "success",
+		BBoxes:          []string{"1,2,3,4"},
+		Requests:        1,
+		SuccessfulCalls: 1,
+		AlertsFound:     3,
+	}
+	if err := writer.Write(context.Background(), summary); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	body, ok := gcs.Objects["run-logs/2024-01-01/160405.600Z.json"]
+	if !ok {
+		t.Fatalf("expected run summary object, got %v", gcs.Objects)
+	}
+	var got models.RunSummary
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("summary is not valid JSON: %v", err)
+	}
+	if !got.StartedAt.Equal(summary.StartedAt) || got.Status != "success" || got.AlertsFound != 3 || len(got.BBoxes) != 1 {
+		t.Errorf("unexpected summary %+v", got)
+	}
+}
+
+func TestRunLogWriter_UploadError(t *testing.T) {
+	gcsClient := &MockGCSClient{
+		BucketFunc: func(bucket string) GCSBucketHandle {
+			return &MockGCSBucketHandle{
+				ObjectFunc: func(name string) GCSObjectHandle {
+					return &MockGCSObjectHandle{
+						NewWriterFunc: func(ctx context.Context) GCSWriter {
+							return &MockGCSWriter{CloseFunc: func() error { return errors.New("permission denied") }}
+						},
+					}
+				},
+			}
+		},
+	}
+
+	err := NewRunLogWriter(gcsClient, "run-bucket").Write(context.Background(), models.RunSummary{StartedAt: time.Now()})
+	if err == nil {
+		t.Fatal("expected upload error")
+	}
+}
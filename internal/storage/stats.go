@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	pb "cloud.google.com/go/firestore/apiv1/firestorepb"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/logging"
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/genproto/googleapis/type/latlng"
+)
+
+// statsSampleSize is the number of documents read to estimate the average document size
+const statsSampleSize = 100
+
+// GetCollectionStats counts the documents in the collection with an aggregation
+// query (billed as a fraction of a read per document rather than a full read)
+// and estimates its storage size from the average size of a sample of documents.
+func (fc *FirestoreClient) GetCollectionStats(ctx context.Context) (models.CollectionStats, error) {
+	collection := fc.client.Collection(fc.collectionName)
+
+	result, err := collection.NewAggregationQuery().WithCount("count").Get(ctx)
+	if err != nil {
+		return models.CollectionStats{}, fmt.Errorf("failed to count documents: %w", err)
+	}
+	count, err := countFromAggregation(result, "count")
+	if err != nil {
+		return models.CollectionStats{}, err
+	}
+
+	docs, err := collection.Limit(statsSampleSize).Documents(ctx).GetAll()
+	if err != nil {
+		return models.CollectionStats{}, fmt.Errorf("failed to sample documents: %w", err)
+	}
+	sizes := make([]int64, 0, len(docs))
+	for _, doc := range docs {
+		sizes = append(sizes, documentSize(fc.collectionName, doc.Ref.ID, doc.Data()))
+	}
+
+	stats := estimateCollectionStats(fc.collectionName, count, sizes)
+	logging.Infof("Collection %s: %d documents, ~%d bytes (sampled %d)", stats.Collection, stats.DocumentCount, stats.EstimatedBytes, stats.SampledDocuments)
+	return stats, nil
+}
+
+// countConcurrency bounds the aggregation queries CountPoliceAlertsPublished runs at once
+const countConcurrency = 8
+
+// CountPoliceAlertsPublished counts the police alerts published in each bucket
+// [edges[i], edges[i+1]) with one count aggregation query per bucket, run
+// concurrently. Each query is billed per index entry matched rather than per
+// document read.
+func (fc *FirestoreClient) CountPoliceAlertsPublished(ctx context.Context, edges []time.Time) ([]int64, error) {
+	if len(edges) < 2 {
+		return nil, fmt.Errorf("at least two bucket edges are required, got %d", len(edges))
+	}
+
+	counts := make([]int64, len(edges)-1)
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(countConcurrency)
+	for i := range counts {
+		g.Go(func() error {
+			query := fc.client.Collection(fc.collectionName).
+				Where("publish_time", ">=", edges[i]).
+				Where("publish_time", "<", edges[i+1])
+			result, err := query.NewAggregationQuery().WithCount("count").Get(gctx)
+			if err != nil {
+				return fmt.Errorf("failed to count police alerts published from %s: %w", edges[i].Format(time.RFC3339), missingIndex(err))
+			}
+			counts[i], err = countFromAggregation(result, "count")
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// countFromAggregation extracts the count stored under alias in an aggregation result
+func countFromAggregation(result firestore.AggregationResult, alias string) (int64, error) {
+	raw, ok := result[alias]
+	if !ok {
+		return 0, fmt.Errorf("aggregation result has no %q value", alias)
+	}
+	value, ok := raw.(*pb.Value)
+	if !ok {
+		return 0, fmt.Errorf("unexpected aggregation value type %T", raw)
+	}
+	return value.GetIntegerValue(), nil
+}
+
+// estimateCollectionStats extrapolates the collection size from the average of
+// the sampled document sizes
+func estimateCollectionStats(collection string, count int64, sampleSizes []int64) models.CollectionStats {
+	stats := models.CollectionStats{
+		Collection:       collection,
+		DocumentCount:    count,
+		SampledDocuments: len(sampleSizes),
+	}
+	if len(sampleSizes) == 0 {
+		return stats
+	}
+
+	var total int64
+	for _, size := range sampleSizes {
+		total += size
+	}
+	stats.AvgDocumentBytes = total / int64(len(sampleSizes))
+	stats.EstimatedBytes = stats.AvgDocumentBytes * count
+	return stats
+}
+
+// documentSize approximates the stored size of a document using Firestore's
+// storage size rules: the document name, each field name and value, plus 32
+// bytes of overhead
+func documentSize(collection, docID string, data map[string]interface{}) int64 {
+	// Document name: each path segment plus one byte, plus 16 bytes
+	size := int64(len(collection)+1) + int64(len(docID)+1) + 16
+	for name, value := range data {
+		size += int64(len(name)+1) + valueSize(value)
+	}
+	return size + 32
+}
+
+// valueSize returns the Firestore storage size of a field value
+func valueSize(v interface{}) int64 {
+	switch val := v.(type) {
+	case nil, bool:
+		return 1
+	case int64, float64, time.Time:
+		return 8
+	case string:
+		return int64(len(val) + 1)
+	case []byte:
+		return int64(len(val))
+	case *latlng.LatLng:
+		return 16
+	case *firestore.DocumentRef:
+		return int64(len(val.Path) + 1)
+	case []interface{}:
+		var size int64
+		for _, elem := range val {
+			size += valueSize(elem)
+		}
+		return size
+	case map[string]interface{}:
+		var size int64
+		for name, elem := range val {
+			size += int64(len(name)+1) + valueSize(elem)
+		}
+		return size
+	default:
+		return 8
+	}
+}
+
+// CountPoliceAlertsByDateRange counts the police alerts active within a date
+// range (expire_time >= startDate AND publish_time <= endDate), matching
+// GetPoliceAlertsByDateRange, with a single count aggregation query
+func (fc *FirestoreClient) CountPoliceAlertsByDateRange(ctx context.Context, startDate, endDate time.Time) (int64, error) {
+	query := fc.client.Collection(fc.collectionName).
+		Where("expire_time", ">=", startDate).
+		Where("publish_time", "<=", endDate)
+	result, err := query.NewAggregationQuery().WithCount("count").Get(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count police alerts: %w", missingIndex(err))
+	}
+	return countFromAggregation(result, "count")
+}
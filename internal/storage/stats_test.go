@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	pb "cloud.google.com/go/firestore/apiv1/firestorepb"
+	"google.golang.org/genproto/googleapis/type/latlng"
+)
+
+func TestCountFromAggregation(t *testing.T) {
+	result := firestore.AggregationResult{
+		"count": &pb.Value{ValueType: &pb.Value_IntegerValue{IntegerValue: 12345}},
+	}
+	count, err := countFromAggregation(result, "count")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count != 12345 {
+		t.Errorf("expected 12345, got %d", count)
+	}
+
+	if _, err := countFromAggregation(result, "missing"); err == nil {
+		t.Error("expected error for missing alias")
+	}
+	if _, err := countFromAggregation(firestore.AggregationResult{"count": int64(1)}, "count"); err == nil {
+		t.Error("expected error for unexpected value type")
+	}
+}
+
+func TestEstimateCollectionStats(t *testing.T) {
+	stats := estimateCollectionStats("police_alerts", 1000, []int64{1000, 2000, 3000})
+	if stats.Collection != "police_alerts" || stats.DocumentCount != 1000 || stats.SampledDocuments != 3 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if stats.AvgDocumentBytes != 2000 {
+		t.Errorf("expected average 2000 bytes, got %d", stats.AvgDocumentBytes)
+	}
+	if stats.EstimatedBytes != 2000000 {
+		t.Errorf("expected estimate 2000000 bytes, got %d", stats.EstimatedBytes)
+	}
+
+	empty := estimateCollectionStats("police_alerts", 0, nil)
+	if empty.AvgDocumentBytes != 0 || empty.EstimatedBytes != 0 {
+		t.Errorf("expected zero estimate for an empty collection, got %+v", empty)
+	}
+}
+
+func TestDocumentSize(t *testing.T) {
+	data := map[string]interface{}{
+		"uuid":         "abc",                                               // 5 + 4
+		"reliability":  int64(5),                                            // 12 + 8
+		"publish_time": time.Now(),                                          // 13 + 8
+		"location_geo": &latlng.LatLng{Latitude: -35},                       // 13 + 16
+		"inscale":      true,                                                // 8 + 1
+		"comments":     []interface{}{map[string]interface{}{"text": "hi"}}, // 9 + (5 + 3)
+	}
+	// Name: "alerts" (7) + "abc" (4) + 16; fields: 9+20+21+29+9+17; overhead: 32
+	expected := int64(7 + 4 + 16 + 9 + 20 + 21 + 29 + 9 + 17 + 32)
+	if got := documentSize("alerts", "abc", data); got != expected {
+		t.Errorf("expected %d bytes, got %d", expected, got)
+	}
+}
@@ -6,135 +6,851 @@
 package waze
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"math/rand/v2"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/logging"
 	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
 )
 
+// ErrInsufficientCoverage is returned when fewer bounding boxes succeed than
+// the configured minimum success ratio allows
+var ErrInsufficientCoverage = errors.New("insufficient bounding box coverage")
+
+// ErrInvalidBBox is returned for a bounding box that is not four coordinates
+// in "west,south,east,north" order within valid longitude and latitude ranges
+var ErrInvalidBBox = errors.New("invalid bounding box")
+
+// ErrUnexpectedResponse is returned when the API responds with a body that is
+// not a georss JSON object, such as an HTML block or error page
+var ErrUnexpectedResponse = errors.New("unexpected API response")
+
+// ErrForbidden matches an HTTPError for a 403, which Waze returns when it
+// blocks the scraper rather than for a transient problem
+var ErrForbidden = errors.New("API access forbidden")
+
+// maxErrorBody is how much of an error response's body an HTTPError keeps
+const maxErrorBody = 500
+
+// HTTPError is returned when the API responds with a status other than 200,
+// after any retries. Body holds up to the first 500 bytes of the response body.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("API returned status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("API returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// Is makes errors.Is(err, ErrForbidden) true for a 403
+func (e *HTTPError) Is(target error) bool {
+	return target == ErrForbidden && e.StatusCode == http.StatusForbidden
+}
+
+// Policies for choosing between copies of an alert returned by several bounding
+// boxes whose core fields disagree (e.g. differing reverse-geocoded streets)
+const (
+	// ConflictKeepFirst keeps the copy from the first bbox that returned the alert
+	ConflictKeepFirst = "keep_first"
+	// ConflictPreferComplete keeps the copy with the most of street and city set,
+	// falling back to the first copy on a tie
+	ConflictPreferComplete = "prefer_complete"
+)
+
+// Units accepted for pubMillis in API responses
+const (
+	// PubTimeAuto treats implausibly small pubMillis values as seconds
+	PubTimeAuto = "auto"
+	// PubTimeMillis always treats pubMillis as milliseconds
+	PubTimeMillis = "millis"
+	// PubTimeSeconds always treats pubMillis as seconds
+	PubTimeSeconds = "seconds"
+)
+
+// DefaultBaseURL is the Waze live-map georss endpoint queried for alerts
+const DefaultBaseURL = "https://www.waze.com/live-map/api/georss"
+
+// DefaultUserAgent is sent with every request unless WithUserAgent or
+// WithHeaders sets another. It matches a desktop browser, as the live map
+// is normally loaded by one.
+const DefaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+
+// DefaultWorkers is the number of bounding boxes GetAlertsMultipleBBoxes
+// fetches at once unless WithWorkers is given
+const DefaultWorkers = 4
+
+// DefaultSubdivideDepth is how many times a truncated bounding box may be
+// split into quadrants unless WithSubdivision sets a depth
+const DefaultSubdivideDepth = 2
+
+// minPlausiblePubMillis is the smallest pubMillis accepted as milliseconds
+// under PubTimeAuto. It is March 1973 in milliseconds but the year 5138 in
+// seconds, so no real publish time is ambiguous.
+const minPlausiblePubMillis = 100_000_000_000
+
+// RetryPolicy configures how GetAlerts retries transient error statuses (429,
+// 500, 502 and 503). Delays double after each attempt and are jittered to
+// between half and all of their value.
+type RetryPolicy struct {
+	// MaxAttempts is the most requests made per GetAlerts call, including the
+	// first. Values below 2 disable retries.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry
+	BaseDelay time.Duration
+	// MaxDelay caps the delay before any retry (zero means no cap)
+	MaxDelay time.Duration
+}
+
+// backoff returns the jittered delay before retry number n (1 for the first)
+func (p RetryPolicy) backoff(n int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < n && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+// retryableStatus reports whether a response status is worth retrying
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable:
+		return true
+	}
+	return false
+}
+
 // Client handles API calls to Waze
 type Client struct {
-	httpClient *http.Client
-	stats      *models.ScrapingStats
+	httpClient   *http.Client
+	baseURL      string
+	responseHook func(bbox string, body []byte)
+
+	// stats is updated by concurrent bbox fetches, so it is only changed under statsMu
+	stats   *models.ScrapingStats
+	statsMu sync.Mutex
+
+	// workers is the number of bounding boxes fetched at once by
+	// GetAlertsMultipleBBoxes
+	workers int
+
+	// subdivideThreshold is the alert count at which a response is taken to be
+	// truncated and its bbox is split into quadrants (zero disables splitting)
+	subdivideThreshold int
+
+	// subdivideDepth is the most times a configured bbox is split
+	subdivideDepth int
+
+	// minSuccessRatio is the fraction of bounding boxes that must be fetched
+	// successfully for GetAlertsMultipleBBoxes to succeed. Zero requires only
+	// a single successful call.
+	minSuccessRatio float64
+
+	// conflictPolicy chooses between conflicting duplicate copies (empty means ConflictKeepFirst)
+	conflictPolicy string
+
+	// logDuplicates logs every duplicate found across bboxes instead of a
+	// single count per call
+	logDuplicates bool
+
+	// trackedTypes limits GetAlertsMultipleBBoxes to these alert types (nil keeps all)
+	trackedTypes map[string]bool
+
+	// pubTimeUnit is the unit of pubMillis in responses (empty means PubTimeAuto)
+	pubTimeUnit string
+
+	// rawAlerts keeps the exact bytes of each alert from the response
+	rawAlerts bool
+
+	// retry is the policy for retrying transient error statuses (zero disables retries)
+	retry RetryPolicy
+
+	// headers are set on every request, including User-Agent
+	headers http.Header
+
+	// sleep waits between retries, returning early with ctx's error if it is
+	// done first. Replaced in tests.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// sleepContext waits for d or until ctx is done, whichever is first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Option configures optional Client behaviour
+type Option func(*Client)
+
+// WithResponseHook registers a function that receives every raw response body
+// read from the API, before it is parsed. Used for sampling responses to detect
+// schema drift. The hook is called concurrently when several bounding boxes are
+// fetched at once.
+func WithResponseHook(hook func(bbox string, body []byte)) Option {
+	return func(c *Client) {
+		c.responseHook = hook
+	}
+}
+
+// WithMinSuccessRatio requires at least the given fraction (0-1) of bounding
+// boxes to be fetched successfully, otherwise GetAlertsMultipleBBoxes returns
+// an error wrapping ErrInsufficientCoverage so the scrape is recorded as degraded.
+func WithMinSuccessRatio(ratio float64) Option {
+	return func(c *Client) {
+		c.minSuccessRatio = ratio
+	}
+}
+
+// WithConflictPolicy sets how GetAlertsMultipleBBoxes chooses between copies of
+// the same alert whose core fields differ. Conflicts are logged under every policy.
+func WithConflictPolicy(policy string) Option {
+	return func(c *Client) {
+		c.conflictPolicy = policy
+	}
+}
+
+// WithDuplicateLogging logs a line for every alert returned by more than one
+// bounding box. By default only the number of duplicates skipped is logged per
+// GetAlertsMultipleBBoxes call at debug level, as overlapping boxes can produce
+// many. The per-alert lines are opted into, so they are logged at info level.
+func WithDuplicateLogging(perAlert bool) Option {
+	return func(c *Client) {
+		c.logDuplicates = perAlert
+	}
+}
+
+// WithTrackedTypes makes GetAlertsMultipleBBoxes drop alerts of other types
+// (e.g. JAM, ACCIDENT) as each response is read, before deduplication, so busy
+// areas don't hold alerts that will never be stored. GetAlerts still returns
+// every type. An empty list keeps all types.
+func WithTrackedTypes(types []string) Option {
+	return func(c *Client) {
+		if len(types) == 0 {
+			c.trackedTypes = nil
+			return
+		}
+		c.trackedTypes = make(map[string]bool, len(types))
+		for _, t := range types {
+			c.trackedTypes[t] = true
+		}
+	}
+}
+
+// WithPubTimeUnit sets the unit of pubMillis in API responses: PubTimeAuto (the
+// default), PubTimeMillis or PubTimeSeconds. Alerts returned by the client always
+// carry pubMillis in milliseconds.
+func WithPubTimeUnit(unit string) Option {
+	return func(c *Client) {
+		c.pubTimeUnit = unit
+	}
+}
+
+// WithRawAlerts sets each returned alert's Raw field to the exact bytes Waze
+// sent for it, preserving field order and fields WazeAlert does not model.
+// Raw is left unchanged by pubMillis normalization.
+func WithRawAlerts(enabled bool) Option {
+	return func(c *Client) {
+		c.rawAlerts = enabled
+	}
+}
+
+// WithRetryPolicy makes GetAlerts retry 429, 500, 502 and 503 responses with
+// exponential backoff before failing the bounding box. Other error statuses,
+// such as 403 and 404, fail immediately. Retries are counted in RetriedCalls.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// WithBaseURL queries the georss endpoint at url instead of DefaultBaseURL, such
+// as an httptest.Server in tests or a proxy. Bounding box parameters are added
+// to it as a query string.
+func WithBaseURL(url string) Option {
+	return func(c *Client) {
+		c.baseURL = url
+	}
+}
+
+// WithUserAgent sends userAgent as the User-Agent of every request instead of
+// DefaultUserAgent
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.headers.Set("User-Agent", userAgent)
+	}
+}
+
+// WithHeaders sets headers on every request, replacing any earlier value of
+// the same header, including the User-Agent
+func WithHeaders(headers map[string]string) Option {
+	return func(c *Client) {
+		for name, value := range headers {
+			c.headers.Set(name, value)
+		}
+	}
+}
+
+// WithWorkers sets how many bounding boxes GetAlertsMultipleBBoxes fetches at
+// once (default DefaultWorkers). Values below 1 fetch them one at a time.
+func WithWorkers(n int) Option {
+	return func(c *Client) {
+		c.workers = n
+	}
+}
+
+// WithSubdivision makes GetAlertsMultipleBBoxes split a bounding box whose
+// response holds at least threshold alerts, which Waze caps per request, into
+// four quadrants and fetch each of them too. Quadrants are split again while
+// they stay at the threshold, up to maxDepth levels (DefaultSubdivideDepth if
+// below 1). A threshold below 1 disables splitting.
+func WithSubdivision(threshold, maxDepth int) Option {
+	return func(c *Client) {
+		c.subdivideThreshold = threshold
+		if maxDepth < 1 {
+			maxDepth = DefaultSubdivideDepth
+		}
+		c.subdivideDepth = maxDepth
+	}
 }
 
 // NewClient creates a new Waze API client
-func NewClient() *Client {
-	return &Client{
+func NewClient(opts ...Option) *Client {
+	c := &Client{
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-		stats: &models.ScrapingStats{},
+		baseURL: DefaultBaseURL,
+		stats:   &models.ScrapingStats{},
+		workers: DefaultWorkers,
+		sleep:   sleepContext,
+		headers: http.Header{"User-Agent": {DefaultUserAgent}},
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
 }
 
 // GetAlerts fetches alerts from Waze API for a single bounding box
 // bbox format: "west,south,east,north" (e.g., "103.6,1.15,104.0,1.45")
 func (c *Client) GetAlerts(bbox string) (*models.WazeAPIResponse, error) {
-	c.stats.TotalRequests++
+	return c.GetAlertsContext(context.Background(), bbox)
+}
+
+// GetAlertsContext is GetAlerts with a context. Cancelling ctx aborts the
+// request in flight, or a wait between retries, and returns ctx.Err().
+func (c *Client) GetAlertsContext(ctx context.Context, bbox string) (*models.WazeAPIResponse, error) {
+	c.updateStats(func(stats *models.ScrapingStats) { stats.TotalRequests++ })
 
 	// Parse bounding box: "west,south,east,north"
-	parts := strings.Split(bbox, ",")
-	if len(parts) != 4 {
-		return nil, fmt.Errorf("invalid bounding box format: %s (expected: west,south,east,north)", bbox)
+	if err := ValidateBBox(bbox); err != nil {
+		return nil, err
 	}
-
+	parts := strings.Split(bbox, ",")
 	west, south, east, north := parts[0], parts[1], parts[2], parts[3]
 
-	url := fmt.Sprintf("https://www.waze.com/live-map/api/georss?top=%s&bottom=%s&left=%s&right=%s&env=row&types=alerts",
-		north, south, west, east)
+	url := fmt.Sprintf("%s?top=%s&bottom=%s&left=%s&right=%s&env=row&types=alerts",
+		c.baseURL, north, south, west, east)
 
-	log.Printf("Fetching alerts from: %s", url)
+	logging.Debugf("Fetching alerts from: %s", url)
 
-	resp, err := c.httpClient.Get(url)
-	if err != nil {
-		c.stats.FailedCalls++
-		return nil, fmt.Errorf("API call failed: %w", err)
+	var resp *http.Response
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			c.updateStats(func(stats *models.ScrapingStats) { stats.FailedCalls++ })
+			return nil, fmt.Errorf("failed to build request: %w", err)
+		}
+		req.Header = c.headers.Clone()
+		resp, err = c.httpClient.Do(req)
+		if err != nil {
+			c.updateStats(func(stats *models.ScrapingStats) { stats.FailedCalls++ })
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("API call failed: %w", err)
+		}
+		if !retryableStatus(resp.StatusCode) || attempt >= c.retry.MaxAttempts {
+			break
+		}
+
+		// Drain the body so the connection can be reused for the retry
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		delay := c.retry.backoff(attempt)
+		logging.Warnf("API returned status %d for bbox %s, retrying in %v (attempt %d/%d)",
+			resp.StatusCode, bbox, delay, attempt+1, c.retry.MaxAttempts)
+		c.updateStats(func(stats *models.ScrapingStats) { stats.RetriedCalls++ })
+		if err := c.sleep(ctx, delay); err != nil {
+			c.updateStats(func(stats *models.ScrapingStats) { stats.FailedCalls++ })
+			return nil, err
+		}
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		c.stats.FailedCalls++
-		return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
+		c.updateStats(func(stats *models.ScrapingStats) { stats.FailedCalls++ })
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(snippet))}
+	}
+
+	// Block pages and error pages are served as HTML, sometimes with a 200
+	if contentType := resp.Header.Get("Content-Type"); strings.Contains(contentType, "html") {
+		c.updateStats(func(stats *models.ScrapingStats) { stats.FailedCalls++ })
+		return nil, fmt.Errorf("%w: content type %q", ErrUnexpectedResponse, contentType)
 	}
 
-	log.Printf("Successful API call: %d", resp.StatusCode)
-	c.stats.SuccessfulCalls++
+	logging.Debugf("API call returned %d", resp.StatusCode)
 
+	// The call only counts as successful once its body has been read and parsed
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
+		c.updateStats(func(stats *models.ScrapingStats) { stats.FailedCalls++ })
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
-	var apiResponse models.WazeGeoRSSResponse
-	if err := json.Unmarshal(body, &apiResponse); err != nil {
-		log.Printf("Failed to parse JSON response: %v", err)
-		log.Printf("Raw response (first 500 chars): %s", string(body[:min(500, len(body))]))
-		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	if c.responseHook != nil {
+		c.responseHook(bbox, body)
+	}
+
+	apiResponse, err := parseGeoRSS(body)
+	if err != nil {
+		logging.Warnf("Failed to parse JSON response: %v", err)
+		logging.Warnf("Raw response (first 500 chars): %s", string(body[:min(500, len(body))]))
+		c.updateStats(func(stats *models.ScrapingStats) { stats.FailedCalls++ })
+		return nil, err
+	}
+	if c.rawAlerts {
+		if err := attachRawAlerts(body, apiResponse.Alerts); err != nil {
+			c.updateStats(func(stats *models.ScrapingStats) { stats.FailedCalls++ })
+			return nil, err
+		}
+	}
+
+	converted := 0
+	for i := range apiResponse.Alerts {
+		pubMillis := normalizePubMillis(apiResponse.Alerts[i].PubMillis, c.pubTimeUnit)
+		if pubMillis != apiResponse.Alerts[i].PubMillis {
+			apiResponse.Alerts[i].PubMillis = pubMillis
+			converted++
+		}
+	}
+	if converted > 0 {
+		logging.Debugf("Converted pubMillis of %d alerts from seconds", converted)
+	}
+
+	c.updateStats(func(stats *models.ScrapingStats) {
+		stats.SuccessfulCalls++
+		stats.TotalAlerts += len(apiResponse.Alerts)
+		stats.LastSuccessfulRun = time.Now()
+	})
+
+	logging.Debugf("Successfully fetched %d alerts", len(apiResponse.Alerts))
+	return apiResponse, nil
+}
+
+// updateStats applies update to the stats while holding statsMu
+func (c *Client) updateStats(update func(stats *models.ScrapingStats)) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	update(c.stats)
+}
+
+// ValidateBBox checks that bbox is "west,south,east,north" with numeric
+// coordinates, west < east, south < north, longitudes within [-180, 180] and
+// latitudes within [-90, 90]. Errors wrap ErrInvalidBBox.
+func ValidateBBox(bbox string) error {
+	parts := strings.Split(bbox, ",")
+	if len(parts) != 4 {
+		return fmt.Errorf("%w format: %s (expected: west,south,east,north)", ErrInvalidBBox, bbox)
+	}
+
+	names := [4]string{"west", "south", "east", "north"}
+	var coords [4]float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return fmt.Errorf("%w: %s %q is not a number", ErrInvalidBBox, names[i], part)
+		}
+		coords[i] = v
+	}
+	west, south, east, north := coords[0], coords[1], coords[2], coords[3]
+
+	// Written as negated ranges so NaN is rejected too
+	for i, v := range coords {
+		limit := 180.0
+		if i%2 == 1 {
+			limit = 90
+		}
+		if !(v >= -limit && v <= limit) {
+			return fmt.Errorf("%w: %s %v is outside [-%v, %v]", ErrInvalidBBox, names[i], v, limit, limit)
+		}
+	}
+	if west >= east {
+		return fmt.Errorf("%w: west must be less than east", ErrInvalidBBox)
+	}
+	if south >= north {
+		return fmt.Errorf("%w: south must be less than north", ErrInvalidBBox)
+	}
+	return nil
+}
+
+// normalizePubMillis returns a pubMillis value in milliseconds, given the unit
+// it was sent in. Under PubTimeAuto, positive values too small to be a
+// millisecond timestamp are taken as seconds.
+func normalizePubMillis(pubMillis int64, unit string) int64 {
+	switch unit {
+	case PubTimeMillis:
+		return pubMillis
+	case PubTimeSeconds:
+		return pubMillis * 1000
+	default:
+		if pubMillis > 0 && pubMillis < minPlausiblePubMillis {
+			return pubMillis * 1000
+		}
+		return pubMillis
 	}
+}
 
-	c.stats.TotalAlerts += len(apiResponse.Alerts)
-	c.stats.LastSuccessfulRun = time.Now()
+// parseGeoRSS decodes a georss response body. A JSON object with a null or
+// missing "alerts" key is a valid response with zero alerts (Waze omits the
+// key when an area has none); anything that is not a JSON object, such as an
+// HTML error page, is rejected with ErrUnexpectedResponse.
+func parseGeoRSS(body []byte) (*models.WazeGeoRSSResponse, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse JSON: %v", ErrUnexpectedResponse, err)
+	}
+	if fields == nil {
+		return nil, fmt.Errorf("%w: body is null", ErrUnexpectedResponse)
+	}
 
-	log.Printf("Successfully fetched %d alerts", len(apiResponse.Alerts))
-	return &apiResponse, nil
+	apiResponse := &models.WazeGeoRSSResponse{}
+	raw, ok := fields["alerts"]
+	if !ok {
+		logging.Infof("Response has no alerts key, treating as zero alerts")
+		return apiResponse, nil
+	}
+	if err := json.Unmarshal(raw, &apiResponse.Alerts); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse alerts: %v", ErrUnexpectedResponse, err)
+	}
+	return apiResponse, nil
+}
+
+// attachRawAlerts sets the Raw field of each parsed alert to its bytes in body.
+// The alerts array is split into elements without decoding them, so each Raw
+// holds the literal bytes Waze sent.
+func attachRawAlerts(body []byte, alerts []models.WazeAlert) error {
+	var response struct {
+		Alerts []json.RawMessage `json:"alerts"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("%w: failed to split alerts: %v", ErrUnexpectedResponse, err)
+	}
+	if len(response.Alerts) != len(alerts) {
+		return fmt.Errorf("%w: split %d raw alerts but parsed %d", ErrUnexpectedResponse, len(response.Alerts), len(alerts))
+	}
+	for i := range alerts {
+		alerts[i].Raw = response.Alerts[i]
+	}
+	return nil
 }
 
 // GetAlertsMultipleBBoxes fetches alerts from multiple bounding boxes and deduplicates
 func (c *Client) GetAlertsMultipleBBoxes(bboxes []string) ([]models.WazeAlert, error) {
+	return c.GetAlertsMultipleBBoxesContext(context.Background(), bboxes)
+}
+
+// GetAlertsMultipleBBoxesContext is GetAlertsMultipleBBoxes with a context.
+// Once ctx is done the bboxes in flight are aborted, the rest are skipped and
+// ctx.Err() is returned instead of a partial result.
+//
+// Bounding boxes are fetched concurrently by the configured number of workers.
+// Responses are merged in bbox order once all have been fetched, so the first
+// configured bbox that returned an alert is still its source.
+func (c *Client) GetAlertsMultipleBBoxesContext(ctx context.Context, bboxes []string) ([]models.WazeAlert, error) {
+	results, errs := c.fetchBBoxes(ctx, bboxes)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	uniqueAlerts := make(map[string]models.WazeAlert)
 	successfulCalls := 0
+	duplicates := 0
+	untracked := 0
 
 	for i, bbox := range bboxes {
-		log.Printf("Fetching alerts for bbox %d/%d: %s", i+1, len(bboxes), bbox)
-
-		result, err := c.GetAlerts(bbox)
-		if err != nil {
-			log.Printf("API call %d failed for bbox: %s, error: %v", i+1, bbox, err)
+		result := results[i]
+		if result == nil {
 			continue
 		}
-
 		successfulCalls++
-		log.Printf("API call %d successful, found %d alerts", i+1, len(result.Alerts))
 
-		// Add alerts to collection, deduplicating by UUID
+		// Add alerts to collection, deduplicating by UUID. The first bbox to
+		// return an alert is recorded as its source.
 		for _, alert := range result.Alerts {
+			if c.trackedTypes != nil && !c.trackedTypes[alert.Type] {
+				untracked++
+				continue
+			}
 			if alert.UUID != "" {
-				if _, exists := uniqueAlerts[alert.UUID]; !exists {
+				existing, exists := uniqueAlerts[alert.UUID]
+				if !exists {
+					alert.SourceBBox = bbox
 					uniqueAlerts[alert.UUID] = alert
 				} else {
-					log.Printf("Duplicate alert found across bboxes: %s", alert.UUID)
+					duplicates++
+					if c.logDuplicates {
+						logging.Infof("Duplicate alert found across bboxes: %s", alert.UUID)
+					}
+					uniqueAlerts[alert.UUID] = c.resolveConflict(existing, alert)
 				}
 			}
 		}
 	}
 
+	if duplicates > 0 {
+		logging.Debugf("%d duplicates skipped across bboxes", duplicates)
+	}
+	if untracked > 0 {
+		logging.Debugf("%d alerts of untracked types dropped", untracked)
+	}
+
 	if successfulCalls == 0 {
+		// Every bbox failed; the first error shows why, e.g. an ErrForbidden block
+		for _, err := range errs {
+			if err != nil {
+				return nil, fmt.Errorf("no successful API calls from %d attempts, first error: %w", len(bboxes), err)
+			}
+		}
 		return nil, fmt.Errorf("no successful API calls from %d attempts", len(bboxes))
 	}
 
+	if ratio := float64(successfulCalls) / float64(len(bboxes)); ratio < c.minSuccessRatio {
+		return nil, fmt.Errorf("%w: %d/%d bounding boxes succeeded (%.0f%%), minimum is %.0f%%",
+			ErrInsufficientCoverage, successfulCalls, len(bboxes), ratio*100, c.minSuccessRatio*100)
+	}
+
 	// Convert map to slice
 	allAlerts := make([]models.WazeAlert, 0, len(uniqueAlerts))
 	for _, alert := range uniqueAlerts {
 		allAlerts = append(allAlerts, alert)
 	}
 
+	c.statsMu.Lock()
 	c.stats.UniqueAlerts = len(allAlerts)
+	totalAlerts := c.stats.TotalAlerts
+	c.statsMu.Unlock()
 
-	log.Printf("Combined results: %d successful calls, %d total alerts, %d unique alerts",
-		successfulCalls, c.stats.TotalAlerts, len(allAlerts))
+	logging.Infof("Combined results: %d successful calls, %d total alerts, %d unique alerts",
+		successfulCalls, totalAlerts, len(allAlerts))
 
 	return allAlerts, nil
 }
 
-// GetStats returns scraping statistics
+// fetchBBoxes fetches every bbox with up to c.workers requests at once. The
+// result for bboxes[i] is at index i, nil if its request failed, with the
+// failure at the same index of the returned errors. Bboxes not yet started
+// when ctx is done are skipped.
+func (c *Client) fetchBBoxes(ctx context.Context, bboxes []string) ([]*models.WazeAPIResponse, []error) {
+	results := make([]*models.WazeAPIResponse, len(bboxes))
+	errs := make([]error, len(bboxes))
+	workers := min(max(c.workers, 1), len(bboxes))
+
+	jobs := make(chan int, len(bboxes))
+	for i := range bboxes {
+		jobs <- i
+	}
+	close(jobs)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() != nil {
+					return
+				}
+				bbox := bboxes[i]
+				logging.Debugf("Fetching alerts for bbox %d/%d: %s", i+1, len(bboxes), bbox)
+
+				result, err := c.GetAlertsContext(ctx, bbox)
+				if err != nil {
+					errs[i] = err
+					if errors.Is(err, ErrForbidden) {
+						logging.Errorf("API call %d for bbox %s was refused with 403 Forbidden, Waze may be blocking the scraper: %v", i+1, bbox, err)
+					} else if ctx.Err() == nil {
+						logging.Warnf("API call %d failed for bbox: %s, error: %v", i+1, bbox, err)
+					}
+					continue
+				}
+				logging.Debugf("API call %d successful, found %d alerts", i+1, len(result.Alerts))
+				results[i] = c.subdivide(ctx, bbox, result, 0)
+			}
+		}()
+	}
+	wg.Wait()
+	return results, errs
+}
+
+// subdivide returns result with the alerts of bbox's quadrants added when it
+// holds at least the subdivision threshold, splitting quadrants that are also
+// at the threshold until the maximum depth. Alerts found more than once within
+// bbox are kept once. A quadrant that fails only loses its own extra alerts.
+func (c *Client) subdivide(ctx context.Context, bbox string, result *models.WazeAPIResponse, depth int) *models.WazeAPIResponse {
+	if c.subdivideThreshold < 1 || len(result.Alerts) < c.subdivideThreshold || depth >= c.subdivideDepth {
+		return result
+	}
+	quadrants, err := splitBBox(bbox)
+	if err != nil {
+		logging.Warnf("Cannot subdivide bbox %s: %v", bbox, err)
+		return result
+	}
+	logging.Infof("Bbox %s returned %d alerts (threshold %d), subdividing into quadrants", bbox, len(result.Alerts), c.subdivideThreshold)
+	c.updateStats(func(stats *models.ScrapingStats) { stats.SubdividedBoxes++ })
+
+	merged := &models.WazeAPIResponse{Alerts: result.Alerts}
+	seen := make(map[string]bool, len(result.Alerts))
+	for _, alert := range result.Alerts {
+		seen[alert.UUID] = true
+	}
+	for _, quadrant := range quadrants {
+		if ctx.Err() != nil {
+			break
+		}
+		quadrantResult, err := c.GetAlertsContext(ctx, quadrant)
+		if err != nil {
+			if ctx.Err() == nil {
+				logging.Warnf("API call failed for quadrant %s of bbox %s, error: %v", quadrant, bbox, err)
+			}
+			continue
+		}
+		quadrantResult = c.subdivide(ctx, quadrant, quadrantResult, depth+1)
+		for _, alert := range quadrantResult.Alerts {
+			if alert.UUID != "" && seen[alert.UUID] {
+				continue
+			}
+			seen[alert.UUID] = true
+			merged.Alerts = append(merged.Alerts, alert)
+		}
+	}
+	return merged
+}
+
+// splitBBox splits a valid "west,south,east,north" bbox into its four
+// quadrants, in the same format
+func splitBBox(bbox string) ([]string, error) {
+	if err := ValidateBBox(bbox); err != nil {
+		return nil, err
+	}
+	var coords [4]float64
+	for i, part := range strings.Split(bbox, ",") {
+		coords[i], _ = strconv.ParseFloat(part, 64)
+	}
+	west, south, east, north := coords[0], coords[1], coords[2], coords[3]
+	midLng, midLat := (west+east)/2, (south+north)/2
+
+	format := func(w, s, e, n float64) string {
+		return strings.Join([]string{
+			strconv.FormatFloat(w, 'f', -1, 64),
+			strconv.FormatFloat(s, 'f', -1, 64),
+			strconv.FormatFloat(e, 'f', -1, 64),
+			strconv.FormatFloat(n, 'f', -1, 64),
+		}, ",")
+	}
+	return []string{
+		format(west, south, midLng, midLat),
+		format(midLng, south, east, midLat),
+		format(west, midLat, midLng, north),
+		format(midLng, midLat, east, north),
+	}, nil
+}
+
+// resolveConflict chooses between the kept copy of an alert and a later
+// duplicate, logging any disagreement in their core fields
+func (c *Client) resolveConflict(kept, duplicate models.WazeAlert) models.WazeAlert {
+	diffs := coreFieldDiffs(kept, duplicate)
+	if len(diffs) == 0 {
+		return kept
+	}
+
+	if c.conflictPolicy == ConflictPreferComplete && completeness(duplicate) > completeness(kept) {
+		logging.Infof("Conflicting copies of alert %s: %s (kept later copy)", kept.UUID, strings.Join(diffs, ", "))
+		// Provenance stays with the first bbox that returned the alert
+		duplicate.SourceBBox = kept.SourceBBox
+		return duplicate
+	}
+
+	logging.Infof("Conflicting copies of alert %s: %s (kept first copy)", kept.UUID, strings.Join(diffs, ", "))
+	return kept
+}
+
+// coreFieldDiffs describes the core fields that differ between two copies of an alert
+func coreFieldDiffs(a, b models.WazeAlert) []string {
+	var diffs []string
+	if a.Street != b.Street {
+		diffs = append(diffs, fmt.Sprintf("street %q vs %q", a.Street, b.Street))
+	}
+	if a.City != b.City {
+		diffs = append(diffs, fmt.Sprintf("city %q vs %q", a.City, b.City))
+	}
+	if a.Country != b.Country {
+		diffs = append(diffs, fmt.Sprintf("country %q vs %q", a.Country, b.Country))
+	}
+	if a.Subtype != b.Subtype {
+		diffs = append(diffs, fmt.Sprintf("subtype %q vs %q", a.Subtype, b.Subtype))
+	}
+	return diffs
+}
+
+// completeness counts how many of an alert's street and city are set
+func completeness(alert models.WazeAlert) int {
+	n := 0
+	if alert.Street != "" {
+		n++
+	}
+	if alert.City != "" {
+		n++
+	}
+	return n
+}
+
+// GetStats returns a copy of the scraping statistics taken under statsMu, so it
+// is safe to read while fetches are in flight
 func (c *Client) GetStats() *models.ScrapingStats {
-	return c.stats
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	stats := *c.stats
+	return &stats
 }
 
 func min(a, b int) int {
@@ -1,12 +1,23 @@
 package waze
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/logging"
 	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
 )
 
@@ -40,6 +51,12 @@ func TestGetStats(t *testing.T) {
 	if stats.FailedCalls != 0 {
 		t.Errorf("Expected FailedCalls 0, got %d", stats.FailedCalls)
 	}
+
+	// The returned stats are a copy, not the client's live counters
+	stats.TotalRequests = 99
+	if got := client.GetStats().TotalRequests; got != 0 {
+		t.Errorf("Expected modifying the returned stats to leave the client's at 0, got %d", got)
+	}
 }
 
 func TestGetAlertsInvalidBBox(t *testing.T) {
@@ -143,25 +160,70 @@ func TestBBoxParsing(t *testing.T) {
 		},
 		{
 			name:        "negative coordinates",
-			bbox:        "-150.38,-34.25,-151.00,-33.93",
+			bbox:        "-151.00,-34.25,-150.38,-33.93",
 			expectError: false,
 		},
+		{
+			name:        "non-numeric",
+			bbox:        "abc,def,ghi,jkl",
+			expectError: true,
+			errorMsg:    `invalid bounding box: west "abc" is not a number`,
+		},
+		{
+			name:        "west past east",
+			bbox:        "-150.38,-34.25,-151.00,-33.93",
+			expectError: true,
+			errorMsg:    "invalid bounding box: west must be less than east",
+		},
+		{
+			name:        "south past north",
+			bbox:        "150.38,-33.93,151.00,-34.25",
+			expectError: true,
+			errorMsg:    "invalid bounding box: south must be less than north",
+		},
+		{
+			name:        "zero width",
+			bbox:        "150.38,-34.25,150.38,-33.93",
+			expectError: true,
+			errorMsg:    "west must be less than east",
+		},
+		{
+			name:        "longitude out of range",
+			bbox:        "150.38,-34.25,181,-33.93",
+			expectError: true,
+			errorMsg:    "invalid bounding box: east 181 is outside [-180, 180]",
+		},
+		{
+			name:        "latitude out of range",
+			bbox:        "150.38,-91,151.00,-33.93",
+			expectError: true,
+			errorMsg:    "invalid bounding box: south -91 is outside [-90, 90]",
+		},
+		{
+			name:        "NaN",
+			bbox:        "150.38,NaN,151.00,-33.93",
+			expectError: true,
+			errorMsg:    "invalid bounding box: south NaN is outside [-90, 90]",
+		},
 	}
 
+	server := createMockWazeServer(models.WazeGeoRSSResponse{}, http.StatusOK)
+	defer server.Close()
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			client := NewClient()
+			client := NewClient(WithBaseURL(server.URL))
 			_, err := client.GetAlerts(tt.bbox)
 
 			if tt.expectError {
-				if err == nil {
-					t.Errorf("expected error for bbox %q, got nil", tt.bbox)
+				if !errors.Is(err, ErrInvalidBBox) {
+					t.Errorf("expected ErrInvalidBBox for bbox %q, got %v", tt.bbox, err)
 				} else if tt.errorMsg != "" && !strings.Contains(err.Error(), tt.errorMsg) {
 					t.Errorf("expected error containing %q, got %q", tt.errorMsg, err.Error())
 				}
+			} else if err != nil {
+				t.Errorf("unexpected error for bbox %q: %v", tt.bbox, err)
 			}
-			// Note: valid bbox tests will fail because they hit the real Waze API
-			// These are tested with mock servers below
 		})
 	}
 }
@@ -283,36 +345,42 @@ func TestGetAlertsWithMockServer(t *testing.T) {
 			server := createMockWazeServer(tt.response, tt.statusCode)
 			defer server.Close()
 
-			// Create a client and override its HTTP call by creating a custom handler
-			client := NewClient()
+			client := NewClient(WithBaseURL(server.URL))
+			resp, err := client.GetAlerts("149.0,-35.5,151.5,-33.5")
 
-			// Make a test request to our mock server instead
-			resp, err := client.httpClient.Get(server.URL)
-			if err != nil {
-				if !tt.expectError {
-					t.Fatalf("unexpected error: %v", err)
+			stats := client.GetStats()
+			if stats.TotalRequests != 1 {
+				t.Errorf("expected 1 request, got %d", stats.TotalRequests)
+			}
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				if !strings.Contains(err.Error(), strconv.Itoa(tt.statusCode)) {
+					t.Errorf("expected error to mention status %d, got %v", tt.statusCode, err)
+				}
+				if stats.FailedCalls != 1 || stats.SuccessfulCalls != 0 {
+					t.Errorf("expected 1 failed and 0 successful calls, got %d and %d", stats.FailedCalls, stats.SuccessfulCalls)
 				}
 				return
 			}
-			defer resp.Body.Close()
-
-			if resp.StatusCode != tt.statusCode {
-				t.Errorf("expected status %d, got %d", tt.statusCode, resp.StatusCode)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
 			}
-
-			if tt.expectError && resp.StatusCode == http.StatusOK {
-				t.Error("expected error status code")
+			if len(resp.Alerts) != tt.expectedAlerts {
+				t.Errorf("expected %d alerts, got %d", tt.expectedAlerts, len(resp.Alerts))
 			}
-
-			if !tt.expectError && resp.StatusCode == http.StatusOK {
-				var apiResponse models.WazeGeoRSSResponse
-				if err := json.NewDecoder(resp.Body).Decode(&apiResponse); err != nil {
-					t.Fatalf("failed to decode response: %v", err)
-				}
-				if len(apiResponse.Alerts) != tt.expectedAlerts {
-					t.Errorf("expected %d alerts, got %d", tt.expectedAlerts, len(apiResponse.Alerts))
+			for i, alert := range resp.Alerts {
+				if alert.UUID != tt.response.Alerts[i].UUID || alert.Street != tt.response.Alerts[i].Street {
+					t.Errorf("alert %d: expected %s on %q, got %s on %q", i, tt.response.Alerts[i].UUID, tt.response.Alerts[i].Street, alert.UUID, alert.Street)
 				}
 			}
+			if stats.SuccessfulCalls != 1 || stats.FailedCalls != 0 {
+				t.Errorf("expected 1 successful and 0 failed calls, got %d and %d", stats.SuccessfulCalls, stats.FailedCalls)
+			}
+			if stats.TotalAlerts != tt.expectedAlerts {
+				t.Errorf("expected TotalAlerts %d, got %d", tt.expectedAlerts, stats.TotalAlerts)
+			}
 		})
 	}
 }
@@ -466,17 +534,17 @@ func TestInvalidJSONResponse(t *testing.T) {
 	}))
 	defer server.Close()
 
-	client := NewClient()
-	resp, err := client.httpClient.Get(server.URL)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	client := NewClient(WithBaseURL(server.URL))
+	_, err := client.GetAlerts("1,2,3,4")
+	if !errors.Is(err, ErrUnexpectedResponse) {
+		t.Errorf("expected ErrUnexpectedResponse for invalid JSON, got %v", err)
 	}
-	defer resp.Body.Close()
-
-	var apiResponse models.WazeGeoRSSResponse
-	err = json.NewDecoder(resp.Body).Decode(&apiResponse)
-	if err == nil {
-		t.Error("expected JSON decode error for invalid JSON")
+	stats := client.GetStats()
+	if stats.TotalAlerts != 0 {
+		t.Errorf("expected no alerts counted, got %d", stats.TotalAlerts)
+	}
+	if stats.SuccessfulCalls != 0 || stats.FailedCalls != 1 {
+		t.Errorf("expected an unparseable 200 to count as 1 failed call, got %d successful and %d failed", stats.SuccessfulCalls, stats.FailedCalls)
 	}
 }
 
@@ -534,3 +602,931 @@ func TestAlertFieldsPreservation(t *testing.T) {
 		t.Errorf("NThumbsUp mismatch: expected %d, got %d", originalAlert.NThumbsUp, deserializedAlert.NThumbsUp)
 	}
 }
+
+// TestResponseHookReceivesRawBody tests that the response hook sees the unparsed body
+func TestResponseHookReceivesRawBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"alerts":[{"uuid":"a1","type":"POLICE","newField":true}]}`))
+	}))
+	defer server.Close()
+
+	var gotBBox string
+	var gotBody []byte
+	client := NewClient(WithResponseHook(func(bbox string, body []byte) {
+		gotBBox = bbox
+		gotBody = body
+	}), WithBaseURL(server.URL))
+
+	resp, err := client.GetAlerts("1,2,3,4")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Alerts) != 1 {
+		t.Errorf("expected 1 alert, got %d", len(resp.Alerts))
+	}
+	if gotBBox != "1,2,3,4" {
+		t.Errorf("expected bbox 1,2,3,4, got %q", gotBBox)
+	}
+	if !strings.Contains(string(gotBody), "newField") {
+		t.Errorf("expected raw body to be passed to hook, got %s", gotBody)
+	}
+}
+
+// TestGetAlertsMultipleBBoxesMinSuccessRatio tests the coverage gate against partial bbox failures
+func TestGetAlertsMultipleBBoxesMinSuccessRatio(t *testing.T) {
+	bboxes := []string{"0,0,1,1", "1,0,2,1", "2,0,3,1", "3,0,4,1"}
+
+	tests := []struct {
+		name      string
+		succeed   int
+		minRatio  float64
+		wantError bool
+	}{
+		{"1/4 with no threshold", 1, 0, false},
+		{"1/4 below half", 1, 0.5, true},
+		{"2/4 meets half", 2, 0.5, false},
+		{"2/4 below three quarters", 2, 0.75, true},
+		{"4/4 meets full coverage", 4, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// The "left" query parameter is the bbox index; fail those past the success count
+				left, _ := strconv.Atoi(r.URL.Query().Get("left"))
+				if left >= tt.succeed {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				_, _ = fmt.Fprintf(w, `{"alerts":[{"uuid":"a%d","type":"POLICE"}]}`, left)
+			}))
+			defer server.Close()
+
+			client := NewClient(WithMinSuccessRatio(tt.minRatio), WithBaseURL(server.URL))
+
+			alerts, err := client.GetAlertsMultipleBBoxes(bboxes)
+			if tt.wantError {
+				if !errors.Is(err, ErrInsufficientCoverage) {
+					t.Fatalf("expected ErrInsufficientCoverage, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(alerts) != tt.succeed {
+				t.Errorf("expected %d alerts, got %d", tt.succeed, len(alerts))
+			}
+		})
+	}
+}
+
+// TestGetAlertsResponseShapes tests that empty alert lists are accepted but non-georss bodies are rejected
+func TestGetAlertsResponseShapes(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantErr     bool
+		wantAlerts  int
+	}{
+		{"alerts present", "application/json", `{"alerts":[{"uuid":"a1","type":"POLICE"}]}`, false, 1},
+		{"empty alerts", "application/json", `{"alerts":[]}`, false, 0},
+		{"null alerts", "application/json", `{"alerts":null}`, false, 0},
+		{"missing alerts key", "application/json", `{"startTimeMillis":1,"endTimeMillis":2}`, false, 0},
+		{"HTML content type", "text/html; charset=utf-8", `<html><body>Access denied</body></html>`, true, 0},
+		{"HTML body without content type", "", `<!DOCTYPE html><html></html>`, true, 0},
+		{"JSON array", "application/json", `[]`, true, 0},
+		{"JSON null", "application/json", `null`, true, 0},
+		{"alerts wrong type", "application/json", `{"alerts":"none"}`, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := NewClient(WithBaseURL(server.URL))
+
+			resp, err := client.GetAlerts("1,2,3,4")
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnexpectedResponse) {
+					t.Fatalf("expected ErrUnexpectedResponse, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(resp.Alerts) != tt.wantAlerts {
+				t.Errorf("expected %d alerts, got %d", tt.wantAlerts, len(resp.Alerts))
+			}
+		})
+	}
+}
+
+// TestGetAlertsMultipleBBoxesSourceBBox tests that each alert records the first bbox that returned it
+func TestGetAlertsMultipleBBoxesSourceBBox(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("left") {
+		case "0":
+			_, _ = w.Write([]byte(`{"alerts":[{"uuid":"only-first","type":"POLICE"},{"uuid":"shared","type":"POLICE"}]}`))
+		case "1":
+			_, _ = w.Write([]byte(`{"alerts":[{"uuid":"shared","type":"POLICE"},{"uuid":"only-second","type":"POLICE"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(WithBaseURL(server.URL))
+
+	alerts, err := client.GetAlertsMultipleBBoxes([]string{"0,0,1,1", "1,0,2,1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"only-first":  "0,0,1,1",
+		"shared":      "0,0,1,1",
+		"only-second": "1,0,2,1",
+	}
+	if len(alerts) != len(expected) {
+		t.Fatalf("expected %d alerts, got %d", len(expected), len(alerts))
+	}
+	for _, alert := range alerts {
+		if alert.SourceBBox != expected[alert.UUID] {
+			t.Errorf("%s: expected source bbox %q, got %q", alert.UUID, expected[alert.UUID], alert.SourceBBox)
+		}
+	}
+}
+
+// TestGetAlertsMultipleBBoxesConflictPolicy tests how conflicting duplicate copies are resolved and logged
+func TestGetAlertsMultipleBBoxesConflictPolicy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("left") {
+		case "0":
+			_, _ = w.Write([]byte(`{"alerts":[{"uuid":"conflict","type":"POLICE","city":"Canberra"},{"uuid":"same","type":"POLICE","street":"Main St"}]}`))
+		case "1":
+			_, _ = w.Write([]byte(`{"alerts":[{"uuid":"conflict","type":"POLICE","street":"Hume Hwy","city":"Canberra"},{"uuid":"same","type":"POLICE","street":"Main St"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		policy     string
+		wantStreet string
+		wantLog    string
+	}{
+		{"default keeps first", "", "", "kept first copy"},
+		{"keep first", ConflictKeepFirst, "", "kept first copy"},
+		{"prefer complete", ConflictPreferComplete, "Hume Hwy", "kept later copy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			client := NewClient(WithConflictPolicy(tt.policy), WithBaseURL(server.URL))
+
+			alerts, err := client.GetAlertsMultipleBBoxes([]string{"0,0,1,1", "1,0,2,1"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, alert := range alerts {
+				if alert.UUID != "conflict" {
+					continue
+				}
+				if alert.Street != tt.wantStreet {
+					t.Errorf("expected street %q, got %q", tt.wantStreet, alert.Street)
+				}
+				if alert.SourceBBox != "0,0,1,1" {
+					t.Errorf("expected source bbox to stay with the first bbox, got %q", alert.SourceBBox)
+				}
+			}
+
+			output := logs.String()
+			if !strings.Contains(output, `Conflicting copies of alert conflict: street "" vs "Hume Hwy"`) || !strings.Contains(output, tt.wantLog) {
+				t.Errorf("expected conflict to be logged with %q, got:\n%s", tt.wantLog, output)
+			}
+			if strings.Contains(output, "Conflicting copies of alert same") {
+				t.Error("expected identical duplicates not to be logged as conflicts")
+			}
+		})
+	}
+}
+
+// TestGetAlertsMultipleBBoxesDuplicateLogging tests that duplicates are logged as one count per call by default
+// (both at debug level)
+func TestGetAlertsMultipleBBoxesDuplicateLogging(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every bbox returns a and b; only the first also returns its own alert
+		switch r.URL.Query().Get("left") {
+		case "0":
+			_, _ = w.Write([]byte(`{"alerts":[{"uuid":"a","type":"POLICE"},{"uuid":"b","type":"POLICE"},{"uuid":"only-0","type":"POLICE"}]}`))
+		default:
+			_, _ = w.Write([]byte(`{"alerts":[{"uuid":"a","type":"POLICE"},{"uuid":"b","type":"POLICE"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		opts        []Option
+		wantPerLine bool
+	}{
+		{"default aggregates", nil, false},
+		{"per-alert logging", []Option{WithDuplicateLogging(true)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			logging.SetLevel(logging.LevelDebug)
+			defer logging.SetLevel(logging.LevelInfo)
+
+			client := NewClient(append(tt.opts, WithBaseURL(server.URL))...)
+
+			alerts, err := client.GetAlertsMultipleBBoxes([]string{"0,0,1,1", "1,0,2,1", "2,0,3,1"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(alerts) != 3 {
+				t.Errorf("expected 3 unique alerts, got %d", len(alerts))
+			}
+
+			output := logs.String()
+			if !strings.Contains(output, "4 duplicates skipped across bboxes") {
+				t.Errorf("expected aggregate count of 4 duplicates, got:\n%s", output)
+			}
+			perLine := strings.Count(output, "Duplicate alert found across bboxes")
+			if tt.wantPerLine && perLine != 4 {
+				t.Errorf("expected 4 per-duplicate lines, got %d", perLine)
+			}
+			if !tt.wantPerLine && perLine != 0 {
+				t.Errorf("expected no per-duplicate lines at default verbosity, got %d", perLine)
+			}
+		})
+	}
+}
+
+func TestGetAlertsMultipleBBoxesTrackedTypes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every bbox returns the same police alert and jam
+		_, _ = w.Write([]byte(`{"alerts":[{"uuid":"police-1","type":"POLICE"},{"uuid":"jam-1","type":"JAM"},{"uuid":"crash-` +
+			r.URL.Query().Get("left") + `","type":"ACCIDENT"}]}`))
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	logging.SetLevel(logging.LevelDebug)
+	defer logging.SetLevel(logging.LevelInfo)
+
+	client := NewClient(WithTrackedTypes([]string{"POLICE"}), WithDuplicateLogging(true), WithBaseURL(server.URL))
+
+	alerts, err := client.GetAlertsMultipleBBoxes([]string{"0,0,1,1", "1,0,2,1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].UUID != "police-1" {
+		t.Errorf("expected only the police alert, got %+v", alerts)
+	}
+	if client.GetStats().TotalAlerts != 6 {
+		t.Errorf("expected every fetched alert to be counted, got %d", client.GetStats().TotalAlerts)
+	}
+
+	// Untracked alerts are dropped before deduplication, so the jam returned by
+	// both bboxes is never seen as a duplicate
+	output := logs.String()
+	if strings.Contains(output, "Duplicate alert found across bboxes: jam-1") {
+		t.Errorf("expected the untracked jam to be dropped before deduplication, got:\n%s", output)
+	}
+	if !strings.Contains(output, "Duplicate alert found across bboxes: police-1") {
+		t.Errorf("expected the tracked duplicate to be deduplicated, got:\n%s", output)
+	}
+	if !strings.Contains(output, "4 alerts of untracked types dropped") {
+		t.Errorf("expected a count of dropped alerts, got:\n%s", output)
+	}
+
+	// GetAlerts is unfiltered, for debugging and previews
+	response, err := client.GetAlerts("0,0,1,1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(response.Alerts) != 3 {
+		t.Errorf("expected GetAlerts to return every type, got %d alerts", len(response.Alerts))
+	}
+}
+
+func TestWithTrackedTypes(t *testing.T) {
+	c := NewClient(WithTrackedTypes([]string{"POLICE", "HAZARD"}))
+	if len(c.trackedTypes) != 2 || !c.trackedTypes["POLICE"] || !c.trackedTypes["HAZARD"] {
+		t.Errorf("unexpected tracked types: %v", c.trackedTypes)
+	}
+
+	WithTrackedTypes(nil)(c)
+	if c.trackedTypes != nil {
+		t.Errorf("expected an empty list to keep all types, got %v", c.trackedTypes)
+	}
+}
+
+func TestNormalizePubMillis(t *testing.T) {
+	const millis = int64(1704067200000) // 2024-01-01T00:00:00Z
+	const seconds = millis / 1000
+
+	tests := []struct {
+		name      string
+		pubMillis int64
+		unit      string
+		expected  int64
+	}{
+		{"auto keeps milliseconds", millis, "", millis},
+		{"auto converts seconds", seconds, PubTimeAuto, millis},
+		{"auto keeps zero", 0, PubTimeAuto, 0},
+		{"millis is never converted", seconds, PubTimeMillis, seconds},
+		{"seconds is always converted", seconds, PubTimeSeconds, millis},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizePubMillis(tt.pubMillis, tt.unit); got != tt.expected {
+				t.Errorf("normalizePubMillis(%d, %q) = %d, want %d", tt.pubMillis, tt.unit, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetAlertsNormalizesPubMillis(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"alerts":[` +
+			`{"uuid":"millis-1","type":"POLICE","pubMillis":1704067200000},` +
+			`{"uuid":"seconds-1","type":"POLICE","pubMillis":1704067200}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(WithBaseURL(server.URL))
+
+	response, err := client.GetAlerts("0,0,1,1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, alert := range response.Alerts {
+		// Storage derives publish_time with time.UnixMilli
+		if publishTime := time.UnixMilli(alert.PubMillis).UTC(); !publishTime.Equal(expected) {
+			t.Errorf("%s: expected publish time %s, got %s", alert.UUID, expected, publishTime)
+		}
+	}
+}
+
+func TestGetAlertsRawAlerts(t *testing.T) {
+	// Field order, spacing and an unmodeled field that re-encoding would lose
+	rawAlerts := []string{
+		`{"type":"POLICE", "uuid":"raw-1","pubMillis":1704067200,"unmodeled":{"x":[1,2]}}`,
+		`{"uuid":"raw-2","type":"POLICE","pubMillis":1704067200000,"street":"Café St"}`,
+	}
+	body := `{"alerts":[` + rawAlerts[0] + ",\n  " + rawAlerts[1] + `],"startTime":"x"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	for _, enabled := range []bool{false, true} {
+		client := NewClient(WithRawAlerts(enabled), WithBaseURL(server.URL))
+
+		response, err := client.GetAlerts("0,0,1,1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(response.Alerts) != len(rawAlerts) {
+			t.Fatalf("expected %d alerts, got %d", len(rawAlerts), len(response.Alerts))
+		}
+		for i, alert := range response.Alerts {
+			if !enabled {
+				if alert.Raw != nil {
+					t.Errorf("%s: expected no raw bytes when disabled, got %s", alert.UUID, alert.Raw)
+				}
+				continue
+			}
+			if string(alert.Raw) != rawAlerts[i] {
+				t.Errorf("%s: expected raw bytes %s, got %s", alert.UUID, rawAlerts[i], alert.Raw)
+			}
+		}
+		// pubMillis is still normalized on the parsed alert
+		if response.Alerts[0].PubMillis != 1704067200000 {
+			t.Errorf("expected normalized pubMillis, got %d", response.Alerts[0].PubMillis)
+		}
+	}
+}
+
+// TestGetAlertsRetry tests that transient statuses are retried with backoff and
+// other errors fail on the first attempt
+func TestGetAlertsRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int // statuses returned before a 200
+		maxAttempts  int
+		wantErr      bool
+		wantRequests int
+		wantRetried  int
+	}{
+		{"no retries configured", []int{503}, 0, true, 1, 0},
+		{"recovers after 429 and 500", []int{429, 500}, 3, false, 3, 2},
+		{"recovers after 502 and 503", []int{502, 503}, 4, false, 3, 2},
+		{"gives up after max attempts", []int{503, 503, 503, 503}, 3, true, 3, 2},
+		{"403 fails immediately", []int{403}, 3, true, 1, 0},
+		{"404 fails immediately", []int{404}, 3, true, 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests <= len(tt.statuses) {
+					w.WriteHeader(tt.statuses[requests-1])
+					return
+				}
+				_, _ = w.Write([]byte(`{"alerts":[{"uuid":"a1","type":"POLICE"}]}`))
+			}))
+			defer server.Close()
+
+			client := NewClient(WithRetryPolicy(RetryPolicy{MaxAttempts: tt.maxAttempts, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}), WithBaseURL(server.URL))
+			var delays []time.Duration
+			client.sleep = func(ctx context.Context, d time.Duration) error {
+				delays = append(delays, d)
+				return nil
+			}
+
+			_, err := client.GetAlerts("1,2,3,4")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if requests != tt.wantRequests {
+				t.Errorf("expected %d requests, got %d", tt.wantRequests, requests)
+			}
+			stats := client.GetStats()
+			if stats.RetriedCalls != tt.wantRetried || len(delays) != tt.wantRetried {
+				t.Errorf("expected %d retries, got RetriedCalls=%d with %d sleeps", tt.wantRetried, stats.RetriedCalls, len(delays))
+			}
+			if stats.TotalRequests != 1 {
+				t.Errorf("expected one counted request per GetAlerts call, got %d", stats.TotalRequests)
+			}
+			if tt.wantErr && stats.FailedCalls != 1 {
+				t.Errorf("expected 1 failed call, got %d", stats.FailedCalls)
+			}
+		})
+	}
+}
+
+// TestRetryPolicyBackoff tests that delays double per retry, stay within the
+// jitter range and are capped at MaxDelay
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	wantMax := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+
+	for i, max := range wantMax {
+		for range 50 {
+			if got := policy.backoff(i + 1); got < max/2 || got > max {
+				t.Fatalf("retry %d: delay %v outside [%v, %v]", i+1, got, max/2, max)
+			}
+		}
+	}
+
+	uncapped := RetryPolicy{BaseDelay: time.Second}
+	if got := uncapped.backoff(5); got < 8*time.Second || got > 16*time.Second {
+		t.Errorf("expected an uncapped fifth delay within [8s, 16s], got %v", got)
+	}
+	if got := (RetryPolicy{}).backoff(3); got != 0 {
+		t.Errorf("expected no delay without a base delay, got %v", got)
+	}
+}
+
+// TestWithBaseURL tests that requests go to the configured endpoint with the
+// bounding box mapped to its query parameters, and that the default is Waze
+func TestWithBaseURL(t *testing.T) {
+	if got := NewClient().baseURL; got != DefaultBaseURL {
+		t.Errorf("expected default base URL %q, got %q", DefaultBaseURL, got)
+	}
+
+	var gotPath string
+	var gotQuery map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotQuery = map[string]string{}
+		for key := range r.URL.Query() {
+			gotQuery[key] = r.URL.Query().Get(key)
+		}
+		_, _ = w.Write([]byte(`{"alerts":[]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(WithBaseURL(server.URL + "/live-map/api/georss"))
+	if _, err := client.GetAlerts("149.0,-35.5,151.5,-33.5"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotPath != "/live-map/api/georss" {
+		t.Errorf("expected path /live-map/api/georss, got %q", gotPath)
+	}
+	want := map[string]string{"left": "149.0", "bottom": "-35.5", "right": "151.5", "top": "-33.5", "env": "row", "types": "alerts"}
+	for key, value := range want {
+		if gotQuery[key] != value {
+			t.Errorf("expected %s=%s, got %q", key, value, gotQuery[key])
+		}
+	}
+}
+
+// TestGetAlertsMultipleBBoxesEndToEnd tests fetching, parsing and deduplication
+// across bounding boxes through the real request path, with one box failing
+func TestGetAlertsMultipleBBoxesEndToEnd(t *testing.T) {
+	responses := map[string]string{
+		"0": `{"alerts":[{"uuid":"a1","type":"POLICE","street":"Hume Hwy"},{"uuid":"a2","type":"POLICE"}]}`,
+		"1": `{"alerts":[{"uuid":"a2","type":"POLICE"},{"uuid":"a3","type":"JAM"}]}`,
+		"2": `not json`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.Query().Get("left")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	client := NewClient(WithBaseURL(server.URL))
+	alerts, err := client.GetAlertsMultipleBBoxes([]string{"0,0,1,1", "1,0,2,1", "2,0,3,1", "3,0,4,1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sources := map[string]string{}
+	for _, alert := range alerts {
+		sources[alert.UUID] = alert.SourceBBox
+	}
+	want := map[string]string{"a1": "0,0,1,1", "a2": "0,0,1,1", "a3": "1,0,2,1"}
+	if len(sources) != len(want) {
+		t.Errorf("expected %d unique alerts, got %v", len(want), sources)
+	}
+	for uuid, bbox := range want {
+		if sources[uuid] != bbox {
+			t.Errorf("expected %s from bbox %s, got %q", uuid, bbox, sources[uuid])
+		}
+	}
+
+	stats := client.GetStats()
+	if stats.TotalRequests != 4 || stats.SuccessfulCalls != 2 || stats.FailedCalls != 2 {
+		t.Errorf("expected 4 requests, 2 successful and 2 failed, got %+v", *stats)
+	}
+	if stats.TotalAlerts != 4 || stats.UniqueAlerts != 3 {
+		t.Errorf("expected 4 total and 3 unique alerts, got %d and %d", stats.TotalAlerts, stats.UniqueAlerts)
+	}
+}
+
+// TestGetAlertsMultipleBBoxesContextCancel tests that cancelling mid-scrape
+// aborts the request in flight, skips the remaining bboxes and returns ctx.Err().
+// A single worker fetches the bboxes in order.
+func TestGetAlertsMultipleBBoxesContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var requests atomic.Int32
+	release := make(chan struct{})
+	defer close(release)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			_, _ = w.Write([]byte(`{"alerts":[{"uuid":"a1","type":"POLICE"}]}`))
+			return
+		}
+		// The second bbox hangs until the scrape is cancelled
+		cancel()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(WithBaseURL(server.URL), WithWorkers(1))
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.GetAlertsMultipleBBoxesContext(ctx, []string{"0,0,1,1", "1,0,2,1", "2,0,3,1"})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetAlertsMultipleBBoxesContext did not return after cancellation")
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("expected the third bbox to be skipped, got %d requests", got)
+	}
+}
+
+// TestGetAlertsMultipleBBoxesWorkers tests that bboxes are fetched concurrently
+// by at most the configured number of workers, with stats counted for each
+func TestGetAlertsMultipleBBoxesWorkers(t *testing.T) {
+	bboxes := []string{"0,0,1,1", "1,0,2,1", "2,0,3,1", "3,0,4,1", "4,0,5,1", "5,0,6,1"}
+
+	for _, workers := range []int{1, 2, 4} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			var inFlight, maxInFlight atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := inFlight.Add(1)
+				defer inFlight.Add(-1)
+				for {
+					m := maxInFlight.Load()
+					if n <= m || maxInFlight.CompareAndSwap(m, n) {
+						break
+					}
+				}
+				// Hold each request so concurrent ones overlap
+				time.Sleep(20 * time.Millisecond)
+				left := r.URL.Query().Get("left")
+				if left == "5" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				_, _ = fmt.Fprintf(w, `{"alerts":[{"uuid":"a%s","type":"POLICE"},{"uuid":"shared","type":"POLICE"}]}`, left)
+			}))
+			defer server.Close()
+
+			client := NewClient(WithBaseURL(server.URL), WithWorkers(workers))
+			alerts, err := client.GetAlertsMultipleBBoxes(bboxes)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := maxInFlight.Load(); got != int32(workers) {
+				t.Errorf("expected %d requests in flight at most, got %d", workers, got)
+			}
+			if len(alerts) != 6 {
+				t.Errorf("expected 6 unique alerts, got %d", len(alerts))
+			}
+			for _, alert := range alerts {
+				if alert.UUID == "shared" && alert.SourceBBox != bboxes[0] {
+					t.Errorf("expected shared alert from the first bbox, got %q", alert.SourceBBox)
+				}
+			}
+			stats := client.GetStats()
+			if stats.TotalRequests != 6 || stats.SuccessfulCalls != 5 || stats.FailedCalls != 1 || stats.TotalAlerts != 10 {
+				t.Errorf("expected 6 requests, 5 successful, 1 failed and 10 alerts, got %+v", *stats)
+			}
+		})
+	}
+}
+
+// TestGetAlertsHeaders tests that every request, including retries, carries the
+// default browser User-Agent or the configured User-Agent and headers
+func TestGetAlertsHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want map[string]string
+	}{
+		{"default", nil, map[string]string{"User-Agent": DefaultUserAgent}},
+		{"user agent", []Option{WithUserAgent("test-agent/1.0")}, map[string]string{"User-Agent": "test-agent/1.0"}},
+		{
+			"headers",
+			[]Option{WithUserAgent("test-agent/1.0"), WithHeaders(map[string]string{"accept-language": "en-AU", "Referer": "https://www.waze.com/live-map"})},
+			map[string]string{"User-Agent": "test-agent/1.0", "Accept-Language": "en-AU", "Referer": "https://www.waze.com/live-map"},
+		},
+		{
+			"headers override user agent",
+			[]Option{WithUserAgent("test-agent/1.0"), WithHeaders(map[string]string{"User-Agent": "header-agent/2.0"})},
+			map[string]string{"User-Agent": "header-agent/2.0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []http.Header
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests = append(requests, r.Header.Clone())
+				if len(requests) == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				_, _ = w.Write([]byte(`{"alerts":[]}`))
+			}))
+			defer server.Close()
+
+			opts := append([]Option{WithBaseURL(server.URL), WithRetryPolicy(RetryPolicy{MaxAttempts: 2})}, tt.opts...)
+			client := NewClient(opts...)
+			client.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+			if _, err := client.GetAlerts("1,2,3,4"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(requests) != 2 {
+				t.Fatalf("expected 2 requests, got %d", len(requests))
+			}
+			for i, header := range requests {
+				for name, value := range tt.want {
+					if got := header.Get(name); got != value {
+						t.Errorf("request %d: expected %s %q, got %q", i+1, name, value, got)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestGetAlertsForbidden tests that a 403 is returned as an HTTPError matching
+// ErrForbidden, with the start of the body, and that other statuses are not
+func TestGetAlertsForbidden(t *testing.T) {
+	status := http.StatusForbidden
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("  Access denied " + strings.Repeat("x", 1000)))
+	}))
+	defer server.Close()
+
+	client := NewClient(WithBaseURL(server.URL))
+	_, err := client.GetAlerts("1,2,3,4")
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected ErrForbidden, got %v", err)
+	}
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("expected an HTTPError, got %T", err)
+	}
+	if httpErr.StatusCode != http.StatusForbidden {
+		t.Errorf("expected status 403, got %d", httpErr.StatusCode)
+	}
+	if !strings.HasPrefix(httpErr.Body, "Access denied") || len(httpErr.Body) > maxErrorBody {
+		t.Errorf("expected the first %d bytes of the body, trimmed, got %d bytes: %q", maxErrorBody, len(httpErr.Body), httpErr.Body)
+	}
+
+	// Every bbox forbidden surfaces the cause from GetAlertsMultipleBBoxes
+	if _, err := client.GetAlertsMultipleBBoxes([]string{"1,2,3,4", "2,3,4,5"}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected ErrForbidden when every bbox is refused, got %v", err)
+	}
+
+	status = http.StatusNotFound
+	_, err = client.GetAlerts("1,2,3,4")
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected an HTTPError with status 404, got %v", err)
+	}
+	if errors.Is(err, ErrForbidden) {
+		t.Errorf("expected a 404 not to match ErrForbidden")
+	}
+}
+
+// TestGetAlertsMultipleBBoxesSubdivision tests that a bbox returning the
+// threshold number of alerts is re-fetched as quadrants, down to the depth limit
+func TestGetAlertsMultipleBBoxesSubdivision(t *testing.T) {
+	var mu sync.Mutex
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		bbox := strings.Join([]string{q.Get("left"), q.Get("bottom"), q.Get("right"), q.Get("top")}, ",")
+		mu.Lock()
+		requested = append(requested, bbox)
+		mu.Unlock()
+
+		// Every box returns 2 alerts, the threshold, one of them shared by
+		// all boxes; the south-east quadrant fails
+		if bbox == "2,0,4,2" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"alerts":[{"uuid":"shared","type":"POLICE"},{"uuid":"%s","type":"POLICE"}]}`, bbox)
+	}))
+	defer server.Close()
+
+	client := NewClient(WithBaseURL(server.URL), WithSubdivision(2, 2))
+	alerts, err := client.GetAlertsMultipleBBoxes([]string{"0,0,4,4"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 1 full box + 4 quadrants + 4 sub-quadrants of each of the 3 quadrants
+	// that succeeded; the depth limit stops the sub-quadrants being split
+	if len(requested) != 17 {
+		t.Errorf("expected 17 requests, got %d: %v", len(requested), requested)
+	}
+	for _, bbox := range requested {
+		if bbox == "0,0,0.5,0.5" {
+			t.Errorf("expected no split beyond depth 2, got request for %s", bbox)
+		}
+	}
+
+	want := map[string]bool{"shared": true, "0,0,4,4": true}
+	for _, quadrant := range []string{"0,0,2,2", "0,2,2,4", "2,2,4,4"} {
+		want[quadrant] = true
+		subs, err := splitBBox(quadrant)
+		if err != nil {
+			t.Fatalf("unexpected error splitting %s: %v", quadrant, err)
+		}
+		for _, sub := range subs {
+			want[sub] = true
+		}
+	}
+	if len(alerts) != len(want) {
+		t.Errorf("expected %d unique alerts, got %d", len(want), len(alerts))
+	}
+	for _, alert := range alerts {
+		if !want[alert.UUID] {
+			t.Errorf("unexpected alert %q", alert.UUID)
+		}
+		if alert.SourceBBox != "0,0,4,4" {
+			t.Errorf("expected alert %q attributed to the configured bbox, got %q", alert.UUID, alert.SourceBBox)
+		}
+	}
+
+	if got := client.GetStats().SubdividedBoxes; got != 4 {
+		t.Errorf("expected 4 subdivided boxes, got %d", got)
+	}
+}
+
+// TestGetAlertsMultipleBBoxesNoSubdivision tests that boxes are never split by default
+func TestGetAlertsMultipleBBoxesNoSubdivision(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte(`{"alerts":[{"uuid":"a","type":"POLICE"},{"uuid":"b","type":"POLICE"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(WithBaseURL(server.URL))
+	if _, err := client.GetAlertsMultipleBBoxes([]string{"0,0,4,4"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("expected 1 request, got %d", got)
+	}
+	if got := client.GetStats().SubdividedBoxes; got != 0 {
+		t.Errorf("expected no subdivided boxes, got %d", got)
+	}
+}
+
+// TestGetAlertsContextDeadline tests that a deadline aborts a hung request
+func TestGetAlertsContextDeadline(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	client := NewClient(WithBaseURL(server.URL))
+	if _, err := client.GetAlertsContext(ctx, "1,2,3,4"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if stats := client.GetStats(); stats.FailedCalls != 1 {
+		t.Errorf("expected 1 failed call, got %d", stats.FailedCalls)
+	}
+}
+
+// TestGetAlertsContextCancelDuringRetryWait tests that cancelling while waiting
+// to retry returns ctx.Err() without waiting out the backoff
+func TestGetAlertsContextCancelDuringRetryWait(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	client := NewClient(WithBaseURL(server.URL), WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute}))
+	start := time.Now()
+	if _, err := client.GetAlertsContext(ctx, "1,2,3,4"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the retry wait to end with the context, took %v", elapsed)
+	}
+}
@@ -1,7 +1,11 @@
 // Package waze provides a client for interacting with the Waze live traffic API.
 package waze
 
-import "github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+import (
+	"context"
+
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+)
 
 // AlertFetcher defines the interface for fetching alerts from Waze.
 // This interface enables dependency injection and mocking for testing.
@@ -13,7 +17,14 @@ type AlertFetcher interface {
 	// GetAlertsMultipleBBoxes fetches alerts from multiple bounding boxes and deduplicates.
 	GetAlertsMultipleBBoxes(bboxes []string) ([]models.WazeAlert, error)
 
-	// GetStats returns scraping statistics.
+	// GetAlertsContext is GetAlerts, returning ctx.Err() once ctx is done.
+	GetAlertsContext(ctx context.Context, bbox string) (*models.WazeAPIResponse, error)
+
+	// GetAlertsMultipleBBoxesContext is GetAlertsMultipleBBoxes, aborting the
+	// remaining bounding boxes and returning ctx.Err() once ctx is done.
+	GetAlertsMultipleBBoxesContext(ctx context.Context, bboxes []string) ([]models.WazeAlert, error)
+
+	// GetStats returns a snapshot of the scraping statistics.
 	GetStats() *models.ScrapingStats
 }
 
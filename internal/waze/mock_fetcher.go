@@ -1,7 +1,11 @@
 // Package waze provides a client for interacting with the Waze live traffic API.
 package waze
 
-import "github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+import (
+	"context"
+
+	"github.com/Lllllllleong/wazePoliceScraperGCP/internal/models"
+)
 
 // MockAlertFetcher is a mock implementation of AlertFetcher for testing.
 type MockAlertFetcher struct {
@@ -13,6 +17,14 @@ type MockAlertFetcher struct {
 	// If nil, returns empty slice with no error.
 	GetAlertsMultipleBBoxesFunc func(bboxes []string) ([]models.WazeAlert, error)
 
+	// GetAlertsContextFunc is called when GetAlertsContext is invoked.
+	// If nil, delegates to GetAlerts.
+	GetAlertsContextFunc func(ctx context.Context, bbox string) (*models.WazeAPIResponse, error)
+
+	// GetAlertsMultipleBBoxesContextFunc is called when GetAlertsMultipleBBoxesContext is invoked.
+	// If nil, delegates to GetAlertsMultipleBBoxes.
+	GetAlertsMultipleBBoxesContextFunc func(ctx context.Context, bboxes []string) ([]models.WazeAlert, error)
+
 	// GetStatsFunc is called when GetStats is invoked.
 	// If nil, returns default empty stats.
 	GetStatsFunc func() *models.ScrapingStats
@@ -34,6 +46,22 @@ func (m *MockAlertFetcher) GetAlertsMultipleBBoxes(bboxes []string) ([]models.Wa
 	return []models.WazeAlert{}, nil
 }
 
+// GetAlertsContext implements AlertFetcher.GetAlertsContext.
+func (m *MockAlertFetcher) GetAlertsContext(ctx context.Context, bbox string) (*models.WazeAPIResponse, error) {
+	if m.GetAlertsContextFunc != nil {
+		return m.GetAlertsContextFunc(ctx, bbox)
+	}
+	return m.GetAlerts(bbox)
+}
+
+// GetAlertsMultipleBBoxesContext implements AlertFetcher.GetAlertsMultipleBBoxesContext.
+func (m *MockAlertFetcher) GetAlertsMultipleBBoxesContext(ctx context.Context, bboxes []string) ([]models.WazeAlert, error) {
+	if m.GetAlertsMultipleBBoxesContextFunc != nil {
+		return m.GetAlertsMultipleBBoxesContextFunc(ctx, bboxes)
+	}
+	return m.GetAlertsMultipleBBoxes(bboxes)
+}
+
 // GetStats implements AlertFetcher.GetStats.
 func (m *MockAlertFetcher) GetStats() *models.ScrapingStats {
 	if m.GetStatsFunc != nil {